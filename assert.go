@@ -0,0 +1,350 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ResponseMismatchError lists where a response diverges from the schema of the handler.
+type ResponseMismatchError struct {
+	Mismatches []string
+}
+
+func (e *ResponseMismatchError) Error() string {
+	return "response does not match the schema: " + strings.Join(e.Mismatches, "; ")
+}
+
+/*
+WithResponseJSONSchema attaches a JSON Schema of the whole response body to the handler for CheckResponse,
+for contracts the reflected schema can't express, like the enum of a string or the fields of a custom marshaler.
+type, enum, const, properties, required, additionalProperties, items, prefixItems, anyOf and the min and max
+of numbers, lengths and items are checked, the other keywords are ignored.
+*/
+func WithResponseJSONSchema(schema json.RawMessage) Option {
+	return func(opts *handlerOptions) {
+		var s map[string]interface{}
+		if err := json.Unmarshal(schema, &s); err != nil {
+			opts.conflict("WithResponseJSONSchema schema is not a json object: %s", err)
+			return
+		}
+		opts.responseJSONSchema = s
+	}
+}
+
+/*
+CheckResponse checks that a response body of the handler matches its reflection derived schema,
+and the schema of WithResponseJSONSchema, to catch custom marshalers or hooks like Config.ShapeResults
+that respond something else than the declared contract. It reads the default JSON envelope only.
+*/
+func (h *Handler) CheckResponse(body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var resp interface{}
+	if err := dec.Decode(&resp); err != nil {
+		return &ResponseMismatchError{Mismatches: []string{"body is not json: " + err.Error()}}
+	}
+
+	c := &responseChecker{}
+	c.envelope(h.schema("").Results, h.callable != nil, resp)
+	if h.opts.responseJSONSchema != nil {
+		c.jsonSchema("", h.opts.responseJSONSchema, resp)
+	}
+	if len(c.mismatches) > 0 {
+		return &ResponseMismatchError{Mismatches: c.mismatches}
+	}
+	return nil
+}
+
+// TestingT is the part of testing.TB that AssertResponse uses.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+/*
+AssertResponse fails the test if the response body of the handler doesn't match its schema, see Handler.CheckResponse:
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	jsonhandlerfunc.AssertResponse(t, h, w.Body.Bytes())
+*/
+func AssertResponse(t TestingT, h *Handler, body []byte) bool {
+	t.Helper()
+	if err := h.CheckResponse(body); err != nil {
+		t.Errorf("%s\nbody: %s", err, bytes.TrimSpace(body))
+		return false
+	}
+	return true
+}
+
+type responseChecker struct {
+	mismatches []string
+}
+
+func (c *responseChecker) mismatch(path string, format string, args ...interface{}) {
+	c.mismatches = append(c.mismatches, strings.TrimPrefix(path, ".")+": "+fmt.Sprintf(format, args...))
+}
+
+// envelope checks the results envelope, the results of a Callable are not known.
+func (c *responseChecker) envelope(results []*FieldSchema, callable bool, resp interface{}) {
+	obj, ok := resp.(map[string]interface{})
+	if !ok {
+		c.mismatch("", "want the envelope object, got %s", jsonKind(resp))
+		return
+	}
+	list, ok := obj["results"].([]interface{})
+	if !ok {
+		c.mismatch("results", "want array, got %s", jsonKind(obj["results"]))
+		return
+	}
+	if len(list) == 0 {
+		c.mismatch("results", "want the error as the last result")
+		return
+	}
+	last := len(list) - 1
+	if !callable {
+		if len(list) != len(results)+1 {
+			c.mismatch("results", "want %d results with the error, got %d", len(results)+1, len(list))
+			return
+		}
+		for i, r := range results {
+			c.typ(fmt.Sprintf("results[%d]", i), r.Type, list[i])
+		}
+	}
+	if list[last] != nil {
+		respErr, ok := list[last].(map[string]interface{})
+		if !ok {
+			c.mismatch(fmt.Sprintf("results[%d]", last), "want the error object or null, got %s", jsonKind(list[last]))
+			return
+		}
+		if _, ok := respErr["error"].(string); !ok {
+			c.mismatch(fmt.Sprintf("results[%d].error", last), "want string, got %s", jsonKind(respErr["error"]))
+		}
+	}
+}
+
+// typ checks v is encoded from a value of ts, slices and maps can be null as nil.
+func (c *responseChecker) typ(path string, ts *TypeSchema, v interface{}) {
+	if ts.Kind == "any" {
+		return
+	}
+	if v == nil {
+		if !ts.Nullable && ts.Kind != "array" && ts.Elem == nil {
+			c.mismatch(path, "want %s, got null", ts.Kind)
+		}
+		return
+	}
+	if got := jsonKind(v); got != ts.Kind && !(ts.Kind == "number" && got == "integer") {
+		c.mismatch(path, "want %s, got %s", ts.Kind, got)
+		return
+	}
+
+	switch {
+	case ts.Kind == "array":
+		for i, ev := range v.([]interface{}) {
+			c.typ(fmt.Sprintf("%s[%d]", path, i), ts.Elem, ev)
+		}
+	case ts.Kind == "object" && ts.Elem != nil:
+		obj := v.(map[string]interface{})
+		for _, k := range sortedKeys(obj) {
+			c.typ(path+"."+k, ts.Elem, obj[k])
+		}
+	case ts.Kind == "object" && ts.Fields != nil:
+		obj := v.(map[string]interface{})
+		known := map[string]bool{}
+		for _, f := range ts.Fields {
+			known[f.Name] = true
+			fv, ok := obj[f.Name]
+			if !ok {
+				if !f.Optional {
+					c.mismatch(path+"."+f.Name, "is missing")
+				}
+				continue
+			}
+			c.typ(path+"."+f.Name, f.Type, fv)
+		}
+		for _, k := range sortedKeys(obj) {
+			if !known[k] {
+				c.mismatch(path+"."+k, "is not a field of %s", defaultString(ts.Name, "the struct"))
+			}
+		}
+	}
+}
+
+// jsonSchema checks v against the supported keywords of the JSON Schema s.
+func (c *responseChecker) jsonSchema(path string, s map[string]interface{}, v interface{}) {
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			subSchema, _ := sub.(map[string]interface{})
+			tried := &responseChecker{}
+			tried.jsonSchema(path, subSchema, v)
+			if len(tried.mismatches) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			c.mismatch(path, "matches none of anyOf")
+		}
+	}
+	if t, ok := s["type"]; ok && !jsonSchemaTypeOK(t, v) {
+		c.mismatch(path, "want type %v, got %s", t, jsonKind(v))
+		return
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.mismatch(path, "%s is not in enum %v", jsonString(v), enum)
+		}
+	}
+	if cv, ok := s["const"]; ok && !jsonEqual(cv, v) {
+		c.mismatch(path, "want %s, got %s", jsonString(cv), jsonString(v))
+	}
+	c.jsonSchemaLimits(path, s, v)
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		props, _ := s["properties"].(map[string]interface{})
+		for _, name := range jsonSchemaStrings(s["required"]) {
+			if _, ok := v[name]; !ok {
+				c.mismatch(path+"."+name, "is missing")
+			}
+		}
+		for _, k := range sortedKeys(v) {
+			if ps, ok := props[k].(map[string]interface{}); ok {
+				c.jsonSchema(path+"."+k, ps, v[k])
+				continue
+			}
+			if _, ok := props[k]; ok {
+				continue
+			}
+			switch ap := s["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					c.mismatch(path+"."+k, "is not allowed")
+				}
+			case map[string]interface{}:
+				c.jsonSchema(path+"."+k, ap, v[k])
+			}
+		}
+	case []interface{}:
+		prefix, _ := s["prefixItems"].([]interface{})
+		for i, ev := range v {
+			if i < len(prefix) {
+				if ps, ok := prefix[i].(map[string]interface{}); ok {
+					c.jsonSchema(fmt.Sprintf("%s[%d]", path, i), ps, ev)
+				}
+				continue
+			}
+			if items, ok := s["items"].(map[string]interface{}); ok {
+				c.jsonSchema(fmt.Sprintf("%s[%d]", path, i), items, ev)
+			}
+		}
+	}
+}
+
+func (c *responseChecker) jsonSchemaLimits(path string, s map[string]interface{}, v interface{}) {
+	limit := func(keyword string, n float64, below bool) {
+		l, ok := s[keyword].(float64)
+		if !ok {
+			return
+		}
+		if below && n < l || !below && n > l {
+			c.mismatch(path, "%s is %v, got %v", keyword, l, n)
+		}
+	}
+	switch v := v.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		limit("minimum", n, true)
+		limit("maximum", n, false)
+	case string:
+		limit("minLength", float64(len([]rune(v))), true)
+		limit("maxLength", float64(len([]rune(v))), false)
+	case []interface{}:
+		limit("minItems", float64(len(v)), true)
+		limit("maxItems", float64(len(v)), false)
+	}
+}
+
+func jsonSchemaTypeOK(t interface{}, v interface{}) bool {
+	kind := jsonKind(v)
+	for _, want := range jsonSchemaStrings(t) {
+		if want == kind || want == "number" && kind == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonSchemaStrings is a string or a list of strings of a schema
+func jsonSchemaStrings(v interface{}) (ss []string) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+	}
+	return
+}
+
+// jsonKind is the JSON Schema type of a value decoded with UseNumber
+func jsonKind(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// jsonEqual compares a value of the schema with a value of the response, numbers by their values.
+func jsonEqual(a, b interface{}) bool {
+	if an, ok := a.(float64); ok {
+		if bn, ok := b.(json.Number); ok {
+			f, err := bn.Float64()
+			return err == nil && f == an
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func sortedKeys(m map[string]interface{}) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,159 @@
+package jsonhandlerfunc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ReceiptHeader is the response header of the receipt hash of WithAuditChain
+const ReceiptHeader = "X-Jsonhf-Receipt"
+
+// ReceiptMetaKey is the response meta key of the receipt of WithAuditChain, without the params and results.
+const ReceiptMetaKey = "receipt"
+
+/*
+Receipt is the tamper evident record of one response, Hash is the sha256 of the json of the receipt
+with an empty Hash, which includes the PrevHash of the previous response, so that changing, removing
+or reordering any receipt breaks all the hashes after it. Check the stored receipts with VerifyReceipts.
+*/
+type Receipt struct {
+	Handler   string          `json:"handler"`
+	ClientIP  ClientIP        `json:"client_ip,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Results   json.RawMessage `json:"results,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+/*
+AuditChain chains the receipts of the responses of the handlers it's passed to with WithAuditChain,
+one chain can be shared by many handlers, and a new chain continues from the last hash it's created with.
+*/
+type AuditChain struct {
+	// OnReceipt stores the receipt, it's called in the order of the chain, keep it fast.
+	OnReceipt func(rc *Receipt)
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	mu   sync.Mutex
+	last string
+}
+
+// NewAuditChain continues the chain from lastHash, which is "" for a new chain.
+func NewAuditChain(lastHash string, onReceipt func(rc *Receipt)) *AuditChain {
+	return &AuditChain{last: lastHash, OnReceipt: onReceipt}
+}
+
+/*
+WithAuditChain adds a Receipt of the handler, params, results and timestamp chained to the previous response's
+to every response, the hash is in the ReceiptHeader header, and the receipt without params and results in the
+"receipt" meta, for tamper evident audit requirements. Only the responses of the func are chained, not the errors
+of header checks, injectors or decoding, since they didn't call the func.
+*/
+func WithAuditChain(chain *AuditChain) Option {
+	if chain == nil {
+		panic("audit chain can not be nil.")
+	}
+	return func(opts *handlerOptions) {
+		if opts.auditChain != nil && opts.auditChain != chain {
+			opts.conflict("WithAuditChain is passed with two chains, keep one of them")
+		}
+		opts.auditChain = chain
+	}
+}
+
+// funcName is the name of the func v, or the type of v for a Callable.
+func funcName(v reflect.Value) string {
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return v.Type().String()
+}
+
+// add appends the receipt of the call to the chain with the params and results encrypted by enc, and sets it to the response.
+func (chain *AuditChain) add(w http.ResponseWriter, state *RequestState, handler string, params []reflect.Value, results []interface{}, enc *fieldEncryption) (err error) {
+	rc := &Receipt{Handler: handler, ClientIP: state.ClientIP()}
+	var ps []interface{}
+	for _, p := range params {
+		ps = append(ps, p.Interface())
+	}
+	if rc.Params, err = json.Marshal(ps); err != nil {
+		return
+	}
+	if rc.Params, err = enc.params(rc.Params); err != nil {
+		return
+	}
+	if rc.Results, err = json.Marshal(results); err != nil {
+		return
+	}
+	if rc.Results, err = enc.results(rc.Results); err != nil {
+		return
+	}
+
+	now := time.Now
+	if chain.Now != nil {
+		now = chain.Now
+	}
+
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	rc.Timestamp = now().UTC()
+	rc.PrevHash = chain.last
+	if rc.Hash, err = rc.hash(); err != nil {
+		return
+	}
+	chain.last = rc.Hash
+	if chain.OnReceipt != nil {
+		chain.OnReceipt(rc)
+	}
+
+	w.Header().Set(ReceiptHeader, rc.Hash)
+	if rw, ok := w.(*responseWriter); ok {
+		rw.setMeta(ReceiptMetaKey, &Receipt{
+			Handler:   rc.Handler,
+			ClientIP:  rc.ClientIP,
+			Timestamp: rc.Timestamp,
+			PrevHash:  rc.PrevHash,
+			Hash:      rc.Hash,
+		})
+	}
+	return
+}
+
+func (rc Receipt) hash() (h string, err error) {
+	rc.Hash = ""
+	b, err := json.Marshal(rc)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// VerifyReceipts checks the hashes of the stored receipts and that they are chained in order.
+func VerifyReceipts(receipts []*Receipt) error {
+	for i, rc := range receipts {
+		h, err := rc.hash()
+		if err != nil {
+			return err
+		}
+		if h != rc.Hash {
+			return fmt.Errorf("receipt %d: hash mismatch, it's changed", i)
+		}
+		if i > 0 && rc.PrevHash != receipts[i-1].Hash {
+			return fmt.Errorf("receipt %d: previous hash mismatch, receipts are removed or reordered", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// BagMetaKey is the response meta key of the Bag values of Config.SurfaceBagKeys.
+const BagMetaKey = "bag"
+
+/*
+Bag is the key value bag of a request, set by the middleware, the injectors, the func and the hooks,
+instead of smuggling the values through ad hoc context keys for the hooks after them:
+
+	var tenantKey = jsonhandlerfunc.NewBagKey[string]("tenant")
+
+	func tenantInjector(w http.ResponseWriter, r *http.Request) (t *Tenant, err error) {
+		t, err = findTenant(r)
+		if err == nil {
+			tenantKey.Set(r.Context(), t.Slug)
+		}
+		return
+	}
+
+The values of Config.SurfaceBagKeys are responded in the meta by BagMetaKey, and returned by Surfaced for the logs,
+like of Config.OnResponse. Read the bag with BagOf, or RequestState.Bag. It's safe to be used by the goroutines of the func.
+*/
+type Bag struct {
+	surface []string
+
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+type bagKey struct{}
+
+// BagOf returns the bag of the request of ctx, nil if ctx is not of a request served by a handler or of WithBag.
+func BagOf(ctx context.Context) *Bag {
+	bag, _ := ctx.Value(bagKey{}).(*Bag)
+	return bag
+}
+
+/*
+WithBag returns r with a bag, for the middleware of Config.Middlewares to set the values before the handler,
+the handler keeps using it. It returns r if r already has a bag.
+*/
+func WithBag(r *http.Request) *http.Request {
+	if BagOf(r.Context()) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), bagKey{}, &Bag{}))
+}
+
+// Set sets the value of name, nil removes it. It does nothing on a nil bag.
+func (b *Bag) Set(name string, value interface{}) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if value == nil {
+		delete(b.values, name)
+		return
+	}
+	if b.values == nil {
+		b.values = map[string]interface{}{}
+	}
+	b.values[name] = value
+}
+
+// Get returns the value of name, nil if it's not set.
+func (b *Bag) Get(name string) interface{} {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.values[name]
+}
+
+// Surfaced returns the set values of Config.SurfaceBagKeys, nil if none.
+func (b *Bag) Surfaced() map[string]interface{} {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var surfaced map[string]interface{}
+	for _, name := range b.surface {
+		if v, ok := b.values[name]; ok {
+			if surfaced == nil {
+				surfaced = map[string]interface{}{}
+			}
+			surfaced[name] = v
+		}
+	}
+	return surfaced
+}
+
+// BagKey is a typed name of the values of Bag.
+type BagKey[T any] struct {
+	Name string
+}
+
+// NewBagKey returns the key of the values of T by name.
+func NewBagKey[T any](name string) BagKey[T] {
+	return BagKey[T]{Name: name}
+}
+
+// Set sets v to the bag of ctx, it does nothing if ctx has no bag.
+func (k BagKey[T]) Set(ctx context.Context, v T) {
+	BagOf(ctx).Set(k.Name, v)
+}
+
+// Get returns the value of the bag of ctx, ok is false if it's not set or not a T.
+func (k BagKey[T]) Get(ctx context.Context) (v T, ok bool) {
+	v, ok = BagOf(ctx).Get(k.Name).(T)
+	return
+}
+
+// withBag returns r with the bag of WithBag or a new one, which surfaces Config.SurfaceBagKeys.
+func (cfg *Config) withBag(r *http.Request) *http.Request {
+	r = WithBag(r)
+	bag := BagOf(r.Context())
+	bag.mu.Lock()
+	bag.surface = cfg.SurfaceBagKeys
+	bag.mu.Unlock()
+	return r
+}
+
+func (rw *responseWriter) setBagMeta() {
+	if surfaced := rw.bag.Surfaced(); surfaced != nil {
+		rw.setMeta(BagMetaKey, surfaced)
+	}
+}
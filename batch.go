@@ -0,0 +1,245 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxBatchSize is the max calls of a batch when Config.MaxBatchSize is not set
+const DefaultMaxBatchSize = 50
+
+// BatchTooLargeCode is the code of BatchTooLargeError
+const BatchTooLargeCode = "batch_too_large"
+
+// BatchTooLargeError is responded with 413 when a batch has more calls than Config.MaxBatchSize.
+type BatchTooLargeError struct {
+	Code    string `json:"code"`
+	Size    int    `json:"size"`
+	MaxSize int    `json:"max_size"`
+}
+
+func (e *BatchTooLargeError) Error() string {
+	return fmt.Sprintf("batch of %d calls is larger than %d", e.Size, e.MaxSize)
+}
+
+func (e *BatchTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// BatchRefKey is the key of the reference to a value of the response of an earlier call of a batch, like {"$ref": "0.results.0.id"}
+const BatchRefKey = "$ref"
+
+// InvalidBatchRefCode is the code of InvalidBatchRefError
+const InvalidBatchRefCode = "invalid_batch_ref"
+
+// InvalidBatchRefError is responded with 422 for a call of a batch with a reference that can't be resolved.
+type InvalidBatchRefError struct {
+	Code   string `json:"code"`
+	Ref    string `json:"ref"`
+	Reason string `json:"reason"`
+}
+
+func (e *InvalidBatchRefError) Error() string {
+	return fmt.Sprintf("invalid batch ref %q: %s", e.Ref, e.Reason)
+}
+
+func (e *InvalidBatchRefError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+type batchKey struct{}
+
+/*
+serveBatch serves a batch request, an array of request envelopes, with h when Config.AllowBatch is set,
+it responds the array of the response envelopes in the same order, and returns false if the request is not a batch.
+Every call is a request with the same headers and context, the response headers of the calls are discarded.
+
+A call can consume the results of an earlier call with a reference in place of any value of its envelope,
+like {"params": [{"$ref": "0.results.0.id"}]}, which is the index of the earlier call and the path in its
+response envelope, the call waits for the earlier call with BatchConcurrency, and it fails with
+InvalidBatchRefError if the earlier call failed or the path is not in its response.
+*/
+func (cfg *Config) serveBatch(w http.ResponseWriter, r *http.Request, h http.Handler) bool {
+	if !cfg.AllowBatch || r.Method != http.MethodPost || r.Context().Value(batchKey{}) != nil {
+		return false
+	}
+	raw, err := ioutil.ReadAll(bufferBody(r))
+	if err = bodyError(err); err != nil {
+		writeJSONResponse(w, statusCodeOf(err, http.StatusUnprocessableEntity), []interface{}{cfg.responseError(err)})
+		return true
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		return false
+	}
+
+	var calls []json.RawMessage
+	if err := json.Unmarshal(raw, &calls); err != nil {
+		writeJSONResponse(w, cfg.decodeErrorStatusCode(), []interface{}{cfg.responseError(fmt.Errorf("decode batch error"))})
+		return true
+	}
+	maxSize := cfg.MaxBatchSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBatchSize
+	}
+	if len(calls) > maxSize {
+		err := &BatchTooLargeError{Code: BatchTooLargeCode, Size: len(calls), MaxSize: maxSize}
+		writeJSONResponse(w, http.StatusRequestEntityTooLarge, []interface{}{cfg.responseError(err)})
+		return true
+	}
+
+	concurrency := cfg.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx := context.WithValue(r.Context(), batchKey{}, true)
+	resps := make([]json.RawMessage, len(calls))
+	statuses := make([]int, len(calls))
+	done := make([]chan struct{}, len(calls))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	response := func(i int) (json.RawMessage, int) {
+		<-done[i]
+		return resps[i], statuses[i]
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, call json.RawMessage) {
+			defer func() {
+				close(done[i])
+				<-sem
+				wg.Done()
+			}()
+			// the earlier calls got their places of sem before this one, waiting for them never deadlocks
+			call, err := resolveBatchRefs(call, i, response)
+			if err != nil {
+				resps[i], statuses[i] = batchCallError(cfg, err)
+				return
+			}
+			resps[i], statuses[i] = serveBatchCall(ctx, r, h, call)
+		}(i, call)
+	}
+	wg.Wait()
+
+	// responses without body, like JSON-RPC notifications, are not in the batch response
+	out := []json.RawMessage{}
+	for _, resp := range resps {
+		if len(resp) > 0 {
+			out = append(out, resp)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(out)
+	return true
+}
+
+func serveBatchCall(ctx context.Context, r *http.Request, h http.Handler, call json.RawMessage) (json.RawMessage, int) {
+	sub := r.Clone(ctx)
+	sub.Body = ioutil.NopCloser(bytes.NewReader(call))
+	sub.ContentLength = int64(len(call))
+	bw := &bufferResponseWriter{header: http.Header{}, status: http.StatusOK}
+	h.ServeHTTP(bw, sub)
+	return bytes.TrimSpace(bw.body.Bytes()), bw.status
+}
+
+func batchCallError(cfg *Config, err error) (json.RawMessage, int) {
+	bw := &bufferResponseWriter{header: http.Header{}, status: http.StatusOK}
+	code := statusCodeOf(err, http.StatusUnprocessableEntity)
+	writeJSONResponse(bw, code, []interface{}{cfg.responseError(err)})
+	return bytes.TrimSpace(bw.body.Bytes()), code
+}
+
+// resolveBatchRefs replaces the references of the call at index with the values of the responses of the earlier calls.
+func resolveBatchRefs(call json.RawMessage, index int, response func(i int) (json.RawMessage, int)) (json.RawMessage, error) {
+	if !bytes.Contains(call, []byte(`"`+BatchRefKey+`"`)) {
+		return call, nil
+	}
+	var v interface{}
+	if decodeNumbers(call, &v) != nil {
+		// the handler responds the decode error
+		return call, nil
+	}
+	v, err := resolveRefs(v, index, response)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func resolveRefs(v interface{}, index int, response func(i int) (json.RawMessage, int)) (_ interface{}, err error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v[BatchRefKey].(string); ok && len(v) == 1 {
+			return resolveRef(ref, index, response)
+		}
+		for k := range v {
+			if v[k], err = resolveRefs(v[k], index, response); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			if v[i], err = resolveRefs(v[i], index, response); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func resolveRef(ref string, index int, response func(i int) (json.RawMessage, int)) (interface{}, error) {
+	refErr := func(format string, args ...interface{}) error {
+		return &InvalidBatchRefError{Code: InvalidBatchRefCode, Ref: ref, Reason: fmt.Sprintf(format, args...)}
+	}
+	parts := strings.Split(ref, ".")
+	i, err := strconv.Atoi(parts[0])
+	if err != nil || i < 0 || i >= index {
+		return nil, refErr("it must start with the index of an earlier call")
+	}
+	resp, status := response(i)
+	if status >= 400 {
+		return nil, refErr("call %d failed with status %d", i, status)
+	}
+	var v interface{}
+	if decodeNumbers(resp, &v) != nil {
+		return nil, refErr("call %d has no json response", i)
+	}
+	for _, part := range parts[1:] {
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			val, ok := cur[part]
+			if !ok {
+				return nil, refErr("%s is not in the response of call %d", part, i)
+			}
+			v = val
+		case []interface{}:
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || n >= len(cur) {
+				return nil, refErr("%s is not in the response of call %d", part, i)
+			}
+			v = cur[n]
+		default:
+			return nil, refErr("%s is not in the response of call %d", part, i)
+		}
+	}
+	return v, nil
+}
+
+// decodeNumbers decodes the json b to v with the numbers as json.Number, so that large ids are kept as they are.
+func decodeNumbers(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
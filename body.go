@@ -0,0 +1,111 @@
+package jsonhandlerfunc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RequestTooLargeCode is the code of RequestTooLargeError
+const RequestTooLargeCode = "request_too_large"
+
+// RequestTooLargeError is responded with 413 when the request body is larger than Config.MaxRequestBodyBytes.
+type RequestTooLargeError struct {
+	Code     string `json:"code"`
+	MaxBytes int64  `json:"max_bytes"`
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("request body is larger than %d bytes", e.MaxBytes)
+}
+
+func (e *RequestTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// RequestTimeoutCode is the code of RequestTimeoutError
+const RequestTimeoutCode = "request_timeout"
+
+// RequestTimeoutError is responded with 408 when the request body is not read in Config.DecodeTimeout.
+type RequestTimeoutError struct {
+	Code      string `json:"code"`
+	TimeoutMs int64  `json:"timeout_ms"`
+}
+
+func (e *RequestTimeoutError) Error() string {
+	return fmt.Sprintf("request body was not read in %dms", e.TimeoutMs)
+}
+
+func (e *RequestTimeoutError) StatusCode() int {
+	return http.StatusRequestTimeout
+}
+
+/*
+limitBody limits the request body by Config.MaxRequestBodyBytes and Config.DecodeTimeout, the returned func
+clears the read deadline of the connection so it doesn't fire on the next request of a keep-alive connection.
+The read deadline is set with http.ResponseController, a writer that doesn't support it, like of a test,
+only fails the reads after the deadline.
+*/
+func (cfg *Config) limitBody(w http.ResponseWriter, r *http.Request) (reset func()) {
+	reset = func() {}
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	if cfg.MaxRequestBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxRequestBodyBytes)
+	}
+	if cfg.DecodeTimeout > 0 {
+		deadline := time.Now().Add(cfg.DecodeTimeout)
+		rc := http.NewResponseController(w)
+		if rc.SetReadDeadline(deadline) == nil {
+			reset = func() { rc.SetReadDeadline(time.Time{}) }
+		}
+		r.Body = &deadlineBody{ReadCloser: r.Body, deadline: deadline, timeout: cfg.DecodeTimeout}
+	}
+	return
+}
+
+// checkBodySize rejects the request by its Content-Length before the body is read.
+func (cfg *Config) checkBodySize(r *http.Request) error {
+	if cfg.MaxRequestBodyBytes > 0 && r.ContentLength > cfg.MaxRequestBodyBytes {
+		return &RequestTooLargeError{Code: RequestTooLargeCode, MaxBytes: cfg.MaxRequestBodyBytes}
+	}
+	return nil
+}
+
+type deadlineBody struct {
+	io.ReadCloser
+	deadline time.Time
+	timeout  time.Duration
+}
+
+func (b *deadlineBody) Read(p []byte) (n int, err error) {
+	if !time.Now().Before(b.deadline) {
+		return 0, b.timeoutError()
+	}
+	n, err = b.ReadCloser.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = b.timeoutError()
+	}
+	return
+}
+
+func (b *deadlineBody) timeoutError() error {
+	return &RequestTimeoutError{Code: RequestTimeoutCode, TimeoutMs: int64(b.timeout / time.Millisecond)}
+}
+
+// bodyError returns the RequestTooLargeError or RequestTimeoutError of reading the request body in err, nil if there isn't one.
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &RequestTooLargeError{Code: RequestTooLargeCode, MaxBytes: maxBytesErr.Limit}
+	}
+	var timeoutErr *RequestTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr
+	}
+	return nil
+}
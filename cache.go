@@ -0,0 +1,255 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatusHeader is the response header of WithResponseCache, HIT if the response is served from the cache, MISS if not.
+const CacheStatusHeader = "X-Jsonhf-Cache"
+
+// CacheDimension is a context dimension of the request that partitions the ResponseCache, like the tenant, locale or role.
+type CacheDimension struct {
+	Name string
+	// Value returns the value of the dimension of the request, it's called after the injectors.
+	Value func(state *RequestState) string
+}
+
+// LocaleDimension partitions the ResponseCache by the language of the request, see Config.LocalizeResults.
+var LocaleDimension = CacheDimension{
+	Name:  "locale",
+	Value: func(state *RequestState) string { return state.Language },
+}
+
+/*
+ResponseCache caches the successful GET responses of WithCacheableGET in the process, for max age of WithCacheableGET,
+except the responses with Set-Cookie.
+The keys are of the handler, the path, the query and the Dimensions of the request, so that a response of a tenant
+is never served to another tenant:
+
+	cache := jsonhandlerfunc.NewResponseCache(jsonhandlerfunc.CacheDimension{
+		Name: "tenant",
+		Value: func(state *jsonhandlerfunc.RequestState) string {
+			var t *Tenant
+			state.Lookup(&t)
+			return t.ID
+		},
+	}, jsonhandlerfunc.LocaleDimension)
+
+With Dimensions the Cache-Control of the responses is private instead of public, since shared caches like CDNs
+don't know the dimensions. One cache can be shared by many handlers.
+*/
+type ResponseCache struct {
+	Dimensions []CacheDimension
+	// MaxEntries is the max cached responses, default is 10000, responses are not cached when it's full of not expired ones.
+	MaxEntries int
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	hits    int64
+	misses  int64
+	dims    map[string]map[string]*CacheHitStats
+}
+
+type cachedResponse struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// CacheHitStats are the hits and misses of the ResponseCache
+type CacheHitStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// ResponseCacheStats are the metrics of the ResponseCache, Dimensions are the stats by the dimension name and value.
+type ResponseCacheStats struct {
+	CacheHitStats
+	Entries    int                                  `json:"entries"`
+	Dimensions map[string]map[string]*CacheHitStats `json:"dimensions,omitempty"`
+}
+
+// NewResponseCache creates a ResponseCache partitioned by dims
+func NewResponseCache(dims ...CacheDimension) *ResponseCache {
+	for _, dim := range dims {
+		if dim.Name == "" || dim.Value == nil {
+			panic("cache dimension needs a name and a value func.")
+		}
+	}
+	return &ResponseCache{Dimensions: dims}
+}
+
+// WithResponseCache serves the GET responses of WithCacheableGET from cache, see ResponseCache.
+func WithResponseCache(cache *ResponseCache) Option {
+	if cache == nil {
+		panic("response cache can not be nil.")
+	}
+	return func(opts *handlerOptions) {
+		if opts.responseCache != nil && opts.responseCache != cache {
+			opts.conflict("WithResponseCache is passed with two caches, keep one of them")
+		}
+		opts.responseCache = cache
+	}
+}
+
+// Stats returns the hits and misses of the cache, and of the values of every dimension.
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := ResponseCacheStats{
+		CacheHitStats: *newCacheHitStats(c.hits, c.misses),
+		Entries:       len(c.entries),
+	}
+	for name, values := range c.dims {
+		if stats.Dimensions == nil {
+			stats.Dimensions = map[string]map[string]*CacheHitStats{}
+		}
+		stats.Dimensions[name] = map[string]*CacheHitStats{}
+		for value, s := range values {
+			stats.Dimensions[name][value] = newCacheHitStats(s.Hits, s.Misses)
+		}
+	}
+	return stats
+}
+
+func newCacheHitStats(hits, misses int64) *CacheHitStats {
+	s := &CacheHitStats{Hits: hits, Misses: misses}
+	if hits+misses > 0 {
+		s.HitRate = float64(hits) / float64(hits+misses)
+	}
+	return s
+}
+
+func (c *ResponseCache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+/*
+serve writes the cached response of the request if there is one, or else the returned store func
+is deferred to cache the response if it's successful.
+*/
+func (c *ResponseCache) serve(rw *responseWriter, r *http.Request, h *Handler, maxAge time.Duration) (served bool, store func()) {
+	state := RequestStateOf(r.Context())
+	values := make([]string, len(c.Dimensions))
+	for i, dim := range c.Dimensions {
+		values[i] = dim.Value(state)
+	}
+	codec := ""
+	if rw.codec != nil {
+		codec = rw.codec.ContentType()
+	}
+	// the handlers of the same func, like of a closure literal, are told apart by their identities
+	handler := fmt.Sprintf("%p", h)
+	key := strings.Join(append([]string{handler, r.URL.Path, r.URL.RawQuery, codec, boolString(rw.compact)}, values...), "\x00")
+
+	now := c.now()
+	c.mu.Lock()
+	cached := c.entries[key]
+	if cached != nil && !now.Before(cached.expires) {
+		delete(c.entries, key)
+		cached = nil
+	}
+	c.count(values, cached != nil)
+	c.mu.Unlock()
+
+	if cached != nil {
+		for k, v := range cached.header {
+			rw.Header()[k] = v
+		}
+		rw.Header().Set(CacheStatusHeader, "HIT")
+		writeBody(rw, http.StatusOK, cached.body)
+		return true, nil
+	}
+
+	rw.Header().Set(CacheStatusHeader, "MISS")
+	if rw.capture == nil {
+		rw.capture = &bytes.Buffer{}
+	}
+	return false, func() {
+		// the cookies are of the client, replaying them would share its session with the other clients
+		if rw.status != http.StatusOK || len(rw.Header()["Set-Cookie"]) > 0 {
+			return
+		}
+		header := http.Header{}
+		for k, v := range rw.Header() {
+			// the body is cached uncompressed, it's compressed again for the coding of every request
+			if k != CacheStatusHeader && k != "Content-Encoding" {
+				header[k] = append([]string(nil), v...)
+			}
+		}
+		c.store(key, &cachedResponse{
+			header:  header,
+			body:    append([]byte(nil), rw.capture.Bytes()...),
+			expires: now.Add(maxAge),
+		})
+	}
+}
+
+// count counts the hit or miss of the request with the dimension values, c.mu is locked.
+func (c *ResponseCache) count(values []string, hit bool) {
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	if c.dims == nil {
+		c.dims = map[string]map[string]*CacheHitStats{}
+	}
+	for i, dim := range c.Dimensions {
+		if c.dims[dim.Name] == nil {
+			c.dims[dim.Name] = map[string]*CacheHitStats{}
+		}
+		s := c.dims[dim.Name][values[i]]
+		if s == nil {
+			s = &CacheHitStats{}
+			c.dims[dim.Name][values[i]] = s
+		}
+		if hit {
+			s.Hits++
+		} else {
+			s.Misses++
+		}
+	}
+}
+
+func (c *ResponseCache) store(key string, cached *cachedResponse) {
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*cachedResponse{}
+	}
+	if len(c.entries) >= maxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxEntries {
+		return
+	}
+	c.entries[key] = cached
+}
+
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
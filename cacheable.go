@@ -0,0 +1,48 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+WithCacheableGET serves the func also with GET, for read endpoints that can be cached by CDNs and browsers,
+while writes stay POST with the json envelope. The GET params are the same json array in the query,
+like /products?params=["shoes",10], or query args by param names, see Config.QueryParams,
+and successful GET responses have Cache-Control: public, max-age, or private with the Dimensions of WithResponseCache.
+The responses of funcs with injectors are private too, since the injected values usually depend on the user, see WithPublicCache.
+Sections of WithEnvelopeSection can be passed as query values too.
+*/
+func WithCacheableGET(maxAge time.Duration) Option {
+	return func(opts *handlerOptions) {
+		if opts.cacheableGET && opts.getMaxAge != maxAge {
+			opts.conflict("WithCacheableGET is set with both max age %s and %s, keep one of them", opts.getMaxAge, maxAge)
+		}
+		opts.cacheableGET = true
+		opts.getMaxAge = maxAge
+	}
+}
+
+/*
+WithPublicCache makes the GET responses of WithCacheableGET Cache-Control public even though the func has injectors,
+for the injectors that don't depend on the user, like the ones of a database connection or a feature flag.
+*/
+func WithPublicCache() Option {
+	return func(opts *handlerOptions) {
+		opts.publicCache = true
+	}
+}
+
+func (opts *handlerOptions) isCacheableGET(r *http.Request) bool {
+	return opts.cacheableGET && r.Method == http.MethodGet
+}
+
+func (h *Handler) setCacheHeaders(w http.ResponseWriter) {
+	opts := h.opts
+	scope := "public"
+	if opts.responseCache != nil && len(opts.responseCache.Dimensions) > 0 || h.hasInjectors && !opts.publicCache {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(opts.getMaxAge/time.Second)))
+}
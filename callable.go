@@ -0,0 +1,233 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+Callable is implemented by hot handlers, hand written or generated, to opt into the call path without reflection,
+pass it to ToHandlerFunc the same as a func. rawParams are the params of the request envelope,
+results are the results except the error, and err is responded the same as an error returned by a func.
+
+Callables can't have injectors, read the request values from ctx, like Language(ctx).
+*/
+type Callable interface {
+	Call(ctx context.Context, rawParams []json.RawMessage) (results []interface{}, err error)
+}
+
+func (cfg *Config) newCallableHandler(c Callable, funcs []interface{}, opts *handlerOptions) *Handler {
+	if len(funcs) > 0 {
+		panic(fmt.Sprintf("%T is a Callable, it can not have injectors", c))
+	}
+
+	conflicts := opts.conflicts
+	add := func(option string) {
+		conflicts = append(conflicts, option+" needs the func's types, it can't be used with a Callable")
+	}
+	if opts.partialTimeout != nil {
+		add("WithPartialTimeout")
+	}
+	if len(opts.envelopeSections) > 0 {
+		add("WithEnvelopeSection")
+	}
+	if opts.cacheableGET {
+		add("WithCacheableGET")
+	}
+	if opts.queryParams != nil {
+		add("WithQueryParams")
+	}
+	if opts.pathParams != nil {
+		add("WithPathParams")
+	}
+	if opts.headerParams != nil {
+		add("WithHeaderParams")
+	}
+	if opts.autoRetry != nil {
+		add("WithAutoRetry")
+	}
+	if opts.responseCache != nil {
+		add("WithResponseCache")
+	}
+	if opts.fieldCipher != nil {
+		add("WithFieldEncryption")
+	}
+	if opts.conditionalPOST {
+		add("WithConditionalPOST")
+	}
+	if opts.requiredParams != nil {
+		add("WithRequiredParams")
+	}
+	if opts.auditChain != nil {
+		add("WithAuditChain")
+	}
+	if opts.paramNames != nil {
+		add("WithParamNames")
+	}
+	if opts.resultNames != nil {
+		add("WithResultNames")
+	}
+	if opts.listPolicy != nil {
+		add("WithListOptions")
+	}
+	if opts.pageSize > 0 {
+		add("WithAutoPaginate")
+	}
+	if len(conflicts) > 0 {
+		panic(fmt.Sprintf("conflicting options for %T:\n  - %s", c, strings.Join(conflicts, "\n  - ")))
+	}
+
+	return &Handler{
+		cfg:           cfg,
+		opts:          opts,
+		v:             reflect.ValueOf(c),
+		delegateIndex: -1,
+		streamIndex:   -1,
+		eventsIndex:   -1,
+		faults:        cfg.faults(opts),
+		tally:         opts.newPanicTally(),
+		pool:          cfg.pool(opts),
+		callable:      c,
+	}
+}
+
+// serveCallable is ServeHTTP after the request checks for a Callable
+func (h *Handler) serveCallable(w http.ResponseWriter, r *http.Request, c *handlerCall) {
+	cfg := h.cfg
+	var rawParams []json.RawMessage
+	req := compactReq{Params: &rawParams}
+	if isCompact(w) {
+		req.P = &rawParams
+	}
+	defer r.Body.Close()
+	stopWatching := watchBody(w, r)
+	defer stopWatching()
+	body, err := h.opts.checkDuplicateKeys(r.Body, requestCodec(w))
+	if _, ok := err.(*DuplicateKeyError); ok {
+		cfg.returnError(nil, w, err, cfg.decodeErrorStatusCode())
+		return
+	}
+	if err == nil {
+		err = requestCodec(w).Decode(body, &req)
+	}
+	stopWatching()
+	if ctxErr := c.contextError(r.Context()); err != nil && ctxErr != nil {
+		if ctxErr == context.Canceled {
+			return
+		}
+		cfg.returnError(nil, w, ctxErr, statusCodeOf(ctxErr, http.StatusGatewayTimeout))
+		return
+	}
+	if bodyErr := bodyError(err); bodyErr != nil {
+		cfg.returnError(nil, w, bodyErr, statusCodeOf(bodyErr, cfg.decodeErrorStatusCode()))
+		return
+	}
+	if err != nil && err != io.EOF {
+		cfg.returnError(nil, w, fmt.Errorf("decode request params error"), cfg.decodeErrorStatusCode())
+		return
+	}
+
+	results, err := h.callCallable(c, r.Context(), rawParams)
+	if cfg.Logger != nil {
+		c.loggedParams, c.loggedResults, c.loggedErr = rawParamsOf(rawParams), results, err
+	}
+	httpCode := cfg.successStatusCode(h.opts)
+	var errOut interface{}
+	if err != nil {
+		httpCode = cfg.errStatusCode(err, http.StatusOK)
+		errOut = cfg.responseError(err)
+	}
+	outs := cfg.localizeResults(w, r, append(results, errOut))
+	outs = cfg.shapeResults(r, outs)
+	outs = h.opts.toProtoStruct(outs)
+	writeJSONResponse(w, httpCode, outs)
+}
+
+// callCallable calls the Callable observed by Config.OnRequest and Config.OnResponse.
+func (h *Handler) callCallable(c *handlerCall, ctx context.Context, rawParams []json.RawMessage) (results []interface{}, err error) {
+	done := h.observe(c.requestCtx, 0, rawParamsOf(rawParams))
+	returned := false
+	defer func() {
+		if !returned {
+			done(nil, observedErr(nil))
+		}
+	}()
+	results, err = h.callCallableWithDeadline(c, ctx, rawParams)
+	returned = true
+	done(results, err)
+	return
+}
+
+// callCallableWithDeadline calls the Callable in the Pool of its class with fault injection and the deadline of the request applied.
+func (h *Handler) callCallableWithDeadline(c *handlerCall, ctx context.Context, rawParams []json.RawMessage) (results []interface{}, err error) {
+	if h.faults != nil {
+		if err = h.faults.inject(ctx); err != nil {
+			if ctx.Err() != nil {
+				err = c.contextError(ctx)
+			}
+			return
+		}
+	}
+	release, err := h.pool.acquire(ctx, c.start)
+	if err != nil {
+		return
+	}
+	ctx, release = h.pool.hold(ctx, release)
+	defer release()
+	defer c.markCalled()()
+	if _, ok := ctx.Deadline(); !ok {
+		return h.callable.Call(ctx, rawParams)
+	}
+
+	type callableResult struct {
+		results  []interface{}
+		err      error
+		panicVal interface{}
+	}
+	done := make(chan callableResult, 1)
+	returned := startFunc(ctx)
+	go func() {
+		defer returned()
+		var res callableResult
+		defer func() {
+			res.panicVal = recover()
+			done <- res
+		}()
+		res.results, res.err = h.callable.Call(ctx, rawParams)
+	}()
+	var res callableResult
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, newTimeoutError(c.start)
+		}
+		res = <-done
+	}
+	if res.panicVal != nil {
+		panic(res.panicVal)
+	}
+	return res.results, res.err
+}
+
+// invokeCallable is Invoke for a Callable, params are encoded to json unless they are json.RawMessage.
+func (h *Handler) invokeCallable(c *handlerCall, ctx context.Context, params []interface{}) (results []interface{}, err error) {
+	rawParams := make([]json.RawMessage, len(params))
+	for i, p := range params {
+		if raw, ok := p.(json.RawMessage); ok {
+			rawParams[i] = raw
+			continue
+		}
+		rawParams[i], err = json.Marshal(p)
+		if err != nil {
+			err = fmt.Errorf("param %d: %s", i, err)
+			return
+		}
+	}
+	return h.callCallable(c, ctx, rawParams)
+}
@@ -0,0 +1,264 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+/*
+Changelog is the difference of two Schema snapshots, for the release notes of client teams,
+encode it with json or write it with WriteMarkdown.
+*/
+type Changelog struct {
+	Added   []string         `json:"added"`
+	Removed []string         `json:"removed"`
+	Changed []*MethodChanges `json:"changed"`
+}
+
+// MethodChanges are the changes of a method that is in both snapshots
+type MethodChanges struct {
+	Method  string    `json:"method"`
+	Changes []*Change `json:"changes"`
+}
+
+/*
+Change is "added", "removed" or "changed" at Path, like "params[0].Address.Zipcode",
+Old and New describe the types. Breaking changes make requests or responses of existing clients fail,
+like removed methods, fields or results, changed types, added params and required headers.
+*/
+type Change struct {
+	Kind     string `json:"kind"`
+	Path     string `json:"path"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+	Breaking bool   `json:"breaking"`
+}
+
+// DiffSchemas returns the changes from oldSchema to newSchema
+func DiffSchemas(oldSchema, newSchema *Schema) (c *Changelog) {
+	c = &Changelog{Added: []string{}, Removed: []string{}, Changed: []*MethodChanges{}}
+	olds := map[string]*MethodSchema{}
+	for _, m := range oldSchema.Methods {
+		olds[m.Name] = m
+	}
+	news := map[string]*MethodSchema{}
+	for _, m := range newSchema.Methods {
+		news[m.Name] = m
+		old, ok := olds[m.Name]
+		if !ok {
+			c.Added = append(c.Added, m.Name)
+			continue
+		}
+		if changes := diffMethod(old, m); len(changes) > 0 {
+			c.Changed = append(c.Changed, &MethodChanges{Method: m.Name, Changes: changes})
+		}
+	}
+	for _, m := range oldSchema.Methods {
+		if _, ok := news[m.Name]; !ok {
+			c.Removed = append(c.Removed, m.Name)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Slice(c.Changed, func(i, j int) bool {
+		return c.Changed[i].Method < c.Changed[j].Method
+	})
+	return
+}
+
+// Breaking reports if any of the changes breaks existing clients
+func (c *Changelog) Breaking() bool {
+	if len(c.Removed) > 0 {
+		return true
+	}
+	for _, mc := range c.Changed {
+		for _, change := range mc.Changes {
+			if change.Breaking {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type schemaDiff struct {
+	changes []*Change
+}
+
+func (d *schemaDiff) add(kind, path, old, new string, breaking bool) {
+	d.changes = append(d.changes, &Change{Kind: kind, Path: path, Old: old, New: new, Breaking: breaking})
+}
+
+func diffMethod(old, new *MethodSchema) []*Change {
+	d := &schemaDiff{}
+	d.fieldList("params", old.Params, new.Params, true)
+	d.fieldsByName("sections", old.Sections, new.Sections, true)
+	if old.NamedResults != new.NamedResults {
+		// the results object and the results array are read differently by the clients
+		d.add("changed", "named_results", strconv.FormatBool(old.NamedResults), strconv.FormatBool(new.NamedResults), true)
+	}
+	if old.NamedResults && new.NamedResults {
+		// the named results are read by their names, a renamed result is removed for the clients
+		d.fieldsByName("results", old.Results, new.Results, false)
+	} else {
+		d.fieldList("results", old.Results, new.Results, false)
+	}
+
+	oldHeaders := map[string]bool{}
+	for _, h := range old.RequiredHeaders {
+		oldHeaders[h] = true
+	}
+	for _, h := range new.RequiredHeaders {
+		if !oldHeaders[h] {
+			d.add("added", "required_headers."+h, "", "", true)
+		}
+		delete(oldHeaders, h)
+	}
+	for _, h := range old.RequiredHeaders {
+		if oldHeaders[h] {
+			d.add("removed", "required_headers."+h, "", "", false)
+		}
+	}
+	oldPreconditions := map[Precondition]bool{}
+	for _, p := range old.Preconditions {
+		oldPreconditions[p] = true
+	}
+	for _, p := range new.Preconditions {
+		if !oldPreconditions[p] {
+			d.add("added", "preconditions."+string(p), "", "", true)
+		}
+		delete(oldPreconditions, p)
+	}
+	for _, p := range old.Preconditions {
+		if oldPreconditions[p] {
+			d.add("removed", "preconditions."+string(p), "", "", false)
+		}
+	}
+	if old.MinClientVersion != new.MinClientVersion {
+		d.add("changed", "min_client_version", old.MinClientVersion, new.MinClientVersion, new.MinClientVersion != "")
+	}
+	return d.changes
+}
+
+// fieldList diffs positional params or results, inbound are params which clients send.
+func (d *schemaDiff) fieldList(path string, olds, news []*FieldSchema, inbound bool) {
+	for i := 0; i < len(olds) || i < len(news); i++ {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(olds):
+			// clients must send an added param, and ignore an added result
+			d.add("added", p, "", describeType(news[i].Type), inbound)
+		case i >= len(news):
+			d.add("removed", p, describeType(olds[i].Type), "", true)
+		default:
+			d.typ(p, olds[i].Type, news[i].Type, inbound)
+		}
+	}
+}
+
+// fieldsByName diffs struct fields or sections
+func (d *schemaDiff) fieldsByName(path string, olds, news []*FieldSchema, inbound bool) {
+	oldByName := map[string]*FieldSchema{}
+	for _, f := range olds {
+		oldByName[f.Name] = f
+	}
+	for _, f := range news {
+		p := path + "." + f.Name
+		old, ok := oldByName[f.Name]
+		delete(oldByName, f.Name)
+		if !ok {
+			// an added field is zero in requests of existing clients, and ignored in their responses
+			d.add("added", p, "", describeType(f.Type), false)
+			continue
+		}
+		d.typ(p, old.Type, f.Type, inbound)
+	}
+	for _, f := range olds {
+		if _, ok := oldByName[f.Name]; ok {
+			// a removed field is ignored by the server in requests, but missing in responses
+			d.add("removed", path+"."+f.Name, describeType(f.Type), "", !inbound)
+		}
+	}
+}
+
+func (d *schemaDiff) typ(path string, old, new *TypeSchema, inbound bool) {
+	if old.Kind != new.Kind || old.Format != new.Format {
+		d.add("changed", path, describeType(old), describeType(new), true)
+		return
+	}
+	if old.Nullable != new.Nullable {
+		// null is fine to send to a nullable param, and to read from a result that was nullable
+		breaking := (inbound && !new.Nullable) || (!inbound && new.Nullable)
+		d.add("changed", path, describeType(old), describeType(new), breaking)
+	}
+	if old.Elem != nil && new.Elem != nil {
+		d.typ(path+"[]", old.Elem, new.Elem, inbound)
+	}
+	if old.Kind == "object" && old.Elem == nil && new.Elem == nil {
+		d.fieldsByName(path, old.Fields, new.Fields, inbound)
+	}
+}
+
+func describeType(t *TypeSchema) (s string) {
+	switch {
+	case t.Kind == "array" && t.Elem != nil:
+		s = "array of " + describeType(t.Elem)
+	case t.Kind == "object" && t.Elem != nil:
+		s = "map of " + describeType(t.Elem)
+	case t.Kind == "object" && t.Name != "":
+		s = "object " + t.Name
+	case t.Format != "":
+		s = t.Kind + " (" + t.Format + ")"
+	default:
+		s = t.Kind
+	}
+	if t.Nullable {
+		s = "nullable " + s
+	}
+	return
+}
+
+// WriteMarkdown writes the changelog as a Markdown section for release notes
+func (c *Changelog) WriteMarkdown(w io.Writer) (err error) {
+	var buf bytes.Buffer
+	buf.WriteString("## API changes\n")
+	if len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0 {
+		buf.WriteString("\nNo changes.\n")
+	}
+	if len(c.Added) > 0 {
+		buf.WriteString("\n### Added methods\n\n")
+		for _, name := range c.Added {
+			fmt.Fprintf(&buf, "- `%s`\n", name)
+		}
+	}
+	if len(c.Removed) > 0 {
+		buf.WriteString("\n### Removed methods\n\n")
+		for _, name := range c.Removed {
+			fmt.Fprintf(&buf, "- `%s` **breaking**\n", name)
+		}
+	}
+	if len(c.Changed) > 0 {
+		buf.WriteString("\n### Changed methods\n")
+		for _, mc := range c.Changed {
+			fmt.Fprintf(&buf, "\n#### `%s`\n\n", mc.Method)
+			for _, change := range mc.Changes {
+				fmt.Fprintf(&buf, "- %s `%s`", change.Kind, change.Path)
+				switch {
+				case change.Old != "" && change.New != "":
+					fmt.Fprintf(&buf, " from %s to %s", change.Old, change.New)
+				case change.Old != "" || change.New != "":
+					fmt.Fprintf(&buf, " %s%s", change.Old, change.New)
+				}
+				if change.Breaking {
+					buf.WriteString(" **breaking**")
+				}
+				buf.WriteString("\n")
+			}
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return
+}
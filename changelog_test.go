@@ -0,0 +1,113 @@
+package jsonhandlerfunc_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/theplant/jsonhandlerfunc"
+)
+
+// ### Changelog: the named results of WithResultNames are diffed by their names
+func ExampleDiffSchemas_namedResults() {
+	v1 := jsonhandlerfunc.NewRegistry(nil)
+	v1.Register("orders.Get", func(id string) (order string, total int, err error) { return }, jsonhandlerfunc.WithResultNames("order", "total"))
+	v1.Register("orders.List", func() (ids []string, err error) { return })
+
+	v2 := jsonhandlerfunc.NewRegistry(nil)
+	v2.Register("orders.Get", func(id string) (order string, amount int, err error) { return }, jsonhandlerfunc.WithResultNames("order", "amount"))
+	v2.Register("orders.List", func() (ids []string, err error) { return }, jsonhandlerfunc.WithResultNames("ids"))
+
+	changelog := jsonhandlerfunc.DiffSchemas(v1.Schema(), v2.Schema())
+	changelog.WriteMarkdown(os.Stdout)
+	fmt.Println("breaking:", changelog.Breaking())
+	//Output:
+	// ## API changes
+	//
+	// ### Changed methods
+	//
+	// #### `orders.Get`
+	//
+	// - added `results.amount` integer
+	// - removed `results.total` integer **breaking**
+	//
+	// #### `orders.List`
+	//
+	// - changed `named_results` from false to true **breaking**
+	// breaking: true
+}
+
+// ### Changelog: diff two schema snapshots for release notes
+func ExampleDiffSchemas() {
+	type AddressV1 struct {
+		Zipcode  int
+		Address1 string
+	}
+	type UserV1 struct {
+		Name    string     `json:"name"`
+		Age     int        `json:"age"`
+		Address *AddressV1 `json:"address"`
+	}
+	v1 := jsonhandlerfunc.NewRegistry(nil)
+	v1.Register("users.Get", func(id string) (u *UserV1, err error) { return })
+	v1.Register("users.Delete", func(id string) (err error) { return })
+	v1.Register("users.Search", func(keyword string) (ids []int, err error) { return })
+
+	type AddressV2 struct {
+		Zipcode  string
+		Address1 string
+		Address2 string `json:",omitempty"`
+	}
+	type UserV2 struct {
+		Name    string     `json:"name"`
+		Address *AddressV2 `json:"address"`
+	}
+	v2 := jsonhandlerfunc.NewRegistry(nil)
+	v2.Register("users.Get", func(id string) (u *UserV2, err error) { return }, jsonhandlerfunc.WithRequiredHeaders("X-Api-Key"))
+	v2.Register("users.Search", func(keyword string, limit int) (ids []int, total int, err error) { return })
+	v2.Register("users.Create", func(u *UserV2) (id string, err error) { return })
+
+	// snapshots are saved as json files for each release
+	b, _ := json.Marshal(v1.Schema())
+	var old jsonhandlerfunc.Schema
+	json.Unmarshal(b, &old)
+
+	changelog := jsonhandlerfunc.DiffSchemas(&old, v2.Schema())
+	changelog.WriteMarkdown(os.Stdout)
+	fmt.Println("breaking:", changelog.Breaking())
+	//Output:
+	// ## API changes
+	//
+	// ### Added methods
+	//
+	// - `users.Create`
+	//
+	// ### Removed methods
+	//
+	// - `users.Delete` **breaking**
+	//
+	// ### Changed methods
+	//
+	// #### `users.Get`
+	//
+	// - changed `results[0].address.Zipcode` from integer to string **breaking**
+	// - added `results[0].address.Address2` string
+	// - removed `results[0].age` integer **breaking**
+	// - added `required_headers.X-Api-Key` **breaking**
+	//
+	// #### `users.Search`
+	//
+	// - added `params[1]` integer **breaking**
+	// - added `results[1]` integer
+	// breaking: true
+}
+
+func ExampleRegistry_Schema() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("users.Rename", func(id int, name string) (ok bool, err error) { return }, jsonhandlerfunc.WithParamNames("id", "name"))
+
+	b, _ := json.Marshal(reg.Schema())
+	fmt.Println(string(b))
+	//Output:
+	// {"methods":[{"name":"users.Rename","params":[{"name":"id","type":{"kind":"integer"}},{"name":"name","type":{"kind":"string"}}],"results":[{"type":{"kind":"boolean"}}]}]}
+}
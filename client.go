@@ -0,0 +1,181 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Client calls funcs served by a Registry (or ToHandlerFunc handlers mounted under BaseURL),
+it posts params in the same {"params":[...]} envelope and decodes the {"results":[...]} back.
+*/
+type Client struct {
+	// BaseURL is joined with method names, like http://localhost:8080/api/
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is set to every request, like X-Api-Key or X-Client-Version
+	Header http.Header
+	// Compact requests the compact envelope, responses in both forms are decoded anyway.
+	Compact bool
+	// StreamMaxRetries is how many times CallStream reconnects, default is 3, -1 disables reconnecting.
+	StreamMaxRetries int
+	// StreamBackoff is the first wait before reconnecting, doubled every time, default is 500ms.
+	StreamBackoff time.Duration
+	// Schema of the server, when it's set the preconditions and the required headers of the methods are checked before sending requests,
+	// a request without the headers of WithRequiredHeaders fails with MissingHeadersError without being sent.
+	Schema *Schema
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: http.DefaultClient,
+		Header:     http.Header{},
+	}
+}
+
+/*
+RemoteError is returned by Client.Call when the func returned an error, or the server responded an error envelope.
+*/
+type RemoteError struct {
+	HTTPStatusCode int
+	Message        string
+	// Code is the ResponseError.Code of an ErrorCoder error, or the code of a structured error
+	Code string
+	// Value is the ResponseError.Value, or the details of a structured error
+	Value json.RawMessage
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) StatusCode() int {
+	return e.HTTPStatusCode
+}
+
+/*
+Call posts params to the method, and unmarshal the results except the last error into results pointers,
+the error result is returned as *RemoteError.
+*/
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, results ...interface{}) (err error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	var reqEnvelope interface{} = Req{Params: params}
+	if c.Compact {
+		reqEnvelope = compactReq{P: params}
+	}
+	body, err := json.Marshal(reqEnvelope)
+	if err != nil {
+		return
+	}
+
+	url := strings.TrimSuffix(c.BaseURL, "/") + "/" + method
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range c.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(PositionalResultsHeader, "1")
+	if c.Compact {
+		req.Header.Set(CompactEnvelopeHeader, "1")
+	}
+	if err = c.checkLocally(req, method); err != nil {
+		return
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNoContent {
+		// WithSuccessStatusCode(204) of a func that only returns an error
+		return nil
+	}
+
+	var resp struct {
+		Results []json.RawMessage `json:"results"`
+		R       []json.RawMessage `json:"r"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("jsonhandlerfunc: decode %s response with status %d error: %s", method, res.StatusCode, err)
+	}
+	if resp.Results == nil {
+		resp.Results = resp.R
+	}
+	return decodeResults(res.StatusCode, resp.Results, results)
+}
+
+// checkLocally fails the request to the method early if it doesn't pass the preconditions or misses the required headers in Schema.
+func (c *Client) checkLocally(req *http.Request, method string) error {
+	ms := c.Schema.method(method)
+	if ms == nil {
+		return nil
+	}
+	if err := checkPreconditionsLocally(req, ms.Preconditions); err != nil {
+		return err
+	}
+	return checkRequiredHeaders(req.Header, ms.RequiredHeaders)
+}
+
+func decodeResults(statusCode int, raws []json.RawMessage, results []interface{}) (err error) {
+	if len(raws) == 0 {
+		return fmt.Errorf("jsonhandlerfunc: empty results with status %d", statusCode)
+	}
+	errRaw := raws[len(raws)-1]
+	if len(errRaw) > 0 && string(errRaw) != "null" {
+		var respErr struct {
+			Error json.RawMessage `json:"error"`
+			Code  string          `json:"code"`
+			Value json.RawMessage `json:"value"`
+			E     string          `json:"e"`
+			C     string          `json:"c"`
+			V     json.RawMessage `json:"v"`
+		}
+		err = json.Unmarshal(errRaw, &respErr)
+		if err != nil {
+			return
+		}
+		remote := &RemoteError{HTTPStatusCode: statusCode, Code: respErr.Code, Value: respErr.Value}
+		var structured struct {
+			Code    string          `json:"code"`
+			Message string          `json:"message"`
+			Details json.RawMessage `json:"details"`
+		}
+		switch {
+		case json.Unmarshal(respErr.Error, &remote.Message) == nil:
+		case json.Unmarshal(respErr.Error, &structured) == nil:
+			remote.Message, remote.Code, remote.Value = structured.Message, structured.Code, structured.Details
+		default:
+			remote.Message, remote.Code, remote.Value = respErr.E, respErr.C, respErr.V
+		}
+		return remote
+	}
+
+	for i, result := range results {
+		if i >= len(raws)-1 {
+			break
+		}
+		err = json.Unmarshal(raws[i], result)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,577 @@
+package jsonhandlerfunc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theplant/jsonhandlerfunc"
+)
+
+// ### Client: call registered funcs with the same envelope
+func ExampleClient_Call() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+	reg.Register("fail", func(name string) (r string, err error) {
+		err = &complicatedError{ErrorCode: 8800, ErrorDeepReason: "It crashed."}
+		return
+	})
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	client := jsonhandlerfunc.NewClient(ts.URL + "/api/")
+
+	var r string
+	err := client.Call(context.Background(), "GreetingService.Hello", []interface{}{"Gates"}, &r)
+	fmt.Println(r, err)
+
+	err = client.Call(context.Background(), "fail", []interface{}{"Gates"}, &r)
+	remoteErr := err.(*jsonhandlerfunc.RemoteError)
+	fmt.Println(remoteErr.StatusCode(), remoteErr.Message, string(remoteErr.Value))
+
+	compactReg := jsonhandlerfunc.NewRegistry(&jsonhandlerfunc.Config{AllowCompactEnvelope: true})
+	compactReg.RegisterInterface((*GreetingService)(nil), greetingService{})
+	compactTs := httptest.NewServer(compactReg)
+	defer compactTs.Close()
+
+	compactClient := jsonhandlerfunc.NewClient(compactTs.URL)
+	compactClient.Compact = true
+	err = compactClient.Call(context.Background(), "GreetingService.Bye", []interface{}{"Gates"}, &r)
+	fmt.Println(r, err)
+	//Output:
+	// Hello Gates <nil>
+	// 200 It crashed. {"ErrorCode":8800,"ErrorDeepReason":"It crashed."}
+	// Bye Gates <nil>
+}
+
+// ### Client: the requests without the required headers in Schema fail without being sent
+func ExampleClient_Call_requiredHeaders() {
+	calls := 0
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("secret", func(name string) (r string, err error) {
+		calls++
+		return "secret of " + name, nil
+	}, jsonhandlerfunc.WithRequiredHeaders("X-Api-Key"))
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	client := jsonhandlerfunc.NewClient(ts.URL)
+	client.Schema = reg.Schema()
+
+	var r string
+	err := client.Call(context.Background(), "secret", []interface{}{"Gates"}, &r)
+	_, missing := err.(*jsonhandlerfunc.MissingHeadersError)
+	fmt.Println(err, missing, calls)
+
+	client.Header.Set("X-Api-Key", "key")
+	err = client.Call(context.Background(), "secret", []interface{}{"Gates"}, &r)
+	fmt.Println(r, err, calls)
+	//Output:
+	// missing required headers: X-Api-Key true 0
+	// secret of Gates <nil> 1
+}
+
+// ### Client: generate a client that implements the same Go interface
+// ### Client.Bind: a typed caller from a func signature, without generating code
+func ExampleClient_Bind() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("add", func(a, b int) (r int, err error) {
+		r = a + b
+		return
+	})
+	reg.Register("div", func(a, b int) (r int, err error) {
+		if b == 0 {
+			err = fmt.Errorf("divided by zero")
+			return
+		}
+		r = a / b
+		return
+	})
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	client := jsonhandlerfunc.NewClient(ts.URL)
+	var add func(ctx context.Context, a, b int) (int, error)
+	var div func(a, b int) (int, error)
+	client.Bind("add", &add)
+	client.Bind("div", &div)
+
+	fmt.Println(add(context.Background(), 1, 2))
+	fmt.Println(div(6, 3))
+	fmt.Println(div(6, 0))
+	//Output:
+	// 3 <nil>
+	// 2 <nil>
+	// 0 divided by zero
+}
+
+func ExampleGenerateClient() {
+	err := jsonhandlerfunc.GenerateClient(os.Stdout, "github.com/theplant/jsonhandlerfunc/greetingclient", (*GreetingService)(nil))
+	if err != nil {
+		panic(err)
+	}
+	//Output:
+	// // Code generated by jsonhandlerfunc.GenerateClient. DO NOT EDIT.
+	//
+	// package greetingclient
+	//
+	// import (
+	// 	"context"
+	// 	"github.com/theplant/jsonhandlerfunc"
+	// 	"github.com/theplant/jsonhandlerfunc_test"
+	// )
+	//
+	// // GreetingServiceClient implements GreetingService by calling the remote funcs with jsonhandlerfunc.Client
+	// type GreetingServiceClient struct {
+	// 	Client *jsonhandlerfunc.Client
+	// }
+	//
+	// var _ jsonhandlerfunc_test.GreetingService = (*GreetingServiceClient)(nil)
+	//
+	// func NewGreetingServiceClient(client *jsonhandlerfunc.Client) *GreetingServiceClient {
+	// 	return &GreetingServiceClient{Client: client}
+	// }
+	//
+	// func (c *GreetingServiceClient) Bye(a0 string) (r0 string, err error) {
+	// 	err = c.Client.Call(context.Background(), "GreetingService.Bye", []interface{}{a0}, &r0)
+	// 	return
+	// }
+	//
+	// func (c *GreetingServiceClient) Hello(ctx context.Context, a0 string) (r0 string, err error) {
+	// 	err = c.Client.Call(ctx, "GreetingService.Hello", []interface{}{a0}, &r0)
+	// 	return
+	// }
+}
+
+type PeopleDirectory interface {
+	ListPeople(ctx context.Context, team string, lo *jsonhandlerfunc.ListOptions) (page *jsonhandlerfunc.Page[string], err error)
+}
+
+// ### Iterate: the items of all the pages of a func returning Page, following the cursors
+func ExampleIterate() {
+	people := []string{"ann", "bob", "cid", "dan", "eve"}
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("ListPeople", func(ctx context.Context, team string, lo *jsonhandlerfunc.ListOptions) (page *jsonhandlerfunc.Page[string], err error) {
+		fmt.Printf("list %s cursor %q limit %d sort %v\n", team, lo.Cursor, lo.Limit, lo.Sort)
+		start, _ := strconv.Atoi(lo.Cursor)
+		end := start + lo.Limit
+		if end > len(people) {
+			end = len(people)
+		}
+		page = &jsonhandlerfunc.Page[string]{Items: people[start:end]}
+		if end < len(people) {
+			page.NextCursor = strconv.Itoa(end)
+		}
+		return
+	}, jsonhandlerfunc.WithListOptions(jsonhandlerfunc.ListPolicy{Sortable: []string{"name"}, DefaultLimit: 10, MaxLimit: 10}))
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	client := jsonhandlerfunc.NewClient(ts.URL)
+	lo := &jsonhandlerfunc.ListOptions{Limit: 2, Sort: []jsonhandlerfunc.SortField{{Field: "name", Desc: true}}}
+	err := jsonhandlerfunc.Iterate(context.Background(), client, "ListPeople", []interface{}{"core", lo}, func(name string) error {
+		fmt.Println(name)
+		return nil
+	})
+	fmt.Println(err, lo.Cursor == "")
+
+	jsonhandlerfunc.GenerateClient(os.Stdout, "github.com/theplant/jsonhandlerfunc/peopleclient", (*PeopleDirectory)(nil))
+	//Output:
+	// list core cursor "" limit 2 sort [{name true}]
+	// ann
+	// bob
+	// list core cursor "2" limit 2 sort [{name true}]
+	// cid
+	// dan
+	// list core cursor "4" limit 2 sort [{name true}]
+	// eve
+	// <nil> true
+	// // Code generated by jsonhandlerfunc.GenerateClient. DO NOT EDIT.
+	//
+	// package peopleclient
+	//
+	// import (
+	// 	"context"
+	// 	"github.com/theplant/jsonhandlerfunc"
+	// 	"github.com/theplant/jsonhandlerfunc_test"
+	// )
+	//
+	// // PeopleDirectoryClient implements PeopleDirectory by calling the remote funcs with jsonhandlerfunc.Client
+	// type PeopleDirectoryClient struct {
+	// 	Client *jsonhandlerfunc.Client
+	// }
+	//
+	// var _ jsonhandlerfunc_test.PeopleDirectory = (*PeopleDirectoryClient)(nil)
+	//
+	// func NewPeopleDirectoryClient(client *jsonhandlerfunc.Client) *PeopleDirectoryClient {
+	// 	return &PeopleDirectoryClient{Client: client}
+	// }
+	//
+	// func (c *PeopleDirectoryClient) ListPeople(ctx context.Context, a0 string, a1 *jsonhandlerfunc.ListOptions) (r0 *jsonhandlerfunc.Page[string], err error) {
+	// 	err = c.Client.Call(ctx, "PeopleDirectory.ListPeople", []interface{}{a0, a1}, &r0)
+	// 	return
+	// }
+	//
+	// // IterateListPeople calls onItem with the items of all the pages of ListPeople
+	// func (c *PeopleDirectoryClient) IterateListPeople(ctx context.Context, a0 string, a1 *jsonhandlerfunc.ListOptions, onItem func(item string) error) (err error) {
+	// 	return jsonhandlerfunc.Iterate(ctx, c.Client, "PeopleDirectory.ListPeople", []interface{}{a0, a1}, onItem)
+	// }
+}
+
+// ### GenerateStaticHandlers: handlers of annotated funcs without reflection
+func ExampleGenerateStaticHandlers() {
+	src := `package users
+
+import (
+	"context"
+
+	"github.com/you/app/models"
+)
+
+//jsonhandlerfunc:gen
+func FindUser(ctx context.Context, id int) (u *models.User, err error) {
+	return
+}
+
+func notAnnotated() {}
+`
+	jsonhandlerfunc.GenerateStaticHandlers(os.Stdout, map[string][]byte{"users.go": []byte(src)})
+	//Output:
+	// // Code generated by jsonhandlerfunc.GenerateStaticHandlers. DO NOT EDIT.
+	//
+	// package users
+	//
+	// import (
+	// 	"net/http"
+	//
+	// 	"github.com/theplant/jsonhandlerfunc"
+	// 	"github.com/you/app/models"
+	// )
+	//
+	// // FindUserHandler serves FindUser with the envelope of jsonhandlerfunc, without reflection.
+	// func FindUserHandler(cfg *jsonhandlerfunc.Config) http.HandlerFunc {
+	// 	return func(w http.ResponseWriter, r *http.Request) {
+	// 		var (
+	// 			p1  int
+	// 			r0  *models.User
+	// 			err error
+	// 		)
+	// 		if err = jsonhandlerfunc.DecodeParams(r, &p1); err == nil {
+	// 			r0, err = FindUser(r.Context(), p1)
+	// 		}
+	// 		cfg.WriteResults(w, err, r0)
+	// 	}
+	// }
+}
+
+var errUserNotFound = errors.New("user not found")
+
+func findUser(ctx context.Context, id int) (name string, err error) {
+	if id != 1 {
+		return "", errUserNotFound
+	}
+	return "felix", nil
+}
+
+// findUserHandler is the handler GenerateStaticHandlers writes for findUser
+func findUserHandler(cfg *jsonhandlerfunc.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			p1  int
+			r0  string
+			err error
+		)
+		if err = jsonhandlerfunc.DecodeParams(r, &p1); err == nil {
+			r0, err = findUser(r.Context(), p1)
+		}
+		cfg.WriteResults(w, err, r0)
+	}
+}
+
+// ### Config.WriteResults: the generated handlers respond the same status codes as ToHandlerFunc with the Config
+func ExampleConfig_WriteResults() {
+	cfg := &jsonhandlerfunc.Config{
+		SuccessStatusCode: http.StatusAccepted,
+		ErrToStatusCode: func(err error) int {
+			if errors.Is(err, errUserNotFound) {
+				return http.StatusNotFound
+			}
+			return 0
+		},
+	}
+	for _, hf := range []http.HandlerFunc{findUserHandler(cfg), cfg.ToHandlerFunc(findUser)} {
+		for _, body := range []string{`{"params": [1]}`, `{"params": [2]}`} {
+			w := httptest.NewRecorder()
+			hf(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+			fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+		}
+	}
+	//Output:
+	// 202 {"results":["felix",null]}
+	// 404 {"results":["",{"error":"user not found","value":{}}]}
+	// 202 {"results":["felix",null]}
+	// 404 {"results":["",{"error":"user not found","value":{}}]}
+}
+
+// ### GenerateFromOpenAPI: func stubs and their wiring from an OpenAPI document
+func ExampleGenerateFromOpenAPI() {
+	doc := `{
+  "openapi": "3.0.3",
+  "info": {"title": "Users", "version": "1.0"},
+  "paths": {
+    "/users": {
+      "post": {
+        "operationId": "createUser",
+        "summary": "creates a user",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewUser"}}}},
+        "responses": {
+          "201": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "409": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Problem"}}}}
+        }
+      }
+    },
+    "/users/{user_id}": {
+      "parameters": [{"name": "user_id", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}}],
+      "get": {
+        "operationId": "get_user",
+        "parameters": [{"name": "expand", "in": "query", "schema": {"type": "array", "items": {"type": "string"}}}],
+        "responses": {
+          "200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "404": {"description": "not found"}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "NewUser": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string"},
+          "role": {"type": "string", "enum": ["admin", "read-only"]}
+        }
+      },
+      "User": {
+        "allOf": [
+          {"$ref": "#/components/schemas/NewUser"},
+          {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer", "format": "int64"}, "created_at": {"type": "string", "format": "date-time", "nullable": true}}}
+        ]
+      },
+      "Problem": {
+        "type": "object",
+        "properties": {"code": {"type": "string", "enum": ["email_taken", "name_taken"]}}
+      }
+    }
+  }
+}`
+	err := jsonhandlerfunc.GenerateFromOpenAPI(os.Stdout, "users", []byte(doc))
+	fmt.Println(err)
+	//Output:
+	// // Code generated by jsonhandlerfunc.GenerateFromOpenAPI from Users 1.0, implement the funcs and keep the rest in sync with the document.
+	//
+	// package users
+	//
+	// import (
+	// 	"context"
+	// 	"errors"
+	// 	"net/http"
+	// 	"time"
+	//
+	// 	"github.com/theplant/jsonhandlerfunc"
+	// )
+	//
+	// // Handle registers the handlers of the operations of the document to mux
+	// func Handle(mux *http.ServeMux, cfg *jsonhandlerfunc.Config) {
+	// 	mux.Handle("POST /users", cfg.ToHandlerFunc(CreateUser))
+	// 	mux.Handle("GET /users/{user_id}", cfg.ToHandlerFunc(GetUser, jsonhandlerfunc.WithQueryParams("expand"), jsonhandlerfunc.WithPathParams("user_id")))
+	// }
+	//
+	// // CreateUser creates a user
+	// // It returns the Error of CodeEmailTaken, CodeNameTaken.
+	// func CreateUser(ctx context.Context, params NewUser) (result *User, err error) {
+	// 	err = jsonhandlerfunc.NewStatusCodeError(http.StatusNotImplemented, errors.New("CreateUser is not implemented"))
+	// 	return
+	// }
+	//
+	// // GetUser handles GET /users/{user_id}
+	// // It returns the Error of CodeNotFound.
+	// func GetUser(ctx context.Context, params GetUserParams) (result *User, err error) {
+	// 	err = jsonhandlerfunc.NewStatusCodeError(http.StatusNotImplemented, errors.New("GetUser is not implemented"))
+	// 	return
+	// }
+	//
+	// type NewUserRole string
+	//
+	// const (
+	// 	NewUserRoleAdmin    NewUserRole = "admin"
+	// 	NewUserRoleReadOnly NewUserRole = "read-only"
+	// )
+	//
+	// type NewUser struct {
+	// 	Name string      `json:"name"`
+	// 	Role NewUserRole `json:"role,omitempty"`
+	// }
+	//
+	// type ProblemCode string
+	//
+	// const (
+	// 	ProblemCodeEmailTaken ProblemCode = "email_taken"
+	// 	ProblemCodeNameTaken  ProblemCode = "name_taken"
+	// )
+	//
+	// type Problem struct {
+	// 	Code ProblemCode `json:"code,omitempty"`
+	// }
+	//
+	// type User struct {
+	// 	NewUser
+	// 	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// 	ID        int64      `json:"id"`
+	// }
+	//
+	// // GetUserParams are the params of GetUser
+	// type GetUserParams struct {
+	// 	UserID int64    `json:"user_id"`
+	// 	Expand []string `json:"expand,omitempty"`
+	// }
+	//
+	// // The codes of the error responses of the document
+	// const (
+	// 	CodeEmailTaken = "email_taken"
+	// 	CodeNameTaken  = "name_taken"
+	// 	CodeNotFound   = "not_found"
+	// )
+	//
+	// var errorStatusCodes = map[string]int{
+	// 	CodeEmailTaken: 409,
+	// 	CodeNameTaken:  409,
+	// 	CodeNotFound:   404,
+	// }
+	//
+	// // Error is an error response of the document, responded with the status code of its Code, default is 500.
+	// type Error struct {
+	// 	Code    string `json:"code"`
+	// 	Message string `json:"message,omitempty"`
+	// }
+	//
+	// func (e *Error) Error() string {
+	// 	if e.Message != "" {
+	// 		return e.Code + ": " + e.Message
+	// 	}
+	// 	return e.Code
+	// }
+	//
+	// func (e *Error) StatusCode() int {
+	// 	if code, ok := errorStatusCodes[e.Code]; ok {
+	// 		return code
+	// 	}
+	// 	return http.StatusInternalServerError
+	// }
+	// <nil>
+}
+
+// ### Client: CallStream reads SSE items, and reconnects with Last-Event-ID when the connection drops
+func ExampleClient_CallStream() {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.Header.Get("Last-Event-ID") == "" {
+			// drops after the first item
+			fmt.Fprint(w, "id: 1\ndata: {\"n\":1}\n\n")
+			return
+		}
+		fmt.Printf("resume after %s\n", r.Header.Get("Last-Event-ID"))
+		fmt.Fprint(w, "id: 2\ndata: {\"n\":2}\n\nevent: end\n\n")
+	}))
+	defer ts.Close()
+
+	client := jsonhandlerfunc.NewClient(ts.URL)
+	client.StreamBackoff = time.Millisecond
+	err := client.CallStream(context.Background(), "numbers", nil, func(item json.RawMessage) error {
+		fmt.Println(string(item))
+		return nil
+	})
+	fmt.Println(err)
+	//Output:
+	// {"n":1}
+	// resume after 1
+	// {"n":2}
+	// <nil>
+}
+
+type tsUser struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email,omitempty"`
+	Friends []*tsUser `json:"friends"`
+}
+
+// ### GenerateTS: TypeScript interfaces and a typed client of the registered funcs
+func ExampleGenerateTS() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("getUser", func(id int64) (r *tsUser, err error) {
+		return
+	}, jsonhandlerfunc.WithParamNames("id"))
+	reg.Register("rename", func(id int64, name string) (err error) {
+		return
+	}, jsonhandlerfunc.WithRequiredHeaders("X-Api-Key"))
+
+	err := jsonhandlerfunc.GenerateTS(os.Stdout, reg.Schema())
+	if err != nil {
+		panic(err)
+	}
+	//Output:
+	// // Code generated by jsonhandlerfunc.GenerateTS. DO NOT EDIT.
+	//
+	// export interface tsUser {
+	// 	id: number;
+	// 	name: string;
+	// 	email?: string;
+	// 	friends: (tsUser | null)[];
+	// }
+	//
+	// export class JSONHandlerError extends Error {
+	// 	constructor(message: string, public status: number, public value: unknown) {
+	// 		super(message);
+	// 	}
+	// }
+	//
+	// async function call(baseURL: string, init: RequestInit | undefined, method: string, params: unknown[], sections?: object, requiredHeaders?: string[]): Promise<unknown[]> {
+	// 	const headers = new Headers(init?.headers);
+	// 	const missing = (requiredHeaders ?? []).filter((name) => !headers.get(name));
+	// 	if (missing.length > 0) {
+	// 		throw new JSONHandlerError("missing required headers: " + missing.join(", "), 400, { code: "missing_headers", headers: missing });
+	// 	}
+	// 	headers.set("Content-Type", "application/json");
+	// 	headers.set("X-Jsonhf-Positional-Results", "1");
+	// 	const res = await fetch(baseURL.replace(/\/$/, "") + "/" + method, {
+	// 		...init,
+	// 		method: "POST",
+	// 		headers,
+	// 		body: JSON.stringify({ ...sections, params }),
+	// 	});
+	// 	const body = await res.json();
+	// 	const results: unknown[] = body.results;
+	// 	const err = results[results.length - 1] as { error: string; value: unknown } | null;
+	// 	if (err) {
+	// 		throw new JSONHandlerError(err.error, res.status, err.value);
+	// 	}
+	// 	return results.slice(0, -1);
+	// }
+	//
+	// export function createClient(baseURL: string, init?: RequestInit) {
+	// 	return {
+	// 		getUser: (id: number): Promise<tsUser | null> =>
+	// 			call(baseURL, init, "getUser", [id]).then((r) => r[0] as tsUser | null),
+	// 		rename: (p0: number, p1: string): Promise<void> =>
+	// 			call(baseURL, init, "rename", [p0, p1], undefined, ["X-Api-Key"]).then(() => undefined),
+	// 	};
+	// }
+}
@@ -0,0 +1,67 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+/*
+Bind sets the func fptr points to as a typed caller of the method, it marshals the args into the params envelope
+and unmarshals the results back into the return values, the last of which must be error.
+Declare the func with the params the client sends, without the injected ones, and an optional leading context.Context:
+
+	var getUser func(ctx context.Context, id int) (*User, error)
+	client.Bind("getUser", &getUser)
+	user, err := getUser(ctx, 1)
+
+Bind panics if fptr is not a pointer to such a func, it's a mistake of the code rather than of the request.
+*/
+func (c *Client) Bind(method string, fptr interface{}) {
+	pv := reflect.ValueOf(fptr)
+	if pv.Kind() != reflect.Ptr || pv.Elem().Kind() != reflect.Func {
+		panic(fmt.Sprintf("jsonhandlerfunc: Bind %s needs a pointer to func, got %T", method, fptr))
+	}
+	ft := pv.Elem().Type()
+	if ft.NumOut() == 0 || !isError(ft.Out(ft.NumOut()-1)) {
+		panic(fmt.Sprintf("jsonhandlerfunc: Bind %s func %s's last return value must be error", method, ft))
+	}
+	hasCtx := ft.NumIn() > 0 && ft.In(0) == contextType
+
+	pv.Elem().Set(reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if hasCtx {
+			if argCtx, ok := args[0].Interface().(context.Context); ok {
+				ctx = argCtx
+			}
+			args = args[1:]
+		}
+		params := []interface{}{}
+		for i, arg := range args {
+			if ft.IsVariadic() && i == len(args)-1 {
+				for j := 0; j < arg.Len(); j++ {
+					params = append(params, arg.Index(j).Interface())
+				}
+				continue
+			}
+			params = append(params, arg.Interface())
+		}
+
+		outs := make([]reflect.Value, ft.NumOut())
+		var results []interface{}
+		for i := 0; i < ft.NumOut()-1; i++ {
+			outs[i] = reflect.New(ft.Out(i))
+			results = append(results, outs[i].Interface())
+		}
+		err := c.Call(ctx, method, params, results...)
+		for i := 0; i < ft.NumOut()-1; i++ {
+			outs[i] = outs[i].Elem()
+		}
+		errVal := reflect.Zero(ft.Out(ft.NumOut() - 1))
+		if err != nil {
+			errVal = reflect.ValueOf(err)
+		}
+		outs[ft.NumOut()-1] = errVal
+		return outs
+	}))
+}
@@ -0,0 +1,233 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const packageImportPath = "github.com/theplant/jsonhandlerfunc"
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+/*
+GenerateClient writes Go source of a <Interface>Client struct that implements the interface iface points to,
+every method calls the same named method registered by RegisterInterface through Client.Call,
+so in process and remote implementations can be swapped behind the interface.
+Set the Schema of the Client to fail the calls that miss the headers of WithRequiredHeaders before sending them.
+
+pkgPath is the import path of the package the source is generated into, like:
+
+	jsonhandlerfunc.GenerateClient(f, "github.com/you/app/userclient", (*users.UserService)(nil))
+*/
+func GenerateClient(w io.Writer, pkgPath string, iface interface{}) (err error) {
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Ptr || it.Elem().Kind() != reflect.Interface {
+		return fmt.Errorf("iface must be a pointer to interface, like (*UserService)(nil)")
+	}
+	it = it.Elem()
+
+	tn := newGoTypeNamer(pkgPath)
+	tn.imports["context"] = "context"
+	tn.imports[packageImportPath] = "jsonhandlerfunc"
+
+	clientName := it.Name() + "Client"
+	body := &bytes.Buffer{}
+	fmt.Fprintf(body, "// %s implements %s by calling the remote funcs with jsonhandlerfunc.Client\n", clientName, it.Name())
+	fmt.Fprintf(body, "type %s struct {\n\tClient *jsonhandlerfunc.Client\n}\n\n", clientName)
+	fmt.Fprintf(body, "var _ %s = (*%s)(nil)\n\n", tn.name(it), clientName)
+	fmt.Fprintf(body, "func New%s(client *jsonhandlerfunc.Client) *%s {\n\treturn &%s{Client: client}\n}\n", clientName, clientName, clientName)
+
+	for i := 0; i < it.NumMethod(); i++ {
+		m := it.Method(i)
+		err = writeClientMethod(body, tn, clientName, interfaceMethodName(it, m.Name), m)
+		if err != nil {
+			return
+		}
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by jsonhandlerfunc.GenerateClient. DO NOT EDIT.\n\npackage %s\n\n", path.Base(pkgPath))
+	tn.writeImports(src)
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return
+	}
+	_, err = w.Write(formatted)
+	return
+}
+
+func writeClientMethod(w io.Writer, tn *goTypeNamer, clientName string, methodName string, m reflect.Method) (err error) {
+	mt := m.Type
+	if mt.NumOut() == 0 || !isError(mt.Out(mt.NumOut()-1)) {
+		return fmt.Errorf("method %s's last return value must be error", m.Name)
+	}
+
+	var ins, params []string
+	ctxArg := "context.Background()"
+	for i := 0; i < mt.NumIn(); i++ {
+		if i == 0 && mt.In(i) == contextType {
+			ctxArg = "ctx"
+			ins = append(ins, "ctx context.Context")
+			continue
+		}
+		argName := fmt.Sprintf("a%d", len(params))
+		typeName := tn.name(mt.In(i))
+		if mt.IsVariadic() && i == mt.NumIn()-1 {
+			typeName = "..." + tn.name(mt.In(i).Elem())
+		}
+		ins = append(ins, argName+" "+typeName)
+		params = append(params, argName)
+	}
+
+	var outs, results []string
+	for i := 0; i < mt.NumOut()-1; i++ {
+		outs = append(outs, fmt.Sprintf("r%d %s", i, tn.name(mt.Out(i))))
+		results = append(results, fmt.Sprintf(", &r%d", i))
+	}
+	outs = append(outs, "err error")
+
+	fmt.Fprintf(w, "\nfunc (c *%s) %s(%s) (%s) {\n", clientName, m.Name, strings.Join(ins, ", "), strings.Join(outs, ", "))
+	if mt.IsVariadic() {
+		// the variadic args are flattened in the params
+		last := params[len(params)-1]
+		fmt.Fprintf(w, "\tparams := []interface{}{%s}\n", strings.Join(params[:len(params)-1], ", "))
+		fmt.Fprintf(w, "\tfor _, p := range %s {\n\t\tparams = append(params, p)\n\t}\n", last)
+		fmt.Fprintf(w, "\terr = c.Client.Call(%s, %q, params%s)\n", ctxArg, methodName, strings.Join(results, ""))
+	} else {
+		fmt.Fprintf(w, "\terr = c.Client.Call(%s, %q, []interface{}{%s}%s)\n", ctxArg, methodName, strings.Join(params, ", "), strings.Join(results, ""))
+	}
+	fmt.Fprintf(w, "\treturn\n}\n")
+	writeClientIterate(w, tn, clientName, methodName, m)
+	return
+}
+
+// writeClientIterate writes Iterate<Method> with Iterate for a method that takes ListOptions and returns a Page.
+func writeClientIterate(w io.Writer, tn *goTypeNamer, clientName string, methodName string, m reflect.Method) {
+	mt := m.Type
+	if mt.NumOut() != 2 || mt.IsVariadic() || pageItemType(mt.Out(0)) == nil {
+		return
+	}
+	ins := []string{"ctx context.Context"}
+	var params []string
+	hasListOptions := false
+	for i := 0; i < mt.NumIn(); i++ {
+		if i == 0 && mt.In(i) == contextType {
+			continue
+		}
+		if mt.In(i) == listOptionsType || mt.In(i) == reflect.PtrTo(listOptionsType) {
+			hasListOptions = true
+		}
+		argName := fmt.Sprintf("a%d", len(params))
+		ins = append(ins, argName+" "+tn.name(mt.In(i)))
+		params = append(params, argName)
+	}
+	if !hasListOptions {
+		return
+	}
+	ins = append(ins, "onItem func(item "+tn.name(pageItemType(mt.Out(0)))+") error")
+	fmt.Fprintf(w, "\n// Iterate%s calls onItem with the items of all the pages of %s\n", m.Name, m.Name)
+	fmt.Fprintf(w, "func (c *%s) Iterate%s(%s) (err error) {\n", clientName, m.Name, strings.Join(ins, ", "))
+	fmt.Fprintf(w, "\treturn jsonhandlerfunc.Iterate(ctx, c.Client, %q, []interface{}{%s}, onItem)\n}\n", methodName, strings.Join(params, ", "))
+}
+
+// goTypeNamer writes Go type expressions for reflect types, and collects the imports they need.
+type goTypeNamer struct {
+	pkgPath string
+	imports map[string]string
+}
+
+func newGoTypeNamer(pkgPath string) *goTypeNamer {
+	return &goTypeNamer{pkgPath: pkgPath, imports: map[string]string{}}
+}
+
+func (tn *goTypeNamer) name(t reflect.Type) string {
+	if item := pageItemType(t); item != nil && t.Kind() == reflect.Struct {
+		return tn.importName(t) + ".Page[" + tn.name(item) + "]"
+	}
+	if t.Name() != "" {
+		if t.PkgPath() == "" || t.PkgPath() == tn.pkgPath {
+			return t.Name()
+		}
+		return tn.importName(t) + "." + t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + tn.name(t.Elem())
+	case reflect.Slice:
+		return "[]" + tn.name(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), tn.name(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", tn.name(t.Key()), tn.name(t.Elem()))
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			field := f.Name + " " + tn.name(f.Type)
+			if f.Anonymous {
+				field = tn.name(f.Type)
+			}
+			if f.Tag != "" {
+				field += fmt.Sprintf(" %q", string(f.Tag))
+			}
+			fields = append(fields, field)
+		}
+		return "struct{ " + strings.Join(fields, "; ") + " }"
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}"
+		}
+	}
+	panic(fmt.Sprintf("jsonhandlerfunc: can not generate type %s", t))
+}
+
+func (tn *goTypeNamer) importName(t reflect.Type) string {
+	if name, ok := tn.imports[t.PkgPath()]; ok {
+		return name
+	}
+	base := strings.SplitN(t.String(), ".", 2)[0]
+	name := base
+	for i := 2; tn.nameTaken(name); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	tn.imports[t.PkgPath()] = name
+	return name
+}
+
+func (tn *goTypeNamer) nameTaken(name string) bool {
+	for _, n := range tn.imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (tn *goTypeNamer) writeImports(w io.Writer) {
+	var paths []string
+	for p := range tn.imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintf(w, "import (\n")
+	for _, p := range paths {
+		name := tn.imports[p]
+		if name == path.Base(p) {
+			fmt.Fprintf(w, "\t%q\n", p)
+			continue
+		}
+		fmt.Fprintf(w, "\t%s %q\n", name, p)
+	}
+	fmt.Fprintf(w, ")\n\n")
+}
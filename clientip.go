@@ -0,0 +1,101 @@
+package jsonhandlerfunc
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP is the real IP of the client injected by ClientIPInjector.
+type ClientIP string
+
+/*
+ClientIPInjector returns an injector of the ClientIP of the request, resolved from the Forwarded header,
+or X-Forwarded-For if there is no Forwarded header, when the peer is in one of trustedCIDRs, like the
+load balancers and reverse proxies in front of the service:
+
+	hf := jsonhandlerfunc.ToHandlerFunc(f, jsonhandlerfunc.ClientIPInjector("10.0.0.0/8"))
+
+The forwarded addresses are walked from the right, the first one not in trustedCIDRs is the client,
+so that a client can't spoof its IP by sending the headers itself. Without trustedCIDRs the peer is
+the client. Config.CheckQuota, Config.OnUsage and WithAuditChain get it with RequestState.ClientIP.
+It panics if a CIDR is invalid.
+*/
+func ClientIPInjector(trustedCIDRs ...string) func(w http.ResponseWriter, r *http.Request) (ip ClientIP, err error) {
+	var trusted []*net.IPNet
+	for _, cidr := range trustedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("invalid trusted CIDR " + cidr + ": " + err.Error())
+		}
+		trusted = append(trusted, ipNet)
+	}
+
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, ipNet := range trusted {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) (ip ClientIP, err error) {
+		peer := stripPort(r.RemoteAddr)
+		ip = ClientIP(peer)
+		if !isTrusted(peer) {
+			return
+		}
+		forwarded := forwardedFor(r.Header)
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip = ClientIP(forwarded[i])
+			if !isTrusted(forwarded[i]) {
+				return
+			}
+		}
+		return
+	}
+}
+
+// ClientIP returns the ClientIP injected by ClientIPInjector, empty if there isn't one.
+func (s *RequestState) ClientIP() (ip ClientIP) {
+	if s != nil {
+		s.Lookup(&ip)
+	}
+	return
+}
+
+// forwardedFor returns the addresses of the Forwarded header, or X-Forwarded-For, from the client to the last proxy.
+func forwardedFor(header http.Header) (addrs []string) {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		for _, elem := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					addrs = append(addrs, stripPort(strings.Trim(kv[1], `"`)))
+				}
+			}
+		}
+		return
+	}
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, stripPort(addr))
+			}
+		}
+	}
+	return
+}
+
+// stripPort strips the port and the brackets of IPv6 from addr, like "[::1]:80" or "1.2.3.4:80".
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
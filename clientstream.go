@@ -0,0 +1,196 @@
+package jsonhandlerfunc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Streaming responses are Server-Sent Events (text/event-stream) or newline delimited json (application/x-ndjson).
+
+SSE items are "data:" events with an "id:" to resume from with Last-Event-ID,
+the stream is finished with an "end" event, an "error" event carries the ResponseError,
+and the "progress" events are the Progress of ReportProgress.
+NDJSON items are one json per line, and the stream is finished at the end of the body.
+*/
+const (
+	SSEContentType    = "text/event-stream"
+	NDJSONContentType = "application/x-ndjson"
+
+	StreamEndEvent      = "end"
+	StreamErrorEvent    = "error"
+	StreamProgressEvent = "progress"
+)
+
+const (
+	defaultStreamMaxRetries = 3
+	defaultStreamBackoff    = 500 * time.Millisecond
+	maxStreamBackoff        = 30 * time.Second
+)
+
+/*
+CallStream posts params to a streaming method, and calls onItem with every item,
+when the SSE connection drops before the end event, it reconnects with Last-Event-ID and exponential backoff,
+up to Client.StreamMaxRetries times. Returning an error from onItem stops the stream with that error.
+*/
+func (c *Client) CallStream(ctx context.Context, method string, params []interface{}, onItem func(item json.RawMessage) error) (err error) {
+	backoff := c.StreamBackoff
+	if backoff <= 0 {
+		backoff = defaultStreamBackoff
+	}
+	maxRetries := c.StreamMaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultStreamMaxRetries
+	}
+
+	var lastEventID string
+	for retries := 0; ; retries++ {
+		var done bool
+		done, err = c.stream(ctx, method, params, &lastEventID, onItem)
+		if done || retries >= maxRetries || ctx.Err() != nil {
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > maxStreamBackoff {
+			backoff = maxStreamBackoff
+		}
+	}
+}
+
+// stream reads one connection, done is false when it should reconnect.
+func (c *Client) stream(ctx context.Context, method string, params []interface{}, lastEventID *string, onItem func(item json.RawMessage) error) (done bool, err error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(Req{Params: params})
+	if err != nil {
+		return true, err
+	}
+	url := strings.TrimSuffix(c.BaseURL, "/") + "/" + method
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range c.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", SSEContentType+", "+NDJSONContentType)
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	if err = c.checkLocally(req, method); err != nil {
+		return true, err
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch mediaType {
+	case SSEContentType:
+		done, err = readSSE(res.Body, lastEventID, onItem)
+	case NDJSONContentType:
+		done, err = readNDJSON(res.Body, onItem)
+	default:
+		// not a stream, like an error envelope responded before streaming
+		var resp struct {
+			Results []json.RawMessage `json:"results"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&resp)
+		if err != nil {
+			return true, fmt.Errorf("jsonhandlerfunc: decode %s response with status %d error: %s", method, res.StatusCode, err)
+		}
+		return true, decodeResults(res.StatusCode, resp.Results, nil)
+	}
+	return
+}
+
+func readSSE(r io.Reader, lastEventID *string, onItem func(item json.RawMessage) error) (done bool, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event, id string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value := line, ""
+			if i := strings.Index(line, ":"); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+			switch field {
+			case "event":
+				event = value
+			case "id":
+				id = value
+			case "data":
+				data = append(data, value)
+			}
+			continue
+		}
+
+		switch event {
+		case StreamEndEvent:
+			return true, nil
+		case StreamErrorEvent:
+			return true, decodeResults(http.StatusOK, []json.RawMessage{json.RawMessage(strings.Join(data, "\n"))}, nil)
+		case "", "message":
+			if len(data) > 0 {
+				if err = onItem(json.RawMessage(strings.Join(data, "\n"))); err != nil {
+					return true, err
+				}
+			}
+		}
+		if id != "" {
+			*lastEventID = id
+		}
+		event, id, data = "", "", nil
+	}
+	err = scanner.Err()
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return false, err
+}
+
+func readNDJSON(r io.Reader, onItem func(item json.RawMessage) error) (done bool, err error) {
+	dec := json.NewDecoder(r)
+	for {
+		var item json.RawMessage
+		err = dec.Decode(&item)
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		if err = onItem(item); err != nil {
+			return true, err
+		}
+	}
+}
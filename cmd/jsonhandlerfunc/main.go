@@ -0,0 +1,155 @@
+/*
+Command jsonhandlerfunc writes the static handlers of the funcs annotated with //jsonhandlerfunc:gen,
+see jsonhandlerfunc.GenerateStaticHandlers:
+
+	jsonhandlerfunc gen ./...
+
+The handlers of a package are written to jsonhandlerfunc_gen.go in its directory, use it with go:generate:
+
+	//go:generate jsonhandlerfunc gen .
+
+The openapi command writes the func stubs of the operations of an OpenAPI document in JSON to stdout,
+see jsonhandlerfunc.GenerateFromOpenAPI:
+
+	jsonhandlerfunc openapi openapi.json users > users/handlers.go
+
+The contract command runs the contract cases of the *.json files in a dir against a live server,
+see jsonhandlerfunc.ContractCase, and exits with 1 if any of them fails:
+
+	jsonhandlerfunc contract http://localhost:8080/api testdata/contracts
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theplant/jsonhandlerfunc"
+)
+
+const outputFile = "jsonhandlerfunc_gen.go"
+
+func main() {
+	if len(os.Args) == 4 && os.Args[1] == "openapi" {
+		if err := fromOpenAPI(os.Args[2], os.Args[3]); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if len(os.Args) == 4 && os.Args[1] == "contract" {
+		passed, err := contract(os.Args[2], os.Args[3])
+		if err != nil {
+			fail(err)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) < 2 || os.Args[1] != "gen" {
+		fmt.Fprintln(os.Stderr, "usage: jsonhandlerfunc gen [dirs, like . or ./...]")
+		fmt.Fprintln(os.Stderr, "       jsonhandlerfunc openapi [document.json] [package]")
+		fmt.Fprintln(os.Stderr, "       jsonhandlerfunc contract [base url] [dir]")
+		os.Exit(2)
+	}
+	patterns := os.Args[2:]
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	for _, pattern := range patterns {
+		dirs, err := expand(pattern)
+		if err != nil {
+			fail(err)
+		}
+		for _, dir := range dirs {
+			if err := generate(dir); err != nil {
+				fail(err)
+			}
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "jsonhandlerfunc:", err)
+	os.Exit(1)
+}
+
+// expand returns the dirs of pattern, a dir or a dir ending with /... for it and all the dirs under it.
+func expand(pattern string) (dirs []string, err error) {
+	if !strings.HasSuffix(pattern, "...") {
+		return []string{pattern}, nil
+	}
+	root := filepath.Clean(strings.TrimSuffix(pattern, "..."))
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, p)
+		return nil
+	})
+	return
+}
+
+// generate writes the handlers of the package in dir, and removes the stale output if there are no annotated funcs.
+func generate(dir string) (err error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return
+	}
+	files := map[string][]byte{}
+	for _, name := range matches {
+		if strings.HasSuffix(name, "_test.go") || filepath.Base(name) == outputFile {
+			continue
+		}
+		if files[name], err = ioutil.ReadFile(name); err != nil {
+			return
+		}
+	}
+	output := filepath.Join(dir, outputFile)
+	if len(files) == 0 {
+		return
+	}
+	src := &bytes.Buffer{}
+	count, err := jsonhandlerfunc.GenerateStaticHandlers(src, files)
+	if err != nil {
+		return
+	}
+	if count == 0 {
+		if _, statErr := os.Stat(output); statErr == nil {
+			return os.Remove(output)
+		}
+		return
+	}
+	return ioutil.WriteFile(output, src.Bytes(), 0644)
+}
+
+// fromOpenAPI writes the func stubs of package pkgName of the OpenAPI document file to stdout.
+func fromOpenAPI(file string, pkgName string) (err error) {
+	doc, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	return jsonhandlerfunc.GenerateFromOpenAPI(os.Stdout, pkgName, doc)
+}
+
+// contract prints the results of the contract cases of dir against the server of baseURL.
+func contract(baseURL string, dir string) (passed bool, err error) {
+	cases, err := jsonhandlerfunc.LoadContracts(dir)
+	if err != nil {
+		return
+	}
+	passed = true
+	for _, r := range jsonhandlerfunc.RunContracts(jsonhandlerfunc.ContractServer(baseURL, nil), cases) {
+		fmt.Println(r)
+		passed = passed && r.Passed()
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Codec encodes the envelopes in another encoding than JSON, like MessagePack, add it to Config.Codecs.
+The request is decoded by the codec of its Content-Type, and the response is encoded by the codec of its Accept,
+or the codec of the request if Accept has none of them, JSON is used otherwise.
+
+The request envelope decodes the params into the pointers in its Params field,
+and the envelope sections and named params are JSON only, they implement json.Unmarshaler.
+*/
+type Codec interface {
+	Decode(r io.Reader, v interface{}) error
+	Encode(w io.Writer, v interface{}) error
+	ContentType() string
+}
+
+// JSONCodec is the default Codec of encoding/json
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+// codecOf returns the codec of Config.Codecs for the media type, nil if none.
+func (cfg *Config) codecOf(mediaType string) Codec {
+	for _, c := range cfg.Codecs {
+		if ct, _, _ := mime.ParseMediaType(c.ContentType()); ct == mediaType {
+			return c
+		}
+	}
+	return nil
+}
+
+// negotiateCodecs returns the codecs of the request and the response, nil for JSON.
+func (cfg *Config) negotiateCodecs(r *http.Request) (reqCodec, respCodec Codec) {
+	if len(cfg.Codecs) == 0 {
+		return
+	}
+	if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		reqCodec = cfg.codecOf(ct)
+	}
+	respCodec = reqCodec
+	for _, accepted := range acceptedMediaTypes(r.Header.Get("Accept")) {
+		if accepted == "application/json" {
+			return reqCodec, nil
+		}
+		if c := cfg.codecOf(accepted); c != nil {
+			return reqCodec, c
+		}
+	}
+	return
+}
+
+// acceptedMediaTypes of the Accept header, sorted by the q value.
+func acceptedMediaTypes(accept string) (types []string) {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var list []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qv, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(qv, 64)
+		}
+		if q > 0 {
+			list = append(list, accepted{mediaType, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	for _, a := range list {
+		types = append(types, a.mediaType)
+	}
+	return
+}
+
+// requestCodec is the codec to decode the request envelope with
+func requestCodec(w http.ResponseWriter) Codec {
+	if rw, ok := w.(*responseWriter); ok && rw.reqCodec != nil {
+		return rw.reqCodec
+	}
+	return JSONCodec
+}
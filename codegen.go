@@ -0,0 +1,288 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenerateDirective in the doc comment of a func annotates it for GenerateStaticHandlers
+const GenerateDirective = "//jsonhandlerfunc:gen"
+
+/*
+GenerateStaticHandlers writes Go source of a <Func>Handler(cfg) http.HandlerFunc for every top level func
+annotated with GenerateDirective in files, the source files of one package by their names. The handlers decode
+the params, call the func and write the same envelope as ToHandlerFunc without reflect.Call, so the params
+and results are type checked by the compiler:
+
+	//jsonhandlerfunc:gen
+	func FindUser(ctx context.Context, id int) (u *User, err error)
+
+	http.Handle("/users/find", users.FindUserHandler(cfg))
+
+The func can have a leading context.Context, which is the request context, and its last result is an error.
+The options and the Config other than the error values and the status codes, like injectors and timeouts, are not applied.
+count is how many handlers are written, nothing is written if it's 0. Run it with go:generate and the
+jsonhandlerfunc command:
+
+	//go:generate jsonhandlerfunc gen .
+*/
+func GenerateStaticHandlers(w io.Writer, files map[string][]byte) (count int, err error) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fset := token.NewFileSet()
+	imports := map[string]string{
+		"net/http":        "",
+		packageImportPath: "",
+	}
+	var pkgName string
+	body := &bytes.Buffer{}
+	for _, name := range names {
+		var f *ast.File
+		f, err = parser.ParseFile(fset, name, files[name], parser.ParseComments)
+		if err != nil {
+			return
+		}
+		pkgName = f.Name.Name
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || !hasGenerateDirective(fd.Doc) {
+				continue
+			}
+			g := &staticGen{fset: fset, file: f, imports: imports}
+			if err = g.handler(body, fd); err != nil {
+				return
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by jsonhandlerfunc.GenerateStaticHandlers. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkgName)
+	var std, others []string
+	for p := range imports {
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			others = append(others, p)
+			continue
+		}
+		std = append(std, p)
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	for i, paths := range [][]string{std, others} {
+		if i > 0 && len(paths) > 0 {
+			fmt.Fprintf(src, "\n")
+		}
+		for _, p := range paths {
+			fmt.Fprintf(src, "\t%s %q\n", imports[p], p)
+		}
+	}
+	fmt.Fprintf(src, ")\n\n")
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return
+	}
+	_, err = w.Write(formatted)
+	return
+}
+
+func hasGenerateDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == GenerateDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// staticGen writes the handler of an annotated func of file, and adds the imports its types use.
+type staticGen struct {
+	fset    *token.FileSet
+	file    *ast.File
+	imports map[string]string
+}
+
+func (g *staticGen) handler(w io.Writer, fd *ast.FuncDecl) (err error) {
+	name := fd.Name.Name
+	pos := g.fset.Position(fd.Pos())
+	if fd.Recv != nil || fd.Type.TypeParams != nil {
+		return fmt.Errorf("%s: %s must be a top level func without type params", pos, name)
+	}
+
+	var params, results []ast.Expr
+	for _, field := range fd.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return fmt.Errorf("%s: %s can not be variadic", pos, name)
+		}
+		for i := 0; i < fieldCount(field); i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if fd.Type.Results != nil {
+		for _, field := range fd.Type.Results.List {
+			for i := 0; i < fieldCount(field); i++ {
+				results = append(results, field.Type)
+			}
+		}
+	}
+	if len(results) == 0 || g.expr(results[len(results)-1]) != "error" {
+		return fmt.Errorf("%s: %s's last return value must be error", pos, name)
+	}
+	results = results[:len(results)-1]
+
+	var args, ptrs, outs []string
+	fmt.Fprintf(w, "// %sHandler serves %s with the envelope of jsonhandlerfunc, without reflection.\n", name, name)
+	fmt.Fprintf(w, "func %sHandler(cfg *jsonhandlerfunc.Config) http.HandlerFunc {\n", name)
+	fmt.Fprintf(w, "return func(w http.ResponseWriter, r *http.Request) {\nvar (\n")
+	for i, p := range params {
+		if i == 0 && g.isContext(p) {
+			args = append(args, "r.Context()")
+			continue
+		}
+		v := fmt.Sprintf("p%d", i)
+		fmt.Fprintf(w, "%s %s\n", v, g.typ(p))
+		args = append(args, v)
+		ptrs = append(ptrs, "&"+v)
+	}
+	for i, res := range results {
+		v := fmt.Sprintf("r%d", i)
+		fmt.Fprintf(w, "%s %s\n", v, g.typ(res))
+		outs = append(outs, v)
+	}
+	fmt.Fprintf(w, "err error\n)\n")
+	fmt.Fprintf(w, "if err = jsonhandlerfunc.DecodeParams(%s); err == nil {\n", strings.Join(append([]string{"r"}, ptrs...), ", "))
+	fmt.Fprintf(w, "%s = %s(%s)\n}\n", strings.Join(append(outs, "err"), ", "), name, strings.Join(args, ", "))
+	fmt.Fprintf(w, "cfg.WriteResults(w, %s)\n}\n}\n\n", strings.Join(append([]string{"err"}, outs...), ", "))
+	return
+}
+
+func fieldCount(field *ast.Field) int {
+	if len(field.Names) == 0 {
+		return 1
+	}
+	return len(field.Names)
+}
+
+func (g *staticGen) expr(e ast.Expr) string {
+	buf := &bytes.Buffer{}
+	printer.Fprint(buf, g.fset, e)
+	return buf.String()
+}
+
+func (g *staticGen) isContext(e ast.Expr) bool {
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && g.importPath(pkg.Name) == "context"
+}
+
+// typ is the source of the type e, and adds the imports of the packages it uses.
+func (g *staticGen) typ(e ast.Expr) string {
+	ast.Inspect(e, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok {
+			if p := g.importPath(pkg.Name); p != "" {
+				if pkg.Name != path.Base(p) {
+					g.imports[p] = pkg.Name
+				} else if _, ok := g.imports[p]; !ok {
+					g.imports[p] = ""
+				}
+			}
+		}
+		return false
+	})
+	return g.expr(e)
+}
+
+// importPath is the path of the package imported by the name in the file, empty if there isn't one.
+func (g *staticGen) importPath(name string) string {
+	for _, spec := range g.file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil && spec.Name.Name == name || spec.Name == nil && path.Base(p) == name {
+			return p
+		}
+	}
+	return ""
+}
+
+/*
+DecodeParams decodes the params of the request envelope, like {"params": [1, "a"]}, to the pointers params,
+for the handlers written by GenerateStaticHandlers.
+*/
+func DecodeParams(r *http.Request, params ...interface{}) (err error) {
+	if len(params) == 0 {
+		return
+	}
+	var req struct {
+		Params []json.RawMessage `json:"params"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("jsonhandlerfunc: decode request params error:", err)
+		return NewStatusCodeError(http.StatusUnprocessableEntity, fmt.Errorf("decode request params error"))
+	}
+	if len(req.Params) != len(params) {
+		e := &ParamsCountError{Code: ParamsCountCode, Required: len(params), Passed: len(req.Params), Params: []ParamDesc{}}
+		for i, p := range params {
+			e.Params = append(e.Params, ParamDesc{Index: i, Type: reflect.TypeOf(p).Elem().String()})
+		}
+		return e
+	}
+	for i, raw := range req.Params {
+		if err = json.Unmarshal(raw, params[i]); err != nil {
+			log.Println("jsonhandlerfunc: decode request params error:", err)
+			return NewStatusCodeError(http.StatusUnprocessableEntity, fmt.Errorf("decode request params error"))
+		}
+	}
+	return
+}
+
+/*
+WriteResults writes the response envelope of the results and err, like {"results": [r0, r1, err]},
+with the status code of err and the ResponseError of cfg, for the handlers written by GenerateStaticHandlers.
+The status codes are the same as of ToHandlerFunc with cfg, by Config.ErrToStatusCode and Config.SuccessStatusCode.
+*/
+func (cfg *Config) WriteResults(w http.ResponseWriter, err error, results ...interface{}) {
+	if cfg == nil {
+		cfg = defaultConfig
+	}
+	httpCode := cfg.successStatusCode(nil)
+	var respErr interface{}
+	if err != nil {
+		httpCode = cfg.errStatusCode(err, http.StatusOK)
+		if codeWithErr, ok := err.(*errorWithStatusCode); ok {
+			err = codeWithErr.innerErr
+		}
+		respErr = cfg.responseError(err)
+	}
+	writeJSONResponse(w, httpCode, append(results, respErr))
+}
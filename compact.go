@@ -0,0 +1,54 @@
+package jsonhandlerfunc
+
+import (
+	"net/http"
+)
+
+/*
+CompactEnvelopeHeader negotiates the compact envelope when Config.AllowCompactEnvelope is set,
+the request sends "X-Jsonhf-Compact: 1" and {"p":[...]}, and the response is {"r":[...]} with errors as {"e":"...","v":...} and meta as "m",
+to reduce payload overhead of high frequency polling endpoints.
+The header is echoed in the response when the compact envelope is used.
+*/
+const CompactEnvelopeHeader = "X-Jsonhf-Compact"
+
+type compactReq struct {
+	Params interface{} `json:"params,omitempty"`
+	P      interface{} `json:"p,omitempty"`
+}
+
+type compactResp struct {
+	R interface{}            `json:"r"`
+	M map[string]interface{} `json:"m,omitempty"`
+	W []Warning              `json:"w,omitempty"`
+}
+
+type compactResponseError struct {
+	E string      `json:"e,omitempty"`
+	C string      `json:"c,omitempty"`
+	V interface{} `json:"v,omitempty"`
+}
+
+func (cfg *Config) wantsCompact(r *http.Request) bool {
+	return cfg.AllowCompactEnvelope && r.Header.Get(CompactEnvelopeHeader) == "1"
+}
+
+func isCompact(w http.ResponseWriter) bool {
+	rw, ok := w.(*responseWriter)
+	return ok && rw.compact
+}
+
+func toCompactResp(out interface{}, meta map[string]interface{}, warnings []Warning) compactResp {
+	outs, ok := out.([]interface{})
+	if !ok {
+		return compactResp{R: out, M: meta, W: warnings}
+	}
+	compactOuts := make([]interface{}, len(outs))
+	for i, o := range outs {
+		if re, ok := o.(*ResponseError); ok {
+			o = &compactResponseError{E: re.Error, C: re.Code, V: re.Value}
+		}
+		compactOuts[i] = o
+	}
+	return compactResp{R: compactOuts, M: meta, W: warnings}
+}
@@ -0,0 +1,161 @@
+package jsonhandlerfunc
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize is the default Compression.MinSize
+const DefaultCompressMinSize = 1024
+
+/*
+Compression compresses the responses with a content coding negotiated from the Accept-Encoding of the request,
+gzip is built in, more codings like zstd can be added with Encoders:
+
+	cfg := &jsonhandlerfunc.Config{Compression: &jsonhandlerfunc.Compression{
+		Encoders: []jsonhandlerfunc.ContentEncoder{{
+			Name:      "zstd",
+			NewWriter: func(w io.Writer) io.WriteCloser { zw, _ := zstd.NewWriter(w); return zw },
+		}},
+	}}
+
+Only the envelopes are compressed, streams and the responses of the delegated handlers are written as they are.
+WithTee and WithResponseCache keep the responses uncompressed, and Config.OnUsage counts the compressed bytes.
+*/
+type Compression struct {
+	// MinSize is the min bytes of a response to be compressed, default is DefaultCompressMinSize.
+	MinSize int
+	// GzipLevel is the level of gzip, like gzip.BestSpeed, default is gzip.DefaultCompression.
+	GzipLevel int
+	// Encoders are the content codings besides gzip, preferred over gzip in order when the request accepts them.
+	Encoders []ContentEncoder
+}
+
+// ContentEncoder is a content coding of Compression
+type ContentEncoder struct {
+	// Name is the content coding in Accept-Encoding and Content-Encoding, like "zstd".
+	Name string
+	// NewWriter returns the writer that compresses to w, the response is written after it's closed.
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// gzipWriters pools the gzip writers by level, from gzip.HuffmanOnly to gzip.BestCompression
+var gzipWriters [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+func (c *Compression) gzipEncoder() ContentEncoder {
+	level := c.GzipLevel
+	if level == 0 || level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	pool := &gzipWriters[level-gzip.HuffmanOnly]
+	return ContentEncoder{
+		Name: "gzip",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			zw, _ := pool.Get().(*gzip.Writer)
+			if zw == nil {
+				zw, _ = gzip.NewWriterLevel(w, level)
+			} else {
+				zw.Reset(w)
+			}
+			return &pooledGzipWriter{Writer: zw, pool: pool}
+		},
+	}
+}
+
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (zw *pooledGzipWriter) Close() error {
+	err := zw.Writer.Close()
+	zw.pool.Put(zw.Writer)
+	return err
+}
+
+/*
+negotiate returns the encoder of the first coding of the Encoders and gzip that acceptEncoding accepts,
+nil if none, a coding of q=0 is not accepted, and * accepts the codings not listed.
+*/
+func (c *Compression) negotiate(acceptEncoding string) *ContentEncoder {
+	if c == nil || acceptEncoding == "" {
+		return nil
+	}
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	for _, enc := range append(append([]ContentEncoder{}, c.Encoders...), c.gzipEncoder()) {
+		ok, listed := accepted[enc.Name]
+		if !listed {
+			ok = accepted["*"]
+		}
+		if ok {
+			return &enc
+		}
+	}
+	return nil
+}
+
+func (c *Compression) minSize() int {
+	if c.MinSize > 0 {
+		return c.MinSize
+	}
+	return DefaultCompressMinSize
+}
+
+/*
+writeBody writes the whole body of the response, compressed with the negotiated content coding of Config.Compression
+if it's not smaller than the min size, the uncompressed body is what WithTee and WithResponseCache capture.
+*/
+func writeBody(w http.ResponseWriter, httpCode int, body []byte) {
+	if !bodyAllowed(httpCode) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(httpCode)
+		return
+	}
+	rw, ok := w.(*responseWriter)
+	if !ok || rw.compression == nil {
+		w.WriteHeader(httpCode)
+		w.Write(body)
+		return
+	}
+	header := rw.Header()
+	if !strings.Contains(strings.Join(header.Values("Vary"), ","), "Accept-Encoding") {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if rw.encoder == nil || len(body) < rw.compression.minSize() || header.Get("Content-Encoding") != "" {
+		rw.WriteHeader(httpCode)
+		rw.Write(body)
+		return
+	}
+
+	buf := getEncodeBuffer()
+	defer putEncodeBuffer(buf)
+	zw := rw.encoder.NewWriter(buf)
+	zw.Write(body)
+	if err := zw.Close(); err != nil {
+		log.Println("jsonhandlerfunc: compress response error:", err)
+		rw.WriteHeader(httpCode)
+		rw.Write(body)
+		return
+	}
+	header.Set("Content-Encoding", rw.encoder.Name)
+	header.Del("Content-Length")
+	rw.WriteHeader(httpCode)
+	n, _ := rw.ResponseWriter.Write(buf.Bytes())
+	rw.written += int64(n)
+	if rw.capture != nil {
+		rw.capture.Write(body)
+	}
+}
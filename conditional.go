@@ -0,0 +1,73 @@
+package jsonhandlerfunc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// NotModifiedKey is the key of the envelope responded by WithConditionalPOST when the results are not modified, {"not_modified": true}
+const NotModifiedKey = "not_modified"
+
+/*
+WithConditionalPOST sets the ETag header of the hash of the successful results of POST requests,
+and when the request's If-None-Match has the same hash, it responds the empty envelope {"not_modified": true}
+with 200 instead of the results, for large resources polled by POST reads. The func is still called,
+only the bandwidth is saved.
+*/
+func WithConditionalPOST() Option {
+	return func(opts *handlerOptions) {
+		opts.conditionalPOST = true
+	}
+}
+
+/*
+notModified sets the ETag of outs, and responds the not modified envelope if it's the same as If-None-Match,
+it returns true if the response is written.
+*/
+func (opts *handlerOptions) notModified(w http.ResponseWriter, r *http.Request, httpCode int, outs []interface{}) bool {
+	if !opts.conditionalPOST || r.Method != http.MethodPost || httpCode >= 300 {
+		return false
+	}
+	if rw, ok := w.(*responseWriter); ok && rw.jsonrpc != nil {
+		return false
+	}
+	b, err := json.Marshal(outs)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(b)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if !etagMatch(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	notModified := map[string]bool{NotModifiedKey: true}
+	if rw, ok := w.(*responseWriter); ok && rw.codec != nil {
+		w.Header().Set("Content-Type", rw.codec.ContentType())
+		w.WriteHeader(http.StatusOK)
+		if err := rw.codec.Encode(w, notModified); err != nil {
+			log.Printf("jsonhandlerfunc: write not modified err: %#+v\n", err)
+		}
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(notModified)
+	return true
+}
+
+// etagMatch is true if the If-None-Match header has etag, or is *, weak tags are compared by their values.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
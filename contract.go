@@ -0,0 +1,329 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+ContractCase is a language agnostic test case of a handler or a registry, the request envelope and the expected response envelope,
+so QA can write the API tests in JSON files without writing Go:
+
+	{
+		"name": "get a missing user",
+		"method": "users.get",
+		"headers": {"Authorization": "Bearer test"},
+		"request": {"params": [404]},
+		"status": 404,
+		"response": {"results": [null, {"error": "$string", "code": "not_found"}]}
+	}
+
+The response is matched by value, numbers by their values, and the objects only by the keys listed in it,
+so "value" or "meta" can be left out. A string starting with $ is a matcher:
+
+	"$any"                   any value, including null
+	"$notnull"               any value except null
+	"$string", "$number", "$integer", "$boolean", "$array", "$object", "$null"
+	"$regex:^u_[0-9]+$"      a string that matches the regexp
+	"$$price"                the string "$price"
+*/
+type ContractCase struct {
+	Name string `json:"name"`
+	// Method is the path of the request under the handler, the method name of a Registry, empty for a single handler.
+	Method string `json:"method,omitempty"`
+	// HTTPMethod default is POST.
+	HTTPMethod string            `json:"http_method,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Request    json.RawMessage   `json:"request,omitempty"`
+	// Status is the expected status code, default is 200.
+	Status int `json:"status,omitempty"`
+	// ResponseHeaders are the expected headers of the response, matched like the strings of Response.
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	Response        json.RawMessage   `json:"response,omitempty"`
+
+	// File is the file the case is loaded from
+	File string `json:"-"`
+}
+
+// ContractResult is the result of a ContractCase, it passed when Mismatches and Err are empty.
+type ContractResult struct {
+	Case       *ContractCase
+	Mismatches []string
+	Err        error
+}
+
+func (cr *ContractResult) Passed() bool {
+	return cr.Err == nil && len(cr.Mismatches) == 0
+}
+
+func (cr *ContractResult) String() string {
+	name := cr.Case.Name
+	if cr.Case.File != "" {
+		name = cr.Case.File + ": " + name
+	}
+	switch {
+	case cr.Err != nil:
+		return "FAIL " + name + ": " + cr.Err.Error()
+	case len(cr.Mismatches) > 0:
+		return "FAIL " + name + ":\n\t" + strings.Join(cr.Mismatches, "\n\t")
+	}
+	return "PASS " + name
+}
+
+/*
+LoadContracts reads the cases of the *.json files in dir in the order of the file names,
+a file is a case or an array of cases. YAML files are not read, convert them to JSON first, like with yq -o json.
+*/
+func LoadContracts(dir string) (cases []*ContractCase, err error) {
+	if _, err = os.Stat(dir); err != nil {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		var b []byte
+		if b, err = ioutil.ReadFile(file); err != nil {
+			return
+		}
+		b = bytes.TrimSpace(b)
+		var fileCases []*ContractCase
+		if len(b) > 0 && b[0] == '[' {
+			err = json.Unmarshal(b, &fileCases)
+		} else {
+			fileCases = []*ContractCase{{}}
+			err = json.Unmarshal(b, fileCases[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jsonhandlerfunc: decode contract %s error: %s", file, err)
+		}
+		for i, c := range fileCases {
+			c.File = filepath.Base(file)
+			if c.Name == "" {
+				c.Name = fmt.Sprintf("#%d", i+1)
+			}
+		}
+		cases = append(cases, fileCases...)
+	}
+	return
+}
+
+/*
+RunContracts serves the cases one by one in order with h, like a Handler or a Registry,
+use ContractServer(baseURL) to run them against a live server.
+*/
+func RunContracts(h http.Handler, cases []*ContractCase) (results []*ContractResult) {
+	for _, c := range cases {
+		results = append(results, runContract(h, c))
+	}
+	return
+}
+
+/*
+AssertContracts fails the test with the cases of dir that don't pass against h, see LoadContracts and RunContracts:
+
+	func TestUsersContracts(t *testing.T) {
+		jsonhandlerfunc.AssertContracts(t, registry, "testdata/contracts")
+	}
+*/
+func AssertContracts(t TestingT, h http.Handler, dir string) bool {
+	t.Helper()
+	cases, err := LoadContracts(dir)
+	if err != nil {
+		t.Errorf("%s", err)
+		return false
+	}
+	passed := true
+	for _, r := range RunContracts(h, cases) {
+		if !r.Passed() {
+			t.Errorf("%s", r)
+			passed = false
+		}
+	}
+	return passed
+}
+
+// ContractServer is a handler that sends the requests to the live server of baseURL, for running the contracts with RunContracts.
+func ContractServer(baseURL string, client *http.Client) http.Handler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequest(r.Method, strings.TrimSuffix(baseURL, "/")+r.URL.RequestURI(), r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		req.Header = r.Header
+		res, err := client.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for k, vs := range res.Header {
+			w.Header()[k] = vs
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	})
+}
+
+func runContract(h http.Handler, c *ContractCase) *ContractResult {
+	result := &ContractResult{Case: c}
+	method := c.HTTPMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+	r, err := http.NewRequest(method, "/"+strings.TrimPrefix(c.Method, "/"), bytes.NewReader(c.Request))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	r.RequestURI = r.URL.RequestURI()
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		r.Header.Set(k, v)
+	}
+
+	rec := &responseRecorder{header: http.Header{}, code: http.StatusOK}
+	h.ServeHTTP(rec, r)
+
+	m := &responseChecker{}
+	status := c.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if rec.code != status {
+		m.mismatch("status", "want %d, got %d", status, rec.code)
+	}
+	for _, k := range sortedStringKeys(c.ResponseHeaders) {
+		m.contract("header "+k, c.ResponseHeaders[k], rec.header.Get(k))
+	}
+	if len(c.Response) > 0 {
+		want, err := decodeContractJSON(c.Response)
+		if err != nil {
+			result.Err = fmt.Errorf("decode the expected response error: %s", err)
+			return result
+		}
+		got, err := decodeContractJSON(rec.body.Bytes())
+		if err != nil {
+			m.mismatch("", "body is not json: %s: %s", err, bytes.TrimSpace(rec.body.Bytes()))
+		} else {
+			m.contract("", want, got)
+		}
+	}
+	result.Mismatches = m.mismatches
+	return result
+}
+
+func decodeContractJSON(b []byte) (v interface{}, err error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	return
+}
+
+// contract matches got with want of a ContractCase, the objects by the keys of want.
+func (c *responseChecker) contract(path string, want, got interface{}) {
+	switch want := want.(type) {
+	case string:
+		if strings.HasPrefix(want, "$$") {
+			want = want[1:]
+		} else if strings.HasPrefix(want, "$") {
+			c.contractMatcher(path, want, got)
+			return
+		}
+		if s, ok := got.(string); !ok || s != want {
+			c.mismatch(path, "want %s, got %s", jsonString(want), jsonString(got))
+		}
+	case map[string]interface{}:
+		obj, ok := got.(map[string]interface{})
+		if !ok {
+			c.mismatch(path, "want object, got %s", jsonKind(got))
+			return
+		}
+		for _, k := range sortedKeys(want) {
+			gv, ok := obj[k]
+			if !ok && want[k] != "$any" {
+				c.mismatch(path+"."+k, "is missing")
+				continue
+			}
+			c.contract(path+"."+k, want[k], gv)
+		}
+	case []interface{}:
+		list, ok := got.([]interface{})
+		if !ok {
+			c.mismatch(path, "want array, got %s", jsonKind(got))
+			return
+		}
+		if len(list) != len(want) {
+			c.mismatch(path, "want %d items, got %d", len(want), len(list))
+			return
+		}
+		for i := range want {
+			c.contract(fmt.Sprintf("%s[%d]", path, i), want[i], list[i])
+		}
+	case json.Number:
+		gn, ok := got.(json.Number)
+		wf, _ := want.Float64()
+		if gf, err := gn.Float64(); !ok || err != nil || gf != wf {
+			c.mismatch(path, "want %s, got %s", want, jsonString(got))
+		}
+	default:
+		if jsonKind(want) != jsonKind(got) || want != got {
+			c.mismatch(path, "want %s, got %s", jsonString(want), jsonString(got))
+		}
+	}
+}
+
+func (c *responseChecker) contractMatcher(path string, matcher string, got interface{}) {
+	if pattern := strings.TrimPrefix(matcher, "$regex:"); pattern != matcher {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			c.mismatch(path, "bad regexp %s: %s", pattern, err)
+			return
+		}
+		if s, ok := got.(string); !ok || !re.MatchString(s) {
+			c.mismatch(path, "want a string matching %s, got %s", pattern, jsonString(got))
+		}
+		return
+	}
+	kind := jsonKind(got)
+	switch matcher {
+	case "$any":
+	case "$notnull":
+		if got == nil {
+			c.mismatch(path, "want not null, got null")
+		}
+	case "$string", "$integer", "$boolean", "$array", "$object", "$null":
+		if want := strings.TrimPrefix(matcher, "$"); kind != want {
+			c.mismatch(path, "want %s, got %s", want, kind)
+		}
+	case "$number":
+		if kind != "number" && kind != "integer" {
+			c.mismatch(path, "want number, got %s", kind)
+		}
+	default:
+		c.mismatch(path, "unknown matcher %s, use $$ for a string starting with $", matcher)
+	}
+}
+
+func sortedStringKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
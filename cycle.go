@@ -0,0 +1,155 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ResultCycleCode is the code of ResultCycleError
+const ResultCycleCode = "result_cycle"
+
+/*
+ResultCycleError is responded with 500 when a result refers to itself, like a user whose manager's reports include the user,
+Path is where the cycle is found, like results[0].manager.reports[1], instead of an encoding error after 1000 levels,
+or a custom Codec that never returns.
+*/
+type ResultCycleError struct {
+	Code string `json:"code"`
+	Path string `json:"path"`
+}
+
+func (e *ResultCycleError) Error() string {
+	return "result has a cycle at " + e.Path
+}
+
+func (e *ResultCycleError) StatusCode() int {
+	return http.StatusInternalServerError
+}
+
+// mayCycleTypes caches if the values of a type can refer to themselves
+var mayCycleTypes sync.Map
+
+/*
+resultCycle returns a ResultCycleError of the first cycle of the results before the error,
+only the values of the types that refer to themselves or have interfaces are walked, so the other results cost nothing.
+*/
+func resultCycle(outVals []reflect.Value) error {
+	for i := 0; i < len(outVals)-1; i++ {
+		if path := findCycle(outVals[i], fmt.Sprintf("results[%d]", i), map[cycleKey]bool{}); path != "" {
+			return &ResultCycleError{Code: ResultCycleCode, Path: path}
+		}
+	}
+	return nil
+}
+
+// cycleKey is a pointer, map or slice on the path being walked, slices of the same array with different lengths are different.
+type cycleKey struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// findCycle returns the path of the first value that is on the path to it, empty if none.
+func findCycle(v reflect.Value, path string, visiting map[cycleKey]bool) string {
+	if !v.IsValid() || !mayCycle(v.Type()) {
+		return ""
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return ""
+		}
+		return findCycle(v.Elem(), path, visiting)
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return ""
+		}
+		key := cycleKey{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if visiting[key] {
+			return path
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		return findCycle(v.Elem(), path, visiting)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if p := findCycle(v.Index(i), fmt.Sprintf("%s[%d]", path, i), visiting); p != "" {
+				return p
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			if p := findCycle(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, k), visiting); p != "" {
+				return p
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if name == "-" || !sf.IsExported() && !sf.Anonymous {
+				continue
+			}
+			fieldPath := path
+			if !sf.Anonymous || name != "" {
+				if name == "" {
+					name = sf.Name
+				}
+				fieldPath += "." + name
+			}
+			if p := findCycle(v.Field(i), fieldPath, visiting); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// mayCycle reports if the values of t can refer to themselves, the types encoded by their own marshalers can't.
+func mayCycle(t reflect.Type) bool {
+	if v, ok := mayCycleTypes.Load(t); ok {
+		return v.(bool)
+	}
+	may := reachesCycle(t, map[reflect.Type]bool{})
+	mayCycleTypes.Store(t, may)
+	return may
+}
+
+func reachesCycle(t reflect.Type, path map[reflect.Type]bool) bool {
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	if path[t] {
+		return true
+	}
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return false
+	}
+	path[t] = true
+	defer delete(path, t)
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return reachesCycle(t.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if reachesCycle(t.Field(i).Type, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+)
+
+var httpHandlerType = reflect.TypeOf((*http.Handler)(nil)).Elem()
+
+/*
+handlerResultIndex finds the http.Handler return value of the func, -1 if there is none.
+
+When the func returns a non nil http.Handler and a nil error, the rest of the request is delegated to it
+instead of responding json, for endpoints that usually answer json but sometimes proxy or stream.
+*/
+func handlerResultIndex(ft reflect.Type) int {
+	for i := 0; i < ft.NumOut()-1; i++ {
+		if ft.Out(i) == httpHandlerType {
+			return i
+		}
+	}
+	return -1
+}
+
+func delegatedHandler(outVals []reflect.Value, index int) http.Handler {
+	if index < 0 || !outVals[len(outVals)-1].IsNil() || outVals[index].IsNil() {
+		return nil
+	}
+	return outVals[index].Interface().(http.Handler)
+}
+
+// DefaultMaxBufferedBody is the max bytes of the request body buffered for the delegated handler when Config.MaxRequestBodyBytes is not set
+const DefaultMaxBufferedBody = 10 << 20
+
+// bufferDelegatedBody buffers the request body of a func that returns a http.Handler, a body over the limit fails the decode with a RequestTooLargeError.
+func (cfg *Config) bufferDelegatedBody(w http.ResponseWriter, r *http.Request) io.Reader {
+	if cfg.MaxRequestBodyBytes <= 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, DefaultMaxBufferedBody)
+	}
+	return bufferBody(r)
+}
+
+// bufferBody reads the request body so that it can be decoded and still be read again by the delegated handler.
+func bufferBody(r *http.Request) io.Reader {
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("jsonhandlerfunc: read request body error:", err)
+	}
+	r.Body.Close()
+	if bodyError(err) != nil {
+		// the body is read again with the error, so a too large or slow body is not decoded truncated
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(raw), failedReader{err}))
+		return io.MultiReader(bytes.NewReader(raw), failedReader{err})
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	return bytes.NewReader(raw)
+}
+
+type failedReader struct {
+	err error
+}
+
+func (r failedReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,124 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+)
+
+// HandlerDiagnostics are the runtime stats of a handler
+type HandlerDiagnostics struct {
+	// InFlight is how many calls are being handled now
+	InFlight int64 `json:"in_flight"`
+	// Calls counts the calls since the handler is created, by http and Invoke
+	Calls       int64       `json:"calls"`
+	Maintenance bool        `json:"maintenance,omitempty"`
+	Panics      *PanicStats `json:"panics,omitempty"`
+	Tee         *TeeStats   `json:"tee,omitempty"`
+	// Cache are the stats of WithResponseCache, which can be shared with other handlers
+	Cache *ResponseCacheStats `json:"cache,omitempty"`
+	// Pool are the stats of the Pool of the handler's class, which is shared with the other handlers of the class
+	Pool *PoolStats `json:"pool,omitempty"`
+}
+
+// Diagnostics are the runtime stats of a Registry, see Registry.ServeDiagnostics
+type Diagnostics struct {
+	Goroutines int                            `json:"goroutines"`
+	Handlers   map[string]*HandlerDiagnostics `json:"handlers"`
+	// Extra are the stats added with Registry.AddDiagnostics
+	Extra map[string]interface{} `json:"extra,omitempty"`
+	// TypeCache are the stats of the type metadata cache of the process, see ReadTypeCacheStats
+	TypeCache TypeCacheStats `json:"type_cache"`
+}
+
+// track counts the call in flight, the returned func is deferred to count it done.
+func (h *Handler) track() (done func()) {
+	atomic.AddInt64(&h.calls, 1)
+	atomic.AddInt64(&h.inFlight, 1)
+	return func() {
+		atomic.AddInt64(&h.inFlight, -1)
+	}
+}
+
+// Diagnostics returns the runtime stats of the handler, read with atomics so it never waits for the calls.
+func (h *Handler) Diagnostics() *HandlerDiagnostics {
+	d := &HandlerDiagnostics{
+		InFlight:    atomic.LoadInt64(&h.inFlight),
+		Calls:       atomic.LoadInt64(&h.calls),
+		Maintenance: h.checkMaintenance(nil) != nil,
+	}
+	if h.tally != nil {
+		stats := h.PanicStats()
+		d.Panics = &stats
+	}
+	if h.opts.tee != nil {
+		stats := h.opts.tee.Stats()
+		d.Tee = &stats
+	}
+	if h.opts.responseCache != nil {
+		stats := h.opts.responseCache.Stats()
+		d.Cache = &stats
+	}
+	if h.pool != nil {
+		stats := h.pool.Stats()
+		d.Pool = &stats
+	}
+	return d
+}
+
+/*
+AddDiagnostics adds the stats of other parts to the Diagnostics under name, like the Stats of a QueueConsumer:
+
+	reg.AddDiagnostics("orders_queue", func() interface{} { return consumer.Stats() })
+
+stats is called for every diagnostics request, it should be cheap and not block.
+*/
+func (reg *Registry) AddDiagnostics(name string, stats func() interface{}) {
+	if reg.extraDiagnostics == nil {
+		reg.extraDiagnostics = map[string]func() interface{}{}
+	}
+	reg.extraDiagnostics[name] = stats
+}
+
+// Diagnostics returns the runtime stats of the registered handlers and the ones of AddDiagnostics.
+func (reg *Registry) Diagnostics() *Diagnostics {
+	d := &Diagnostics{
+		Goroutines: runtime.NumGoroutine(),
+		Handlers:   map[string]*HandlerDiagnostics{},
+		TypeCache:  ReadTypeCacheStats(),
+	}
+	for name, h := range reg.handlers {
+		d.Handlers[name] = h.Diagnostics()
+	}
+	for name, stats := range reg.extraDiagnostics {
+		if d.Extra == nil {
+			d.Extra = map[string]interface{}{}
+		}
+		d.Extra[name] = stats()
+	}
+	return d
+}
+
+/*
+ServeDiagnostics serves the Diagnostics as json at the url path with GET, like /api/debug/jsonhandlerfunc, for scraping,
+it's lighter than pprof and safe to call often. Protect it with Use middleware like the other methods if needed.
+*/
+func (reg *Registry) ServeDiagnostics(path string) {
+	reg.diagnosticsPath = path
+}
+
+func (reg *Registry) serveDiagnostics(w http.ResponseWriter, r *http.Request) bool {
+	if reg.diagnosticsPath == "" || r.URL.Path != reg.diagnosticsPath || r.Method != http.MethodGet {
+		return false
+	}
+	var next http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reg.Diagnostics())
+	})
+	for i := len(reg.middleware) - 1; i >= 0; i-- {
+		next = reg.middleware[i](next)
+	}
+	next.ServeHTTP(w, r)
+	return true
+}
@@ -0,0 +1,159 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// DuplicateKeyCode is the code of DuplicateKeyError
+const DuplicateKeyCode = "duplicate_key"
+
+// DuplicateKeyError is responded with 422 when the request body has an object with a duplicate key, with WithRejectDuplicateKeys.
+type DuplicateKeyError struct {
+	Code string `json:"code"`
+	// Path is where the duplicate key is, like params[0].role
+	Path string `json:"path"`
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %s", e.Path)
+}
+
+func (e *DuplicateKeyError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+/*
+WithRejectDuplicateKeys rejects request bodies that have duplicate object keys with a DuplicateKeyError,
+encoding/json silently takes the last one, so a validating proxy and the func could see different values,
+use it for security sensitive handlers. Keys are compared case-insensitively like encoding/json matches
+the struct fields, so "role" and "Role" in one object are duplicates too.
+*/
+func WithRejectDuplicateKeys() Option {
+	return func(opts *handlerOptions) {
+		opts.rejectDuplicateKeys = true
+	}
+}
+
+// checkDuplicateKeys reads body, and returns it to be read again if there is no duplicate key, bodies of other Codecs are not checked.
+func (opts *handlerOptions) checkDuplicateKeys(body io.Reader, codec Codec) (io.Reader, error) {
+	if !opts.rejectDuplicateKeys || codec != JSONCodec {
+		return body, nil
+	}
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if path, found := duplicateKey(raw); found {
+		return nil, &DuplicateKeyError{Code: DuplicateKeyCode, Path: path}
+	}
+	return bytes.NewReader(raw), nil
+}
+
+type jsonFrame struct {
+	object    bool
+	keys      map[string]bool
+	expectKey bool
+	key       string
+	index     int
+}
+
+// duplicateKey finds the first duplicate object key of the json raw, invalid json is left to the decoder.
+func duplicateKey(raw []byte) (path string, found bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var stack []*jsonFrame
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		delim, isDelim := tok.(json.Delim)
+
+		if top != nil && top.object && top.expectKey {
+			if isDelim && delim == '}' {
+				stack = stack[:len(stack)-1]
+				if valueDone(stack) {
+					return "", false
+				}
+				continue
+			}
+			key, _ := tok.(string)
+			if top.keys[foldKey(key)] {
+				return jsonPath(stack[:len(stack)-1]) + jsonPathKey(key), true
+			}
+			top.keys[foldKey(key)] = true
+			top.key = key
+			top.expectKey = false
+			continue
+		}
+
+		if isDelim && delim == ']' {
+			stack = stack[:len(stack)-1]
+			if valueDone(stack) {
+				return "", false
+			}
+			continue
+		}
+		if top != nil && !top.object {
+			top.index++
+		}
+		if isDelim {
+			stack = append(stack, &jsonFrame{object: delim == '{', keys: map[string]bool{}, expectKey: delim == '{', index: -1})
+			continue
+		}
+		if valueDone(stack) {
+			return "", false
+		}
+	}
+}
+
+// foldKey is the same for the keys that encoding/json takes as the same struct field, every rune is the smallest of its case folding.
+func foldKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, key)
+}
+
+// valueDone marks the value in the top frame done, and reports if the whole json is done.
+func valueDone(stack []*jsonFrame) bool {
+	if len(stack) == 0 {
+		return true
+	}
+	if top := stack[len(stack)-1]; top.object {
+		top.expectKey = true
+	}
+	return false
+}
+
+func jsonPath(stack []*jsonFrame) string {
+	var b strings.Builder
+	for _, f := range stack {
+		if f.object {
+			b.WriteString(jsonPathKey(f.key))
+			continue
+		}
+		fmt.Fprintf(&b, "[%d]", f.index)
+	}
+	return strings.TrimPrefix(b.String(), ".")
+}
+
+func jsonPathKey(key string) string {
+	return "." + key
+}
@@ -0,0 +1,355 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// EncryptedPrefix prefixes the strings of the values encrypted by WithFieldEncryption, followed by the base64 of the ciphertext.
+const EncryptedPrefix = "jsonhf:enc:"
+
+// FieldCipher encrypts the json of the fields tagged `jsonhf:"encrypt"` for WithFieldEncryption
+type FieldCipher interface {
+	Encrypt(plaintext []byte) (ciphertext []byte, err error)
+	Decrypt(ciphertext []byte) (plaintext []byte, err error)
+}
+
+type aesFieldCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESFieldCipher creates a FieldCipher of AES-GCM, the key is 16, 24 or 32 bytes for AES-128, AES-192 or AES-256.
+func NewAESFieldCipher(key []byte) (FieldCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesFieldCipher{aead: aead}, nil
+}
+
+func (c *aesFieldCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *aesFieldCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < c.aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:c.aead.NonceSize()], ciphertext[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, sealed, nil)
+}
+
+/*
+WithFieldEncryption encrypts the fields tagged `jsonhf:"encrypt"` of the params and results with c
+when the envelopes are persisted by WithTee and WithAuditChain, so sensitive values never hit
+their storage in plaintext:
+
+	type Card struct {
+		Holder string `json:"holder"`
+		Number string `json:"number" jsonhf:"encrypt"`
+	}
+
+The value of a tagged field is replaced by the EncryptedPrefix string of its encrypted json, read it back
+with DecryptJSON. An envelope that can't be walked by the types of the func, like of another Codec or without the params
+or the results of the default, the compact or the ResponseShape envelope, is encrypted as a whole. The requests and responses themselves are not changed.
+*/
+func WithFieldEncryption(c FieldCipher) Option {
+	if c == nil {
+		panic("field cipher can not be nil.")
+	}
+	return func(opts *handlerOptions) {
+		opts.fieldCipher = c
+	}
+}
+
+// fieldEncryption encrypts the tagged fields of the envelopes of a func, a nil one doesn't change them.
+type fieldEncryption struct {
+	cipher      FieldCipher
+	paramTypes  []reflect.Type
+	resultTypes []reflect.Type
+	// requestKeys and responseKeys are the keys of the params and results in the envelopes, of the default,
+	// the compact envelope and the ResponseShape
+	requestKeys  []envelopeKey
+	responseKeys []envelopeKey
+}
+
+// envelopeKey is a key of the params or results in an envelope, single is of the unwrapped single result of ResponseShape.
+type envelopeKey struct {
+	name   string
+	single bool
+}
+
+func newFieldEncryption(c FieldCipher, shape *ResponseShape, ft reflect.Type, firstParam int) *fieldEncryption {
+	if c == nil {
+		return nil
+	}
+	enc := &fieldEncryption{
+		cipher:       c,
+		requestKeys:  []envelopeKey{{name: "params"}, {name: "p"}},
+		responseKeys: []envelopeKey{{name: "results"}, {name: "r"}},
+	}
+	if shape != nil {
+		enc.responseKeys = append(enc.responseKeys,
+			envelopeKey{name: defaultString(shape.ResultsKey, "results")},
+			envelopeKey{name: defaultString(shape.ResultKey, "result"), single: true})
+	}
+	for i := firstParam; i < ft.NumIn(); i++ {
+		enc.paramTypes = append(enc.paramTypes, ft.In(i))
+	}
+	for i := 0; i < ft.NumOut()-1; i++ {
+		enc.resultTypes = append(enc.resultTypes, ft.Out(i))
+	}
+	return enc
+}
+
+// params encrypts the tagged fields of the params of raw, a json array
+func (enc *fieldEncryption) params(raw json.RawMessage) (json.RawMessage, error) {
+	if enc == nil {
+		return raw, nil
+	}
+	return enc.array(raw, enc.paramTypes)
+}
+
+// results encrypts the tagged fields of the results of raw, a json array
+func (enc *fieldEncryption) results(raw json.RawMessage) (json.RawMessage, error) {
+	if enc == nil {
+		return raw, nil
+	}
+	return enc.array(raw, enc.resultTypes)
+}
+
+/*
+envelope encrypts the tagged fields of the params or results under the keys of the envelope raw, like "params" of a request,
+the envelope without any of the keys is encrypted as a whole, so an unknown shape is never persisted in plaintext.
+*/
+func (enc *fieldEncryption) envelope(raw json.RawMessage, keys []envelopeKey, types []reflect.Type) (json.RawMessage, error) {
+	if enc == nil || len(bytes.TrimSpace(raw)) == 0 {
+		return raw, nil
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil {
+		return enc.whole(raw)
+	}
+	found := false
+	for _, key := range keys {
+		val, ok := obj[key.name]
+		if !ok {
+			continue
+		}
+		found = true
+		var err error
+		if key.single {
+			val, err = enc.single(val, types)
+		} else {
+			val, err = enc.array(val, types)
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj[key.name] = val
+	}
+	if !found {
+		return enc.whole(raw)
+	}
+	return json.Marshal(obj)
+}
+
+// single encrypts the tagged fields of the unwrapped single result raw of ResponseShape
+func (enc *fieldEncryption) single(raw json.RawMessage, types []reflect.Type) (json.RawMessage, error) {
+	if len(types) != 1 {
+		return enc.whole(raw)
+	}
+	var v interface{}
+	if json.Unmarshal(raw, &v) != nil {
+		return enc.whole(raw)
+	}
+	v, err := enc.walk(v, types[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// record encrypts the tagged fields of the request params and response results of rec
+func (enc *fieldEncryption) record(rec *TeeRecord) (err error) {
+	if enc == nil {
+		return
+	}
+	if rec.Request, err = enc.envelope(rec.Request, enc.requestKeys, enc.paramTypes); err != nil {
+		return
+	}
+	rec.Response, err = enc.envelope(rec.Response, enc.responseKeys, enc.resultTypes)
+	return
+}
+
+func (enc *fieldEncryption) array(raw json.RawMessage, types []reflect.Type) (json.RawMessage, error) {
+	var vals []interface{}
+	if json.Unmarshal(raw, &vals) != nil {
+		return enc.whole(raw)
+	}
+	for i := range vals {
+		if i >= len(types) {
+			break
+		}
+		v, err := enc.walk(vals[i], types[i])
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return json.Marshal(vals)
+}
+
+// whole encrypts raw as one value
+func (enc *fieldEncryption) whole(raw json.RawMessage) (json.RawMessage, error) {
+	s, err := enc.encrypt(raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+func (enc *fieldEncryption) encrypt(plaintext []byte) (string, error) {
+	ciphertext, err := enc.cipher.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// walk encrypts the tagged fields of the decoded json v of type t
+func (enc *fieldEncryption) walk(v interface{}, t reflect.Type) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if obj, ok := v.(map[string]interface{}); ok {
+			return obj, enc.walkFields(obj, t)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := v.([]interface{}); ok {
+			for i := range arr {
+				ev, err := enc.walk(arr[i], t.Elem())
+				if err != nil {
+					return nil, err
+				}
+				arr[i] = ev
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for k := range obj {
+				ev, err := enc.walk(obj[k], t.Elem())
+				if err != nil {
+					return nil, err
+				}
+				obj[k] = ev
+			}
+		}
+	}
+	return v, nil
+}
+
+// walkFields walks the fields of the struct t in obj
+func (enc *fieldEncryption) walkFields(obj map[string]interface{}, t reflect.Type) error {
+	for _, f := range structFields(t) {
+		fv, ok := obj[f.name]
+		if !ok || fv == nil {
+			continue
+		}
+		var err error
+		if f.encrypt {
+			var plaintext []byte
+			if plaintext, err = json.Marshal(fv); err == nil {
+				obj[f.name], err = enc.encrypt(plaintext)
+			}
+		} else {
+			obj[f.name], err = enc.walk(fv, f.typ)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasEncryptTag(sf reflect.StructField) bool {
+	for _, opt := range strings.Split(sf.Tag.Get("jsonhf"), ",") {
+		if opt == "encrypt" {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+DecryptJSON decrypts the values encrypted by WithFieldEncryption at any depth of raw with c,
+like the Request of a stored TeeRecord or the Params of a Receipt.
+*/
+func DecryptJSON(raw json.RawMessage, c FieldCipher) (json.RawMessage, error) {
+	var v interface{}
+	if len(raw) == 0 {
+		return raw, nil
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	v, err := decryptValue(v, c)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func decryptValue(v interface{}, c FieldCipher) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		if !strings.HasPrefix(v, EncryptedPrefix) {
+			return v, nil
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, EncryptedPrefix))
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := c.Decrypt(ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		var dv interface{}
+		if err = json.Unmarshal(plaintext, &dv); err != nil {
+			return nil, err
+		}
+		return decryptValue(dv, c)
+	case map[string]interface{}:
+		for k := range v {
+			if v[k], err = decryptValue(v[k], c); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			if v[i], err = decryptValue(v[i], c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
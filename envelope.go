@@ -0,0 +1,62 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+EnvelopeHeader is the envelope version of the response when Config.EmitEnvelopeVersion is set,
+clients can request versions in the preferred order with the same header, like "X-Jsonhf-Envelope: v2, v1",
+so future envelope formats can be rolled out per request instead of with a breaking release.
+*/
+const EnvelopeHeader = "X-Jsonhf-Envelope"
+
+// EnvelopeV1 is the envelope of {"params": [...]} and {"results": [...]}
+const EnvelopeV1 = "v1"
+
+// supportedEnvelopes are the envelope versions in the order of preference
+var supportedEnvelopes = []string{EnvelopeV1}
+
+// UnsupportedEnvelopeCode is the code of UnsupportedEnvelopeError
+const UnsupportedEnvelopeCode = "unsupported_envelope"
+
+// UnsupportedEnvelopeError is responded with 406 when none of the requested envelope versions is supported.
+type UnsupportedEnvelopeError struct {
+	Code      string   `json:"code"`
+	Requested string   `json:"requested"`
+	Supported []string `json:"supported"`
+}
+
+func (e *UnsupportedEnvelopeError) Error() string {
+	return fmt.Sprintf("envelope %s is not supported, supported are %s", e.Requested, strings.Join(e.Supported, ", "))
+}
+
+func (e *UnsupportedEnvelopeError) StatusCode() int {
+	return http.StatusNotAcceptable
+}
+
+// negotiateEnvelope picks the first supported version the request asks for, and sets it to the response header.
+func (cfg *Config) negotiateEnvelope(w http.ResponseWriter, r *http.Request) error {
+	if !cfg.EmitEnvelopeVersion {
+		return nil
+	}
+	// the error is in the v1 envelope, which every client can read
+	w.Header().Set(EnvelopeHeader, EnvelopeV1)
+
+	requested := r.Header.Get(EnvelopeHeader)
+	if requested == "" {
+		return nil
+	}
+	for _, version := range strings.Split(requested, ",") {
+		version = strings.TrimSpace(version)
+		for _, supported := range supportedEnvelopes {
+			if version == supported {
+				w.Header().Set(EnvelopeHeader, version)
+				return nil
+			}
+		}
+	}
+	return &UnsupportedEnvelopeError{Code: UnsupportedEnvelopeCode, Requested: requested, Supported: supportedEnvelopes}
+}
@@ -0,0 +1,154 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+/*
+DefaultErrorValue is how ResponseError.Value is serialized when Config.ErrorValueMarshaler is not set,
+it's always a json object:
+
+  - an error implementing json.Marshaler is encoded by itself
+  - a struct error is encoded with its exported fields, like {"ErrorCode":8800}
+  - a map error with string keys is encoded as the map, like {"name":"is required"}
+  - a slice or scalar error is wrapped as {"details": ...}, like {"details":["a","b"]}
+  - otherwise the wrapped errors of errors.Unwrap are tried one by one, and {} if none of them has a value
+*/
+func DefaultErrorValue(err error) interface{} {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if v, ok := errorValue(e); ok {
+			return v
+		}
+	}
+	return struct{}{}
+}
+
+func errorValue(err error) (v interface{}, ok bool) {
+	if _, isMarshaler := err.(json.Marshaler); isMarshaler {
+		return err, true
+	}
+
+	rv := reflect.ValueOf(err)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		if hasExportedFields(rv.Type()) {
+			return err, true
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			return err, true
+		}
+	case reflect.Slice, reflect.Array, reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"details": rv.Interface()}, true
+	}
+	return
+}
+
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && f.Tag.Get("json") != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// responseError wraps err for the response, err is converted with ErrHandler first.
+func (cfg *Config) responseError(err error) *ResponseError {
+	if codeWithErr, ok := err.(*errorWithStatusCode); ok {
+		err = codeWithErr.innerErr
+	}
+	if cfg.ErrHandler != nil {
+		err = cfg.ErrHandler(err)
+	}
+	marshal := cfg.ErrorValueMarshaler
+	if marshal == nil {
+		marshal = DefaultErrorValue
+	}
+	re := &ResponseError{Error: err.Error(), Code: ErrorCodeOf(err), Value: marshal(err)}
+	if cfg.StructuredErrors {
+		re.structured = structuredErrorOf(err, re)
+	}
+	return re
+}
+
+/*
+ErrorCoder is implemented by errors with a code that clients branch on, like an injector's "token_expired",
+the code is responded as ResponseError.Code.
+*/
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// ErrorCodeOf returns the code of the first ErrorCoder in the chain of err, empty if none.
+func ErrorCodeOf(err error) string {
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		return coder.ErrorCode()
+	}
+	return ""
+}
+
+// ErrorDetailer is implemented by errors with details for the clients, responded with Config.StructuredErrors.
+type ErrorDetailer interface {
+	ErrorDetails() interface{}
+}
+
+// structuredError is the error of Config.StructuredErrors
+type structuredError struct {
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+/*
+structuredErrorOf takes the code of the ErrorCoder, or else the "code" of the value like the errors of this package,
+and the details of the ErrorDetailer, or else the value if it's not empty.
+*/
+func structuredErrorOf(err error, re *ResponseError) *structuredError {
+	se := &structuredError{Code: re.Code, Message: re.Error}
+	var detailer ErrorDetailer
+	if errors.As(err, &detailer) {
+		se.Details = detailer.ErrorDetails()
+	}
+
+	raw, marshalErr := json.Marshal(re.Value)
+	if marshalErr != nil {
+		return se
+	}
+	if se.Code == "" {
+		var coded struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(raw, &coded)
+		se.Code = coded.Code
+	}
+	if se.Details == nil && string(raw) != "{}" && string(raw) != "null" {
+		se.Details = re.Value
+	}
+	return se
+}
+
+// MarshalJSON encodes the error as {"error": {"code": ..., "message": ..., "details": ...}} with Config.StructuredErrors.
+func (re *ResponseError) MarshalJSON() ([]byte, error) {
+	if re.structured != nil {
+		return json.Marshal(struct {
+			Error *structuredError `json:"error"`
+		}{re.structured})
+	}
+	type plain ResponseError
+	return json.Marshal((*plain)(re))
+}
@@ -0,0 +1,182 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+EventStream is a result that sends the items as the func produces them, instead of encoding the results once,
+for progress updates, tailing logs and LLM tokens:
+
+	func tail(ctx context.Context, name string) (*jsonhandlerfunc.EventStream[*LogLine], error) {
+		f, err := openLog(name)
+		if err != nil {
+			return nil, err
+		}
+		return jsonhandlerfunc.NewEventStream(func(ctx context.Context, send func(*LogLine) error) error {
+			defer f.Close()
+			for line := range f.Lines(ctx) {
+				if err := send(line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	}
+
+The items are Server-Sent Events with sequential ids, or newline delimited json when the request prefers application/x-ndjson,
+and every item is flushed once it's sent. The stream is finished with the "end" event when produce returns nil,
+or the "error" event of its error, the way Client.CallStream reads them, the ndjson response is aborted on the error.
+
+produce is called with the request context, which is canceled when the client went away, then send returns the context error.
+The progress that produce reports with ReportProgress of the context is sent as the "progress" events of SSE, which have no id.
+When the request has Last-Event-ID, the items up to it are skipped, so produce should send the same items in order again to resume.
+
+When the error of the func is not nil, or the stream is nil, the results are responded in the envelope as usual.
+*/
+type EventStream[T any] struct {
+	produce func(ctx context.Context, send func(item T) error) error
+}
+
+// NewEventStream returns an EventStream of the items that produce sends.
+func NewEventStream[T any](produce func(ctx context.Context, send func(item T) error) error) *EventStream[T] {
+	return &EventStream[T]{produce: produce}
+}
+
+// eventStreamer is the EventStream of any item type
+type eventStreamer interface {
+	serveEvents(w http.ResponseWriter, r *http.Request, cfg *Config)
+}
+
+var eventStreamerType = reflect.TypeOf((*eventStreamer)(nil)).Elem()
+
+// errNilEventStream is the error of the EventStreams that are not made by NewEventStream
+var errNilEventStream = errors.New("jsonhandlerfunc: EventStream has no produce func, use NewEventStream")
+
+func (es *EventStream[T]) serveEvents(w http.ResponseWriter, r *http.Request, cfg *Config) {
+	ndjson := prefersNDJSON(r.Header.Get("Accept"))
+	var skip int64
+	if !ndjson {
+		skip, _ = strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	}
+
+	header := w.Header()
+	if ndjson {
+		header.Set("Content-Type", NDJSONContentType)
+	} else {
+		header.Set("Content-Type", SSEContentType)
+	}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	produce := es.produce
+	if produce == nil {
+		produce = func(context.Context, func(T) error) error { return errNilEventStream }
+	}
+	ctx := r.Context()
+	// mu serializes the writes of the items and of the progress reported from other goroutines
+	var mu sync.Mutex
+	var finished bool
+	produceCtx := ctx
+	if !ndjson {
+		produceCtx = WithProgressListener(ctx, func(p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			if finished || ctx.Err() != nil {
+				return
+			}
+			data, _ := json.Marshal(p)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", StreamProgressEvent, data)
+			rc.Flush()
+		})
+	}
+	var id int64
+	err := produce(produceCtx, func(item T) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		id++
+		if id <= skip {
+			return nil
+		}
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if ndjson {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		} else {
+			_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		return err
+	})
+	mu.Lock()
+	finished = true
+	mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Println("jsonhandlerfunc: event stream error:", err)
+		if ndjson {
+			// ndjson has no error line, the response is aborted so the client doesn't take it as finished
+			panic(http.ErrAbortHandler)
+		}
+		data, _ := json.Marshal(cfg.responseError(err))
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", StreamErrorEvent, data)
+	} else if !ndjson {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", StreamEndEvent)
+	}
+	rc.Flush()
+}
+
+// prefersNDJSON reports if application/x-ndjson is accepted before text/event-stream.
+func prefersNDJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		switch strings.TrimSpace(mediaType) {
+		case SSEContentType:
+			return false
+		case NDJSONContentType:
+			return true
+		}
+	}
+	return false
+}
+
+// eventStreamIndex finds the *EventStream return value of the func, -1 if there is none.
+func eventStreamIndex(ft reflect.Type) int {
+	for i := 0; i < ft.NumOut()-1; i++ {
+		if ft.Out(i).Implements(eventStreamerType) {
+			return i
+		}
+	}
+	return -1
+}
+
+// eventStream returns the event stream result when the error is nil, nil otherwise.
+func (h *Handler) eventStream(outVals []reflect.Value) eventStreamer {
+	if h.eventsIndex < 0 || !outVals[len(outVals)-1].IsNil() || outVals[h.eventsIndex].IsNil() {
+		return nil
+	}
+	es, _ := outVals[h.eventsIndex].Interface().(eventStreamer)
+	return es
+}
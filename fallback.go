@@ -0,0 +1,30 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+/*
+FallbackFunc is called by a Registry for the methods that are not registered, with the method name and the raw params,
+like proxying them to another backend with a Client during an incremental migration.
+results are the results except the error, and err is responded the same as an error returned by a func.
+*/
+type FallbackFunc func(ctx context.Context, method string, rawParams []json.RawMessage) (results []interface{}, err error)
+
+// Call makes a FallbackFunc a Callable, the method is read from ctx with MethodName.
+func (f FallbackFunc) Call(ctx context.Context, rawParams []json.RawMessage) (results []interface{}, err error) {
+	return f(ctx, MethodName(ctx), rawParams)
+}
+
+/*
+Fallback sets f to serve the unknown methods instead of responding MethodNotFoundError,
+options like WithRequiredHeaders apply to it the same as to a Callable, the middleware of Use wrap it too.
+*/
+func (reg *Registry) Fallback(f FallbackFunc, opts ...Option) {
+	funcs := []interface{}{f}
+	for _, opt := range opts {
+		funcs = append(funcs, opt)
+	}
+	reg.fallback = reg.Config.NewHandler(funcs...)
+}
@@ -0,0 +1,96 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+// FaultInjectionEnv must be set to "1" for FaultInjection to take effect, so that faults are never injected by default.
+const FaultInjectionEnv = "JSONHANDLERFUNC_FAULT_INJECTION"
+
+// InjectedFaultCode is the code of InjectedFaultError
+const InjectedFaultCode = "injected_fault"
+
+/*
+FaultInjection delays or fails a percentage of calls, to test client retry logic and alerts,
+set it on Config.FaultInjection or per handler with WithFaultInjection.
+It only takes effect when the FaultInjectionEnv environment variable is "1" when the handler is created.
+*/
+type FaultInjection struct {
+	// DelayRate of calls from 0 to 1 are delayed for Delay before calling the func.
+	DelayRate float64
+	Delay     time.Duration
+	// ErrorRate of calls from 0 to 1 are responded with Error without calling the func,
+	// Error defaults to InjectedFaultError with 503.
+	ErrorRate float64
+	Error     error
+	// Rand returns a number in [0, 1), defaults to rand.Float64
+	Rand func() float64
+}
+
+// InjectedFaultError is the default error of FaultInjection
+type InjectedFaultError struct {
+	Code string `json:"code"`
+}
+
+func (e *InjectedFaultError) Error() string {
+	return "injected fault"
+}
+
+func (e *InjectedFaultError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// WithFaultInjection overrides Config.FaultInjection for this handler.
+func WithFaultInjection(fi *FaultInjection) Option {
+	return func(opts *handlerOptions) {
+		opts.faultInjection = fi
+	}
+}
+
+// faults of the handler, nil if FaultInjectionEnv is not set
+func (cfg *Config) faults(opts *handlerOptions) *FaultInjection {
+	if !faultInjectionEnabled() {
+		return nil
+	}
+	if opts.faultInjection != nil {
+		return opts.faultInjection
+	}
+	return cfg.FaultInjection
+}
+
+func faultInjectionEnabled() bool {
+	return os.Getenv(FaultInjectionEnv) == "1"
+}
+
+// inject delays the call or returns the error to respond with, the error of ctx if it is done during the delay.
+func (fi *FaultInjection) inject(ctx context.Context) (err error) {
+	random := fi.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+
+	if fi.DelayRate > 0 && random() < fi.DelayRate {
+		timer := time.NewTimer(fi.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if fi.ErrorRate > 0 && random() < fi.ErrorRate {
+		err = fi.Error
+		if err == nil {
+			err = &InjectedFaultError{Code: InjectedFaultCode}
+		}
+		if _, ok := err.(StatusCodeError); !ok {
+			err = NewStatusCodeError(http.StatusServiceUnavailable, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// FloatFormat is how the numbers of the response json are formatted, see Config.FloatFormat
+type FloatFormat int
+
+const (
+	// FloatDefault formats the numbers the same as encoding/json, with exponents for very large and small ones, like 1e+21
+	FloatDefault FloatFormat = iota
+	// FloatDecimal formats the numbers without exponents, like 1000000000000000000000, for clients that can't parse them
+	FloatDecimal
+)
+
+// decimalFloats rewrites the numbers with exponents of the json b to decimals, the strings are kept as they are.
+func decimalFloats(b []byte) []byte {
+	if !bytes.ContainsAny(b, "eE") {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	inString := false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(b) {
+				i++
+				out = append(out, b[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			out = append(out, c)
+			continue
+		}
+		if c != '-' && (c < '0' || c > '9') {
+			out = append(out, c)
+			continue
+		}
+		end := i
+		for end < len(b) && bytes.IndexByte([]byte("+-.0123456789eE"), b[end]) >= 0 {
+			end++
+		}
+		num := b[i:end]
+		if bytes.ContainsAny(num, "eE") {
+			if f, err := strconv.ParseFloat(string(num), 64); err == nil {
+				num = strconv.AppendFloat(nil, f, 'f', -1, 64)
+			}
+		}
+		out = append(out, num...)
+		i = end - 1
+	}
+	return out
+}
@@ -0,0 +1,187 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+/*
+FormDescriptor describes the params of a handler for admin UIs to generate forms that submit valid envelopes,
+it's responded to OPTIONS requests when Config.ServeFormDescriptors is set.
+
+The fields are described by struct tags besides json:
+
+	type CreateUser struct {
+		Name   string `json:"name" label:"Full name" doc:"as shown on the profile"`
+		Status string `json:"status" enum:"active,inactive"`
+		Note   string `json:"note,omitempty"`
+	}
+
+Label defaults to the name in words, and fields are required unless they are omitempty or pointers,
+or tagged required:"false", a required:"true" tag makes them required anyway.
+*/
+type FormDescriptor struct {
+	Params   []*FormField `json:"params"`
+	Sections []*FormField `json:"sections,omitempty"`
+}
+
+// FormField describes a param or a struct field, Type is one of the TypeSchema kinds or a format like "date-time".
+type FormField struct {
+	Name     string       `json:"name,omitempty"`
+	Label    string       `json:"label,omitempty"`
+	Doc      string       `json:"doc,omitempty"`
+	Type     string       `json:"type"`
+	Required bool         `json:"required"`
+	Enum     []string     `json:"enum,omitempty"`
+	Elem     *FormField   `json:"elem,omitempty"`
+	Fields   []*FormField `json:"fields,omitempty"`
+}
+
+// FormDescriptor returns the form of the handler's params, a Callable has no params described.
+func (h *Handler) FormDescriptor() *FormDescriptor {
+	fd := &FormDescriptor{Params: []*FormField{}}
+	if h.callable != nil || h.firstIsAlsoInjector {
+		return fd
+	}
+	injected := injectedCount(h.argsInjectors)
+	for i := injected; i < h.ft.NumIn(); i++ {
+		name := ""
+		if h.opts.paramNames != nil {
+			name = h.opts.paramNames[i-injected]
+		}
+		if section, ok := h.opts.envelopeSections[i]; ok {
+			fd.Sections = append(fd.Sections, formField(section, "", h.ft.In(i), map[reflect.Type]bool{}))
+			continue
+		}
+		fd.Params = append(fd.Params, formField(name, "", h.ft.In(i), map[reflect.Type]bool{}))
+	}
+	return fd
+}
+
+func formField(name string, tag reflect.StructTag, t reflect.Type, visiting map[reflect.Type]bool) *FormField {
+	ts := cachedTypeSchema(t)
+	f := &FormField{
+		Name:     name,
+		Label:    tag.Get("label"),
+		Doc:      tag.Get("doc"),
+		Type:     ts.Kind,
+		Required: !ts.Nullable,
+	}
+	if ts.Format != "" {
+		f.Type = ts.Format
+	}
+	if f.Label == "" && name != "" {
+		f.Label = wordsOf(name)
+	}
+	if enum := tag.Get("enum"); enum != "" {
+		f.Enum = strings.Split(enum, ",")
+	}
+	switch tag.Get("required") {
+	case "true":
+		f.Required = true
+	case "false":
+		f.Required = false
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case ts.Kind == "array" || ts.Kind == "object" && ts.Elem != nil:
+		f.Elem = formField("", "", t.Elem(), visiting)
+	case ts.Kind == "object" && t.Kind() == reflect.Struct:
+		if visiting[t] {
+			return f
+		}
+		visiting[t] = true
+		f.Fields = formFields(t, visiting)
+		delete(visiting, t)
+	}
+	return f
+}
+
+// formFields follows the field names of encoding/json, embedded structs are flattened.
+func formFields(t reflect.Type, visiting map[reflect.Type]bool) (fs []*FormField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fs = append(fs, formFields(ft, visiting)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := formField(name, sf.Tag, sf.Type, visiting)
+		if strings.Contains(","+opts+",", ",omitempty,") && sf.Tag.Get("required") != "true" {
+			f.Required = false
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// wordsOf makes a label of a name, like created_at and CreatedAt are "Created at".
+func wordsOf(name string) string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ' || r == '.':
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+			continue
+		case unicode.IsUpper(r) && len(word) > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+			words = append(words, string(word))
+			word = nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	for i, w := range words {
+		if i > 0 && strings.ToUpper(w) != w {
+			words[i] = strings.ToLower(w)
+		}
+	}
+	if len(words) == 0 {
+		return name
+	}
+	first := []rune(words[0])
+	first[0] = unicode.ToUpper(first[0])
+	words[0] = string(first)
+	return strings.Join(words, " ")
+}
+
+// serveFormDescriptor responds the FormDescriptor of h to OPTIONS requests that are not CORS preflights.
+func (cfg *Config) serveFormDescriptor(w http.ResponseWriter, r *http.Request, h *Handler) bool {
+	if !cfg.ServeFormDescriptors || r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") != "" {
+		return false
+	}
+	allow := "POST, OPTIONS"
+	if h.opts.cacheableGET || h.opts.queryParams != nil {
+		allow = "GET, " + allow
+	}
+	w.Header().Set("Allow", allow)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.FormDescriptor())
+	return true
+}
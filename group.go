@@ -0,0 +1,131 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+)
+
+/*
+Group runs the concurrent downstream calls of a fan-out func with the request context, like errgroup.Group,
+so they all follow the cancellation of the request: the context of the calls is canceled when one of them fails,
+the Config.Timeout fires or the client went away. Inject it with GroupInjector:
+
+	func getDashboard(g *jsonhandlerfunc.Group, userID int) (d *Dashboard, err error) {
+		d = &Dashboard{}
+		g.Go(func(ctx context.Context) (err error) {
+			d.Orders, err = orders.List(ctx, userID)
+			return
+		})
+		g.Go(func(ctx context.Context) (err error) {
+			d.Messages, err = messages.List(ctx, userID)
+			return
+		})
+		err = g.Wait()
+		return
+	}
+
+A panic of a call is panicked again by Wait, so it's handled by the handler like a panic of the func.
+*/
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	errOnce sync.Once
+	err     error
+
+	mu       sync.Mutex
+	panicked interface{}
+	stack    []byte
+}
+
+// NewGroup creates a Group with the context derived from ctx, limit is the max calls running at the same time, 0 is no limit.
+func NewGroup(ctx context.Context, limit int) *Group {
+	g := &Group{}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	if limit > 0 {
+		g.sem = make(chan struct{}, limit)
+	}
+	return g
+}
+
+// GroupInjector returns an injector of a new Group of the request context for every request, with the limit of NewGroup.
+func GroupInjector(limit int) func(w http.ResponseWriter, r *http.Request) (g *Group, err error) {
+	return func(w http.ResponseWriter, r *http.Request) (g *Group, err error) {
+		g = NewGroup(r.Context(), limit)
+		return
+	}
+}
+
+// Context is the context of the calls, it's done when a call failed, or the request context is done.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+/*
+Go calls f in a new goroutine with the context of the group, it waits for a free slot when the limit is reached,
+and f is not called if the context is done before that.
+*/
+func (g *Group) Go(f func(ctx context.Context) error) {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(g.ctx.Err())
+			return
+		}
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if g.sem != nil {
+				<-g.sem
+			}
+		}()
+		defer func() {
+			if p := recover(); p != nil {
+				g.mu.Lock()
+				if g.panicked == nil {
+					g.panicked, g.stack = p, debug.Stack()
+				}
+				g.mu.Unlock()
+				g.cancel()
+			}
+		}()
+		if err := f(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *Group) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait waits for all the calls, and returns the first error of them, it panics again if a call panicked.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	if g.panicked != nil {
+		panic(&groupPanic{value: g.panicked, stack: g.stack})
+	}
+	return g.err
+}
+
+// groupPanic is the panic of a call of a Group panicked again by Wait, with the stack of the call.
+type groupPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *groupPanic) String() string {
+	return fmt.Sprintf("group call panicked: %v\n%s", p.value, p.stack)
+}
@@ -6,44 +6,193 @@ package jsonhandlerfunc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"reflect"
+	"sync"
+	"time"
 )
 
 type Config struct {
 	ErrHandler func(oldErr error) (newErr error)
-}
+	// ErrToStatusCode maps the errors of the funcs and the injectors without a StatusCodeError in the chain to the response status code,
+	// like 404 for sql.ErrNoRows, so the business errors don't need to be wrapped with NewStatusCodeError. 0 keeps the default 200.
+	ErrToStatusCode func(err error) int
+	// SuccessStatusCode is the status code of the responses without error, default is 200, WithSuccessStatusCode sets it for one handler.
+	SuccessStatusCode int
+	// DecodeErrorStatusCode is the status code of the requests whose params can't be decoded, like 400, default is 422.
+	// The errors of Validator keep their own status codes.
+	DecodeErrorStatusCode int
 
-var defaultConfig *Config = &Config{}
+	// Timeout limits how long the func may run, after that a TimeoutError is responded with 504.
+	// A deadline already set on the request context is respected the same way, the late return values of the func are discarded.
+	// The decoding of the request body stops at the deadline too, or when the client went away, so it doesn't keep a goroutine.
+	Timeout time.Duration
 
-func (cfg *Config) injectedParams(w http.ResponseWriter, r *http.Request, injectFunc interface{}, ft reflect.Type) (injVals []reflect.Value, shouldReturn bool) {
-	if injectFunc == nil {
-		return
-	}
-	v := reflect.ValueOf(injectFunc)
-	outVals := v.Call([]reflect.Value{reflect.ValueOf(w), reflect.ValueOf(r)})
-	var httpCode int
-	var err error
-	httpCode, _, injVals, err = cfg.returnVals(outVals)
-	if err != nil {
-		cfg.returnError(ft, w, err, httpCode)
-		shouldReturn = true
-	}
-	return
+	// ClientVersionHeader is the header that WithMinClientVersion reads, default is X-Client-Version.
+	ClientVersionHeader string
+	// CompareClientVersion returns -1, 0 or 1 when version is older, equal or newer than minVersion,
+	// default compares dotted numeric versions.
+	CompareClientVersion func(version, minVersion string) (int, error)
+
+	// AllowCompactEnvelope lets clients opt in the compact envelope with CompactEnvelopeHeader.
+	AllowCompactEnvelope bool
+
+	// OnProgress is called with the request when the func calls ReportProgress with its context.
+	OnProgress func(r *http.Request, p Progress)
+
+	// FaultInjection delays or fails calls for resilience testing, only when FaultInjectionEnv is set.
+	FaultInjection *FaultInjection
+
+	// ErrorValueMarshaler returns what to encode as ResponseError.Value for the error, default is DefaultErrorValue.
+	ErrorValueMarshaler func(err error) interface{}
+
+	// Languages are the supported languages negotiated from Accept-Language, the first is the default.
+	// The chosen one is set to Content-Language, and can be read from the func's context with Language.
+	Languages []string
+	// LocalizeResults post processes the results except the error for the negotiated language,
+	// like translating enum display names.
+	LocalizeResults func(ctx context.Context, lang string, results []interface{}) []interface{}
+
+	// Indent pretty prints the response json with the indent, like "  ", default is one line.
+	Indent string
+	// DisableHTMLEscape keeps <, > and & in the strings of the response json as they are, like in URLs,
+	// default escapes them like \u0026 for embedding in HTML.
+	DisableHTMLEscape bool
+	// FloatFormat is how the numbers of the response json are formatted, default FloatDefault is of encoding/json.
+	FloatFormat FloatFormat
+	// Compression compresses the responses with gzip, or other codings, negotiated from Accept-Encoding, default is not compressed.
+	Compression *Compression
+
+	// ParamStyle NamedParams also accepts the params as an object keyed by names, default is PositionalParams.
+	ParamStyle ParamStyle
+	// DisallowUnknownFields rejects the json params with fields that are not of their structs, or unknown names of NamedParams,
+	// with a ValidationError of the "unknown" rule, so misspelled fields are not silently zero values.
+	// Params more or less than the func's are always rejected with a ParamsCountError.
+	DisallowUnknownFields bool
+	// RequireParams rejects the json params that are null, or omitted names of NamedParams, with a ValidationError
+	// of the "required" rule, WithRequiredParams requires some params of a handler.
+	RequireParams bool
+
+	// EmitEnvelopeVersion sets EnvelopeHeader to the response, and negotiates the version the request asks for.
+	EmitEnvelopeVersion bool
+
+	// JSONRPC speaks JSON-RPC 2.0 instead of the params and results envelope,
+	// serve a Registry to dispatch by the "method" of the requests.
+	JSONRPC bool
+
+	// AllowBatch accepts an array of request envelopes in one request, and responds the array of their responses.
+	AllowBatch bool
+	// Pools are the workers of the classes of handlers by WithPoolClass, see Pool.
+	Pools map[string]*Pool
+	// DefaultPoolClass is the class of the handlers without WithPoolClass, default is not limited by a pool.
+	DefaultPoolClass string
+
+	// BatchConcurrency is how many calls of a batch run at the same time, default 1 runs them in order.
+	BatchConcurrency int
+	// MaxBatchSize is the max calls of a batch, default is DefaultMaxBatchSize.
+	MaxBatchSize int
+
+	// ShapeResults post processes the results except the error with the request state, like the injected user,
+	// for filtering fields by role or adding links. It's called after LocalizeResults.
+	ShapeResults func(state *RequestState, results []interface{}) []interface{}
+
+	// IsAuthenticated reports if the request is authenticated for RequireAuthenticated, default checks the Authorization header is set.
+	IsAuthenticated func(r *http.Request) bool
+	// TrustForwardedProto lets RequireTLS accept requests with X-Forwarded-Proto https, set it behind a TLS terminating proxy.
+	TrustForwardedProto bool
+
+	// CheckQuota is called after the injectors with the request state, like the injected API key or tenant,
+	// an error is responded instead of calling the func, return a QuotaExceededError for 429.
+	CheckQuota func(state *RequestState) error
+	// Residency rejects the requests of the data in other regions with the endpoints of the regions, see Residency.
+	Residency *Residency
+	// OnUsage is called with the request and response sizes after every response, for usage based billing or abuse detection.
+	OnUsage func(state *RequestState, usage *Usage)
+
+	// Codecs are the encodings besides JSON, selected by the Content-Type and Accept of the request, see Codec.
+	Codecs []Codec
+
+	// ServeFormDescriptors responds the FormDescriptor of the handler to OPTIONS requests, except CORS preflights.
+	ServeFormDescriptors bool
+	// MaxRequestBodyBytes rejects the request bodies larger than it with a RequestTooLargeError of 413, including the uploaded files,
+	// before the func is called, default is no limit.
+	MaxRequestBodyBytes int64
+	// DecodeTimeout rejects the request bodies not read in it after the request started, like of slow-drip clients,
+	// with a RequestTimeoutError of 408, default is no timeout.
+	DecodeTimeout time.Duration
+	// MaxMultipartMemory is how many bytes of the uploaded files are kept in memory, default is DefaultMaxMultipartMemory.
+	MaxMultipartMemory int64
+	// MaxQueryEnvelopeBytes rejects the QueryEnvelopeKey envelopes of GET requests larger than it when decoded
+	// with a RequestTooLargeError of 413, default is DefaultMaxQueryEnvelope.
+	MaxQueryEnvelopeBytes int64
+
+	// Validator checks the params after they are decoded and before the func is called, with the params after the injected ones,
+	// return a ValidationError to respond the invalid fields with 422, ValidateTags checks validate struct tags.
+	Validator func(params []interface{}) error
+
+	// ResponseShape changes the envelope of the responses, default is {"results": [...]}.
+	ResponseShape *ResponseShape
+
+	// Maintenance puts all the handlers of the config in maintenance while it's started, see Maintenance.
+	Maintenance *Maintenance
+
+	// StructuredErrors responds the errors as {"error": {"code": ..., "message": ..., "details": ...}} for clients to branch on the code,
+	// the code is of the ErrorCoder, and the details of the ErrorDetailer or else the error value.
+	StructuredErrors bool
+
+	// PanicHandler returns the error to respond when the func or an injector panicked, with 500 unless it has a status code,
+	// default logs the panic and the stack, and responds a PanicError. WithPanicIsolation handlers use its OnPanic instead.
+	PanicHandler func(recovered interface{}, stack []byte) error
+
+	// QueryParams decodes the params of GET requests with an empty body from the query, for linkable read endpoints,
+	// like /users?params=["felix"], or /users?name=felix by the names of WithParamNames or the fields of the single struct param.
+	// Only enable it for configs of read only funcs, WithCacheableGET enables it for one handler.
+	QueryParams bool
+
+	// OnOps is called after the response with the timings of the ops the func started with StartOp, for metrics and tracing.
+	OnOps func(state *RequestState, ops []OpTiming)
+	// DebugOps responds the timings of the ops in the meta and the Server-Timing header, for local development.
+	DebugOps bool
+
+	// Middlewares wrap the handlers created with the config, the first one is the outermost, see Use.
+	Middlewares []func(http.Handler) http.Handler
+
+	// OnRequest is called before the func is called, with the reflected func name and the params after the injected ones,
+	// see WithRedactedParams for sensitive params. The params of a Callable are json.RawMessage.
+	OnRequest func(ctx context.Context, funcName string, params []interface{})
+	// OnResponse is called after the func returned, with the results except the error, and the error of the func or the call,
+	// like a TimeoutError or a PanicError, for metrics and structured logs of every call.
+	OnResponse func(ctx context.Context, funcName string, results []interface{}, err error, duration time.Duration)
+	// SurfaceBagKeys are the names of the Bag values that are responded in the meta by BagMetaKey, and returned by Bag.Surfaced for the logs.
+	SurfaceBagKeys []string
+	// Metrics records the calls, their status codes and latencies, like the Collector of the metrics package.
+	Metrics MetricsRecorder
+
+	// Logger logs every request after its response with the method, the func name, the status code, the duration and the error.
+	Logger *slog.Logger
+	// LogParams and LogResults also log the params and the results of the func, redacted by RedactLogField,
+	// the struct fields tagged `log:"redact"` and WithRedactedParams.
+	LogParams  bool
+	LogResults bool
+	// RedactLogField reports if the struct field or map key of the json name must be logged as RedactedParam, like passwords and tokens.
+	RedactLogField func(name string) bool
+
+	// typeCodecs are the types registered with RegisterType
+	typeCodecs map[reflect.Type]*typeCodec
 }
 
+var defaultConfig *Config = &Config{}
+
 func contextInjector(w http.ResponseWriter, r *http.Request) (ctx context.Context, err error) {
 	ctx = r.Context()
 	return
 }
 
-type needIndirectValue struct {
-	needIndirect bool
-	val          interface{}
-}
-
 var errorNil = reflect.Zero(reflect.TypeOf((*error)(nil)).Elem())
 
 /*
@@ -52,17 +201,70 @@ that will accept json.Unmarshal request body as parameters,
 and response with a body with a return values into json.
 
 The second argument is an arguments injector, it's parameter should be (w http.ResponseWriter, r *http.Request), and return values
-Will be injected to first func's first few arguments.
+Will be injected to first func's first few arguments, after the request context if the first argument is a context.Context. An injector can also take the values injected by the injectors before it
+before (w http.ResponseWriter, r *http.Request), like func(s *Session, w http.ResponseWriter, r *http.Request) (u *User, err error).
+
+Options like WithRequiredHeaders can be mixed in to customize this handler.
 */
 func ToHandlerFunc(funcs ...interface{}) http.HandlerFunc {
 	return defaultConfig.ToHandlerFunc(funcs...)
 }
 
 func (cfg *Config) ToHandlerFunc(funcs ...interface{}) http.HandlerFunc {
+	return cfg.NewHandler(funcs...).ServeHTTP
+}
 
+/*
+Handler is what ToHandlerFunc serves with, it can also be called in process with Invoke.
+*/
+type Handler struct {
+	cfg                 *Config
+	opts                *handlerOptions
+	v                   reflect.Value
+	ft                  reflect.Type
+	argsInjectors       []interface{}
+	injectorArgs        [][]int
+	firstIsAlsoInjector bool
+	hasInjectors        bool
+	delegateIndex       int
+	streamIndex         int
+	eventsIndex         int
+	faults              *FaultInjection
+	tally               *panicTally
+	pool                *Pool
+	hasListOptions      bool
+	callable            Callable
+	encryption          *fieldEncryption
+	argPlans            []argPlan
+	// argsPool pools the handlerArgs of the calls
+	argsPool sync.Pool
+	// chain is the handler wrapped by Config.Middlewares, and invokeChain is the one of Invoke
+	chain, invokeChain http.Handler
+
+	// inFlight and calls are the stats of Diagnostics
+	inFlight, calls int64
+}
+
+// NewHandler is the same as ToHandlerFunc, but returns the *Handler
+func NewHandler(funcs ...interface{}) *Handler {
+	return defaultConfig.NewHandler(funcs...)
+}
+
+func (cfg *Config) NewHandler(funcs ...interface{}) *Handler {
+	h := cfg.newHandler(funcs...)
+	h.chain = cfg.wrapMiddlewares(http.HandlerFunc(h.serve))
+	h.invokeChain = cfg.wrapMiddlewares(http.HandlerFunc(h.serveInvoke))
+	return h
+}
+
+func (cfg *Config) newHandler(funcs ...interface{}) *Handler {
+	funcs, opts := splitOptions(funcs)
 	if len(funcs) == 0 {
 		panic("pass in one or more func, from the second one is all arguments injector.")
 	}
+	if c, ok := funcs[0].(Callable); ok {
+		return cfg.newCallableHandler(c, funcs[1:], opts)
+	}
 	var serverFunc = funcs[0]
 	v := reflect.ValueOf(serverFunc)
 	ft := v.Type()
@@ -79,150 +281,717 @@ func (cfg *Config) ToHandlerFunc(funcs ...interface{}) http.HandlerFunc {
 			}
 		}
 		check(injt)
-		if !isInjector(injt) {
-			panic("injector params must be func(w http.ResponseWriter, r *http.Request) ...")
+		if !isChainedInjector(injt) {
+			panic("injector params must be func(w http.ResponseWriter, r *http.Request) ..., or with the injected values before w")
 		}
 		argsInjectors = append(argsInjectors, injector)
 	}
-	// if first argument is context, use contextInjector
-	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
-	if len(funcs) == 1 && ft.NumIn() > 0 && ft.In(0).Implements(contextType) {
-		argsInjectors = append(argsInjectors, contextInjector)
+	// the injectors passed in, the contextInjector doesn't depend on the user
+	hasInjectors := len(argsInjectors) > 0
+	// if first argument is context, use contextInjector before the other injectors, unless the first of them injects a context
+	if !firstIsAlsoInjector && ft.NumIn() > 0 && ft.In(0).Implements(contextType) && !injectsContext(argsInjectors) {
+		argsInjectors = append([]interface{}{contextInjector}, argsInjectors...)
 	}
 
 	if !firstIsAlsoInjector {
 		checkInjectorsType(ft, argsInjectors)
 	}
+	injectorArgs := chainInjectors(argsInjectors)
+	opts.validate(cfg, ft, firstIsAlsoInjector)
+	if opts.partialTimeout != nil {
+		opts.partialTimeout.check(ft)
+	}
+	opts.checkEnvelopeSections(ft, injectedCount(argsInjectors))
+	opts.checkRedactedParams(ft, injectedCount(argsInjectors))
+	opts.checkRequiredParams(ft, injectedCount(argsInjectors))
+	if !firstIsAlsoInjector {
+		opts.checkParamNames(ft, injectedCount(argsInjectors))
+		opts.checkResultNames(ft)
+	}
+	firstParam := injectedCount(argsInjectors)
+	if firstIsAlsoInjector {
+		firstParam = ft.NumIn()
+	}
+	opts.checkQueryParams(ft, firstParam)
+	cfg.checkValidateTags(ft, firstParam)
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		var injectVals []reflect.Value
-		for _, injector := range argsInjectors {
-			thisInjectVals, shouldReturn := cfg.injectedParams(w, r, injector, ft)
-			if shouldReturn {
-				return
-			}
-			injectVals = append(injectVals, thisInjectVals...)
+	return &Handler{
+		cfg:                 cfg,
+		opts:                opts,
+		v:                   v,
+		ft:                  ft,
+		argsInjectors:       argsInjectors,
+		injectorArgs:        injectorArgs,
+		firstIsAlsoInjector: firstIsAlsoInjector,
+		hasInjectors:        hasInjectors,
+		delegateIndex:       handlerResultIndex(ft),
+		streamIndex:         streamResultIndex(ft),
+		eventsIndex:         eventStreamIndex(ft),
+		faults:              cfg.faults(opts),
+		tally:               opts.newPanicTally(),
+		pool:                cfg.pool(opts),
+		hasListOptions:      hasListOptionsParam(ft),
+		encryption:          newFieldEncryption(opts.fieldCipher, cfg.ResponseShape, ft, firstParam),
+		argPlans:            newArgPlans(cfg, opts, ft, firstParam),
+	}
+}
+
+// ServeHTTP serves the calls of a batch one by one, each through Config.Middlewares
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer h.cfg.limitBody(w, r)()
+	if h.cfg.serveBatch(w, r, h) {
+		return
+	}
+	h.chain.ServeHTTP(w, r)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
+	cfg, opts, ft := h.cfg, h.opts, h.ft
+	if cfg.serveFormDescriptor(w, r, h) {
+		return
+	}
+	rw := cfg.newResponseWriter(w, r)
+	w = rw
+
+	c, r := h.newCall(r)
+	defer c.cancel()
+	defer h.track()()
+	endMetrics := h.recordMetrics()
+	defer func() { endMetrics(rw.statusCode()) }()
+	defer h.logRequest(rw, r, c)()
+	defer cfg.reportOps(r)()
+	if cfg.DebugOps {
+		rw.opState = RequestStateOf(r.Context())
+	}
+	rw.resultNames = opts.namedResults(r)
+	rw.bag = BagOf(r.Context())
+	rw.funcHeader = ResponseHeaderOf(r.Context())
+	rw.warnings = warningsOf(r.Context())
+	if opts.timingMeta {
+		rw.timing = &timingMeta{start: c.start, ctx: c.requestCtx}
+	}
+	defer cfg.countUsage(rw, r, c.start)()
+	defer opts.tee.record(rw, r, c.start, h.encryption)()
+
+	if h.tally != nil {
+		if h.tally.disabled() {
+			cfg.returnError(ft, w, &HandlerDisabledError{Code: HandlerDisabledCode}, http.StatusServiceUnavailable)
+			return
 		}
+		defer h.isolate(c, func(err error) {
+			cfg.returnError(ft, w, err, http.StatusInternalServerError)
+		})
+	} else {
+		defer h.recoverPanic(func(err error) {
+			cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusInternalServerError))
+		})
+	}
 
-		if firstIsAlsoInjector {
-			injectVals = append(injectVals, errorNil)
-			httpCode, outs, _, _ := cfg.returnVals(injectVals)
-			w.WriteHeader(httpCode)
-			writeJSONResponse(w, outs)
+	if err := h.checkMaintenance(w); err != nil {
+		cfg.returnError(ft, w, err, http.StatusServiceUnavailable)
+		return
+	}
+	if httpCode, err := h.checkRequest(rw, r); err != nil {
+		cfg.returnError(ft, w, err, httpCode)
+		return
+	}
+	if h.callable != nil {
+		if err := cfg.checkResidency(r); err != nil {
+			cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusInternalServerError))
+			return
+		}
+		if err := cfg.checkQuota(w, r); err != nil {
+			cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusTooManyRequests))
 			return
 		}
+		h.serveCallable(w, r, c)
+		return
+	}
 
-		// log.Printf("injectVals: %#+v\n", len(injectVals))
-		injectedCount := len(injectVals)
+	injectVals, httpCode, responded, err := h.inject(w, r)
+	if responded {
+		return
+	}
+	if err != nil {
+		cfg.returnError(ft, w, err, httpCode)
+		return
+	}
+	RequestStateOf(r.Context()).setInjected(injectVals)
+	if err := cfg.checkResidency(r); err != nil {
+		cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusInternalServerError))
+		return
+	}
+	if err := cfg.checkQuota(w, r); err != nil {
+		cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusTooManyRequests))
+		return
+	}
+	if opts.responseCache != nil && opts.isCacheableGET(r) {
+		served, store := opts.responseCache.serve(rw, r, h, opts.getMaxAge)
+		if served {
+			return
+		}
+		defer store()
+	}
 
-		var params []interface{}
-		var notNilParams []interface{}
-		numIn := ft.NumIn()
-		var ptrs = make([]bool, numIn)
+	if h.firstIsAlsoInjector {
+		injectVals = append(injectVals, errorNil)
+		httpCode, outs, _, _ := cfg.returnVals(injectVals)
+		writeJSONResponse(w, httpCode, outs)
+		return
+	}
 
-		for i := 0; i < numIn; i++ {
-			if i < injectedCount {
-				continue
+	args := h.newArgs(len(injectVals))
+	defer args.release()
+	if args.needDecode() {
+		stopWatching := watchBody(w, r)
+		defer stopWatching()
+		var body io.Reader = r.Body
+		var err error
+		queryGET := h.isQueryGET(r)
+		if queryGET {
+			if body, err = args.queryEnvelope(r); err != nil {
+				cfg.returnError(ft, w, err, statusCodeOf(err, cfg.decodeErrorStatusCode()))
+				return
 			}
-
-			paramType := ft.In(i)
-			// log.Printf("paramType: %#+v\n", paramType.String())
-			ptrs[i] = true
-			var pv interface{}
-			switch paramType.Kind() {
-			case reflect.Chan:
-				panic("params can not be chan type.")
-			case reflect.Ptr:
-				pv = reflect.New(paramType.Elem()).Interface()
-			case reflect.Array, reflect.Slice, reflect.Map:
-				pv = reflect.New(paramType).Interface()
-				ptrs[i] = false
-			default:
-				pv = reflect.New(paramType).Interface()
-				ptrs[i] = false
+		} else if isMultipart(r) {
+			body, err = cfg.multipartEnvelope(r)
+			defer removeMultipartFiles(r)
+		} else if h.delegateIndex >= 0 {
+			body = cfg.bufferDelegatedBody(w, r)
+		}
+		defer r.Body.Close()
+		if err == nil {
+			var dupErr error
+			if body, dupErr = opts.checkDuplicateKeys(body, requestCodec(w)); dupErr != nil {
+				if _, ok := dupErr.(*DuplicateKeyError); ok {
+					cfg.returnError(ft, w, dupErr, cfg.decodeErrorStatusCode())
+					return
+				}
+				err = dupErr
 			}
-			// log.Printf("pv: %#+v\n", pv)
-			params = append(params, pv)
-			notNilParams = append(notNilParams, pv)
 		}
-
-		if len(params) > 0 {
-			dec := json.NewDecoder(r.Body)
-			defer r.Body.Close()
-			req := Req{
-				Params: &params,
+		if err == nil {
+			var strictErr error
+			if body, strictErr = h.checkStrict(body, requestCodec(w), isCompact(w)); strictErr != nil {
+				if _, ok := strictErr.(*ValidationError); ok {
+					cfg.returnError(ft, w, strictErr, cfg.decodeErrorStatusCode())
+					return
+				}
+				err = strictErr
 			}
-			err := dec.Decode(&req)
-			if err != nil {
-				log.Println("jsonhandlerfunc: decode request params error:", err)
-				cfg.returnError(ft, w, fmt.Errorf("decode request params error"), http.StatusUnprocessableEntity)
+		}
+		if err == nil {
+			err = args.decode(body, requestCodec(w), isCompact(w))
+		}
+		stopWatching()
+		if ctxErr := c.contextError(r.Context()); err != nil && ctxErr != nil {
+			if ctxErr == context.Canceled {
+				// the client went away, no one reads the response
 				return
 			}
+			cfg.returnError(ft, w, ctxErr, statusCodeOf(ctxErr, http.StatusGatewayTimeout))
+			return
+		}
+		if bodyErr := bodyError(err); bodyErr != nil {
+			cfg.returnError(ft, w, bodyErr, statusCodeOf(bodyErr, cfg.decodeErrorStatusCode()))
+			return
+		}
+		if err != nil {
+			log.Println("jsonhandlerfunc: decode request params error:", err)
+			cfg.returnError(ft, w, fmt.Errorf("decode request params error"), cfg.decodeErrorStatusCode())
+			return
+		}
+		if err := args.bindRequest(r, queryGET); err != nil {
+			cfg.returnError(ft, w, err, cfg.decodeErrorStatusCode())
+			return
 		}
+		if err := args.resolveFiles(r); err != nil {
+			cfg.returnError(ft, w, err, cfg.decodeErrorStatusCode())
+			return
+		}
+	}
 
-		inVals := injectVals
-		for i, p := range params {
+	inVals, err := args.inVals(injectVals)
+	if err != nil {
+		cfg.returnError(ft, w, err, cfg.decodeErrorStatusCode())
+		return
+	}
+	if err := h.checkListOptions(inVals); err != nil {
+		cfg.returnError(ft, w, err, cfg.decodeErrorStatusCode())
+		return
+	}
+	if err := h.validate(inVals); err != nil {
+		cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusUnprocessableEntity))
+		return
+	}
+	var pageStart int
+	if opts.pageSize > 0 {
+		if pageStart, err = pageOffset(args.cursor, inVals[len(injectVals):]); err != nil {
+			cfg.returnError(ft, w, err, cfg.decodeErrorStatusCode())
+			return
+		}
+	}
 
-			var val = reflect.ValueOf(p)
-			if !val.IsValid() {
-				val = reflect.ValueOf(notNilParams[i])
-			}
+	outVals, degraded, err := h.call(c, r.Context(), inVals)
+	if cfg.Logger != nil {
+		c.logCall(len(injectVals), inVals, outVals, err)
+	}
+	if degraded {
+		rw.setMeta(DegradedMetaKey, true)
+	}
+	if c.attempts > 1 {
+		rw.setMeta(AttemptsMetaKey, c.attempts)
+	}
+	if err != nil {
+		cfg.returnError(ft, w, err, statusCodeOf(err, http.StatusInternalServerError))
+		return
+	}
+	if dh := delegatedHandler(outVals, h.delegateIndex); dh != nil {
+		dh.ServeHTTP(w, r)
+		return
+	}
+	if s := h.streamed(outVals); s != nil {
+		s.ServeHTTP(w, r)
+		return
+	}
+	if es := h.eventStream(outVals); es != nil {
+		es.serveEvents(w, r, cfg)
+		return
+	}
+	if err := resultCycle(outVals); err != nil {
+		cfg.returnError(ft, w, err, http.StatusInternalServerError)
+		return
+	}
+	httpCode, outs, _, _ := cfg.returnVals(outVals)
+	if outVals[len(outVals)-1].IsNil() {
+		httpCode = cfg.successStatusCode(opts)
+	}
+	if opts.pageSize > 0 && outVals[len(outVals)-1].IsNil() {
+		h.paginate(rw, outs, pageStart, inVals[len(injectVals):])
+	}
+	if opts.isCacheableGET(r) && httpCode < 300 {
+		h.setCacheHeaders(w)
+	}
+	outs = cfg.localizeResults(w, r, outs)
+	outs = cfg.shapeResults(r, outs)
+	outs = opts.toProtoStruct(outs)
+	if opts.auditChain != nil {
+		if err := opts.auditChain.add(w, RequestStateOf(r.Context()), funcName(h.v), inVals[len(injectVals):], outs, h.encryption); err != nil {
+			cfg.returnError(ft, w, fmt.Errorf("audit receipt error: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if opts.notModified(w, r, httpCode, outs) {
+		return
+	}
+	writeJSONResponse(w, httpCode, outs)
+}
 
-			if !ptrs[i+injectedCount] {
-				val = reflect.Indirect(val)
-			}
-			inVals = append(inVals, val)
+// handlerCall is the state of one call of the func
+type handlerCall struct {
+	start time.Time
+	// requestCtx is the request context, the func's context is canceled separately by cancelMain for WithPartialTimeout
+	requestCtx context.Context
+	cancelMain context.CancelFunc
+	cancels    []context.CancelFunc
+	// attempts is how many times the func is called by WithAutoRetry
+	attempts int
+	// called is true once the func is called, after the checks and the Pool, panicked if the func panicked then
+	called, panicked bool
+	// the params from loggedFirstIndex, the results and the error of the call for Config.Logger
+	loggedFirstIndex int
+	loggedParams     []interface{}
+	loggedResults    []interface{}
+	loggedErr        error
+}
+
+// markCalled marks the func is called for WithPanicIsolation, the returned func is deferred to mark it panicked.
+func (c *handlerCall) markCalled() func() {
+	c.called = true
+	return func() {
+		if p := recover(); p != nil {
+			c.panicked = true
+			panic(p)
+		}
+	}
+}
+
+func (c *handlerCall) cancel() {
+	for _, cancel := range c.cancels {
+		cancel()
+	}
+}
+
+// checkRequest checks the protocol and the headers of the request before any work.
+func (h *Handler) checkRequest(rw *responseWriter, r *http.Request) (httpCode int, err error) {
+	cfg, opts := h.cfg, h.opts
+	if rw.jsonrpc != nil && rw.jsonrpc.err != nil {
+		return http.StatusBadRequest, rw.jsonrpc.err
+	}
+	if err = cfg.negotiateEnvelope(rw, r); err != nil {
+		return http.StatusNotAcceptable, err
+	}
+	if err = cfg.checkBodySize(r); err != nil {
+		return http.StatusRequestEntityTooLarge, err
+	}
+	if err = cfg.checkPreconditions(r, opts.preconditions); err != nil {
+		return statusCodeOf(err, http.StatusBadRequest), err
+	}
+	if err = opts.checkRequiredHeaders(r); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err = cfg.checkClientVersion(r, opts.minClientVersion); err != nil {
+		return http.StatusUpgradeRequired, err
+	}
+	return
+}
+
+// newCall sets the timeout, progress listeners and language to the request context.
+func (h *Handler) newCall(r *http.Request) (c *handlerCall, nr *http.Request) {
+	c = &handlerCall{start: time.Now(), cancelMain: func() {}}
+	if h.cfg.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), h.cfg.Timeout)
+		c.cancels = append(c.cancels, cancel)
+		r = r.WithContext(ctx)
+	}
+	r = h.cfg.withProgressListener(r)
+	r = h.cfg.withLanguage(r)
+	r = withResponseHeader(r)
+	r = withWarnings(r)
+	c.requestCtx = r.Context()
+	if h.opts.partialTimeout != nil {
+		mainCtx, cancelMain := context.WithCancel(c.requestCtx)
+		c.cancelMain = cancelMain
+		c.cancels = append(c.cancels, cancelMain)
+		r = r.WithContext(mainCtx)
+	}
+	r = h.cfg.withBag(r)
+	r = withRequestState(r)
+	RequestStateOf(r.Context()).ops = &opRecorder{timeouts: h.opts.opTimeouts}
+	return c, r
+}
+
+/*
+inject calls the injectors, responded is true if an injector already wrote the response,
+like a redirect or auth challenge, that should be passed through as is.
+*/
+func (h *Handler) inject(w http.ResponseWriter, r *http.Request) (injectVals []reflect.Value, httpCode int, responded bool, err error) {
+	for i, injector := range h.argsInjectors {
+		outVals := reflect.ValueOf(injector).Call(injectorInVals(h.injectorArgs[i], injectVals, w, r))
+		if rw, ok := w.(*responseWriter); ok && rw.wroteHeader {
+			responded = true
+			return
 		}
+		var thisInjectVals []reflect.Value
+		httpCode, _, thisInjectVals, err = h.cfg.returnVals(outVals)
+		if err != nil {
+			return
+		}
+		injectVals = append(injectVals, thisInjectVals...)
+	}
+	return
+}
 
-		if len(inVals) != numIn {
-			cfg.returnError(ft, w, fmt.Errorf("require %d params, but passed in %d params", numIn, len(inVals)), http.StatusUnprocessableEntity)
+// call calls the func in the Pool of its class with fault injection, Timeout, WithPartialTimeout and WithAutoRetry applied.
+func (h *Handler) call(c *handlerCall, mainCtx context.Context, inVals []reflect.Value) (outVals []reflect.Value, degraded bool, err error) {
+	defer h.observeCall(c.requestCtx, inVals)(&outVals, &err)
+	if h.faults != nil {
+		if err = h.faults.inject(mainCtx); err != nil {
+			if mainCtx.Err() != nil {
+				err = c.contextError(mainCtx)
+			}
 			return
 		}
+	}
+	release, err := h.pool.acquire(c.requestCtx, c.start)
+	if err != nil {
+		return
+	}
+	ctx, release := h.pool.hold(c.requestCtx, release)
+	defer release()
+	defer c.markCalled()()
+	if h.opts.partialTimeout != nil {
+		return h.opts.partialTimeout.call(ctx, mainCtx, c.cancelMain, c.start, h.v, inVals)
+	}
+	if h.opts.autoRetry != nil {
+		outVals, err = h.opts.autoRetry.call(ctx, c, h, inVals)
+		return
+	}
+	outVals, err = callWithDeadline(ctx, c.start, h.v, inVals)
+	return
+}
+
+// handlerArgs holds the params decoded from the request for the func's arguments after the injected ones.
+type handlerArgs struct {
+	h             *Handler
+	ft            reflect.Type
+	injectedCount int
+	params        []interface{}
+	notNilParams  []interface{}
+	argIndexes    []int
+	sections      map[string]interface{}
+	cursor        string
+	argVals       []interface{}
+}
+
+/*
+argPlan is the reflection of a param after the injected ones, computed once when the handler is created,
+so that a call only allocates the values the params are decoded to.
+*/
+type argPlan struct {
+	index int
+	// newType is the type of the value to decode to, the param is the pointer to it if ptr is true
+	newType  reflect.Type
+	ptr      bool
+	file     bool
+	multiple bool
+	section  string
+	// schema is the type schema of the param for the query args, only with WithCacheableGET, the bound params or Config.QueryParams
+	schema *TypeSchema
+	// decode is of the type registered with RegisterType
+	decode func(raw json.RawMessage) (reflect.Value, error)
+}
+
+func newArgPlans(cfg *Config, opts *handlerOptions, ft reflect.Type, injectedCount int) (plans []argPlan) {
+	for i := injectedCount; i < ft.NumIn(); i++ {
+		paramType := ft.In(i)
+		plan := argPlan{index: i, newType: paramType}
+		switch paramType.Kind() {
+		case reflect.Chan:
+			panic("params can not be chan type.")
+		case reflect.Ptr:
+			plan.newType = paramType.Elem()
+			plan.ptr = true
+		}
+		if isFileParam(paramType) {
+			plan.file = true
+			plan.multiple = paramType == fileHeadersType
+		} else {
+			plan.decode = cfg.typeDecoder(plan.newType)
+		}
+		plan.section = opts.envelopeSections[i]
+		if opts.cacheableGET || opts.bindsRequest() || cfg.QueryParams {
+			plan.schema = cachedTypeSchema(paramType)
+		}
+		plans = append(plans, plan)
+	}
+	return
+}
+
+// newArgs gets the args from the pool of the handler, with new values of the params to decode to.
+func (h *Handler) newArgs(injectedCount int) *handlerArgs {
+	args, _ := h.argsPool.Get().(*handlerArgs)
+	if args == nil {
+		args = &handlerArgs{
+			h:        h,
+			ft:       h.ft,
+			sections: map[string]interface{}{},
+			argVals:  make([]interface{}, h.ft.NumIn()),
+		}
+	}
+	args.injectedCount = injectedCount
 
-		outVals := v.Call(inVals)
-		httpCode, outs, _, _ := cfg.returnVals(outVals)
-		w.WriteHeader(httpCode)
-		writeJSONResponse(w, outs)
+	for _, plan := range h.argPlans {
+		var pv interface{}
+		if plan.file {
+			pv = &fileParam{multiple: plan.multiple}
+		} else if plan.decode != nil {
+			pv = &typeParam{decode: plan.decode, val: reflect.New(plan.newType)}
+		} else {
+			pv = reflect.New(plan.newType).Interface()
+		}
+		if plan.section != "" {
+			args.sections[plan.section] = pv
+			args.argVals[plan.index] = pv
+			continue
+		}
+		args.params = append(args.params, pv)
+		args.notNilParams = append(args.notNilParams, pv)
+		args.argIndexes = append(args.argIndexes, plan.index)
+	}
+	return args
+}
+
+/*
+release puts args back to the pool of the handler after the response, the slices are cleared to their capacity,
+since decoding to them reuses the elements after their length.
+*/
+func (args *handlerArgs) release() {
+	clearValues(args.params)
+	clearValues(args.notNilParams)
+	clearValues(args.argVals)
+	args.params = args.params[:0]
+	args.notNilParams = args.notNilParams[:0]
+	args.argIndexes = args.argIndexes[:0]
+	for name := range args.sections {
+		delete(args.sections, name)
+	}
+	args.cursor = ""
+	args.h.argsPool.Put(args)
+}
+
+func clearValues(vals []interface{}) {
+	vals = vals[:cap(vals)]
+	for i := range vals {
+		vals[i] = nil
+	}
+}
+
+// needDecode is true if there are params to decode, or the cursor of WithAutoPaginate
+func (args *handlerArgs) needDecode() bool {
+	return len(args.params) > 0 || len(args.sections) > 0 || args.h.opts.pageSize > 0
+}
+
+func (args *handlerArgs) decode(body io.Reader, codec Codec, compact bool) (err error) {
+	var params interface{} = &args.params
+	if args.h.cfg.ParamStyle == NamedParams {
+		params = &namedParams{args: args}
+	} else if args.variadic() {
+		params = &variadicParams{args: args}
+	}
+	req := envelopeReq{
+		compactReq: compactReq{
+			Params: params,
+		},
+		sections: args.sections,
+	}
+	if args.h.opts.pageSize > 0 {
+		req.cursor = &args.cursor
+	}
+	if compact {
+		req.P = params
+	}
+	err = codec.Decode(body, &req)
+	if err == io.EOF && len(args.params) == 0 && len(args.sections) == 0 {
+		// only the cursor is decoded, the body can be empty for the first page
+		err = nil
+	}
+	if err == io.EOF && args.h.opts.bindsRequest() {
+		// the params are bound from the request, like of GET /users/{id}
+		err = nil
+	}
+	return
+}
 
+func (args *handlerArgs) inVals(injectVals []reflect.Value) (inVals []reflect.Value, err error) {
+	numIn := args.ft.NumIn()
+	passedCount := args.injectedCount + len(args.sections) + len(args.params)
+	if passedCount != numIn {
+		err = args.h.paramsCountError(args.injectedCount, len(args.params), false)
 		return
 	}
+
+	for i, p := range args.params {
+		if p == nil {
+			p = args.notNilParams[i]
+		}
+		args.argVals[args.argIndexes[i]] = p
+	}
+
+	inVals = injectVals
+	for _, plan := range args.h.argPlans {
+		var val = reflect.ValueOf(args.argVals[plan.index])
+		if tp, ok := args.argVals[plan.index].(*typeParam); ok {
+			val = tp.val
+		}
+		if !plan.ptr {
+			val = reflect.Indirect(val)
+		}
+		inVals = append(inVals, val)
+	}
+	return
 }
 
 func (cfg *Config) returnVals(outVals []reflect.Value) (httpCode int, outs []interface{}, normalVals []reflect.Value, err error) {
 	normalVals = outVals[0 : len(outVals)-1]
-	httpCode = http.StatusOK
+	httpCode = cfg.successStatusCode(nil)
 
 	for _, nVal := range normalVals {
-		ov := nVal.Interface()
-		outs = append(outs, ov)
+		outs = append(outs, cfg.encodeType(nVal))
 	}
 
 	last := outVals[len(outVals)-1].Interface()
 	if last != nil {
 		err = last.(error)
-		if httpE, ok := last.(StatusCodeError); ok {
-			httpCode = httpE.StatusCode()
-		}
+		httpCode = cfg.errStatusCode(err, http.StatusOK)
 		if codeWithErr, ok := last.(*errorWithStatusCode); ok {
 			err = codeWithErr.innerErr
 		}
-		if cfg.ErrHandler != nil {
-			err = cfg.ErrHandler(err)
-		}
-		outs = append(outs, &ResponseError{Error: err.Error(), Value: err})
+		outs = append(outs, cfg.responseError(err))
 	} else {
 		outs = append(outs, nil)
 	}
 	return
 }
 
-func writeJSONResponse(w http.ResponseWriter, out interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	enc := json.NewEncoder(w)
-	err := enc.Encode(Resp{Results: out})
+func writeJSONResponse(w http.ResponseWriter, httpCode int, out interface{}) {
+	if alreadyWritten(w, httpCode) {
+		return
+	}
+	var meta map[string]interface{}
+	var warnings []Warning
+	var codec Codec
+	var shape *ResponseShape
+	var resultNames []resultName
+	var noEscapeHTML bool
+	if rw, ok := w.(*responseWriter); ok {
+		if rw.jsonrpc != nil {
+			rw.jsonrpc.write(w, httpCode, out)
+			return
+		}
+		rw.debugOps()
+		rw.setTimingMeta(httpCode)
+		rw.setBagMeta()
+		meta = rw.meta
+		warnings = rw.warnings.take(true)
+		codec = rw.codec
+		shape = rw.shape
+		resultNames = rw.resultNames
+		noEscapeHTML = rw.noEscapeHTML
+	}
+	var resp interface{} = Resp{Results: out, Meta: meta, Warnings: warnings}
+	if codec == nil {
+		resp = Resp{Results: toResultsObject(resultNames, out, noEscapeHTML), Meta: meta, Warnings: warnings}
+	}
+	switch {
+	case isCompact(w):
+		w.Header().Set(CompactEnvelopeHeader, "1")
+		resp = toCompactResp(out, meta, warnings)
+	case shape != nil && shape.Write != nil:
+		results, respErr := splitResults(out)
+		shape.Write(w, httpCode, results, respErr)
+		return
+	case shape != nil:
+		resp = shape.envelope(out, meta, warnings)
+	}
+	buf := getEncodeBuffer()
+	defer putEncodeBuffer(buf)
+	if codec != nil {
+		if err := codec.Encode(buf, resp); err != nil {
+			log.Printf("writeJSONResponse Write err: %#+v\n", err)
+		}
+		w.Header().Set("Content-Type", codec.ContentType())
+		writeBody(w, httpCode, buf.Bytes())
+		return
+	}
+	enc := json.NewEncoder(buf)
+	rw, _ := w.(*responseWriter)
+	if rw != nil && rw.indent != "" && !rw.compact {
+		enc.SetIndent("", rw.indent)
+	}
+	if rw != nil && rw.noEscapeHTML {
+		enc.SetEscapeHTML(false)
+	}
+	err := enc.Encode(resp)
 	if err != nil {
 		log.Printf("writeJSONResponse Write err: %#+v\n", err)
 	}
+	body := buf.Bytes()
+	if rw != nil && rw.floatFormat == FloatDecimal {
+		body = decimalFloats(body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeBody(w, httpCode, body)
 }
 
 type errorWithStatusCode struct {
@@ -238,6 +1007,10 @@ func (e *errorWithStatusCode) StatusCode() int {
 	return e.HTTPStatusCode
 }
 
+func (e *errorWithStatusCode) Unwrap() error {
+	return e.innerErr
+}
+
 // NewStatusCodeError for returning an error with http code
 func NewStatusCodeError(code int, innerError error) (err error) {
 	err = &errorWithStatusCode{code, innerError}
@@ -249,12 +1022,26 @@ type StatusCodeError interface {
 	StatusCode() int
 }
 
+// statusCodeOf returns the status code of the first StatusCodeError in the chain of err
+func statusCodeOf(err error, defaultCode int) int {
+	var httpE StatusCodeError
+	if errors.As(err, &httpE) {
+		return httpE.StatusCode()
+	}
+	return defaultCode
+}
+
 /*
 ResponseError is error of the Go func return values will be wrapped with this struct, So that error details can be exposed as json.
+Value is serialized by DefaultErrorValue, or Config.ErrorValueMarshaler, and Code is of the ErrorCoder in the error chain.
+Errors of the injectors are wrapped the same way.
 */
 type ResponseError struct {
 	Error string      `json:"error,omitempty"`
+	Code  string      `json:"code,omitempty"`
 	Value interface{} `json:"value,omitempty"`
+
+	structured *structuredError
 }
 
 type Req struct {
@@ -262,7 +1049,10 @@ type Req struct {
 }
 
 type Resp struct {
-	Results interface{} `json:"results"`
+	Results interface{}            `json:"results"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	// Warnings are of AddWarning
+	Warnings []Warning `json:"warnings,omitempty"`
 }
 
 func checkInjectorsType(ft reflect.Type, injectors []interface{}) {
@@ -291,6 +1081,22 @@ func checkInjectorsType(ft reflect.Type, injectors []interface{}) {
 
 }
 
+// injectsContext is true if the first injected value of injectors is a context
+func injectsContext(injectors []interface{}) bool {
+	if len(injectors) == 0 {
+		return false
+	}
+	injt := reflect.TypeOf(injectors[0])
+	return injt.NumOut() > 1 && injt.Out(0).Implements(contextType)
+}
+
+func injectedCount(injectors []interface{}) (count int) {
+	for _, inj := range injectors {
+		count += reflect.TypeOf(inj).NumOut() - 1
+	}
+	return
+}
+
 func typesAssignableTo(toTypes []reflect.Type, fromTypes []reflect.Type) bool {
 	if len(toTypes) != len(fromTypes) {
 		return false
@@ -321,7 +1127,7 @@ func check(ft reflect.Type) {
 	}
 	for i := 0; i < ft.NumOut(); i++ {
 		if ft.Out(i).Kind() == reflect.Chan {
-			panic("func return values can not be chan type.")
+			panic("func return values can not be chan type, return an EventStream to send the items incrementally.")
 		}
 	}
 }
@@ -346,6 +1152,10 @@ func isError(t reflect.Type) bool {
 }
 
 func (cfg *Config) returnError(ft reflect.Type, w http.ResponseWriter, err error, httpCode int) {
+	if ft == nil {
+		writeJSONResponse(w, httpCode, []interface{}{cfg.responseError(err)})
+		return
+	}
 	var errIndex = 0
 	errOuts := []interface{}{}
 	for i := 0; i < ft.NumOut(); i++ {
@@ -354,11 +1164,7 @@ func (cfg *Config) returnError(ft reflect.Type, w http.ResponseWriter, err error
 			errIndex = i
 		}
 	}
-	if cfg.ErrHandler != nil {
-		err = cfg.ErrHandler(err)
-	}
-	errOuts[errIndex] = &ResponseError{Error: err.Error(), Value: err}
-	w.WriteHeader(httpCode)
-	writeJSONResponse(w, errOuts)
+	errOuts[errIndex] = cfg.responseError(err)
+	writeJSONResponse(w, httpCode, errOuts)
 	return
 }
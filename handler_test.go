@@ -1,14 +1,28 @@
+//go:debug httpmuxgo121=0
+
 package jsonhandlerfunc_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/theplant/jsonhandlerfunc"
 )
@@ -134,7 +148,7 @@ func ExampleToHandlerFunc_03slicemapspointers() {
 	responseBody = httpPostJSON(hf, ``)
 	fmt.Println(responseBody)
 	//Output:
-	// {"results":["",{"error":"require 4 params, but passed in 1 params","value":{}}]}
+	// {"results":["",{"error":"require 4 params ([]string, map[string]string, *struct { Names []string; Address struct { Zipcode int; Address1 string } }, *[]string), but passed in 1 params","value":{"code":"params_count_mismatch","required":4,"passed":1,"params":[{"index":0,"type":"[]string"},{"index":1,"type":"map[string]string"},{"index":2,"type":"*struct { Names []string; Address struct { Zipcode int; Address1 string } }"},{"index":3,"type":"*[]string"}]}}]}
 	//
 	// {"results":["Hi, Mr. Felix, Your zipcode is 100, Your gender is Male",null]}
 	//
@@ -411,6 +425,2770 @@ func ExampleToHandlerFunc_10ErrHandler() {
 	// {"results":["",{"error":"system error","value":{}}]}
 }
 
+// ### 11) Config Timeout, func that runs longer than it is responded with 504 and a TimeoutError
+func ExampleToHandlerFunc_11timeout() {
+	cfg := &jsonhandlerfunc.Config{
+		Timeout: 20 * time.Millisecond,
+	}
+	var slow = func(ctx context.Context, name string) (r string, err error) {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(time.Second):
+			r = "Hi " + name
+		}
+		return
+	}
+
+	hf := cfg.ToHandlerFunc(slow)
+
+	responseBody, code := httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	var resp struct {
+		Results []json.RawMessage
+	}
+	json.Unmarshal([]byte(responseBody), &resp)
+	var respErr struct {
+		Value jsonhandlerfunc.TimeoutError
+	}
+	json.Unmarshal(resp.Results[1], &respErr)
+	fmt.Println(code)
+	fmt.Println(respErr.Value.Code, respErr.Value.ElapsedMs >= 20)
+	//Output:
+	// 504
+	// deadline_exceeded true
+}
+
+// ### 12) Response is only written once, if an injector already wrote the response, the error response is suppressed
+func ExampleToHandlerFunc_12doublewrite() {
+	var helloworld = func(userId string, name string) (r string, err error) {
+		r = fmt.Sprintf("Hi %s, your id is %s", name, userId)
+		return
+	}
+
+	var authInjector = func(w http.ResponseWriter, r *http.Request) (userId string, err error) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("please login"))
+		err = fmt.Errorf("not logged in")
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, authInjector)
+	responseBody, code := httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	fmt.Println(code)
+	fmt.Println(responseBody)
+	//Output:
+	// 401
+	// please login
+}
+
+// ### 13) If an injector already responded, like an auth challenge or redirect, the func is not called and the response is passed through
+func ExampleToHandlerFunc_13injectorresponded() {
+	var helloworld = func(userId string, name string) (r string, err error) {
+		fmt.Println("never called")
+		return
+	}
+
+	var challengeInjector = func(w http.ResponseWriter, r *http.Request) (userId string, err error) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="api"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, challengeInjector)
+	responseBody, code := httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	fmt.Println(code)
+	fmt.Printf("%q\n", responseBody)
+	//Output:
+	// 401
+	// ""
+}
+
+// ### 14) WithRequiredHeaders option responds 400 listing the missing headers
+func ExampleToHandlerFunc_14requiredheaders() {
+	var helloworld = func(name string) (r string, err error) {
+		r = "Hi " + name
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, jsonhandlerfunc.WithRequiredHeaders("X-Api-Key", "X-Client-Version"))
+
+	responseBody, code := httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	fmt.Println(code)
+	fmt.Println(responseBody)
+	//Output:
+	// 400
+	// {"results":["",{"error":"missing required headers: X-Api-Key, X-Client-Version","value":{"code":"missing_headers","headers":["X-Api-Key","X-Client-Version"]}}]}
+}
+
+// ### 15) WithMinClientVersion option responds 426 for clients older than the min version in X-Client-Version header
+func ExampleToHandlerFunc_15minclientversion() {
+	var helloworld = func(name string) (r string, err error) {
+		r = "Hi " + name
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, jsonhandlerfunc.WithMinClientVersion("2.3"))
+
+	for _, version := range []string{"2.2.9", "v2.3.0"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["Gates"]}`))
+		req.Header.Set("X-Client-Version", version)
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Println(w.Code)
+		fmt.Println(w.Body.String())
+	}
+	//Output:
+	// 426
+	// {"results":["",{"error":"client version \"2.2.9\" is not supported, upgrade to 2.3 or later","value":{"code":"upgrade_required","client_version":"2.2.9","min_version":"2.3"}}]}
+	//
+	// 200
+	// {"results":["Hi Gates",null]}
+}
+
+// ### 16) Return a http.Handler to delegate the rest of the request to it, the request body can still be read by it
+func ExampleToHandlerFunc_16delegatehandler() {
+	var download = func(name string) (h http.Handler, r string, err error) {
+		if name != "report.csv" {
+			r = "Hi " + name
+			return
+		}
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/csv")
+			fmt.Fprintf(w, "name,body\nreport.csv,%s", body)
+		})
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(download)
+
+	fmt.Println(httpPostJSON(hf, `{"params":["Gates"]}`))
+	fmt.Println(httpPostJSON(hf, `{"params":["report.csv"]}`))
+	//Output:
+	// {"results":[null,"Hi Gates",null]}
+	//
+	// name,body
+	// report.csv,{"params":["report.csv"]}
+}
+
+// ### 17) Config AllowCompactEnvelope, clients can opt in shorter envelope keys with X-Jsonhf-Compact header
+func ExampleToHandlerFunc_17compactenvelope() {
+	cfg := &jsonhandlerfunc.Config{
+		AllowCompactEnvelope: true,
+	}
+	var helloworld = func(name string, gender int) (r string, err error) {
+		if gender == 0 {
+			err = fmt.Errorf("Sorry, I don't know about your gender.")
+		}
+		r = "Hi " + name
+		return
+	}
+
+	hf := cfg.ToHandlerFunc(helloworld)
+
+	for _, body := range []string{`{"p": ["Gates", 1]}`, `{"p": ["Gates", 0]}`} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("X-Jsonhf-Compact", "1")
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Println(w.Body.String())
+	}
+	//Output:
+	// {"r":["Hi Gates",null]}
+	//
+	// {"r":["Hi Gates",{"e":"Sorry, I don't know about your gender.","v":{}}]}
+}
+
+// ### 18) WithPartialTimeout option responds the result of a cheaper func with "degraded" meta when the func is too slow
+func ExampleToHandlerFunc_18partialtimeout() {
+	var search = func(ctx context.Context, keyword string) (r []string, err error) {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(time.Second):
+			r = []string{"personalized " + keyword}
+		}
+		return
+	}
+	var popular = func(ctx context.Context, keyword string) (r []string, err error) {
+		r = []string{"popular " + keyword}
+		err = ctx.Err()
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(search, jsonhandlerfunc.WithPartialTimeout(20*time.Millisecond, popular))
+
+	fmt.Println(httpPostJSON(hf, `{"params": ["shoes"]}`))
+	//Output:
+	// {"results":[["popular shoes"],null],"meta":{"degraded":true}}
+}
+
+// ### 19) ReportProgress from long running funcs, Config OnProgress receives the progress
+func ExampleToHandlerFunc_19reportprogress() {
+	cfg := &jsonhandlerfunc.Config{
+		OnProgress: func(r *http.Request, p jsonhandlerfunc.Progress) {
+			fmt.Printf("%s %.0f%% %s\n", r.URL.Path, p.Percent, p.Message)
+		},
+	}
+	var export = func(ctx context.Context, rows int) (r string, err error) {
+		for i := 1; i <= rows; i++ {
+			jsonhandlerfunc.ReportProgress(ctx, float64(i*100/rows), fmt.Sprintf("row %d", i))
+		}
+		r = "done"
+		return
+	}
+
+	hf := cfg.ToHandlerFunc(export)
+	fmt.Println(httpPostJSON(hf, `{"params": [2]}`))
+	//Output:
+	// / 50% row 1
+	// / 100% row 2
+	// {"results":["done",null]}
+}
+
+// ### 20) FaultInjection delays or fails calls, only when JSONHANDLERFUNC_FAULT_INJECTION=1 is set in the environment
+func ExampleToHandlerFunc_20faultinjection() {
+	var helloworld = func(name string) (r string, err error) {
+		r = "Hi " + name
+		return
+	}
+	faults := &jsonhandlerfunc.FaultInjection{
+		ErrorRate: 0.5,
+		Rand: func() float64 {
+			return 0.1
+		},
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, jsonhandlerfunc.WithFaultInjection(faults))
+	responseBody, code := httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	fmt.Println(code)
+	fmt.Println(responseBody)
+
+	os.Setenv("JSONHANDLERFUNC_FAULT_INJECTION", "1")
+	defer os.Unsetenv("JSONHANDLERFUNC_FAULT_INJECTION")
+	hf = jsonhandlerfunc.ToHandlerFunc(helloworld, jsonhandlerfunc.WithFaultInjection(faults))
+	responseBody, code = httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	fmt.Println(code)
+	fmt.Println(responseBody)
+	//Output:
+	// 200
+	// {"results":["Hi Gates",null]}
+	//
+	// 503
+	// {"results":["",{"error":"injected fault","value":{"code":"injected_fault"}}]}
+}
+
+// ### 21) WithEnvelopeSection decodes a top level section of the request into a param, for clients that can't set headers
+func ExampleToHandlerFunc_21envelopesection() {
+	type Auth struct {
+		Token string
+	}
+	var helloworld = func(name string, auth *Auth, gender int) (r string, err error) {
+		r = fmt.Sprintf("Hi %s, gender %d, token %s", name, gender, auth.Token)
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, jsonhandlerfunc.WithEnvelopeSection("auth", 1))
+
+	fmt.Println(httpPostJSON(hf, `{"auth": {"Token": "abc"}, "params": ["Gates", 1]}`))
+	fmt.Println(httpPostJSON(hf, `{"params": ["Gates", 1, 2]}`))
+	//Output:
+	// {"results":["Hi Gates, gender 1, token abc",null]}
+	//
+	// {"results":["",{"error":"require 2 params (string, int), but passed in 3 params","value":{"code":"params_count_mismatch","required":2,"passed":3,"params":[{"index":0,"type":"string"},{"index":1,"type":"int"}]}}]}
+}
+
+// ### 22) WithCacheableGET serves the same func with GET and params in query, and cache headers, POST still works
+func ExampleToHandlerFunc_22cacheableget() {
+	var products = func(keyword string, limit int) (r []string, err error) {
+		for i := 0; i < limit; i++ {
+			r = append(r, fmt.Sprintf("%s %d", keyword, i))
+		}
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(products, jsonhandlerfunc.WithCacheableGET(time.Minute))
+
+	req := httptest.NewRequest("GET", "/products?params="+url.QueryEscape(`["shoes",2]`), nil)
+	w := httptest.NewRecorder()
+	hf(w, req)
+	fmt.Println(w.Code, w.Header().Get("Cache-Control"))
+	fmt.Println(w.Body.String())
+
+	fmt.Println(httpPostJSON(hf, `{"params": ["shoes", 1]}`))
+	//Output:
+	// 200 public, max-age=60
+	// {"results":[["shoes 0","shoes 1"],null]}
+	//
+	// {"results":[["shoes 0"],null]}
+}
+
+type validationErrors map[string]string
+
+func (ve validationErrors) Error() string {
+	return fmt.Sprintf("%d fields are invalid", len(ve))
+}
+
+// ### 23) Error values have a stable shape: struct fields, string keyed maps, {"details": ...} for others, wrapped errors are unwrapped
+func ExampleToHandlerFunc_23errorvalue() {
+	var errs = []error{
+		validationErrors{"name": "is required"},
+		fmt.Errorf("wrapped: %w", &complicatedError{ErrorCode: 8800, ErrorDeepReason: "It crashed."}),
+		errors.New("plain"),
+	}
+	var helloworld = func(i int) (err error) {
+		return errs[i]
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld)
+	for i := range errs {
+		fmt.Println(httpPostJSON(hf, fmt.Sprintf(`{"params": [%d]}`, i)))
+	}
+
+	cfg := &jsonhandlerfunc.Config{
+		ErrorValueMarshaler: func(err error) interface{} {
+			return map[string]string{"type": fmt.Sprintf("%T", err)}
+		},
+	}
+	hf = cfg.ToHandlerFunc(helloworld)
+	fmt.Println(httpPostJSON(hf, `{"params": [0]}`))
+	//Output:
+	// {"results":[{"error":"1 fields are invalid","value":{"name":"is required"}}]}
+	//
+	// {"results":[{"error":"wrapped: It crashed.","value":{"ErrorCode":8800,"ErrorDeepReason":"It crashed."}}]}
+	//
+	// {"results":[{"error":"plain","value":{}}]}
+	//
+	// {"results":[{"error":"1 fields are invalid","value":{"type":"jsonhandlerfunc_test.validationErrors"}}]}
+}
+
+// ### 24) Conflicting options panic when creating the handler, with all the conflicts listed
+func ExampleToHandlerFunc_24optionsconflict() {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+		}
+	}()
+
+	var search = func(keyword string) (r []string, err error) {
+		return
+	}
+
+	cfg := &jsonhandlerfunc.Config{Timeout: time.Second}
+	cfg.ToHandlerFunc(search,
+		jsonhandlerfunc.WithCacheableGET(time.Minute),
+		jsonhandlerfunc.WithPartialTimeout(2*time.Second, search),
+		jsonhandlerfunc.WithMinClientVersion("1.0"),
+		jsonhandlerfunc.WithMinClientVersion("2.0"),
+	)
+	fmt.Println("DONE")
+	//Output:
+	// conflicting options for func(string) ([]string, error):
+	//   - WithMinClientVersion is set to both 1.0 and 2.0, keep one of them
+	//   - WithPartialTimeout(2s) is not shorter than Config.Timeout 1s, the partial func would never be used, make it shorter
+	//   - WithCacheableGET would cache the degraded results of WithPartialTimeout, remove one of them
+}
+
+// ### 25) Config Languages and LocalizeResults translate results for Accept-Language, and set Content-Language
+func ExampleToHandlerFunc_25localizeresults() {
+	translations := map[string]map[string]string{
+		"ja": {"Shipped": "発送済み"},
+	}
+	cfg := &jsonhandlerfunc.Config{
+		Languages: []string{"en", "ja"},
+		LocalizeResults: func(ctx context.Context, lang string, results []interface{}) []interface{} {
+			if status, ok := results[0].(string); ok && translations[lang][status] != "" {
+				results[0] = translations[lang][status]
+			}
+			return results
+		},
+	}
+	var orderStatus = func(ctx context.Context, id int) (status string, err error) {
+		status = "Shipped"
+		return
+	}
+
+	hf := cfg.ToHandlerFunc(orderStatus)
+	for _, acceptLanguage := range []string{"ja-JP,en;q=0.8", "fr"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [1]}`))
+		req.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Println(w.Header().Get("Content-Language"), w.Body.String())
+	}
+	//Output:
+	// ja {"results":["発送済み",null]}
+	//
+	// en {"results":["Shipped",null]}
+}
+
+// ### 26) NewHandler returns the handler that can also be called in process with Invoke, with injectors and options applied
+func ExampleHandler_Invoke() {
+	type Address struct {
+		Zipcode int
+	}
+	var helloworld = func(userId string, name string, address *Address) (r string, err error) {
+		r = fmt.Sprintf("Hi %s (%s), your zipcode is %d", name, userId, address.Zipcode)
+		return
+	}
+	var userIdInjector = func(w http.ResponseWriter, r *http.Request) (userId string, err error) {
+		userId = "system"
+		return
+	}
+
+	h := jsonhandlerfunc.NewHandler(helloworld, userIdInjector)
+
+	results, err := h.Invoke(context.Background(), "Gates", &Address{Zipcode: 100})
+	fmt.Println(results, err)
+	results, err = h.Invoke(context.Background(), "Gates", map[string]interface{}{"Zipcode": 200})
+	fmt.Println(results, err)
+	results, err = h.Invoke(context.Background(), "Gates")
+	fmt.Println(results, err)
+	//Output:
+	// [Hi Gates (system), your zipcode is 100] <nil>
+	// [Hi Gates (system), your zipcode is 200] <nil>
+	// [] require 2 params (string, *jsonhandlerfunc_test.Address), but passed in 1 params
+}
+
+// ### 27) WithAuditChain chains a receipt hash of every response to the previous one, for tamper evident audit
+func ExampleToHandlerFunc_27auditchain() {
+	var transfer = func(from string, to string, amount int) (balance int, err error) {
+		balance = 1000 - amount
+		return
+	}
+
+	var receipts []*jsonhandlerfunc.Receipt
+	chain := jsonhandlerfunc.NewAuditChain("", func(rc *jsonhandlerfunc.Receipt) {
+		receipts = append(receipts, rc)
+	})
+	chain.Now = func() time.Time {
+		return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(transfer, jsonhandlerfunc.WithAuditChain(chain))
+	fmt.Println(httpPostJSON(hf, `{"params": ["alice", "bob", 100]}`))
+	httpPostJSON(hf, `{"params": ["alice", "bob", 200]}`)
+	fmt.Println(receipts[1].PrevHash == receipts[0].Hash, string(receipts[1].Params), string(receipts[1].Results))
+	fmt.Println(jsonhandlerfunc.VerifyReceipts(receipts))
+
+	receipts[0].Results = json.RawMessage(`[9000,null]`)
+	fmt.Println(jsonhandlerfunc.VerifyReceipts(receipts))
+	//Output:
+	// {"results":[900,null],"meta":{"receipt":{"handler":"github.com/theplant/jsonhandlerfunc_test.ExampleToHandlerFunc_27auditchain.func1","timestamp":"2024-01-01T00:00:00Z","prev_hash":"","hash":"8dfaa707201d8ee39107868ef5b5d68f8f0cae384b3abb17257b9773b43f555a"}}}
+	//
+	// true ["alice","bob",200] [800,null]
+	// <nil>
+	// receipt 0: hash mismatch, it's changed
+}
+
+// ### 28) DevConfig and ProdConfig are presets of Config, which can be overridden further
+func ExampleToHandlerFunc_28configprofiles() {
+	var helloworld = func(name string) (r string, err error) {
+		r = "Hello " + name
+		return
+	}
+
+	dev := jsonhandlerfunc.DevConfig()
+	fmt.Println(httpPostJSON(dev.ToHandlerFunc(helloworld), `{"params": ["Gates"]}`))
+
+	prod := jsonhandlerfunc.ProdConfig()
+	prod.Timeout = 5 * time.Second
+	fmt.Println(prod.Timeout, httpPostJSON(prod.ToHandlerFunc(helloworld), `{"params": ["Gates"]}`))
+	//Output:
+	// {
+	//   "results": [
+	//     "Hello Gates",
+	//     null
+	//   ]
+	// }
+	//
+	// 5s {"results":["Hello Gates",null]}
+}
+
+// ### 29) WithParamNames names the params in the error of a params count mismatch
+func ExampleToHandlerFunc_29paramnames() {
+	var helloworld = func(ctx context.Context, name string, gender int) (r string, err error) {
+		r = fmt.Sprintf("Hi %s, gender %d", name, gender)
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(helloworld, jsonhandlerfunc.WithParamNames("name", "gender"))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`))
+	//Output:
+	// {"results":["",{"error":"require 2 params (name string, gender int), but passed in 1 params","value":{"code":"params_count_mismatch","required":2,"passed":1,"params":[{"index":0,"name":"name","type":"string"},{"index":1,"name":"gender","type":"int"}]}}]}
+	//  422
+}
+
+// ### 30) WithPanicIsolation responds a panic of one call with 500, and disables the handler by the panic rate until Enable
+func ExampleToHandlerFunc_30panicisolation() {
+	var divide = func(a int, b int) (r int, err error) {
+		r = a / b
+		return
+	}
+
+	h := jsonhandlerfunc.NewHandler(divide, jsonhandlerfunc.WithPanicIsolation(jsonhandlerfunc.PanicIsolation{
+		Window:      4,
+		MinCalls:    2,
+		DisableRate: 0.5,
+		OnPanic: func(recovered interface{}, stack []byte) {
+			fmt.Println("panic:", recovered)
+		},
+	}))
+
+	fmt.Println(httpPostJSONReturnCode(h.ServeHTTP, `{"params": [6, 3]}`))
+	fmt.Println(httpPostJSONReturnCode(h.ServeHTTP, `{"params": [6, 0]}`))
+	fmt.Printf("%+v\n", h.PanicStats())
+	fmt.Println(httpPostJSONReturnCode(h.ServeHTTP, `{"params": [6, 3]}`))
+
+	h.Enable()
+	fmt.Println(h.Invoke(context.Background(), 6, 3))
+	fmt.Printf("%+v\n", h.PanicStats())
+	//Output:
+	// {"results":[2,null]}
+	//  200
+	// panic: runtime error: integer divide by zero
+	// {"results":[0,{"error":"internal error","value":{"code":"panic"}}]}
+	//  500
+	// {Calls:2 Panics:1 Rate:0.5 Disabled:true Restarts:0}
+	// {"results":[0,{"error":"handler is disabled","value":{"code":"handler_disabled"}}]}
+	//  503
+	// [2] <nil>
+	// {Calls:3 Panics:1 Rate:0 Disabled:false Restarts:1}
+}
+
+// ### 31) Config ParamStyle NamedParams accepts params keyed by WithParamNames, or by the fields of a single struct param
+func ExampleToHandlerFunc_31namedparams() {
+	var helloworld = func(name string, gender int) (r string, err error) {
+		r = fmt.Sprintf("Hi %s, gender %d", name, gender)
+		return
+	}
+	type Query struct {
+		Keyword string `json:"keyword"`
+		Limit   int    `json:"limit"`
+	}
+	var search = func(ctx context.Context, q *Query) (r string, err error) {
+		r = fmt.Sprintf("search %s limit %d", q.Keyword, q.Limit)
+		return
+	}
+
+	cfg := &jsonhandlerfunc.Config{ParamStyle: jsonhandlerfunc.NamedParams}
+	hf := cfg.ToHandlerFunc(helloworld, jsonhandlerfunc.WithParamNames("name", "gender"))
+	fmt.Println(httpPostJSON(hf, `{"params": {"gender": 1, "name": "Gates", "unknown": true}}`))
+	fmt.Println(httpPostJSON(hf, `{"params": {"name": "Gates"}}`))
+	fmt.Println(httpPostJSON(hf, `{"params": ["Gates", 2]}`))
+
+	hf = cfg.ToHandlerFunc(search)
+	fmt.Println(httpPostJSON(hf, `{"params": {"keyword": "shoes", "limit": 10}}`))
+	//Output:
+	// {"results":["Hi Gates, gender 1",null]}
+	//
+	// {"results":["Hi Gates, gender 0",null]}
+	//
+	// {"results":["Hi Gates, gender 2",null]}
+	//
+	// {"results":["search shoes limit 10",null]}
+}
+
+// ### 32) Config EmitEnvelopeVersion sets the envelope version header, and negotiates the version requested by clients
+func ExampleToHandlerFunc_32envelopeversion() {
+	var helloworld = func(name string) (r string, err error) {
+		r = "Hello " + name
+		return
+	}
+
+	cfg := &jsonhandlerfunc.Config{EmitEnvelopeVersion: true}
+	hf := cfg.ToHandlerFunc(helloworld)
+	for _, requested := range []string{"", "v2, v1", "v2"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["Gates"]}`))
+		if requested != "" {
+			req.Header.Set(jsonhandlerfunc.EnvelopeHeader, requested)
+		}
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Print(w.Code, " ", w.Header().Get(jsonhandlerfunc.EnvelopeHeader), " ", w.Body.String())
+	}
+	//Output:
+	// 200 v1 {"results":["Hello Gates",null]}
+	// 200 v1 {"results":["Hello Gates",null]}
+	// 406 v1 {"results":["",{"error":"envelope v2 is not supported, supported are v1","value":{"code":"unsupported_envelope","requested":"v2","supported":["v1"]}}]}
+}
+
+// ### 33) ListOptions is the standard list param, sorting and filtering are limited to the fields declared by WithListOptions
+func ExampleToHandlerFunc_33listoptions() {
+	var listUsers = func(keyword string, lo *jsonhandlerfunc.ListOptions) (r string, err error) {
+		r = fmt.Sprintf("%s sort %+v filter %+v limit %d offset %d", keyword, lo.Sort, lo.Filters, lo.Limit, lo.Offset)
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(listUsers, jsonhandlerfunc.WithListOptions(jsonhandlerfunc.ListPolicy{
+		Sortable:   []string{"name", "created_at"},
+		Filterable: []string{"status", "age"},
+	}))
+
+	fmt.Println(httpPostJSON(hf, `{"params": ["a", {"sort": "-created_at,name", "filter": ["status = active", "age >= 18", "status = a>=b"], "offset": 40}]}`))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": ["a", {"sort": ["password"]}]}`))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": ["a", {"limit": 1000}]}`))
+	//Output:
+	// {"results":["a sort [{Field:created_at Desc:true} {Field:name Desc:false}] filter [{Field:status Op:= Value:active} {Field:age Op:\u003e= Value:18} {Field:status Op:= Value:a\u003e=b}] limit 20 offset 40",null]}
+	//
+	// {"results":["",{"error":"invalid list options: can not sort by \"password\"","value":{"code":"invalid_list_options","reason":"can not sort by \"password\"","allowed":["name","created_at"]}}]}
+	//  422
+	// {"results":["",{"error":"invalid list options: limit 1000 is not in 0 to 100","value":{"code":"invalid_list_options","reason":"limit 1000 is not in 0 to 100"}}]}
+	//  422
+}
+
+type addCallable struct{}
+
+func (addCallable) Call(ctx context.Context, rawParams []json.RawMessage) (results []interface{}, err error) {
+	if len(rawParams) != 2 {
+		err = jsonhandlerfunc.NewStatusCodeError(http.StatusUnprocessableEntity, fmt.Errorf("require 2 params"))
+		return
+	}
+	var a, b int
+	if err = json.Unmarshal(rawParams[0], &a); err != nil {
+		return
+	}
+	if err = json.Unmarshal(rawParams[1], &b); err != nil {
+		return
+	}
+	results = []interface{}{a + b}
+	return
+}
+
+// ### 34) A Callable is called without reflection, for hot handlers
+func ExampleToHandlerFunc_34callable() {
+	h := jsonhandlerfunc.NewHandler(addCallable{})
+	fmt.Println(httpPostJSONReturnCode(h.ServeHTTP, `{"params": [1, 2]}`))
+	fmt.Println(httpPostJSONReturnCode(h.ServeHTTP, `{"params": [1]}`))
+	fmt.Println(h.Invoke(context.Background(), 3, 4))
+	//Output:
+	// {"results":[3,null]}
+	//  200
+	// {"results":[{"error":"require 2 params","value":{}}]}
+	//  422
+	// [7] <nil>
+}
+
+type stateUser struct {
+	Name  string
+	Admin bool
+}
+
+type stateAccount struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// ### 35) ShapeResults reads the injected values from the RequestState, like filtering fields by the role of the user
+func ExampleToHandlerFunc_35requeststate() {
+	cfg := &jsonhandlerfunc.Config{
+		ShapeResults: func(state *jsonhandlerfunc.RequestState, results []interface{}) []interface{} {
+			var u *stateUser
+			if state.Lookup(&u) && u.Admin {
+				return results
+			}
+			acc := results[0].(*stateAccount)
+			results[0] = &stateAccount{Name: acc.Name}
+			return results
+		},
+	}
+
+	var getAccount = func(u *stateUser, name string) (r *stateAccount, err error) {
+		r = &stateAccount{Name: name, Email: name + "@example.com"}
+		return
+	}
+	var userInjector = func(w http.ResponseWriter, r *http.Request) (u *stateUser, err error) {
+		u = &stateUser{Name: r.Header.Get("X-User"), Admin: r.Header.Get("X-User") == "root"}
+		return
+	}
+
+	hf := cfg.ToHandlerFunc(getAccount, userInjector)
+	for _, user := range []string{"root", "guest"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["felix"]}`))
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Print(w.Body.String())
+	}
+	//Output:
+	// {"results":[{"name":"felix","email":"felix@example.com"},null]}
+	// {"results":[{"name":"felix"},null]}
+}
+
+// ### 36) Preconditions are checked before any work, and exported in the schema for clients
+func ExampleToHandlerFunc_36preconditions() {
+	var deleteUser = func(id int) (err error) {
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(deleteUser, jsonhandlerfunc.RequireBody(), jsonhandlerfunc.RequireAuthenticated())
+	fmt.Println(httpPostJSONReturnCode(hf, ``))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [1]}`))
+
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("deleteUser", deleteUser, jsonhandlerfunc.RequireTLS())
+	client := jsonhandlerfunc.NewClient("http://localhost/api")
+	client.Schema = reg.Schema()
+	fmt.Println(client.Call(context.Background(), "deleteUser", []interface{}{1}))
+	//Output:
+	// {"results":[{"error":"request body is required","value":{"code":"body_required","precondition":"body"}}]}
+	//  400
+	// {"results":[{"error":"request is not authenticated","value":{"code":"unauthenticated","precondition":"authenticated"}}]}
+	//  401
+	// request must be over TLS
+}
+
+// ### 37) CheckQuota and OnUsage account the requests of the injected API key
+func ExampleToHandlerFunc_37usage() {
+	type apiKey string
+	used := map[apiKey]int64{}
+
+	cfg := &jsonhandlerfunc.Config{
+		CheckQuota: func(state *jsonhandlerfunc.RequestState) error {
+			var key apiKey
+			state.Lookup(&key)
+			if used[key] >= 60 {
+				return &jsonhandlerfunc.QuotaExceededError{Code: jsonhandlerfunc.QuotaExceededCode, Quota: "bytes", RetryAfter: time.Minute}
+			}
+			return nil
+		},
+		OnUsage: func(state *jsonhandlerfunc.RequestState, usage *jsonhandlerfunc.Usage) {
+			var key apiKey
+			state.Lookup(&key)
+			used[key] += usage.RequestBytes + usage.ResponseBytes
+			fmt.Printf("%s: request %d bytes, response %d bytes, status %d\n", key, usage.RequestBytes, usage.ResponseBytes, usage.StatusCode)
+		},
+	}
+	var echo = func(key apiKey, s string) (r string, err error) {
+		r = s
+		return
+	}
+	var keyInjector = func(w http.ResponseWriter, r *http.Request) (key apiKey, err error) {
+		key = apiKey(r.Header.Get("X-Api-Key"))
+		return
+	}
+
+	hf := cfg.ToHandlerFunc(echo, keyInjector)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["hello"]}`))
+		req.Header.Set("X-Api-Key", "k1")
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Print(w.Code, " ", w.Header().Get("Retry-After"), " ", w.Body.String())
+	}
+	//Output:
+	// k1: request 21 bytes, response 27 bytes, status 200
+	// 200  {"results":["hello",null]}
+	// k1: request 21 bytes, response 27 bytes, status 200
+	// 200  {"results":["hello",null]}
+	// k1: request 0 bytes, response 101 bytes, status 429
+	// 429 60 {"results":["",{"error":"quota exceeded: bytes","value":{"code":"quota_exceeded","quota":"bytes"}}]}
+}
+
+type protoOrder struct {
+	OrderID   int64     `json:"order_id"`
+	Amount    float64   `json:"amount"`
+	Quantity  int32     `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// ### 38) WithProtoStructResults encodes the results in the JSON form of google.protobuf.Struct
+func ExampleToHandlerFunc_38protostruct() {
+	var getOrder = func(id int64) (r *protoOrder, total uint64, err error) {
+		r = &protoOrder{OrderID: id, Amount: 9.5, Quantity: 2, CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+		total = 18446744073709551615
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(getOrder, jsonhandlerfunc.WithProtoStructResults())
+	fmt.Println(httpPostJSON(hf, `{"params": [42]}`))
+	//Output:
+	// {"results":[{"amount":9.5,"createdAt":"2020-01-02T03:04:05Z","orderId":"42","quantity":2},"18446744073709551615",null]}
+}
+
+// base64JSONCodec stands for a binary codec like MessagePack in the example
+type base64JSONCodec struct{}
+
+func (base64JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(base64.NewDecoder(base64.StdEncoding, r)).Decode(v)
+}
+
+func (base64JSONCodec) Encode(w io.Writer, v interface{}) error {
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if err := json.NewEncoder(enc).Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (base64JSONCodec) ContentType() string {
+	return "application/x-base64-json"
+}
+
+// ### 39) Codecs serve the same func in other encodings, selected by Content-Type and Accept
+func ExampleToHandlerFunc_39codecs() {
+	cfg := &jsonhandlerfunc.Config{Codecs: []jsonhandlerfunc.Codec{base64JSONCodec{}}}
+	var hello = func(name string) (r string, err error) {
+		r = "Hello " + name
+		return
+	}
+	hf := cfg.ToHandlerFunc(hello)
+
+	body := &bytes.Buffer{}
+	base64JSONCodec{}.Encode(body, map[string]interface{}{"params": []string{"Gates"}})
+	for _, accept := range []string{"", "application/json"} {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(body.Bytes()))
+		req.Header.Set("Content-Type", "application/x-base64-json")
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Print(w.Header().Get("Content-Type"), " ", w.Body.String(), "\n")
+	}
+	//Output:
+	// application/x-base64-json eyJyZXN1bHRzIjpbIkhlbGxvIEdhdGVzIixudWxsXX0K
+	// application/json {"results":["Hello Gates",null]}
+}
+
+type tokenExpiredError struct {
+	ExpiredAt string `json:"expired_at"`
+}
+
+func (e *tokenExpiredError) Error() string     { return "token expired" }
+func (e *tokenExpiredError) ErrorCode() string { return "token_expired" }
+func (e *tokenExpiredError) StatusCode() int   { return http.StatusUnauthorized }
+
+// ### 40) Errors of injectors are structured the same as the func's, with the code of ErrorCoder
+func ExampleToHandlerFunc_40injectorerrorcode() {
+	var profile = func(userID int) (r string, err error) {
+		return
+	}
+	var authInjector = func(w http.ResponseWriter, r *http.Request) (userID int, err error) {
+		err = fmt.Errorf("auth: %w", &tokenExpiredError{ExpiredAt: "2020-01-01T00:00:00Z"})
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(profile, authInjector)
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": []}`))
+	//Output:
+	// {"results":["",{"error":"auth: token expired","code":"token_expired","value":{"expired_at":"2020-01-01T00:00:00Z"}}]}
+	//  401
+}
+
+// ### 41) io.Reader and Stream results are copied to the response instead of encoded
+func ExampleToHandlerFunc_41stream() {
+	var export = func(format string) (s *jsonhandlerfunc.Stream, err error) {
+		if format != "csv" {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusBadRequest, fmt.Errorf("unsupported format %s", format))
+			return
+		}
+		s = &jsonhandlerfunc.Stream{Reader: strings.NewReader("id,name\n1,felix\n"), ContentType: "text/csv", Filename: "users.csv"}
+		return
+	}
+	var readme = func() (r io.Reader, err error) {
+		r = strings.NewReader("# README\n")
+		return
+	}
+
+	for _, format := range []string{"csv", "xls"} {
+		w := httptest.NewRecorder()
+		jsonhandlerfunc.ToHandlerFunc(export)(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["`+format+`"]}`)))
+		fmt.Printf("%d %s %q %q\n", w.Code, w.Header().Get("Content-Type"), w.Header().Get("Content-Disposition"), w.Body.String())
+	}
+	w := httptest.NewRecorder()
+	jsonhandlerfunc.ToHandlerFunc(readme, jsonhandlerfunc.WithStreamContentType("text/markdown"))(w, httptest.NewRequest("POST", "/", nil))
+	fmt.Printf("%d %s %q\n", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	//Output:
+	// 200 text/csv "attachment; filename=users.csv" "id,name\n1,felix\n"
+	// 400 application/json "" "{\"results\":[null,{\"error\":\"unsupported format xls\",\"value\":{}}]}\n"
+	// 200 text/markdown "# README\n"
+}
+
+// ### 42) File params are uploaded with multipart/form-data, the other params are in the envelope field
+func ExampleToHandlerFunc_42upload() {
+	var upload = func(title string, file *multipart.FileHeader, attachments []*multipart.FileHeader) (r string, err error) {
+		f, err := file.Open()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		content, _ := io.ReadAll(f)
+		r = fmt.Sprintf("%s: %s %q, %d attachments", title, file.Filename, content, len(attachments))
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(upload)
+
+	post := func(envelope string, files map[string][]string) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField(jsonhandlerfunc.MultipartEnvelopeField, envelope)
+		for field, names := range files {
+			for _, name := range names {
+				fw, _ := mw.CreateFormFile(field, name)
+				fw.Write([]byte("content of " + name))
+			}
+		}
+		mw.Close()
+		req := httptest.NewRequest("POST", "/", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		hf(w, req)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	post(`{"params": ["report", "doc", "more"]}`, map[string][]string{"doc": {"a.txt"}, "more": {"b.png", "c.png"}})
+	post(`{"params": ["report", "doc", null]}`, nil)
+	//Output:
+	// 200 {"results":["report: a.txt \"content of a.txt\", 2 attachments",null]}
+	// 422 {"results":["",{"error":"file doc is not uploaded","value":{"code":"missing_file","field":"doc"}}]}
+}
+
+// ### 43) Duplicate keys are rejected with WithRejectDuplicateKeys, instead of the last one wins, the keys of different cases too
+func ExampleToHandlerFunc_43duplicatekeys() {
+	type grant struct {
+		User string `json:"user"`
+		Role string `json:"role"`
+	}
+	var grantRole = func(g grant) (r string, err error) {
+		r = g.User + " is " + g.Role
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(grantRole, jsonhandlerfunc.WithRejectDuplicateKeys())
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [{"user": "felix", "role": "viewer"}]}`))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [{"user": "felix", "role": "viewer", "role": "admin"}]}`))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [{"user": "felix", "role": "viewer", "Role": "admin"}]}`))
+	//Output:
+	// {"results":["felix is viewer",null]}
+	//  200
+	// {"results":["",{"error":"duplicate key params[0].role","value":{"code":"duplicate_key","path":"params[0].role"}}]}
+	//  422
+	// {"results":["",{"error":"duplicate key params[0].Role","value":{"code":"duplicate_key","path":"params[0].Role"}}]}
+	//  422
+}
+
+type signUp struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Password string   `json:"password" validate:"min=8"`
+	Plan     string   `json:"plan" validate:"oneof=free pro"`
+	Tags     []string `json:"tags" validate:"max=2"`
+}
+
+// ### 44) Params are validated by Config.Validator before the func is called, ValidateTags checks validate struct tags
+func ExampleToHandlerFunc_44validate() {
+	var register = func(s signUp, referrer *string) (r string, err error) {
+		r = "welcome " + s.Email
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{Validator: jsonhandlerfunc.ValidateTags}
+	hf := cfg.ToHandlerFunc(register)
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [{"email": "felix@theplant.jp", "password": "12345678", "plan": "pro"}, null]}`))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [{"email": "felix", "password": "123", "plan": "gold", "tags": ["a", "b", "c"]}, null]}`))
+	fmt.Println(httpPostJSONReturnCode(hf, `{"params": [{}, null]}`))
+	//Output:
+	// {"results":["welcome felix@theplant.jp",null]}
+	//  200
+	// {"results":["",{"error":"invalid params: params[0].email must be an email address, params[0].password must be at least 8 characters, params[0].plan must be one of free, pro, params[0].tags must be at most 2 items","value":{"code":"invalid_params","fields":[{"field":"params[0].email","rule":"email","message":"must be an email address"},{"field":"params[0].password","rule":"min=8","message":"must be at least 8 characters"},{"field":"params[0].plan","rule":"oneof=free pro","message":"must be one of free, pro"},{"field":"params[0].tags","rule":"max=2","message":"must be at most 2 items"}]}}]}
+	//  422
+	// {"results":["",{"error":"invalid params: params[0].email is required, params[0].password must be at least 8 characters, params[0].plan must be one of free, pro","value":{"code":"invalid_params","fields":[{"field":"params[0].email","rule":"required","message":"is required"},{"field":"params[0].password","rule":"min=8","message":"must be at least 8 characters"},{"field":"params[0].plan","rule":"oneof=free pro","message":"must be one of free, pro"}]}}]}
+	//  422
+}
+
+// ### 45) The response envelope can be shaped to match an existing API contract
+func ExampleToHandlerFunc_45responseshape() {
+	var getUser = func(id int) (r map[string]interface{}, err error) {
+		if id != 1 {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusNotFound, fmt.Errorf("user %d not found", id))
+			return
+		}
+		r = map[string]interface{}{"id": 1, "name": "felix"}
+		return
+	}
+
+	unwrap := &jsonhandlerfunc.Config{ResponseShape: &jsonhandlerfunc.ResponseShape{UnwrapSingleResult: true, ResultKey: "data"}}
+	fmt.Println(httpPostJSONReturnCode(unwrap.ToHandlerFunc(getUser), `{"params": [1]}`))
+	fmt.Println(httpPostJSONReturnCode(unwrap.ToHandlerFunc(getUser), `{"params": [2]}`))
+
+	custom := &jsonhandlerfunc.Config{ResponseShape: &jsonhandlerfunc.ResponseShape{
+		Write: func(w http.ResponseWriter, statusCode int, results []interface{}, err *jsonhandlerfunc.ResponseError) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(statusCode)
+			if err != nil {
+				fmt.Fprintln(w, "error:", err.Error)
+				return
+			}
+			fmt.Fprintln(w, "ok:", results[0])
+		},
+	}}
+	fmt.Println(httpPostJSONReturnCode(custom.ToHandlerFunc(getUser), `{"params": [1]}`))
+	fmt.Println(httpPostJSONReturnCode(custom.ToHandlerFunc(getUser), `{"params": [2]}`))
+	//Output:
+	// {"data":{"id":1,"name":"felix"},"error":null}
+	//  200
+	// {"data":null,"error":{"error":"user 2 not found","value":{}}}
+	//  404
+	// ok: map[id:1 name:felix]
+	//  200
+	// error: user 2 not found
+	//  404
+}
+
+// ### 46) Handlers are put in maintenance at runtime, for all handlers of a Config or WithMaintenance for some
+func ExampleToHandlerFunc_46maintenance() {
+	var checkout = func(cartID string) (r string, err error) {
+		r = "checked out " + cartID
+		return
+	}
+	payments := &jsonhandlerfunc.Maintenance{}
+	hf := jsonhandlerfunc.ToHandlerFunc(checkout, jsonhandlerfunc.WithMaintenance(payments))
+
+	post := func() {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["c1"]}`)))
+		fmt.Print(w.Code, " ", w.Header().Get("Retry-After"), " ", w.Body.String())
+	}
+	post()
+	payments.Start("migrating payments", 90*time.Second)
+	post()
+	payments.Stop()
+	post()
+	//Output:
+	// 200  {"results":["checked out c1",null]}
+	// 503 90 {"results":["",{"error":"in maintenance: migrating payments","value":{"code":"maintenance","reason":"migrating payments"}}]}
+	// 200  {"results":["checked out c1",null]}
+}
+
+type insufficientFundsError struct {
+	Balance, Amount int
+}
+
+func (e *insufficientFundsError) Error() string     { return "insufficient funds" }
+func (e *insufficientFundsError) ErrorCode() string { return "insufficient_funds" }
+func (e *insufficientFundsError) ErrorDetails() interface{} {
+	return map[string]int{"shortfall": e.Amount - e.Balance}
+}
+
+// ### 47) Errors are responded as {"error": {"code", "message", "details"}} with Config.StructuredErrors
+func ExampleToHandlerFunc_47structurederrors() {
+	var withdraw = func(amount int) (balance int, err error) {
+		switch {
+		case amount > 100:
+			err = &insufficientFundsError{Balance: 100, Amount: amount}
+		case amount <= 0:
+			err = fmt.Errorf("amount must be positive")
+		}
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{StructuredErrors: true}
+	hf := cfg.ToHandlerFunc(withdraw)
+	fmt.Print(httpPostJSON(hf, `{"params": [150]}`))
+	fmt.Print(httpPostJSON(hf, `{"params": [0]}`))
+	fmt.Print(httpPostJSON(hf, `{"params": [1, 2]}`))
+
+	ts := httptest.NewServer(hf)
+	defer ts.Close()
+	var balance int
+	err := jsonhandlerfunc.NewClient(ts.URL).Call(context.Background(), "", []interface{}{150}, &balance)
+	re := err.(*jsonhandlerfunc.RemoteError)
+	fmt.Println(re.Code, re.Message, string(re.Value))
+	//Output:
+	// {"results":[0,{"error":{"code":"insufficient_funds","message":"insufficient funds","details":{"shortfall":50}}}]}
+	// {"results":[0,{"error":{"message":"amount must be positive"}}]}
+	// {"results":[0,{"error":{"code":"params_count_mismatch","message":"require 1 params (int), but passed in 2 params","details":{"code":"params_count_mismatch","required":1,"passed":2,"params":[{"index":0,"type":"int"}]}}}]}
+	// insufficient_funds insufficient funds {"shortfall":50}
+}
+
+// ### 48) Slice results are split into pages with WithAutoPaginate, the next page is requested with the cursor in the meta
+func ExampleToHandlerFunc_48autopaginate() {
+	var listIDs = func(prefix string) (ids []string, err error) {
+		for i := 1; i <= 5; i++ {
+			ids = append(ids, fmt.Sprintf("%s%d", prefix, i))
+		}
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(listIDs, jsonhandlerfunc.WithAutoPaginate(2))
+
+	cursor := ""
+	for {
+		body, _ := json.Marshal(map[string]interface{}{"params": []string{"u"}, "cursor": cursor})
+		var resp struct {
+			Results []interface{}          `json:"results"`
+			Meta    map[string]interface{} `json:"meta"`
+		}
+		json.Unmarshal([]byte(httpPostJSON(hf, string(body))), &resp)
+		fmt.Println(resp.Results)
+		next, ok := resp.Meta[jsonhandlerfunc.NextCursorMetaKey].(string)
+		if !ok {
+			break
+		}
+		cursor = next
+	}
+	fmt.Print(httpPostJSON(hf, `{"params": ["x"], "cursor": "`+cursor+`"}`))
+	//Output:
+	// [[u1 u2] <nil>]
+	// [[u3 u4] <nil>]
+	// [[u5] <nil>]
+	// {"results":[null,{"error":"invalid cursor","value":{"code":"invalid_cursor"}}]}
+}
+
+// ### 49) Panics of the func and the injectors are recovered and responded as json with 500, or what Config.PanicHandler returns
+func ExampleToHandlerFunc_49panichandler() {
+	var divide = func(a, b int) (r int, err error) {
+		r = a / b
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{
+		PanicHandler: func(recovered interface{}, stack []byte) error {
+			return fmt.Errorf("recovered: %v", recovered)
+		},
+	}
+	fmt.Println(httpPostJSONReturnCode(cfg.ToHandlerFunc(divide), `{"params": [1, 0]}`))
+
+	w := httptest.NewRecorder()
+	jsonhandlerfunc.DevConfig().ToHandlerFunc(divide)(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [1, 0]}`)))
+	var resp struct {
+		Results []*struct {
+			Value jsonhandlerfunc.PanicError `json:"value"`
+		} `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	pe := resp.Results[1].Value
+	fmt.Println(w.Code, pe.Code, pe.Panic, strings.Contains(pe.Stack, "goroutine"))
+	//Output:
+	// {"results":[0,{"error":"recovered: runtime error: integer divide by zero","value":{}}]}
+	//  500
+	// 500 panic runtime error: integer divide by zero true
+}
+
+type userQuery struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+	Age  int      `json:"age"`
+}
+
+// ### 50) GET requests with an empty body decode the params from the query with Config.QueryParams
+func ExampleToHandlerFunc_50queryparams() {
+	var search = func(name string, limit int) (r string, err error) {
+		r = fmt.Sprintf("%d of %s", limit, name)
+		return
+	}
+	var find = func(q userQuery) (r string, err error) {
+		r = fmt.Sprintf("%s %v %d", q.Name, q.Tags, q.Age)
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{QueryParams: true}
+	get := func(hf http.HandlerFunc, url string) {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("GET", url, nil))
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	get(cfg.ToHandlerFunc(search), `/search?params=["felix",10]`)
+	get(cfg.ToHandlerFunc(search, jsonhandlerfunc.WithParamNames("name", "limit")), "/search?name=123&limit=5")
+	get(cfg.ToHandlerFunc(find), "/find?name=felix&tags=a&tags=b&age=30")
+	get(cfg.ToHandlerFunc(find), "/find?age=old")
+	//Output:
+	// 200 {"results":["10 of felix",null]}
+	// 200 {"results":["5 of 123",null]}
+	// 200 {"results":["felix [a b] 30",null]}
+	// 422 {"results":["",{"error":"decode request params error","value":{}}]}
+}
+
+// ### 51) Funcs declare named ops with StartOp, slow ones fail with an OpTimeoutError, and their timings are reported
+func ExampleToHandlerFunc_51ops() {
+	var report = func(ctx context.Context, slow bool) (r string, err error) {
+		op := jsonhandlerfunc.StartOp(ctx, "db.query")
+		if slow {
+			<-op.Context().Done()
+			err = op.Context().Err()
+		}
+		if err = op.End(err); err != nil {
+			return
+		}
+		r = "report"
+		return
+	}
+	timings := make(chan jsonhandlerfunc.OpTiming, 2)
+	cfg := &jsonhandlerfunc.Config{
+		OnOps: func(state *jsonhandlerfunc.RequestState, ops []jsonhandlerfunc.OpTiming) {
+			for _, op := range ops {
+				timings <- op
+			}
+		},
+	}
+	hf := cfg.ToHandlerFunc(report, jsonhandlerfunc.WithOpTimeout("db.query", 20*time.Millisecond))
+	for _, slow := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"params": [%t]}`, slow))))
+		var resp struct {
+			Results []*struct {
+				Value jsonhandlerfunc.OpTimeoutError `json:"value"`
+			} `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		op := <-timings
+		fmt.Println(w.Code, resp.Results[1] != nil && resp.Results[1].Value.Code == jsonhandlerfunc.OpDeadlineExceededCode, op.Name, op.Timeout, op.Exceeded)
+	}
+
+	w := httptest.NewRecorder()
+	jsonhandlerfunc.DevConfig().ToHandlerFunc(report)(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [false]}`)))
+	fmt.Println(strings.HasPrefix(w.Header().Get("Server-Timing"), "db.query;dur="), strings.Contains(w.Body.String(), `"ops": [`))
+	//Output:
+	// 200 false db.query 20ms false
+	// 504 true db.query 20ms true
+	// true true
+}
+
+// ### 52) Middleware are attached to the handlers of a Config with Use
+func ExampleToHandlerFunc_52middlewares() {
+	var hello = func(name string) (r string, err error) {
+		r = "Hello " + name
+		return
+	}
+	cors := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			next.ServeHTTP(w, r)
+		})
+	}
+	apiKey := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Api-Key") != "secret" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	hf := (&jsonhandlerfunc.Config{}).Use(cors, apiKey).ToHandlerFunc(hello)
+
+	for _, key := range []string{"", "secret"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["Gates"]}`))
+		req.Header.Set("X-Api-Key", key)
+		hf(w, req)
+		fmt.Print(w.Code, " ", w.Header().Get("Access-Control-Allow-Origin"), " ", w.Body.String())
+	}
+	//Output:
+	// 403 * forbidden
+	// 200 * {"results":["Hello Gates",null]}
+}
+
+// ### 53) Every call is observed with Config.OnRequest and Config.OnResponse, sensitive params are redacted
+func ExampleToHandlerFunc_53lifecyclehooks() {
+	var login = func(name, password string) (token string, err error) {
+		if password != "secret" {
+			err = fmt.Errorf("wrong password")
+			return
+		}
+		token = "t0k3n"
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{
+		OnRequest: func(ctx context.Context, funcName string, params []interface{}) {
+			fmt.Println("request:", funcName[strings.LastIndex(funcName, ".")+1:], params)
+		},
+		OnResponse: func(ctx context.Context, funcName string, results []interface{}, err error, duration time.Duration) {
+			fmt.Println("response:", results, err)
+		},
+	}
+	hf := cfg.ToHandlerFunc(login, jsonhandlerfunc.WithRedactedParams(1))
+	for _, password := range []string{"secret", "guess"} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["felix", "`+password+`"]}`)))
+	}
+	//Output:
+	// request: func1 [felix [REDACTED]]
+	// response: [t0k3n] <nil>
+	// request: func1 [felix [REDACTED]]
+	// response: [] wrong password
+}
+
+// ### 54) Inject the real client IP behind trusted proxies with ClientIPInjector, Config.CheckQuota can limit by it
+func ExampleToHandlerFunc_54clientip() {
+	var whoami = func(ip jsonhandlerfunc.ClientIP) (r string, err error) {
+		r = "you are " + string(ip)
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{
+		CheckQuota: func(state *jsonhandlerfunc.RequestState) error {
+			if state.ClientIP() == "203.0.113.9" {
+				return &jsonhandlerfunc.QuotaExceededError{Code: jsonhandlerfunc.QuotaExceededCode, Quota: "requests per minute"}
+			}
+			return nil
+		},
+	}
+	hf := cfg.ToHandlerFunc(whoami, jsonhandlerfunc.ClientIPInjector("10.0.0.0/8"))
+	for _, req := range []struct{ remoteAddr, header, value string }{
+		{"198.51.100.1:1234", "X-Forwarded-For", "1.2.3.4"},
+		{"10.0.0.2:1234", "X-Forwarded-For", "1.2.3.4, 198.51.100.7, 10.0.0.1"},
+		{"10.0.0.2:1234", "Forwarded", `for="[2001:db8::1]:4711", for=10.0.0.1`},
+		{"10.0.0.2:1234", "X-Forwarded-For", "203.0.113.9"},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": []}`))
+		r.RemoteAddr = req.remoteAddr
+		r.Header.Set(req.header, req.value)
+		w := httptest.NewRecorder()
+		hf(w, r)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// 200 {"results":["you are 198.51.100.1",null]}
+	// 200 {"results":["you are 198.51.100.7",null]}
+	// 200 {"results":["you are 2001:db8::1",null]}
+	// 429 {"results":["",{"error":"quota exceeded: requests per minute","value":{"code":"quota_exceeded","quota":"requests per minute"}}]}
+}
+
+// ### 55) Cache GET responses in the process with WithResponseCache, partitioned by tenant
+func ExampleToHandlerFunc_55responsecache() {
+	type tenant string
+	var calls int
+	var products = func(t tenant, category string) (r []string, err error) {
+		calls++
+		r = []string{string(t) + " " + category}
+		return
+	}
+	var tenantInjector = func(w http.ResponseWriter, r *http.Request) (t tenant, err error) {
+		t = tenant(r.Header.Get("X-Tenant"))
+		return
+	}
+	cache := jsonhandlerfunc.NewResponseCache(jsonhandlerfunc.CacheDimension{
+		Name: "tenant",
+		Value: func(state *jsonhandlerfunc.RequestState) string {
+			var t tenant
+			state.Lookup(&t)
+			return string(t)
+		},
+	})
+	hf := jsonhandlerfunc.ToHandlerFunc(products, tenantInjector,
+		jsonhandlerfunc.WithCacheableGET(time.Minute), jsonhandlerfunc.WithResponseCache(cache))
+	for _, t := range []string{"acme", "acme", "globex"} {
+		r := httptest.NewRequest("GET", `/?params=["shoes"]`, nil)
+		r.Header.Set("X-Tenant", t)
+		w := httptest.NewRecorder()
+		hf(w, r)
+		fmt.Print(w.Header().Get(jsonhandlerfunc.CacheStatusHeader), " ", w.Header().Get("Cache-Control"), " ", w.Body.String())
+	}
+	fmt.Println("calls:", calls)
+	stats, _ := json.Marshal(cache.Stats())
+	fmt.Println(string(stats))
+	//Output:
+	// MISS private, max-age=60 {"results":[["acme shoes"],null]}
+	// HIT private, max-age=60 {"results":[["acme shoes"],null]}
+	// MISS private, max-age=60 {"results":[["globex shoes"],null]}
+	// calls: 2
+	// {"hits":1,"misses":2,"hit_rate":0.3333333333333333,"entries":2,"dimensions":{"tenant":{"acme":{"hits":1,"misses":1,"hit_rate":0.5},"globex":{"hits":0,"misses":1,"hit_rate":0}}}}
+}
+
+// ### 56) Encrypt the sensitive fields of the params and results persisted by WithAuditChain and WithTee with WithFieldEncryption
+func ExampleToHandlerFunc_56fieldencryption() {
+	type card struct {
+		Holder string `json:"holder"`
+		Number string `json:"number" jsonhf:"encrypt"`
+	}
+	var pay = func(c card, amount int) (ok bool, err error) {
+		ok = true
+		return
+	}
+	cipher, _ := jsonhandlerfunc.NewAESFieldCipher([]byte("0123456789abcdef0123456789abcdef"))
+	var stored *jsonhandlerfunc.Receipt
+	chain := jsonhandlerfunc.NewAuditChain("", func(rc *jsonhandlerfunc.Receipt) {
+		stored = rc
+	})
+	hf := jsonhandlerfunc.ToHandlerFunc(pay, jsonhandlerfunc.WithAuditChain(chain), jsonhandlerfunc.WithFieldEncryption(cipher))
+	w := httptest.NewRecorder()
+	hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [{"holder": "Felix", "number": "4242424242424242"}, 100]}`)))
+
+	var params []map[string]interface{}
+	json.Unmarshal(stored.Params, &params)
+	fmt.Println(params[0]["holder"], strings.HasPrefix(params[0]["number"].(string), jsonhandlerfunc.EncryptedPrefix))
+	fmt.Println(strings.Contains(string(stored.Params), "4242"))
+	decrypted, _ := jsonhandlerfunc.DecryptJSON(stored.Params, cipher)
+	fmt.Println(string(decrypted))
+	fmt.Println(jsonhandlerfunc.VerifyReceipts([]*jsonhandlerfunc.Receipt{stored}))
+	//Output:
+	// Felix true
+	// false
+	// [{"holder":"Felix","number":"4242424242424242"},100]
+	// <nil>
+}
+
+// ### 57) Poll by POST with If-None-Match of the ETag of the last response, WithConditionalPOST responds {"not_modified": true} if it's the same
+func ExampleToHandlerFunc_57conditionalpost() {
+	var version = 1
+	var dashboard = func(team string) (r map[string]int, err error) {
+		r = map[string]int{"version": version}
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(dashboard, jsonhandlerfunc.WithConditionalPOST())
+	var etag string
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			version = 2
+		}
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["core"]}`))
+		r.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		hf(w, r)
+		fmt.Print(w.Code, " ", w.Header().Get("ETag") == etag, " ", w.Body.String())
+		etag = w.Header().Get("ETag")
+	}
+	//Output:
+	// 200 false {"results":[{"version":1},null]}
+	// 200 true {"not_modified":true}
+	// 200 false {"results":[{"version":2},null]}
+}
+
+// ### 58) Keep & in URLs with Config.DisableHTMLEscape, and format floats without exponents with FloatDecimal
+func ExampleToHandlerFunc_58encoderformats() {
+	var share = func(id int) (url string, views float64, ratio float64, err error) {
+		url = fmt.Sprintf("https://example.com/share?id=%d&ref=mail", id)
+		views = 1e21
+		ratio = 0.0000005
+		return
+	}
+	for _, cfg := range []*jsonhandlerfunc.Config{
+		{},
+		{DisableHTMLEscape: true, FloatFormat: jsonhandlerfunc.FloatDecimal},
+	} {
+		w := httptest.NewRecorder()
+		cfg.ToHandlerFunc(share)(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [7]}`)))
+		fmt.Print(w.Body.String())
+	}
+	//Output:
+	// {"results":["https://example.com/share?id=7\u0026ref=mail",1e+21,5e-7,null]}
+	// {"results":["https://example.com/share?id=7&ref=mail",1000000000000000000000,0.0000005,null]}
+}
+
+// ### 59) Reject misspelled fields with Config.DisallowUnknownFields, and null params with WithRequiredParams
+func ExampleToHandlerFunc_59strictdecoding() {
+	type address struct {
+		City string `json:"city"`
+	}
+	type profile struct {
+		Name    string   `json:"name"`
+		Address *address `json:"address"`
+	}
+	var update = func(id int, p profile, note string) (r string, err error) {
+		r = fmt.Sprintf("%d %s %s", id, p.Name, p.Address.City)
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{DisallowUnknownFields: true}
+	hf := cfg.ToHandlerFunc(update, jsonhandlerfunc.WithRequiredParams(0))
+	for _, body := range []string{
+		`{"params": [1, {"Name": "felix", "address": {"city": "Hangzhou"}}, null]}`,
+		`{"params": [null, {"name": "felix", "adress": {"city": "Hangzhou"}, "address": {"citi": "Hangzhou"}}, ""]}`,
+		`{"params": [1, {}, "", "extra"]}`,
+	} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// 200 {"results":["1 felix Hangzhou",null]}
+	// 422 {"results":["",{"error":"invalid params: params[0] is required, params[1].address.citi is not a field of jsonhandlerfunc_test.address, params[1].adress is not a field of jsonhandlerfunc_test.profile","value":{"code":"invalid_params","fields":[{"field":"params[0]","rule":"required","message":"is required"},{"field":"params[1].address.citi","rule":"unknown","message":"is not a field of jsonhandlerfunc_test.address"},{"field":"params[1].adress","rule":"unknown","message":"is not a field of jsonhandlerfunc_test.profile"}]}}]}
+	// 422 {"results":["",{"error":"require 3 params (int, jsonhandlerfunc_test.profile, string), but passed in 4 params","value":{"code":"params_count_mismatch","required":3,"passed":4,"params":[{"index":0,"type":"int"},{"index":1,"type":"jsonhandlerfunc_test.profile"},{"index":2,"type":"string"}]}}]}
+}
+
+// ### 60) Reject oversized request bodies with Config.MaxRequestBodyBytes, and slow-drip ones with Config.DecodeTimeout
+func ExampleToHandlerFunc_60bodylimits() {
+	var echo = func(s string) (r string, err error) {
+		r = s
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{
+		MaxRequestBodyBytes: 32,
+		DecodeTimeout:       50 * time.Millisecond,
+	}
+	hf := cfg.ToHandlerFunc(echo)
+	serve := func(r *http.Request) {
+		w := httptest.NewRecorder()
+		hf(w, r)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+
+	serve(httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["hello"]}`)))
+	serve(httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["hello, this is a long long message"]}`)))
+
+	chunked := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["hello, this is a long long message"]}`))
+	chunked.ContentLength = -1
+	serve(chunked)
+
+	serve(httptest.NewRequest("POST", "/", &slowReader{body: `{"params": ["hello"]}`, delay: 100 * time.Millisecond}))
+	//Output:
+	// 200 {"results":["hello",null]}
+	// 413 {"results":["",{"error":"request body is larger than 32 bytes","value":{"code":"request_too_large","max_bytes":32}}]}
+	// 413 {"results":["",{"error":"request body is larger than 32 bytes","value":{"code":"request_too_large","max_bytes":32}}]}
+	// 408 {"results":["",{"error":"request body was not read in 50ms","value":{"code":"request_timeout","timeout_ms":50}}]}
+}
+
+// slowReader drips its body byte by byte, like a slow-drip client
+type slowReader struct {
+	body  string
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (n int, err error) {
+	if len(r.body) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	n = copy(p[:1], r.body)
+	r.body = r.body[n:]
+	return
+}
+
+// ### 61) Bind only some params from the URL query of GET requests with WithQueryParams, the rest are zero values
+func ExampleToHandlerFunc_61queryparams() {
+	type productQuery struct {
+		Category string `json:"category"`
+		Limit    int    `json:"limit"`
+		Cursor   string `json:"cursor"`
+	}
+	var listProducts = func(q productQuery) (r string, err error) {
+		r = fmt.Sprintf("category=%q limit=%d cursor=%q", q.Category, q.Limit, q.Cursor)
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(listProducts,
+		jsonhandlerfunc.WithQueryParams("limit", "cursor"),
+		jsonhandlerfunc.WithCacheableGET(time.Minute),
+	)
+	w := httptest.NewRecorder()
+	hf(w, httptest.NewRequest("GET", "/api/products?limit=10&cursor=abc&category=shoes", nil))
+	fmt.Print(w.Code, " ", w.Header().Get("Cache-Control"), " ", w.Body.String())
+
+	var search = func(keyword string, limit int) (r string, err error) {
+		r = fmt.Sprintf("keyword=%q limit=%d", keyword, limit)
+		return
+	}
+	hf = jsonhandlerfunc.ToHandlerFunc(search,
+		jsonhandlerfunc.WithParamNames("keyword", "limit"),
+		jsonhandlerfunc.WithQueryParams("limit"),
+	)
+	w = httptest.NewRecorder()
+	hf(w, httptest.NewRequest("GET", "/api/search?limit=5&keyword=shoes", nil))
+	fmt.Print(w.Code, " ", w.Body.String())
+
+	defer func() {
+		fmt.Println(recover())
+	}()
+	jsonhandlerfunc.ToHandlerFunc(search, jsonhandlerfunc.WithQueryParams("limit"))
+	//Output:
+	// 200 public, max-age=60 {"results":["category=\"\" limit=10 cursor=\"abc\"",null]}
+	// 200 {"results":["keyword=\"\" limit=5",null]}
+	// WithQueryParams names [limit] are not names of WithParamNames or fields of the single struct param of func(string, int) (string, error)
+}
+
+// ### 62) Config.Timeout also stops decoding the body of a slow request, and a request abandoned by the client is not responded
+func ExampleToHandlerFunc_62decodecancel() {
+	var echo = func(s string) (r string, err error) {
+		r = s
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{Timeout: 30 * time.Millisecond}
+	hf := cfg.ToHandlerFunc(echo)
+
+	w := httptest.NewRecorder()
+	hf(w, httptest.NewRequest("POST", "/", &slowReader{body: `{"params": ["hello"]}`, delay: 20 * time.Millisecond}))
+	var resp struct {
+		Results []struct {
+			Value jsonhandlerfunc.TimeoutError
+		}
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	fmt.Println(w.Code, resp.Results[1].Value.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel)
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", &slowReader{body: `{"params": ["hello"]}`, delay: 20 * time.Millisecond})
+	jsonhandlerfunc.ToHandlerFunc(echo)(w, r.WithContext(ctx))
+	fmt.Printf("client went away: %q\n", w.Body.String())
+	//Output:
+	// 504 deadline_exceeded
+	// client went away: ""
+}
+
+// ### 63) WithAutoRetry calls an idempotent func again for transient errors, like 503 of a flaky downstream
+func ExampleToHandlerFunc_63autoretry() {
+	calls := 0
+	var getRates = func(currency string) (rate float64, err error) {
+		calls++
+		if calls < 3 {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusServiceUnavailable, errors.New("rates service unavailable"))
+			return
+		}
+		rate = 7.1
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(getRates,
+		jsonhandlerfunc.WithAutoRetry(2, jsonhandlerfunc.ExponentialBackoff(time.Millisecond, 10*time.Millisecond), nil),
+	)
+	w := httptest.NewRecorder()
+	hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["CNY"]}`)))
+	fmt.Print(w.Code, " ", w.Body.String())
+
+	calls = -10
+	w = httptest.NewRecorder()
+	hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["CNY"]}`)))
+	fmt.Print(w.Code, " ", w.Body.String())
+	fmt.Println("calls:", calls+10)
+
+	backoff := jsonhandlerfunc.ExponentialBackoff(100*time.Millisecond, time.Second)
+	fmt.Println(backoff(1), backoff(2), backoff(3), backoff(5))
+	//Output:
+	// 200 {"results":[7.1,null],"meta":{"attempts":3}}
+	// 503 {"results":[0,{"error":"rates service unavailable","value":{}}],"meta":{"attempts":3}}
+	// calls: 3
+	// 100ms 200ms 400ms 1s
+}
+
+// ### 64) Config.Compression compresses large responses with the coding negotiated from Accept-Encoding
+func ExampleToHandlerFunc_64compression() {
+	var listProducts = func(n int) (names []string, err error) {
+		for i := 0; i < n; i++ {
+			names = append(names, fmt.Sprintf("product %d", i))
+		}
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{Compression: &jsonhandlerfunc.Compression{
+		MinSize: 512,
+		Encoders: []jsonhandlerfunc.ContentEncoder{{
+			Name: "deflate",
+			NewWriter: func(w io.Writer) io.WriteCloser {
+				fw, _ := flate.NewWriter(w, flate.BestSpeed)
+				return fw
+			},
+		}},
+	}}
+	hf := cfg.ToHandlerFunc(listProducts)
+	for _, c := range []struct {
+		n              int
+		acceptEncoding string
+	}{
+		{1000, "gzip, br"},
+		{1000, "gzip, deflate"},
+		{1000, "deflate;q=0, *"},
+		{1000, ""},
+		{3, "gzip"},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"params": [%d]}`, c.n)))
+		r.Header.Set("Accept-Encoding", c.acceptEncoding)
+		w := httptest.NewRecorder()
+		hf(w, r)
+
+		var body io.Reader = w.Body
+		switch w.Header().Get("Content-Encoding") {
+		case "gzip":
+			body, _ = gzip.NewReader(body)
+		case "deflate":
+			body = flate.NewReader(body)
+		}
+		size := w.Body.Len()
+		var resp struct{ Results []interface{} }
+		json.NewDecoder(body).Decode(&resp)
+		fmt.Printf("%q: %q %q compressed=%v results=%d\n", c.acceptEncoding, w.Header().Get("Content-Encoding"),
+			w.Header().Get("Vary"), size < c.n*10, len(resp.Results[0].([]interface{})))
+	}
+	//Output:
+	// "gzip, br": "gzip" "Accept-Encoding" compressed=true results=1000
+	// "gzip, deflate": "deflate" "Accept-Encoding" compressed=true results=1000
+	// "deflate;q=0, *": "gzip" "Accept-Encoding" compressed=true results=1000
+	// "": "" "Accept-Encoding" compressed=false results=1000
+	// "gzip": "" "Accept-Encoding" compressed=false results=3
+}
+
+// ### 65) Injectors can receive the values injected by the injectors before them, like session, user and permissions
+func ExampleToHandlerFunc_65chainedinjectors() {
+	type session struct{ UserID int }
+	type user struct{ Name string }
+	type permissions []string
+
+	var sessionInjector = func(w http.ResponseWriter, r *http.Request) (s *session, err error) {
+		if r.Header.Get("Cookie") != "session=abc" {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusUnauthorized, errors.New("no session"))
+			return
+		}
+		s = &session{UserID: 7}
+		return
+	}
+	var userInjector = func(ctx context.Context, s *session, w http.ResponseWriter, r *http.Request) (u *user, err error) {
+		u = &user{Name: fmt.Sprintf("user %d", s.UserID)}
+		return
+	}
+	var permissionsInjector = func(u *user, w http.ResponseWriter, r *http.Request) (perms permissions, err error) {
+		perms = permissions{"orders:read"}
+		return
+	}
+	var listOrders = func(s *session, u *user, perms permissions, status string) (r string, err error) {
+		r = fmt.Sprintf("%s %v %s orders", u.Name, perms, status)
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(listOrders, sessionInjector, userInjector, permissionsInjector)
+	for _, cookie := range []string{"session=abc", ""} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["paid"]}`))
+		r.Header.Set("Cookie", cookie)
+		w := httptest.NewRecorder()
+		hf(w, r)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+
+	defer func() {
+		fmt.Println(recover())
+	}()
+	jsonhandlerfunc.ToHandlerFunc(func(u *user, perms permissions) (err error) { return }, userInjector, permissionsInjector)
+	//Output:
+	// 200 {"results":["user 7 [orders:read] paid orders",null]}
+	// 401 {"results":["",{"error":"no session","value":{}}]}
+	// injector func(context.Context, *jsonhandlerfunc_test.session, http.ResponseWriter, *http.Request) (*jsonhandlerfunc_test.user, error) param *jsonhandlerfunc_test.session is not injected by the injectors before it, injected []
+}
+
+// ### 66) GroupInjector injects a Group for the concurrent downstream calls of a fan-out func, canceled with the request
+func ExampleToHandlerFunc_66group() {
+	var running, maxRunning int32
+	var fetch = func(ctx context.Context, id int) (err error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		wait := time.After(10 * time.Millisecond)
+		if id == 99 {
+			// blocks until the request times out
+			wait = nil
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if id == 13 {
+			err = errors.New("item 13 not found")
+		}
+		return
+	}
+	var getItems = func(g *jsonhandlerfunc.Group, ids []int) (fetched int, err error) {
+		var count int32
+		for _, id := range ids {
+			id := id
+			g.Go(func(ctx context.Context) (err error) {
+				if err = fetch(ctx, id); err == nil {
+					atomic.AddInt32(&count, 1)
+				}
+				return
+			})
+		}
+		err = g.Wait()
+		fetched = int(count)
+		return
+	}
+
+	hf := (&jsonhandlerfunc.Config{Timeout: 10 * time.Second}).ToHandlerFunc(getItems, jsonhandlerfunc.GroupInjector(2))
+	timeoutHf := (&jsonhandlerfunc.Config{Timeout: 20 * time.Millisecond}).ToHandlerFunc(getItems, jsonhandlerfunc.GroupInjector(2))
+	for _, c := range []struct {
+		hf  http.HandlerFunc
+		ids string
+	}{
+		{hf, "[1, 2, 3, 4, 5]"},
+		{hf, "[1, 13, 3, 4, 5]"},
+		{timeoutHf, "[1, 2, 99, 4, 5]"},
+	} {
+		hf, ids := c.hf, c.ids
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [`+ids+`]}`)))
+		var resp struct {
+			Results []interface{}
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if respErr, ok := resp.Results[1].(map[string]interface{}); ok {
+			if code := respErr["value"].(map[string]interface{})["code"]; code != nil {
+				fmt.Println(w.Code, code, "max running:", atomic.LoadInt32(&maxRunning))
+				continue
+			}
+			fmt.Println(w.Code, respErr["error"], "max running:", atomic.LoadInt32(&maxRunning))
+			continue
+		}
+		fmt.Println(w.Code, "fetched", resp.Results[0], "max running:", atomic.LoadInt32(&maxRunning))
+	}
+	//Output:
+	// 200 fetched 5 max running: 2
+	// 200 item 13 not found max running: 2
+	// 504 deadline_exceeded max running: 2
+}
+
+// ### 67) A leading context.Context is injected from the request together with the values of the injectors after it
+func ExampleToHandlerFunc_67contextwithinjectors() {
+	type user struct{ Name string }
+	var userInjector = func(w http.ResponseWriter, r *http.Request) (u *user, err error) {
+		u = &user{Name: r.Header.Get("X-User")}
+		return
+	}
+	var getOrder = func(ctx context.Context, u *user, id int) (r string, err error) {
+		_, hasDeadline := ctx.Deadline()
+		r = fmt.Sprintf("order %d of %s, deadline %v", id, u.Name, hasDeadline)
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{Timeout: time.Second}
+	hf := cfg.ToHandlerFunc(getOrder, userInjector)
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [42]}`))
+	r.Header.Set("X-User", "felix")
+	w := httptest.NewRecorder()
+	hf(w, r)
+	fmt.Print(w.Body.String())
+	//Output:
+	// {"results":["order 42 of felix, deadline true",null]}
+}
+
+// ### 68) WithTimingMeta responds the server processing time, the remaining deadline and the retry advice in the meta
+func ExampleToHandlerFunc_68timingmeta() {
+	var getQuote = func(ip jsonhandlerfunc.ClientIP, symbol string) (price float64, err error) {
+		time.Sleep(5 * time.Millisecond)
+		price = 188.5
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{
+		Timeout: time.Second,
+		CheckQuota: func(state *jsonhandlerfunc.RequestState) error {
+			if state.ClientIP() == "203.0.113.9" {
+				return &jsonhandlerfunc.QuotaExceededError{Code: jsonhandlerfunc.QuotaExceededCode, RetryAfter: 2 * time.Second}
+			}
+			return nil
+		},
+	}
+	hf := cfg.ToHandlerFunc(getQuote, jsonhandlerfunc.ClientIPInjector(), jsonhandlerfunc.WithTimingMeta())
+	for _, ip := range []string{"203.0.113.1", "203.0.113.9"} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["AAPL"]}`))
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		hf(w, r)
+		var resp struct {
+			Meta struct {
+				Timing jsonhandlerfunc.TimingMeta `json:"timing"`
+			} `json:"meta"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		timing := resp.Meta.Timing
+		fmt.Println(w.Code, "called:", timing.ServerMs >= 5,
+			"deadline remaining:", *timing.DeadlineRemainingMs > 0 && *timing.DeadlineRemainingMs <= 1000)
+		if timing.Retry != nil {
+			fmt.Printf("retry: %+v\n", *timing.Retry)
+		}
+	}
+	//Output:
+	// 200 called: true deadline remaining: true
+	// 429 called: false deadline remaining: true
+	// retry: {Retryable:true AfterMs:2000}
+}
+
+// ### 69) WithResultNames responds the results as an object keyed by their names
+func ExampleToHandlerFunc_69resultnames() {
+	type Order struct {
+		ID    int `json:"id"`
+		Total int `json:"total"`
+	}
+	type Shipment struct {
+		Carrier string `json:"carrier"`
+	}
+	var getOrder = func(id int) (order *Order, shipment *Shipment, invoices []string, err error) {
+		if id == 0 {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		order = &Order{ID: id, Total: 100}
+		invoices = []string{"INV-1"}
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(getOrder, jsonhandlerfunc.WithResultNames("order", "shipment,omitempty", "invoices"))
+	for _, req := range []struct {
+		body       string
+		positional bool
+	}{
+		{`{"params": [7]}`, false},
+		{`{"params": [0]}`, false},
+		{`{"params": [7]}`, true},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(req.body))
+		if req.positional {
+			r.Header.Set(jsonhandlerfunc.PositionalResultsHeader, "1")
+		}
+		w := httptest.NewRecorder()
+		hf(w, r)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// 200 {"results":{"order":{"id":7,"total":100},"invoices":["INV-1"],"error":null}}
+	// 404 {"results":{"order":null,"invoices":null,"error":{"error":"order not found","value":{}}}}
+	// 200 {"results":[{"id":7,"total":100},null,["INV-1"],null]}
+}
+
+// ### 70) a result that refers to itself is responded with a ResultCycleError of the path of the cycle
+func ExampleToHandlerFunc_70resultcycle() {
+	type Employee struct {
+		Name    string      `json:"name"`
+		Manager *Employee   `json:"manager,omitempty"`
+		Reports []*Employee `json:"reports,omitempty"`
+	}
+	var getEmployee = func(name string) (e *Employee, err error) {
+		boss := &Employee{Name: "ann"}
+		e = &Employee{Name: name, Manager: boss}
+		boss.Reports = []*Employee{{Name: "bob"}}
+		if name == "cid" {
+			boss.Reports = append(boss.Reports, e)
+		}
+		return
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(getEmployee)
+	for _, name := range []string{"dan", "cid"} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"params": [%q]}`, name))))
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// 200 {"results":[{"name":"dan","manager":{"name":"ann","reports":[{"name":"bob"}]}},null]}
+	// 500 {"results":[null,{"error":"result has a cycle at results[0].manager.reports[1]","value":{"code":"result_cycle","path":"results[0].manager.reports[1]"}}]}
+}
+
+// ### 71) an EventStream result sends the items as Server-Sent Events while the func produces them
+func ExampleToHandlerFunc_71eventstream() {
+	type Progress struct {
+		Done  int `json:"done"`
+		Total int `json:"total"`
+	}
+	var importRows = func(ctx context.Context, total int) (es *jsonhandlerfunc.EventStream[Progress], err error) {
+		if total <= 0 {
+			return nil, jsonhandlerfunc.NewStatusCodeError(http.StatusUnprocessableEntity, errors.New("nothing to import"))
+		}
+		return jsonhandlerfunc.NewEventStream(func(ctx context.Context, send func(Progress) error) error {
+			for done := 1; done <= total; done++ {
+				if done == 3 {
+					return errors.New("row 3 is invalid")
+				}
+				if err := send(Progress{Done: done, Total: total}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	}
+	ts := httptest.NewServer(jsonhandlerfunc.ToHandlerFunc(importRows))
+	defer ts.Close()
+
+	for _, body := range []string{`{"params": [2]}`, `{"params": [5]}`, `{"params": [0]}`} {
+		res, _ := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		fmt.Printf("%d %s\n%s\n", res.StatusCode, res.Header.Get("Content-Type"), bytes.TrimSpace(b))
+	}
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(`{"params": [2]}`))
+	req.Header.Set("Accept", "application/x-ndjson")
+	req.Header.Set("Content-Type", "application/json")
+	res, _ := http.DefaultClient.Do(req)
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	fmt.Printf("%s\n%s", res.Header.Get("Content-Type"), b)
+	//Output:
+	// 200 text/event-stream
+	// id: 1
+	// data: {"done":1,"total":2}
+	//
+	// id: 2
+	// data: {"done":2,"total":2}
+	//
+	// event: end
+	// data: {}
+	// 200 text/event-stream
+	// id: 1
+	// data: {"done":1,"total":5}
+	//
+	// id: 2
+	// data: {"done":2,"total":5}
+	//
+	// event: error
+	// data: {"error":"row 3 is invalid","value":{}}
+	// 422 application/json
+	// {"results":[null,{"error":"nothing to import","value":{}}]}
+	// application/x-ndjson
+	// {"done":1,"total":2}
+	// {"done":2,"total":2}
+}
+
+// ### 72) Config.SuccessStatusCode, WithSuccessStatusCode, Config.DecodeErrorStatusCode and Config.ErrToStatusCode change the status codes
+func ExampleToHandlerFunc_72statuscodes() {
+	errNotFound := errors.New("not found")
+	cfg := &jsonhandlerfunc.Config{
+		DecodeErrorStatusCode: http.StatusBadRequest,
+		ErrToStatusCode: func(err error) int {
+			if errors.Is(err, errNotFound) {
+				return http.StatusNotFound
+			}
+			return 0
+		},
+	}
+	var createNote = func(text string) (id int, err error) {
+		return 7, nil
+	}
+	var getNote = func(id int) (text string, err error) {
+		if id != 7 {
+			return "", fmt.Errorf("note %d: %w", id, errNotFound)
+		}
+		return "hello", nil
+	}
+	var deleteNote = func(id int) (err error) {
+		return
+	}
+	create := cfg.ToHandlerFunc(createNote, jsonhandlerfunc.WithSuccessStatusCode(http.StatusCreated))
+	get := cfg.ToHandlerFunc(getNote)
+	del := cfg.ToHandlerFunc(deleteNote, jsonhandlerfunc.WithSuccessStatusCode(http.StatusNoContent))
+	for _, c := range []struct {
+		hf   http.HandlerFunc
+		body string
+	}{
+		{create, `{"params": ["hi"]}`},
+		{get, `{"params": [7]}`},
+		{get, `{"params": [8]}`},
+		{get, `{"params": ["seven"]}`},
+		{del, `{"params": [7]}`},
+	} {
+		w := httptest.NewRecorder()
+		c.hf(w, httptest.NewRequest("POST", "/", strings.NewReader(c.body)))
+		fmt.Printf("%d %q\n", w.Code, w.Body.String())
+	}
+	//Output:
+	// 201 "{\"results\":[7,null]}\n"
+	// 200 "{\"results\":[\"hello\",null]}\n"
+	// 404 "{\"results\":[\"\",{\"error\":\"note 8: not found\",\"value\":{}}]}\n"
+	// 400 "{\"results\":[\"\",{\"error\":\"decode request params error\",\"value\":{}}]}\n"
+	// 204 ""
+}
+
+// ### 73) the Bag values of Config.SurfaceBagKeys set by the middleware, the injectors and the func are responded in the meta
+func ExampleToHandlerFunc_73bag() {
+	var tenantKey = jsonhandlerfunc.NewBagKey[string]("tenant")
+	var cacheHitKey = jsonhandlerfunc.NewBagKey[bool]("cache_hit")
+	cfg := &jsonhandlerfunc.Config{
+		SurfaceBagKeys: []string{"request_id", "tenant", "cache_hit"},
+		Middlewares: []func(http.Handler) http.Handler{
+			func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r = jsonhandlerfunc.WithBag(r)
+					jsonhandlerfunc.BagOf(r.Context()).Set("request_id", r.Header.Get("X-Request-Id"))
+					next.ServeHTTP(w, r)
+				})
+			},
+		},
+		OnResponse: func(ctx context.Context, funcName string, results []interface{}, err error, duration time.Duration) {
+			fmt.Println("log:", jsonhandlerfunc.BagOf(ctx).Surfaced())
+		},
+	}
+	var tenantInjector = func(w http.ResponseWriter, r *http.Request) (tenant string, err error) {
+		tenant = r.Header.Get("X-Tenant")
+		tenantKey.Set(r.Context(), tenant)
+		return
+	}
+	var getPrice = func(ctx context.Context, tenant string, sku string) (price int, err error) {
+		cacheHitKey.Set(ctx, true)
+		if t, _ := tenantKey.Get(ctx); t != tenant {
+			return 0, errors.New("tenant is not in the bag")
+		}
+		return 42, nil
+	}
+	hf := cfg.ToHandlerFunc(getPrice, tenantInjector)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["apple"]}`))
+	r.Header.Set("X-Request-Id", "req-1")
+	r.Header.Set("X-Tenant", "acme")
+	hf(w, r)
+	fmt.Print(w.Body.String())
+	//Output:
+	// log: map[cache_hit:true request_id:req-1 tenant:acme]
+	// {"results":[42,null],"meta":{"bag":{"cache_hit":true,"request_id":"req-1","tenant":"acme"}}}
+}
+
+// ### 74) the func sets the headers and the cookies of its response with ResponseHeaderOf its context
+func ExampleToHandlerFunc_74responseheader() {
+	var login = func(ctx context.Context, email string, password string) (name string, err error) {
+		h := jsonhandlerfunc.ResponseHeaderOf(ctx)
+		h.Set("Cache-Control", "no-store")
+		if password != "secret" {
+			h.SetCookie(&http.Cookie{Name: "session", MaxAge: -1})
+			return "", jsonhandlerfunc.NewStatusCodeError(http.StatusUnauthorized, errors.New("wrong password"))
+		}
+		h.SetCookie(&http.Cookie{Name: "session", Value: "s3cr3t", HttpOnly: true})
+		return "felix", nil
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(login)
+	for _, password := range []string{"secret", "guess"} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(`{"params": ["felix@example.com", %q]}`, password))))
+		fmt.Println(w.Code, w.Header().Get("Cache-Control"), w.Header()["Set-Cookie"])
+		fmt.Print(w.Body.String())
+	}
+	//Output:
+	// 200 no-store [session=s3cr3t; HttpOnly]
+	// {"results":["felix",null]}
+	// 401 no-store [session=; Max-Age=0]
+	// {"results":["",{"error":"wrong password","value":{}}]}
+}
+
+// ### 75) the params after the others are the variadic slice of a variadic func
+func ExampleToHandlerFunc_75variadic() {
+	var tagUsers = func(ctx context.Context, tag string, ids ...int64) (tagged string, err error) {
+		return fmt.Sprintf("%s %v", tag, ids), nil
+	}
+	h := jsonhandlerfunc.NewHandler(tagUsers)
+	for _, body := range []string{`{"params": ["vip", 1, 2, 3]}`, `{"params": ["vip"]}`, `{"params": []}`} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	results, err := h.Invoke(context.Background(), "new", int64(4), 5)
+	fmt.Println(results, err)
+	//Output:
+	// 200 {"results":["vip [1 2 3]",null]}
+	// 200 {"results":["vip []",null]}
+	// 422 {"results":["",{"error":"require at least 1 params (string, ...int64), but passed in 0 params","value":{"code":"params_count_mismatch","required":1,"passed":0,"params":[{"index":0,"type":"string"},{"index":1,"type":"...int64"}],"variadic":true}}]}
+	// [new [4 5]] <nil>
+}
+
+// ### 76) GET requests take the whole envelope as URL-safe base64 json in the q query arg, for deep links
+func ExampleToHandlerFunc_76queryenvelope() {
+	type Filter struct {
+		Tags  []string          `json:"tags"`
+		Price map[string]string `json:"price"`
+	}
+	var search = func(category string, f Filter) (r string, err error) {
+		return fmt.Sprintf("%s %v %v", category, f.Tags, f.Price), nil
+	}
+	cfg := &jsonhandlerfunc.Config{QueryParams: true, MaxQueryEnvelopeBytes: 100}
+	hf := cfg.ToHandlerFunc(search)
+
+	q, _ := jsonhandlerfunc.EncodeQueryEnvelope("shoes", Filter{Tags: []string{"red & blue", "50%"}, Price: map[string]string{"lt": "100"}})
+	fmt.Println(q)
+	long, _ := jsonhandlerfunc.EncodeQueryEnvelope(strings.Repeat("shoes", 30), Filter{})
+	for _, query := range []string{q, long, "not-base64!"} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("GET", "/search?q="+query, nil))
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// eyJwYXJhbXMiOlsic2hvZXMiLHsidGFncyI6WyJyZWQgXHUwMDI2IGJsdWUiLCI1MCUiXSwicHJpY2UiOnsibHQiOiIxMDAifX1dfQ
+	// 200 {"results":["shoes [red \u0026 blue 50%] map[lt:100]",null]}
+	// 413 {"results":["",{"error":"request body is larger than 100 bytes","value":{"code":"request_too_large","max_bytes":100}}]}
+	// 422 {"results":["",{"error":"query q is not URL-safe base64 json","value":{}}]}
+}
+
+// ### 77) Config.Logger logs the requests with the params and the results redacted
+func ExampleToHandlerFunc_77logger() {
+	type Credentials struct {
+		Email    string `json:"email"`
+		Password string `json:"password" log:"redact"`
+	}
+	type Session struct {
+		UserID       int    `json:"user_id"`
+		AccessToken  string `json:"access_token"`
+		internalHint string
+	}
+	var signIn = func(ctx context.Context, c Credentials, otp string) (s *Session, err error) {
+		if c.Password != "secret" {
+			return nil, jsonhandlerfunc.NewStatusCodeError(http.StatusUnauthorized, errors.New("wrong password"))
+		}
+		return &Session{UserID: 1, AccessToken: "t0k3n", internalHint: "x"}, nil
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		// drop the changing attrs for the output
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" || a.Key == "func" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	cfg := &jsonhandlerfunc.Config{
+		Logger:     logger,
+		LogParams:  true,
+		LogResults: true,
+		RedactLogField: func(name string) bool {
+			return strings.HasSuffix(name, "token")
+		},
+	}
+	hf := cfg.ToHandlerFunc(signIn, jsonhandlerfunc.WithRedactedParams(2))
+	for _, password := range []string{"secret", "guess"} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/signin", strings.NewReader(fmt.Sprintf(`{"params": [{"email": "felix@example.com", "password": %q}, "123456"]}`, password))))
+	}
+	//Output:
+	// {"level":"INFO","msg":"jsonhandlerfunc request","method":"/signin","status":200,"params":[{"email":"felix@example.com","password":"[REDACTED]"},"[REDACTED]"],"results":[{"access_token":"[REDACTED]","user_id":1}]}
+	// {"level":"WARN","msg":"jsonhandlerfunc request","method":"/signin","status":401,"params":[{"email":"felix@example.com","password":"[REDACTED]"},"[REDACTED]"],"results":[null],"error":"401: wrong password"}
+}
+
+// ### 78) WithPoolClass runs the funcs of a class in its own Pool of workers
+func ExampleToHandlerFunc_78poolClass() {
+	started := make(chan bool)
+	finish := make(chan bool)
+	var exportOrders = func(ctx context.Context, month string) (count int, err error) {
+		started <- true
+		<-finish
+		return 42, nil
+	}
+	cfg := &jsonhandlerfunc.Config{
+		Pools: map[string]*jsonhandlerfunc.Pool{
+			"bulk": {Workers: 1, QueueTimeout: 10 * time.Millisecond},
+		},
+	}
+	h := cfg.NewHandler(exportOrders, jsonhandlerfunc.WithPoolClass("bulk"))
+
+	first := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		h.ServeHTTP(first, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["2026-09"]}`)))
+		done <- true
+	}()
+	<-started
+
+	// the only worker of bulk is busy
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["2026-10"]}`)))
+	fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+
+	close(finish)
+	<-done
+	fmt.Println(first.Code, strings.TrimSpace(first.Body.String()))
+	stats, _ := json.Marshal(cfg.PoolStats())
+	fmt.Println(string(stats))
+	//Output:
+	// 503 {"results":[0,{"error":"pool bulk is busy","value":{"code":"pool_busy","class":"bulk"}}]}
+	// 200 {"results":[42,null]}
+	// [{"class":"bulk","workers":1,"busy":0,"waiting":0,"completed":1,"rejected":1}]
+}
+
+// ### 79) RegisterType decodes the params and encodes the results of a type, like time.Time
+func ExampleToHandlerFunc_79registerType() {
+	cfg := &jsonhandlerfunc.Config{}
+	jsonhandlerfunc.RegisterType(cfg, func(raw json.RawMessage) (t time.Time, err error) {
+		var millis int64
+		if err = json.Unmarshal(raw, &millis); err == nil {
+			return time.UnixMilli(millis).UTC(), nil
+		}
+		var s string
+		if err = json.Unmarshal(raw, &s); err != nil {
+			return
+		}
+		return time.Parse("2006-01-02", s)
+	}, func(t time.Time) interface{} {
+		return t.Format("2006-01-02")
+	})
+	var nextDay = func(ctx context.Context, day time.Time) (next *time.Time, err error) {
+		t := day.AddDate(0, 0, 1)
+		return &t, nil
+	}
+	hf := cfg.ToHandlerFunc(nextDay)
+	for _, body := range []string{
+		`{"params": ["2024-01-02"]}`,
+		`{"params": [1704153600000]}`,
+		`{"params": ["yesterday"]}`,
+	} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// 200 {"results":["2024-01-03",null]}
+	// 200 {"results":["2024-01-03",null]}
+	// 422 {"results":[null,{"error":"decode request params error","value":{}}]}
+}
+
+// ### 80) AddWarning reports the degraded behavior of the func in the warnings of the response
+func ExampleToHandlerFunc_80warnings() {
+	var listProducts = func(ctx context.Context, q string) (names []string, err error) {
+		jsonhandlerfunc.AddWarning(ctx, "search_unavailable", "the products are not ranked")
+		return []string{"apple", "banana"}, nil
+	}
+	hf := jsonhandlerfunc.ToHandlerFunc(listProducts)
+	w := httptest.NewRecorder()
+	hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["fruit"]}`)))
+	fmt.Println(strings.TrimSpace(w.Body.String()))
+	//Output:
+	// {"results":[["apple","banana"],null],"warnings":[{"code":"search_unavailable","message":"the products are not ranked"}]}
+}
+
+// ### 81) Config.Residency rejects the requests of the tenants in other regions with their endpoints
+func ExampleToHandlerFunc_81residency() {
+	type Tenant struct {
+		Slug   string
+		Region string
+	}
+	var tenantInjector = func(w http.ResponseWriter, r *http.Request) (t *Tenant, err error) {
+		regions := map[string]string{"acme": "eu", "globex": "us", "initech": "cn"}
+		slug := r.Header.Get("X-Tenant")
+		return &Tenant{Slug: slug, Region: regions[slug]}, nil
+	}
+	var getInvoice = func(t *Tenant, id int) (slug string, err error) {
+		return fmt.Sprintf("%s-%d", t.Slug, id), nil
+	}
+	cfg := &jsonhandlerfunc.Config{
+		Residency: &jsonhandlerfunc.Residency{
+			Region: "eu",
+			RegionOf: func(state *jsonhandlerfunc.RequestState) (region string, err error) {
+				var t *Tenant
+				if state.Lookup(&t) {
+					region = t.Region
+				}
+				return
+			},
+			Endpoints: map[string]string{
+				"eu": "https://eu.api.example.com",
+				"us": "https://us.api.example.com",
+			},
+		},
+	}
+	hf := cfg.ToHandlerFunc(getInvoice, tenantInjector)
+	for _, tenant := range []string{"acme", "globex", "initech"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/invoices/get", strings.NewReader(`{"params": [7]}`))
+		r.Header.Set("X-Tenant", tenant)
+		hf(w, r)
+		fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// 200 {"results":["acme-7",null]}
+	// 421 {"results":["",{"error":"the data is in region us, send the request to https://us.api.example.com/invoices/get","value":{"code":"wrong_region","region":"us","endpoint":"https://us.api.example.com/invoices/get"}}]}
+	// 451 {"results":["",{"error":"the data in region cn can not be served","value":{"code":"residency_blocked","region":"cn"}}]}
+}
+
+type plaintextSink struct{ plaintext string }
+
+func (s plaintextSink) Send(ctx context.Context, rec *jsonhandlerfunc.TeeRecord) error {
+	fmt.Println(strings.Contains(string(rec.Request), s.plaintext), strings.Contains(string(rec.Response), s.plaintext))
+	return nil
+}
+
+// ### 82) WithFieldEncryption encrypts the compact envelope and the envelope of ResponseShape too
+func ExampleToHandlerFunc_82fieldencryptionShapes() {
+	type card struct {
+		Holder string `json:"holder"`
+		Number string `json:"number" jsonhf:"encrypt"`
+	}
+	var echo = func(c card) (r card, err error) {
+		return c, nil
+	}
+	cipher, _ := jsonhandlerfunc.NewAESFieldCipher([]byte("0123456789abcdef0123456789abcdef"))
+	tee := jsonhandlerfunc.NewTee(plaintextSink{plaintext: "4111"}, 10)
+	compact := &jsonhandlerfunc.Config{AllowCompactEnvelope: true}
+	shaped := &jsonhandlerfunc.Config{ResponseShape: &jsonhandlerfunc.ResponseShape{UnwrapSingleResult: true}}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"p": [{"holder": "Felix", "number": "4111"}]}`))
+	r.Header.Set(jsonhandlerfunc.CompactEnvelopeHeader, "1")
+	compact.ToHandlerFunc(echo, jsonhandlerfunc.WithTee(tee), jsonhandlerfunc.WithFieldEncryption(cipher))(httptest.NewRecorder(), r)
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [{"holder": "Felix", "number": "4111"}]}`))
+	shaped.ToHandlerFunc(echo, jsonhandlerfunc.WithTee(tee), jsonhandlerfunc.WithFieldEncryption(cipher))(httptest.NewRecorder(), r)
+	tee.Close()
+	//Output:
+	// false false
+	// false false
+}
+
+type signInCallable struct{}
+
+func (signInCallable) Call(ctx context.Context, rawParams []json.RawMessage) (results []interface{}, err error) {
+	return []interface{}{true}, nil
+}
+
+// ### 83) Config.Logger redacts the json params of a Callable by the keys too
+func ExampleToHandlerFunc_83loggerCallable() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" || a.Key == "func" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	cfg := &jsonhandlerfunc.Config{
+		Logger:    logger,
+		LogParams: true,
+		RedactLogField: func(name string) bool {
+			return name == "password"
+		},
+	}
+	hf := cfg.ToHandlerFunc(signInCallable{})
+	hf(httptest.NewRecorder(), httptest.NewRequest("POST", "/signin", strings.NewReader(`{"params": [{"email": "felix@example.com", "password": "hunter2", "id": 12345678901234567890}]}`)))
+	//Output:
+	// {"level":"INFO","msg":"jsonhandlerfunc request","method":"/signin","status":200,"params":[{"email":"felix@example.com","id":12345678901234567890,"password":"[REDACTED]"}]}
+}
+
+// ### 84) The responses with the cookies of ResponseHeaderOf are private and not cached by WithResponseCache
+func ExampleToHandlerFunc_84cookieNotCached() {
+	var calls int
+	var me = func(ctx context.Context) (name string, err error) {
+		calls++
+		user := fmt.Sprintf("user-%d", calls)
+		jsonhandlerfunc.ResponseHeaderOf(ctx).SetCookie(&http.Cookie{Name: "session", Value: user})
+		return user, nil
+	}
+	cache := jsonhandlerfunc.NewResponseCache()
+	hf := jsonhandlerfunc.ToHandlerFunc(me, jsonhandlerfunc.WithCacheableGET(time.Minute), jsonhandlerfunc.WithResponseCache(cache))
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("GET", "/", nil))
+		fmt.Println(w.Header().Get(jsonhandlerfunc.CacheStatusHeader), w.Header().Get("Cache-Control"), w.Header().Get("Set-Cookie"), strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// MISS private, max-age=60 session=user-1 {"results":["user-1",null]}
+	// MISS private, max-age=60 session=user-2 {"results":["user-2",null]}
+}
+
+// ### 85) The handlers of the same func share a ResponseCache without serving the responses of each other
+func ExampleToHandlerFunc_85responsecacheHandlers() {
+	cache := jsonhandlerfunc.NewResponseCache()
+	secretOf := func(tenant string) http.HandlerFunc {
+		return jsonhandlerfunc.ToHandlerFunc(func() (secret string, err error) {
+			return tenant + "-secret", nil
+		}, jsonhandlerfunc.WithCacheableGET(time.Minute), jsonhandlerfunc.WithResponseCache(cache))
+	}
+	a, b := secretOf("tenant-a"), secretOf("tenant-b")
+	for _, hf := range []http.HandlerFunc{a, b, a, b} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("GET", "/secret", nil))
+		fmt.Println(w.Header().Get(jsonhandlerfunc.CacheStatusHeader), strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// MISS {"results":["tenant-a-secret",null]}
+	// MISS {"results":["tenant-b-secret",null]}
+	// HIT {"results":["tenant-a-secret",null]}
+	// HIT {"results":["tenant-b-secret",null]}
+}
+
+// ### 86) The path values, headers and query args are bound by WithPathParams, WithHeaderParams and WithQueryParams
+func ExampleToHandlerFunc_86pathParams() {
+	type getUserParams struct {
+		ID     int64    `json:"id"`
+		Tenant string   `json:"X-Tenant"`
+		Expand []string `json:"expand"`
+	}
+	var getUser = func(ctx context.Context, params getUserParams) (r getUserParams, err error) {
+		return params, nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{id}", jsonhandlerfunc.ToHandlerFunc(getUser,
+		jsonhandlerfunc.WithPathParams("id"), jsonhandlerfunc.WithHeaderParams("X-Tenant"), jsonhandlerfunc.WithQueryParams("expand")))
+	mux.Handle("POST /users/{id}", jsonhandlerfunc.ToHandlerFunc(getUser,
+		jsonhandlerfunc.WithPathParams("id"), jsonhandlerfunc.WithQueryParams("expand")))
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/users/42", nil),
+		httptest.NewRequest("GET", "/users/42?expand=orders&expand=address", nil),
+		httptest.NewRequest("POST", "/users/42?expand=orders", strings.NewReader(`{"params": [{"X-Tenant": "acme"}]}`)),
+		httptest.NewRequest("GET", "/users/abc", nil),
+	} {
+		r.Header.Set("X-Tenant", "acme")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// 200 {"results":[{"id":42,"X-Tenant":"acme","expand":null},null]}
+	// 200 {"results":[{"id":42,"X-Tenant":"acme","expand":["orders","address"]},null]}
+	// 200 {"results":[{"id":42,"X-Tenant":"acme","expand":["orders"]},null]}
+	// 422 {"results":[{"id":0,"X-Tenant":"","expand":null},{"error":"invalid params: params[0].id is not of type integer","value":{"code":"invalid_params","fields":[{"field":"params[0].id","rule":"type","message":"is not of type integer"}]}}]}
+}
+
+// ### 87) WithPanicIsolation only tallies the calls of the func, and aborts the response on http.ErrAbortHandler
+func ExampleToHandlerFunc_87panicisolationAbort() {
+	var auth = func(w http.ResponseWriter, r *http.Request) (user string, err error) {
+		if user = r.Header.Get("User"); user == "" {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		}
+		return
+	}
+	var download = func(user string, abort bool) (r string, err error) {
+		if abort {
+			panic(http.ErrAbortHandler)
+		}
+		return "file of " + user, nil
+	}
+	h := jsonhandlerfunc.NewHandler(download, auth, jsonhandlerfunc.WithPanicIsolation(jsonhandlerfunc.PanicIsolation{}))
+	for _, req := range []struct{ user, body string }{
+		{"", `{"params": [false]}`},
+		{"felix", `{"params": [false]}`},
+		{"felix", `{"params": [true]}`},
+	} {
+		func() {
+			defer func() {
+				fmt.Println("recovered:", recover())
+			}()
+			r := httptest.NewRequest("POST", "/", strings.NewReader(req.body))
+			r.Header.Set("User", req.user)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+		}()
+	}
+	fmt.Printf("%+v\n", h.PanicStats())
+	//Output:
+	// 401 {"results":["",{"error":"unauthorized","value":{}}]}
+	// recovered: <nil>
+	// 200 {"results":["file of felix",null]}
+	// recovered: <nil>
+	// recovered: net/http: abort Handler
+	// {Calls:2 Panics:0 Rate:0 Disabled:false Restarts:0}
+}
+
+// ### 88) Invoke goes through Config.Middlewares like ServeHTTP, a middleware that responds fails the call
+func ExampleHandler_Invoke_middlewares() {
+	type tenantKey struct{}
+	cfg := (&jsonhandlerfunc.Config{}).Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, _ := r.Context().Value(tenantKey{}).(string)
+			if tenant == "" {
+				http.Error(w, "no tenant", http.StatusForbidden)
+				return
+			}
+			fmt.Println("middleware:", tenant)
+			next.ServeHTTP(w, r)
+		})
+	})
+	h := cfg.NewHandler(func(ctx context.Context, name string) (r string, err error) {
+		return "Hello " + name, nil
+	})
+	fmt.Println(h.Invoke(context.WithValue(context.Background(), tenantKey{}, "acme"), "Gates"))
+	_, err := h.Invoke(context.Background(), "Gates")
+	fmt.Println(err, err.(jsonhandlerfunc.StatusCodeError).StatusCode())
+	//Output:
+	// middleware: acme
+	// [Hello Gates] <nil>
+	// 403: jsonhandlerfunc: middleware responded with status 403: no tenant 403
+}
+
+// ### 89) the progress that the produce of an EventStream reports with ReportProgress is sent as the progress events of SSE
+func ExampleToHandlerFunc_89eventstreamProgress() {
+	var importRows = func(ctx context.Context, total int) (es *jsonhandlerfunc.EventStream[int], err error) {
+		return jsonhandlerfunc.NewEventStream(func(ctx context.Context, send func(int) error) error {
+			for row := 1; row <= total; row++ {
+				jsonhandlerfunc.ReportProgress(ctx, float64(row*100/total), fmt.Sprintf("row %d", row))
+				if err := send(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	}
+	ts := httptest.NewServer(jsonhandlerfunc.ToHandlerFunc(importRows))
+	defer ts.Close()
+
+	res, _ := http.Post(ts.URL, "application/json", strings.NewReader(`{"params": [2]}`))
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	fmt.Printf("%s\n", bytes.TrimSpace(b))
+
+	var rows []string
+	err := jsonhandlerfunc.NewClient(ts.URL).CallStream(context.Background(), "", []interface{}{2}, func(item json.RawMessage) error {
+		rows = append(rows, string(item))
+		return nil
+	})
+	fmt.Println(rows, err)
+	//Output:
+	// event: progress
+	// data: {"percent":50,"message":"row 1"}
+	//
+	// id: 1
+	// data: 1
+	//
+	// event: progress
+	// data: {"percent":100,"message":"row 2"}
+	//
+	// id: 2
+	// data: 2
+	//
+	// event: end
+	// data: {}
+	// [1 2] <nil>
+}
+
+// ### 90) ValidateTags panics when the handler is created with an unknown rule or a min or max that is not a number
+func ExampleToHandlerFunc_90validateTagsCheck() {
+	type SignUp struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"min=eight"`
+	}
+	type Team struct {
+		Plan    string   `json:"plan" validate:"oneof=free pro,unique"`
+		Members []SignUp `json:"members" validate:"required"`
+	}
+	cfg := &jsonhandlerfunc.Config{Validator: jsonhandlerfunc.ValidateTags}
+	for _, f := range []interface{}{
+		func(ctx context.Context, team Team) (err error) { return },
+		func(ctx context.Context, signUps []*SignUp) (err error) { return },
+	} {
+		func() {
+			defer func() {
+				fmt.Println(recover())
+			}()
+			cfg.ToHandlerFunc(f)
+		}()
+	}
+	//Output:
+	// ValidateTags of func(context.Context, jsonhandlerfunc_test.Team) error: Plan of jsonhandlerfunc_test.Team: unknown validate rule "unique"
+	// ValidateTags of func(context.Context, []*jsonhandlerfunc_test.SignUp) error: Password of jsonhandlerfunc_test.SignUp: validate rule "min=eight" needs a number
+}
+
+// ### 91) the named results of WithResultNames escape HTML unless Config.DisableHTMLEscape
+func ExampleToHandlerFunc_91resultNamesEscapeHTML() {
+	var link = func() (html string, err error) {
+		return `<a href="/?a=1&b=2">next</a>`, nil
+	}
+	for _, cfg := range []*jsonhandlerfunc.Config{{}, {DisableHTMLEscape: true}} {
+		hf := cfg.ToHandlerFunc(link, jsonhandlerfunc.WithResultNames("html"))
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": []}`)))
+		fmt.Println(strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// {"results":{"html":"\u003ca href=\"/?a=1\u0026b=2\"\u003enext\u003c/a\u003e","error":null}}
+	// {"results":{"html":"<a href=\"/?a=1&b=2\">next</a>","error":null}}
+}
+
+// ### 92) a func of a Pool that timed out keeps its worker until it returns
+func ExampleToHandlerFunc_92poolTimeout() {
+	finish := make(chan bool)
+	var exportOrders = func(ctx context.Context, month string) (count int, err error) {
+		// ignores ctx
+		<-finish
+		return 42, nil
+	}
+	cfg := &jsonhandlerfunc.Config{
+		Timeout: 20 * time.Millisecond,
+		Pools: map[string]*jsonhandlerfunc.Pool{
+			"bulk": {Workers: 1, QueueTimeout: 10 * time.Millisecond},
+		},
+	}
+	h := cfg.NewHandler(exportOrders, jsonhandlerfunc.WithPoolClass("bulk"))
+
+	for _, month := range []string{"2026-09", "2026-10"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": ["`+month+`"]}`)))
+		fmt.Println(w.Code)
+	}
+	fmt.Println("busy:", cfg.PoolStats()[0].Busy)
+
+	close(finish)
+	for cfg.PoolStats()[0].Busy > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stats, _ := json.Marshal(cfg.PoolStats())
+	fmt.Println(string(stats))
+	//Output:
+	// 504
+	// 503
+	// busy: 1
+	// [{"class":"bulk","workers":1,"busy":0,"waiting":0,"completed":1,"rejected":1}]
+}
+
+// ### 93) WithCacheableGET responses of funcs with injectors are private, unless WithPublicCache says the injected values don't depend on the user
+func ExampleToHandlerFunc_93cacheablegetInjectors() {
+	var products = func(region string, keyword string) (r string, err error) {
+		return region + " " + keyword, nil
+	}
+	var regionInjector = func(w http.ResponseWriter, r *http.Request) (region string, err error) {
+		return "eu", nil
+	}
+
+	for _, hf := range []http.HandlerFunc{
+		jsonhandlerfunc.ToHandlerFunc(products, regionInjector, jsonhandlerfunc.WithCacheableGET(time.Minute)),
+		jsonhandlerfunc.ToHandlerFunc(products, regionInjector, jsonhandlerfunc.WithCacheableGET(time.Minute), jsonhandlerfunc.WithPublicCache()),
+	} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("GET", "/products?params="+url.QueryEscape(`["shoes"]`), nil))
+		fmt.Println(w.Code, w.Header().Get("Cache-Control"), strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// 200 private, max-age=60 {"results":["eu shoes",null]}
+	// 200 public, max-age=60 {"results":["eu shoes",null]}
+}
+
+// ### 94) The request body of a func that returns a http.Handler is buffered up to DefaultMaxBufferedBody, or Config.MaxRequestBodyBytes
+func ExampleToHandlerFunc_94delegateBodyLimit() {
+	var upload = func(name string) (h http.Handler, err error) {
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s: %d bytes", name, len(body))
+		})
+		return
+	}
+
+	hf := jsonhandlerfunc.ToHandlerFunc(upload)
+	for _, size := range []int{10, jsonhandlerfunc.DefaultMaxBufferedBody} {
+		w := httptest.NewRecorder()
+		hf(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params":["`+strings.Repeat("a", size)+`"]}`)))
+		fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	//Output:
+	// 200 aaaaaaaaaa: 25 bytes
+	// 413 {"results":[null,{"error":"request body is larger than 10485760 bytes","value":{"code":"request_too_large","max_bytes":10485760}}]}
+}
+
+// ### 95) The delay of FaultInjection stops with the context of the request, without calling the func
+func ExampleToHandlerFunc_95faultDelayCanceled() {
+	var called bool
+	var helloworld = func(name string) (r string, err error) {
+		called = true
+		r = "Hi " + name
+		return
+	}
+	faults := &jsonhandlerfunc.FaultInjection{
+		DelayRate: 1,
+		Delay:     time.Hour,
+	}
+
+	os.Setenv("JSONHANDLERFUNC_FAULT_INJECTION", "1")
+	defer os.Unsetenv("JSONHANDLERFUNC_FAULT_INJECTION")
+	cfg := &jsonhandlerfunc.Config{Timeout: 20 * time.Millisecond}
+	hf := cfg.ToHandlerFunc(helloworld, jsonhandlerfunc.WithFaultInjection(faults))
+	responseBody, code := httpPostJSONReturnCode(hf, `{"params": ["Gates"]}`)
+	fmt.Println(code, called, strings.Contains(responseBody, `"code":"deadline_exceeded"`))
+	//Output:
+	// 504 false true
+}
+
+type printT struct{}
+
+func (printT) Helper() {}
+func (printT) Errorf(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+type account struct {
+	ID      int      `json:"id"`
+	Status  string   `json:"status"`
+	Balance *float64 `json:"balance"`
+}
+
+func ExampleAssertResponse() {
+	var getAccount = func(id int) (a *account, err error) {
+		a = &account{ID: id, Status: "frozen"}
+		return
+	}
+	cfg := &jsonhandlerfunc.Config{
+		// a hook that diverges from the declared contract
+		ShapeResults: func(state *jsonhandlerfunc.RequestState, results []interface{}) []interface{} {
+			results[0] = map[string]interface{}{"id": "1", "status": "frozen", "balance": nil, "owner": "felix"}
+			return results
+		},
+	}
+	h := cfg.NewHandler(getAccount, jsonhandlerfunc.WithResponseJSONSchema(json.RawMessage(`{
+		"properties": {"results": {"prefixItems": [{"properties": {"status": {"enum": ["active", "closed"]}}}]}}
+	}`)))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [1]}`)))
+	fmt.Println(jsonhandlerfunc.AssertResponse(printT{}, h, w.Body.Bytes()))
+	//Output:
+	// response does not match the schema: results[0].id: want integer, got string; results[0].owner: is not a field of account; results[0].status: "frozen" is not in enum [active closed]
+	// body: {"results":[{"balance":null,"id":"1","owner":"felix","status":"frozen"},null]}
+	// false
+}
+
 func httpPostJSON(hf http.HandlerFunc, req string) (r string) {
 	r, _ = httpPostJSONReturnCode(hf, req)
 	return
@@ -0,0 +1,105 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+ResponseHeader is the header that the func sets to its response from the context, without taking the http.ResponseWriter
+with an injector, like the Cache-Control of a result or the cookie of a login:
+
+	func login(ctx context.Context, email, password string) (u *User, err error) {
+		u, token, err := signIn(email, password)
+		if err != nil {
+			return
+		}
+		jsonhandlerfunc.ResponseHeaderOf(ctx).SetCookie(&http.Cookie{Name: "session", Value: token, HttpOnly: true, Secure: true})
+		return
+	}
+
+The header is applied when the response is written, including the error responses, and overrides the headers
+of the options like WithCacheableGET. The responses with cookies are Cache-Control private and not stored by WithResponseCache. The changes after the response is written, like from a goroutine of a timed out func, are dropped.
+*/
+type ResponseHeader struct {
+	mu      sync.Mutex
+	header  http.Header
+	written bool
+}
+
+type responseHeaderKey struct{}
+
+// ResponseHeaderOf returns the response header of the request of ctx, nil if ctx is not of a request served by a handler, its methods do nothing on nil.
+func ResponseHeaderOf(ctx context.Context) *ResponseHeader {
+	h, _ := ctx.Value(responseHeaderKey{}).(*ResponseHeader)
+	return h
+}
+
+func withResponseHeader(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), responseHeaderKey{}, &ResponseHeader{header: http.Header{}}))
+}
+
+func (h *ResponseHeader) Set(key, value string) {
+	h.change(func(header http.Header) { header.Set(key, value) })
+}
+
+func (h *ResponseHeader) Add(key, value string) {
+	h.change(func(header http.Header) { header.Add(key, value) })
+}
+
+// Del deletes the header of key, including the one set by the options.
+func (h *ResponseHeader) Del(key string) {
+	h.change(func(header http.Header) { header[http.CanonicalHeaderKey(key)] = nil })
+}
+
+// SetCookie adds the Set-Cookie header of cookie, the invalid cookies are dropped like http.SetCookie does.
+func (h *ResponseHeader) SetCookie(cookie *http.Cookie) {
+	if v := cookie.String(); v != "" {
+		h.Add("Set-Cookie", v)
+	}
+}
+
+func (h *ResponseHeader) change(f func(header http.Header)) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.written {
+		log.Println("jsonhandlerfunc: response header changed after the response is written, dropped")
+		return
+	}
+	f(h.header)
+}
+
+// apply sets the header to w once, replacing the values of w except the cookies, a nil value deletes the header.
+func (h *ResponseHeader) apply(w http.ResponseWriter) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.written {
+		return
+	}
+	h.written = true
+	header := w.Header()
+	for k, vs := range h.header {
+		switch {
+		case vs == nil:
+			header.Del(k)
+		case k == "Set-Cookie":
+			// the cookies of the injectors are kept
+			header[k] = append(header[k], vs...)
+		default:
+			header[k] = append([]string(nil), vs...)
+		}
+	}
+	// the cookies are of the client, the shared caches must not store them for the other clients
+	if cc := header.Get("Cache-Control"); len(header["Set-Cookie"]) > 0 && strings.Contains(cc, "public") {
+		header.Set("Cache-Control", strings.Replace(cc, "public", "private", 1))
+	}
+}
@@ -0,0 +1,104 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// RedactedParam replaces the params of WithRedactedParams passed to Config.OnRequest
+const RedactedParam = "[REDACTED]"
+
+/*
+WithRedactedParams passes RedactedParam to Config.OnRequest instead of the params at the indexes of the func's params,
+like passwords and tokens, the func still gets them.
+*/
+func WithRedactedParams(paramIndexes ...int) Option {
+	return func(opts *handlerOptions) {
+		if opts.redactedParams == nil {
+			opts.redactedParams = map[int]bool{}
+		}
+		for _, i := range paramIndexes {
+			opts.redactedParams[i] = true
+		}
+	}
+}
+
+func (opts *handlerOptions) checkRedactedParams(ft reflect.Type, injectedCount int) {
+	for index := range opts.redactedParams {
+		if index < injectedCount || index >= ft.NumIn() {
+			panic(fmt.Sprintf("redacted param index %d must be one of the not injected params of %s", index, ft))
+		}
+	}
+}
+
+/*
+observe calls Config.OnRequest with the params, and returns the func to call Config.OnResponse with the results.
+params are the values of the func's params from firstIndex, or the raw params of a Callable.
+*/
+func (h *Handler) observe(ctx context.Context, firstIndex int, params []interface{}) (done func(results []interface{}, err error)) {
+	cfg := h.cfg
+	if cfg.OnRequest == nil && cfg.OnResponse == nil {
+		return func([]interface{}, error) {}
+	}
+	name := funcName(h.v)
+	start := time.Now()
+	if cfg.OnRequest != nil {
+		observed := make([]interface{}, len(params))
+		for i, p := range params {
+			if h.opts.redactedParams[firstIndex+i] {
+				p = RedactedParam
+			}
+			observed[i] = p
+		}
+		cfg.OnRequest(ctx, name, observed)
+	}
+	return func(results []interface{}, err error) {
+		if cfg.OnResponse != nil {
+			cfg.OnResponse(ctx, name, results, err, time.Since(start))
+		}
+	}
+}
+
+// observeCall observes the call of the func with inVals, the returned func is deferred with the results of call.
+func (h *Handler) observeCall(ctx context.Context, inVals []reflect.Value) func(outVals *[]reflect.Value, err *error) {
+	injected := injectedCount(h.argsInjectors)
+	var params []interface{}
+	for _, v := range inVals[injected:] {
+		params = append(params, v.Interface())
+	}
+	done := h.observe(ctx, injected, params)
+	return func(outVals *[]reflect.Value, err *error) {
+		if *err != nil || len(*outVals) == 0 {
+			done(nil, observedErr(*err))
+			return
+		}
+		var results []interface{}
+		for _, v := range (*outVals)[:len(*outVals)-1] {
+			results = append(results, v.Interface())
+		}
+		var funcErr error
+		if last := (*outVals)[len(*outVals)-1]; !last.IsNil() {
+			funcErr = last.Interface().(error)
+		}
+		done(results, funcErr)
+	}
+}
+
+// observedErr is the error of the call, a PanicError if the call panicked without an error
+func observedErr(err error) error {
+	if err == nil {
+		return &PanicError{Code: PanicCode}
+	}
+	return err
+}
+
+func rawParamsOf(rawParams []json.RawMessage) []interface{} {
+	params := make([]interface{}, len(rawParams))
+	for i, p := range rawParams {
+		params[i] = p
+	}
+	return params
+}
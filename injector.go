@@ -0,0 +1,73 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+var (
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+)
+
+/*
+isChainedInjector is true for an injector, whose last params are (w http.ResponseWriter, r *http.Request),
+the params before w receive the values injected by the injectors before it, for chained injection like session, user and permissions:
+
+	func(session *Session, w http.ResponseWriter, r *http.Request) (user *User, err error)
+	func(user *User, w http.ResponseWriter, r *http.Request) (perms Permissions, err error)
+
+A context.Context param that is not injected before is the request context.
+*/
+func isChainedInjector(ft reflect.Type) bool {
+	n := ft.NumIn()
+	return n >= 2 && responseWriterType.AssignableTo(ft.In(n-2)) && requestType.AssignableTo(ft.In(n-1))
+}
+
+/*
+chainInjectors returns the indexes of the injected values that are passed to the params before w of every injector,
+the last one injected before it that is assignable to the param, or -1 for the request context.
+It panics if a param is not injected before.
+*/
+func chainInjectors(injectors []interface{}) (args [][]int) {
+	var injectedTypes []reflect.Type
+	for _, inj := range injectors {
+		injt := reflect.TypeOf(inj)
+		var indexes []int
+		for i := 0; i < injt.NumIn()-2; i++ {
+			index := -2
+			for j := len(injectedTypes) - 1; j >= 0; j-- {
+				if injectedTypes[j].AssignableTo(injt.In(i)) {
+					index = j
+					break
+				}
+			}
+			if index == -2 && injt.In(i) == contextType {
+				index = -1
+			}
+			if index == -2 {
+				panic(fmt.Sprintf("injector %s param %s is not injected by the injectors before it, injected %v", injt, injt.In(i), injectedTypes))
+			}
+			indexes = append(indexes, index)
+		}
+		args = append(args, indexes)
+		for i := 0; i < injt.NumOut()-1; i++ {
+			injectedTypes = append(injectedTypes, injt.Out(i))
+		}
+	}
+	return
+}
+
+// injectorInVals are the values of the params of an injector, with the injected values of indexes before w and r.
+func injectorInVals(indexes []int, injectVals []reflect.Value, w http.ResponseWriter, r *http.Request) []reflect.Value {
+	inVals := make([]reflect.Value, 0, len(indexes)+2)
+	for _, index := range indexes {
+		if index < 0 {
+			inVals = append(inVals, reflect.ValueOf(r.Context()))
+			continue
+		}
+		inVals = append(inVals, injectVals[index])
+	}
+	return append(inVals, reflect.ValueOf(w), reflect.ValueOf(r))
+}
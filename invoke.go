@@ -0,0 +1,206 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+/*
+Invoke calls the func in process, for schedulers, message consumers and other Go code,
+with Config.Middlewares, the injectors, Timeout, WithPartialTimeout and fault injection applied the same as ServeHTTP,
+but without checks of request headers. Middlewares and injectors get a POST request with ctx and no body,
+a middleware that responds instead of calling the next handler fails the call with its status code.
+
+params are the arguments after the injected ones, a param that is not assignable to the argument type
+is converted through json, like a map or json.RawMessage to a struct.
+results are the func's return values except the error, err is the error the func returned or the error of the pipeline.
+*/
+func (h *Handler) Invoke(ctx context.Context, params ...interface{}) (results []interface{}, err error) {
+	r, err := http.NewRequest("POST", "/", http.NoBody)
+	if err != nil {
+		return
+	}
+	inv := &invocation{params: params}
+	r = r.WithContext(context.WithValue(ctx, invocationKey{}, inv))
+	w := &bufferResponseWriter{header: http.Header{}, status: http.StatusOK}
+	h.invokeChain.ServeHTTP(w, r)
+	if !inv.called {
+		err = NewStatusCodeError(w.status, fmt.Errorf("jsonhandlerfunc: middleware responded with status %d: %s", w.status, bytes.TrimSpace(w.body.Bytes())))
+		return
+	}
+	return inv.results, inv.err
+}
+
+// invocation is the params and the results of Invoke passed through Config.Middlewares.
+type invocation struct {
+	params  []interface{}
+	results []interface{}
+	err     error
+	called  bool
+}
+
+type invocationKey struct{}
+
+// serveInvoke is the handler of Invoke wrapped by Config.Middlewares.
+func (h *Handler) serveInvoke(_ http.ResponseWriter, r *http.Request) {
+	inv := r.Context().Value(invocationKey{}).(*invocation)
+	inv.called = true
+	inv.results, inv.err = h.invoke(r, inv.params...)
+}
+
+func (h *Handler) invoke(r *http.Request, params ...interface{}) (results []interface{}, err error) {
+	w := newResponseWriter(&bufferResponseWriter{header: http.Header{}, status: http.StatusOK})
+
+	c, r := h.newCall(r)
+	defer c.cancel()
+	defer h.track()()
+	endMetrics := h.recordMetrics()
+	defer func() { endMetrics(invokeStatusCode(err)) }()
+	defer h.cfg.reportOps(r)()
+	if err = h.checkMaintenance(nil); err != nil {
+		return
+	}
+
+	if h.tally != nil {
+		if h.tally.disabled() {
+			err = &HandlerDisabledError{Code: HandlerDisabledCode}
+			return
+		}
+		defer h.isolate(c, func(panicErr error) {
+			results, err = nil, panicErr
+		})
+	} else {
+		defer h.recoverPanic(func(panicErr error) {
+			results, err = nil, panicErr
+		})
+	}
+
+	if h.callable != nil {
+		return h.invokeCallable(c, r.Context(), params)
+	}
+
+	injectVals, _, responded, err := h.inject(w, r)
+	if responded {
+		err = fmt.Errorf("jsonhandlerfunc: injector responded with status %d", w.status)
+		return
+	}
+	if err != nil {
+		return
+	}
+	if h.firstIsAlsoInjector {
+		for _, val := range injectVals {
+			results = append(results, val.Interface())
+		}
+		return
+	}
+
+	inVals, err := h.convertParams(injectVals, params)
+	if err != nil {
+		return
+	}
+	if err = h.checkListOptions(inVals); err != nil {
+		return
+	}
+	if err = h.validate(inVals); err != nil {
+		return
+	}
+
+	outVals, _, err := h.call(c, r.Context(), inVals)
+	if err != nil {
+		return
+	}
+	for _, val := range outVals[:len(outVals)-1] {
+		results = append(results, val.Interface())
+	}
+	if last := outVals[len(outVals)-1]; !last.IsNil() {
+		err = last.Interface().(error)
+	}
+	return
+}
+
+func (h *Handler) convertParams(injectVals []reflect.Value, params []interface{}) (inVals []reflect.Value, err error) {
+	numIn := h.ft.NumIn()
+	var variadic []interface{}
+	if fixed := numIn - 1 - len(injectVals); h.ft.IsVariadic() && len(params) >= fixed {
+		params, variadic = params[:fixed], params[fixed:]
+		numIn--
+	}
+	if passedCount := len(injectVals) + len(params); passedCount != numIn {
+		err = h.paramsCountError(len(injectVals), len(params), true)
+		return
+	}
+
+	inVals = injectVals
+	for i, p := range params {
+		var val reflect.Value
+		val, err = convertParam(p, h.ft.In(len(injectVals)+i), h.paramDecoder(len(injectVals)+i))
+		if err != nil {
+			err = fmt.Errorf("param %d: %s", len(injectVals)+i, err)
+			return
+		}
+		inVals = append(inVals, val)
+	}
+	if numIn < h.ft.NumIn() {
+		var val reflect.Value
+		if val, err = variadicParamOf(variadic, h.ft.In(numIn)); err != nil {
+			return
+		}
+		inVals = append(inVals, val)
+	}
+	return
+}
+
+// paramDecoder is the decode of the argPlan of the param at index, for the types registered with RegisterType.
+func (h *Handler) paramDecoder(index int) func(raw json.RawMessage) (reflect.Value, error) {
+	for _, plan := range h.argPlans {
+		if plan.index == index {
+			return plan.decode
+		}
+	}
+	return nil
+}
+
+/*
+convertParam converts p to type t, nil is the same as json null, that is a new value for pointers.
+decode is of the registered type of t, to convert p the same as the params of the requests.
+*/
+func convertParam(p interface{}, t reflect.Type, decode func(raw json.RawMessage) (reflect.Value, error)) (val reflect.Value, err error) {
+	if p == nil {
+		if t.Kind() == reflect.Ptr {
+			return reflect.New(t.Elem()), nil
+		}
+		return reflect.Zero(t), nil
+	}
+	if pv := reflect.ValueOf(p); pv.Type().AssignableTo(t) {
+		return pv, nil
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	if decode != nil {
+		elem := t
+		if t.Kind() == reflect.Ptr {
+			elem = t.Elem()
+		}
+		tp := &typeParam{decode: decode, val: reflect.New(elem)}
+		if err = json.Unmarshal(b, tp); err != nil {
+			return
+		}
+		if t.Kind() == reflect.Ptr {
+			return tp.val, nil
+		}
+		return tp.val.Elem(), nil
+	}
+	ptr := reflect.New(t)
+	err = json.Unmarshal(b, ptr.Interface())
+	if err != nil {
+		return
+	}
+	return ptr.Elem(), nil
+}
@@ -0,0 +1,192 @@
+package jsonhandlerfunc
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicCode is the code of PanicError
+const PanicCode = "panic"
+
+// PanicError is responded with 500 when the func or an injector panicked, Panic and Stack are set by DebugPanicHandler.
+type PanicError struct {
+	Code  string `json:"code"`
+	Panic string `json:"panic,omitempty"`
+	Stack string `json:"stack,omitempty"`
+}
+
+func (e *PanicError) Error() string {
+	return "internal error"
+}
+
+func (e *PanicError) StatusCode() int {
+	return http.StatusInternalServerError
+}
+
+// HandlerDisabledCode is the code of HandlerDisabledError
+const HandlerDisabledCode = "handler_disabled"
+
+// HandlerDisabledError is responded with 503 after the handler is disabled by its panic rate, until Handler.Enable.
+type HandlerDisabledError struct {
+	Code string `json:"code"`
+}
+
+func (e *HandlerDisabledError) Error() string {
+	return "handler is disabled"
+}
+
+func (e *HandlerDisabledError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+/*
+PanicIsolation recovers the panics of each call, so that one panicking call is responded with a PanicError
+instead of tearing down the connection, and tallies the panic rate of the handler.
+*/
+type PanicIsolation struct {
+	// Window is how many of the latest calls the panic rate is of, default is 100.
+	Window int
+	// MinCalls is how many calls in the window are needed before the handler can be disabled, default is 10.
+	MinCalls int
+	// DisableRate from 0 to 1 disables the handler when the panic rate reaches it,
+	// then it responds HandlerDisabledError with 503 until Handler.Enable is called. 0 never disables.
+	DisableRate float64
+	// OnPanic is called with the recovered value and the stack, default logs them.
+	OnPanic func(recovered interface{}, stack []byte)
+}
+
+// WithPanicIsolation recovers and tallies the panics of the handler, see PanicIsolation.
+func WithPanicIsolation(pi PanicIsolation) Option {
+	return func(opts *handlerOptions) {
+		if opts.panicIsolation != nil {
+			opts.conflict("WithPanicIsolation is passed more than once, keep one of them")
+		}
+		if pi.Window <= 0 {
+			pi.Window = 100
+		}
+		if pi.MinCalls <= 0 {
+			pi.MinCalls = 10
+		}
+		if pi.MinCalls > pi.Window {
+			opts.conflict("WithPanicIsolation MinCalls %d is more than Window %d, the handler would never be disabled", pi.MinCalls, pi.Window)
+		}
+		opts.panicIsolation = &pi
+	}
+}
+
+// PanicStats are the panic metrics of a handler with WithPanicIsolation
+type PanicStats struct {
+	Calls  int64 `json:"calls"`
+	Panics int64 `json:"panics"`
+	// Rate is the panic rate of the latest calls in the window
+	Rate     float64 `json:"rate"`
+	Disabled bool    `json:"disabled"`
+	// Restarts counts how many times the handler is enabled again after disabled
+	Restarts int64 `json:"restarts"`
+}
+
+type panicTally struct {
+	pi *PanicIsolation
+
+	mu       sync.Mutex
+	window   []bool
+	next     int
+	filled   int
+	inWindow int
+	stats    PanicStats
+}
+
+func (opts *handlerOptions) newPanicTally() *panicTally {
+	pi := opts.panicIsolation
+	if pi == nil {
+		return nil
+	}
+	return &panicTally{pi: pi, window: make([]bool, pi.Window)}
+}
+
+func (t *panicTally) disabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats.Disabled
+}
+
+func (t *panicTally) record(panicked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.Calls++
+	if panicked {
+		t.stats.Panics++
+	}
+
+	if t.filled == len(t.window) && t.window[t.next] {
+		t.inWindow--
+	}
+	t.window[t.next] = panicked
+	if panicked {
+		t.inWindow++
+	}
+	t.next = (t.next + 1) % len(t.window)
+	if t.filled < len(t.window) {
+		t.filled++
+	}
+	t.stats.Rate = float64(t.inWindow) / float64(t.filled)
+
+	if t.pi.DisableRate > 0 && t.filled >= t.pi.MinCalls && t.stats.Rate >= t.pi.DisableRate {
+		t.stats.Disabled = true
+	}
+}
+
+/*
+isolate is deferred by the handler to recover the panic of the call, and respond with onPanic.
+Only the calls of the func are tallied, not the ones rejected before it, and only the panics of the func count,
+http.ErrAbortHandler is panicked again to abort the response like recoverPanic.
+*/
+func (h *Handler) isolate(c *handlerCall, onPanic func(err error)) {
+	p := recover()
+	if c.called {
+		h.tally.record(c.panicked && p != http.ErrAbortHandler)
+	}
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	stack := debug.Stack()
+	if h.tally.pi.OnPanic != nil {
+		h.tally.pi.OnPanic(p, stack)
+	} else {
+		log.Printf("jsonhandlerfunc: %s panicked: %v\n%s", h.v.Type(), p, stack)
+	}
+	onPanic(&PanicError{Code: PanicCode})
+}
+
+// PanicStats returns the panic metrics of the handler, zero if it's not created WithPanicIsolation.
+func (h *Handler) PanicStats() (stats PanicStats) {
+	if h.tally == nil {
+		return
+	}
+	h.tally.mu.Lock()
+	defer h.tally.mu.Unlock()
+	return h.tally.stats
+}
+
+// Enable enables the handler disabled by its panic rate again, and clears the window of the panic rate.
+func (h *Handler) Enable() {
+	if h.tally == nil {
+		return
+	}
+	t := h.tally
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.stats.Disabled {
+		return
+	}
+	t.stats.Disabled = false
+	t.stats.Restarts++
+	t.stats.Rate = 0
+	t.window = make([]bool, len(t.window))
+	t.next, t.filled, t.inWindow = 0, 0, 0
+}
@@ -0,0 +1,128 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// JSONRPCVersion is the "jsonrpc" member of JSON-RPC 2.0 requests and responses
+const JSONRPCVersion = "2.0"
+
+// JSON-RPC 2.0 error codes, the error code of a response is from its http status code.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	JSONRPCServerError    = -32000
+)
+
+// JSONRPCError is the "error" member of JSON-RPC 2.0 responses, Data is the ResponseError's value.
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type jsonrpcResult struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcErrorResp struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Error   *JSONRPCError   `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcRequest is the JSON-RPC members of the request, the params are decoded by the handler as usual.
+type jsonrpcRequest struct {
+	ID json.RawMessage
+	// err is responded when the request is not a valid JSON-RPC 2.0 request, with errCode
+	err     error
+	errCode int
+}
+
+var jsonrpcNullID = json.RawMessage("null")
+
+// readJSONRPC reads the JSON-RPC members of the request when Config.JSONRPC is set, the body is kept for the handler.
+func (cfg *Config) readJSONRPC(r *http.Request) *jsonrpcRequest {
+	if !cfg.JSONRPC {
+		return nil
+	}
+	var req struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+	}
+	if err := json.NewDecoder(bufferBody(r)).Decode(&req); err != nil {
+		return &jsonrpcRequest{ID: jsonrpcNullID, err: fmt.Errorf("parse error"), errCode: JSONRPCParseError}
+	}
+	if req.JSONRPC != JSONRPCVersion {
+		id := req.ID
+		if id == nil {
+			id = jsonrpcNullID
+		}
+		return &jsonrpcRequest{ID: id, err: fmt.Errorf("invalid request, jsonrpc must be %q", JSONRPCVersion), errCode: JSONRPCInvalidRequest}
+	}
+	return &jsonrpcRequest{ID: req.ID}
+}
+
+func jsonrpcErrorCode(httpCode int) int {
+	switch httpCode {
+	case http.StatusBadRequest:
+		return JSONRPCInvalidRequest
+	case http.StatusNotFound:
+		return JSONRPCMethodNotFound
+	case http.StatusUnprocessableEntity:
+		return JSONRPCInvalidParams
+	case http.StatusInternalServerError:
+		return JSONRPCInternalError
+	}
+	return JSONRPCServerError
+}
+
+/*
+write writes out as a JSON-RPC 2.0 response with http code 200, the results except the error are the "result",
+one result is the value, more results are an array, and no result is null.
+Notifications, the requests without id, are responded with 204 and no body.
+*/
+func (req *jsonrpcRequest) write(w http.ResponseWriter, httpCode int, out interface{}) {
+	if req.ID == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var result interface{} = out
+	var respErr *ResponseError
+	if outs, ok := out.([]interface{}); ok && len(outs) > 0 {
+		respErr, _ = outs[len(outs)-1].(*ResponseError)
+		results := outs[:len(outs)-1]
+		switch len(results) {
+		case 0:
+			result = nil
+		case 1:
+			result = results[0]
+		default:
+			result = results
+		}
+	}
+
+	var resp interface{} = jsonrpcResult{JSONRPC: JSONRPCVersion, Result: result, ID: req.ID}
+	if respErr != nil {
+		code := req.errCode
+		if code == 0 {
+			code = jsonrpcErrorCode(httpCode)
+		}
+		resp = jsonrpcErrorResp{
+			JSONRPC: JSONRPCVersion,
+			Error:   &JSONRPCError{Code: code, Message: respErr.Error, Data: respErr.Value},
+			ID:      req.ID,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,92 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type languageKey struct{}
+
+// Language returns the language negotiated from Accept-Language with Config.Languages, empty if not configured.
+func Language(ctx context.Context) string {
+	lang, _ := ctx.Value(languageKey{}).(string)
+	return lang
+}
+
+/*
+negotiateLanguage picks the best of supported languages for the Accept-Language header,
+a supported "zh" matches "zh-TW", and the first supported language is the default.
+*/
+func negotiateLanguage(acceptLanguage string, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		w := weighted{tag: part, q: 1}
+		if i := strings.Index(part, ";"); i >= 0 {
+			w.tag = strings.TrimSpace(part[:i])
+			if q := strings.TrimSpace(part[i+1:]); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil {
+					w.q = v
+				}
+			}
+		}
+		if w.q > 0 {
+			accepted = append(accepted, w)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+
+	for _, a := range accepted {
+		for _, s := range supported {
+			if strings.EqualFold(a.tag, s) {
+				return s
+			}
+		}
+		primary := strings.SplitN(a.tag, "-", 2)[0]
+		for _, s := range supported {
+			if strings.EqualFold(primary, strings.SplitN(s, "-", 2)[0]) {
+				return s
+			}
+		}
+	}
+	return supported[0]
+}
+
+func (cfg *Config) withLanguage(r *http.Request) *http.Request {
+	if len(cfg.Languages) == 0 {
+		return r
+	}
+	lang := negotiateLanguage(r.Header.Get("Accept-Language"), cfg.Languages)
+	return r.WithContext(context.WithValue(r.Context(), languageKey{}, lang))
+}
+
+// localizeResults calls Config.LocalizeResults with the results except the error, and sets Content-Language.
+func (cfg *Config) localizeResults(w http.ResponseWriter, r *http.Request, outs []interface{}) []interface{} {
+	lang := Language(r.Context())
+	if lang == "" {
+		return outs
+	}
+	w.Header().Set("Content-Language", lang)
+	if cfg.LocalizeResults == nil {
+		return outs
+	}
+	last := len(outs) - 1
+	localized := cfg.LocalizeResults(r.Context(), lang, outs[:last])
+	return append(localized, outs[last])
+}
@@ -0,0 +1,278 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+ListOptions is the standard param of list funcs, clients pass it like:
+
+	{"sort": "-created_at,name", "filter": ["status = active", "age >= 18"], "limit": 20, "offset": 40}
+
+sort and filter can be a string separated by commas or an array of strings, a sort field starts with "-" for descending,
+filter operators are =, !=, >, >=, <, <= and ~ for contains. Paginate with limit and offset, or with the cursor
+returned by the previous page. It's validated against the ListPolicy of WithListOptions before the func is called.
+*/
+type ListOptions struct {
+	Sort    []SortField `json:"sort"`
+	Filters []Filter    `json:"filter"`
+	Limit   int         `json:"limit"`
+	Offset  int         `json:"offset"`
+	Cursor  string      `json:"cursor"`
+}
+
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+type Filter struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// filterOps are the filter operators, the longer ones first for parsing the operator at the same index
+var filterOps = []string{"!=", ">=", "<=", "=", ">", "<", "~"}
+
+func (lo *ListOptions) UnmarshalJSON(b []byte) (err error) {
+	var raw struct {
+		Sort   json.RawMessage `json:"sort"`
+		Filter json.RawMessage `json:"filter"`
+		Limit  int             `json:"limit"`
+		Offset int             `json:"offset"`
+		Cursor string          `json:"cursor"`
+	}
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return
+	}
+	*lo = ListOptions{Limit: raw.Limit, Offset: raw.Offset, Cursor: raw.Cursor}
+
+	sorts, err := stringOrStrings(raw.Sort)
+	if err != nil {
+		return fmt.Errorf("sort: %s", err)
+	}
+	for _, s := range sorts {
+		sf := SortField{Field: s}
+		if strings.HasPrefix(s, "-") {
+			sf = SortField{Field: s[1:], Desc: true}
+		}
+		lo.Sort = append(lo.Sort, sf)
+	}
+
+	filters, err := stringOrStrings(raw.Filter)
+	if err != nil {
+		return fmt.Errorf("filter: %s", err)
+	}
+	for _, expr := range filters {
+		var f Filter
+		f, err = parseFilter(expr)
+		if err != nil {
+			return
+		}
+		lo.Filters = append(lo.Filters, f)
+	}
+	return
+}
+
+// MarshalJSON is of the form UnmarshalJSON decodes, for the clients that pass ListOptions, like Iterate.
+func (lo ListOptions) MarshalJSON() ([]byte, error) {
+	raw := struct {
+		Sort   []string `json:"sort,omitempty"`
+		Filter []string `json:"filter,omitempty"`
+		Limit  int      `json:"limit,omitempty"`
+		Offset int      `json:"offset,omitempty"`
+		Cursor string   `json:"cursor,omitempty"`
+	}{Limit: lo.Limit, Offset: lo.Offset, Cursor: lo.Cursor}
+	for _, sf := range lo.Sort {
+		if sf.Desc {
+			raw.Sort = append(raw.Sort, "-"+sf.Field)
+			continue
+		}
+		raw.Sort = append(raw.Sort, sf.Field)
+	}
+	for _, f := range lo.Filters {
+		raw.Filter = append(raw.Filter, f.Field+" "+f.Op+" "+f.Value)
+	}
+	return json.Marshal(raw)
+}
+
+// stringOrStrings decodes "a,b" or ["a", "b"] to trimmed not empty strings
+func stringOrStrings(b json.RawMessage) (ss []string, err error) {
+	if len(b) == 0 || string(b) == "null" {
+		return
+	}
+	var all []string
+	var s string
+	if err = json.Unmarshal(b, &s); err == nil {
+		all = strings.Split(s, ",")
+	} else if err = json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+	for _, s := range all {
+		if s = strings.TrimSpace(s); s != "" {
+			ss = append(ss, s)
+		}
+	}
+	return
+}
+
+// parseFilter splits expr at the first operator, so the value can contain operators like "note = a>=b".
+func parseFilter(expr string) (f Filter, err error) {
+	at := -1
+	for _, op := range filterOps {
+		if i := strings.Index(expr, op); i > 0 && (at < 0 || i < at) {
+			at = i
+			f = Filter{
+				Field: strings.TrimSpace(expr[:i]),
+				Op:    op,
+				Value: strings.TrimSpace(expr[i+len(op):]),
+			}
+		}
+	}
+	if at > 0 {
+		return
+	}
+	err = fmt.Errorf("invalid filter %q, must be like \"status = active\"", expr)
+	return
+}
+
+/*
+ListPolicy declares what a list func allows, sorting and filtering by fields that are not in the safe lists
+are rejected, so clients can't sort or filter by columns that are not indexed or not meant to be exposed.
+*/
+type ListPolicy struct {
+	Sortable   []string
+	Filterable []string
+	// DefaultLimit is used when the client doesn't pass limit, default is 20.
+	DefaultLimit int
+	// MaxLimit is the largest limit clients can pass, default is 100.
+	MaxLimit int
+}
+
+// WithListOptions validates the ListOptions param of the func with policy, and sets its default limit.
+func WithListOptions(policy ListPolicy) Option {
+	if policy.DefaultLimit <= 0 {
+		policy.DefaultLimit = 20
+	}
+	if policy.MaxLimit <= 0 {
+		policy.MaxLimit = 100
+	}
+	return func(opts *handlerOptions) {
+		if opts.listPolicy != nil {
+			opts.conflict("WithListOptions is passed more than once, keep one of them")
+		}
+		if policy.DefaultLimit > policy.MaxLimit {
+			opts.conflict("WithListOptions DefaultLimit %d is more than MaxLimit %d", policy.DefaultLimit, policy.MaxLimit)
+		}
+		opts.listPolicy = &policy
+	}
+}
+
+// defaultListPolicy applies to ListOptions params of funcs without WithListOptions, nothing is sortable or filterable.
+var defaultListPolicy = &ListPolicy{DefaultLimit: 20, MaxLimit: 100}
+
+var listOptionsType = reflect.TypeOf(ListOptions{})
+
+func hasListOptionsParam(ft reflect.Type) bool {
+	for i := 0; i < ft.NumIn(); i++ {
+		if t := ft.In(i); t == listOptionsType || t == reflect.PtrTo(listOptionsType) {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidListOptionsCode is the code of InvalidListOptionsError
+const InvalidListOptionsCode = "invalid_list_options"
+
+// InvalidListOptionsError is responded with 422 when the ListOptions is not allowed by the ListPolicy.
+type InvalidListOptionsError struct {
+	Code    string   `json:"code"`
+	Reason  string   `json:"reason"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+func (e *InvalidListOptionsError) Error() string {
+	return "invalid list options: " + e.Reason
+}
+
+func (e *InvalidListOptionsError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+func (policy *ListPolicy) validate(lo *ListOptions) error {
+	invalid := func(allowed []string, format string, args ...interface{}) error {
+		return &InvalidListOptionsError{Code: InvalidListOptionsCode, Reason: fmt.Sprintf(format, args...), Allowed: allowed}
+	}
+	for _, sf := range lo.Sort {
+		if !containsString(policy.Sortable, sf.Field) {
+			return invalid(policy.Sortable, "can not sort by %q", sf.Field)
+		}
+	}
+	for _, f := range lo.Filters {
+		if !containsString(policy.Filterable, f.Field) {
+			return invalid(policy.Filterable, "can not filter by %q", f.Field)
+		}
+	}
+	if lo.Limit < 0 || lo.Limit > policy.MaxLimit {
+		return invalid(nil, "limit %d is not in 0 to %d", lo.Limit, policy.MaxLimit)
+	}
+	if lo.Offset < 0 {
+		return invalid(nil, "offset %d is negative", lo.Offset)
+	}
+	if lo.Offset > 0 && lo.Cursor != "" {
+		return invalid(nil, "pass one of offset and cursor")
+	}
+	if lo.Limit == 0 {
+		lo.Limit = policy.DefaultLimit
+	}
+	return nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, one := range ss {
+		if one == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkListOptions validates the ListOptions args, and replaces them with the ones with defaults applied.
+func (h *Handler) checkListOptions(inVals []reflect.Value) error {
+	if !h.hasListOptions {
+		return nil
+	}
+	policy := h.opts.listPolicy
+	if policy == nil {
+		policy = defaultListPolicy
+	}
+	for i, val := range inVals {
+		var lo ListOptions
+		switch val.Type() {
+		case listOptionsType:
+			lo = val.Interface().(ListOptions)
+		case reflect.PtrTo(listOptionsType):
+			if !val.IsNil() {
+				lo = *val.Interface().(*ListOptions)
+			}
+		default:
+			continue
+		}
+		if err := policy.validate(&lo); err != nil {
+			return err
+		}
+		if val.Kind() == reflect.Ptr {
+			inVals[i] = reflect.ValueOf(&lo)
+			continue
+		}
+		inVals[i] = reflect.ValueOf(lo)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+Request logging with Config.Logger logs every request after its response, with the method, the func name, the status code,
+the duration and the error, and the params and the results with Config.LogParams and Config.LogResults:
+
+	cfg := &jsonhandlerfunc.Config{
+		Logger:    slog.Default(),
+		LogParams: true,
+		RedactLogField: func(name string) bool {
+			return strings.Contains(name, "password") || strings.Contains(name, "token")
+		},
+	}
+
+For logr, use slog.New(logr.ToSlogHandler(logger)). The requests are logged at Info, the 4xx at Warn and the 5xx at Error.
+
+The logged params and results are redacted before they are encoded: the struct fields tagged `log:"redact"`,
+the fields of the names that Config.RedactLogField reports, and the params of WithRedactedParams are logged as RedactedParam,
+and the fields tagged `json:"-"` are not logged. The values of json.Marshaler and encoding.TextMarshaler, like the json.RawMessage
+params of a Callable, are logged as their decoded json, with the keys that Config.RedactLogField reports redacted.
+*/
+
+// maxLogDepth is how deep the params and the results are logged, the values deeper are logged as "..."
+const maxLogDepth = 16
+
+// logRequest logs the request of c to Config.Logger after the response is written.
+func (h *Handler) logRequest(rw *responseWriter, r *http.Request, c *handlerCall) func() {
+	logger := h.cfg.Logger
+	if logger == nil {
+		return func() {}
+	}
+	return func() {
+		status := rw.statusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		ctx := r.Context()
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+		method := r.URL.Path
+		if state := RequestStateOf(ctx); state != nil && state.Method != "" {
+			method = state.Method
+		}
+		attrs := []slog.Attr{
+			slog.String("method", method),
+			slog.String("func", funcName(h.v)),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(c.start)),
+		}
+		if h.cfg.LogParams && c.loggedParams != nil {
+			params := make([]interface{}, len(c.loggedParams))
+			for i, p := range c.loggedParams {
+				if h.opts.redactedParams[c.loggedFirstIndex+i] {
+					params[i] = RedactedParam
+					continue
+				}
+				params[i] = h.cfg.logValue(reflect.ValueOf(p), 0)
+			}
+			attrs = append(attrs, slog.Any("params", params))
+		}
+		if h.cfg.LogResults && c.loggedResults != nil {
+			results := make([]interface{}, len(c.loggedResults))
+			for i, res := range c.loggedResults {
+				results[i] = h.cfg.logValue(reflect.ValueOf(res), 0)
+			}
+			attrs = append(attrs, slog.Any("results", results))
+		}
+		if c.loggedErr != nil {
+			attrs = append(attrs, slog.String("error", c.loggedErr.Error()))
+		}
+		if warnings := WarningsOf(ctx); warnings != nil {
+			attrs = append(attrs, slog.Any("warnings", warnings))
+		}
+		if surfaced := BagOf(ctx).Surfaced(); surfaced != nil {
+			attrs = append(attrs, slog.Any("bag", surfaced))
+		}
+		logger.LogAttrs(context.WithoutCancel(ctx), level, "jsonhandlerfunc request", attrs...)
+	}
+}
+
+// logCall keeps the params from firstIndex, the results and the error of the call of the func for Config.Logger.
+func (c *handlerCall) logCall(firstIndex int, inVals []reflect.Value, outVals []reflect.Value, err error) {
+	c.loggedFirstIndex = firstIndex
+	c.loggedParams = []interface{}{}
+	for _, v := range inVals[firstIndex:] {
+		c.loggedParams = append(c.loggedParams, v.Interface())
+	}
+	if err != nil || len(outVals) == 0 {
+		c.loggedErr = err
+		return
+	}
+	c.loggedResults = []interface{}{}
+	for _, v := range outVals[:len(outVals)-1] {
+		c.loggedResults = append(c.loggedResults, v.Interface())
+	}
+	if last := outVals[len(outVals)-1]; !last.IsNil() {
+		c.loggedErr = last.Interface().(error)
+	}
+}
+
+// logValue is v for the logs with the fields redacted, the structs are maps keyed by their json names.
+func (cfg *Config) logValue(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxLogDepth {
+		return "..."
+	}
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil
+		}
+		// the json of the marshalers, like the json.RawMessage params of a Callable, is decoded to be redacted by its keys
+		var decoded interface{}
+		dec := json.NewDecoder(bytes.NewReader(mustMarshal(v.Interface())))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return RedactedParam
+		}
+		return cfg.logValue(reflect.ValueOf(decoded), depth+1)
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return cfg.logValue(v.Elem(), depth+1)
+	case reflect.Struct:
+		fields := map[string]interface{}{}
+		cfg.logFields(fields, v, depth)
+		return fields
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			if cfg.RedactLogField != nil && cfg.RedactLogField(key) {
+				m[key] = RedactedParam
+				continue
+			}
+			m[key] = cfg.logValue(iter.Value(), depth+1)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("[%d bytes]", v.Len())
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = cfg.logValue(v.Index(i), depth+1)
+		}
+		return list
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return nil
+	}
+	return v.Interface()
+}
+
+// logFields sets the fields of the struct v to fields by their json names, the embedded structs are flattened like encoding/json.
+func (cfg *Config) logFields(fields map[string]interface{}, v reflect.Value, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				ft, fv = ft.Elem(), fv.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				cfg.logFields(fields, fv, depth)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if sf.Tag.Get("log") == "redact" || cfg.RedactLogField != nil && cfg.RedactLogField(name) {
+			fields[name] = RedactedParam
+			continue
+		}
+		fields[name] = cfg.logValue(fv, depth+1)
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(err.Error())
+	}
+	return b
+}
@@ -0,0 +1,99 @@
+package jsonhandlerfunc
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaintenanceCode is the code of MaintenanceError
+const MaintenanceCode = "maintenance"
+
+// MaintenanceError is responded with 503 while the handler is in maintenance, RetryAfter sets the Retry-After header if it's not 0.
+type MaintenanceError struct {
+	Code       string        `json:"code"`
+	Reason     string        `json:"reason,omitempty"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Reason != "" {
+		return "in maintenance: " + e.Reason
+	}
+	return "in maintenance"
+}
+
+func (e *MaintenanceError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+/*
+Maintenance is a switch that puts handlers in maintenance at runtime, for coordinated deploys and incident response,
+set it to Config.Maintenance for all the handlers of the config, like a Registry's, or pass it WithMaintenance to some of them.
+The handlers respond MaintenanceError with 503 between Start and Stop, without calling the injectors or the func.
+*/
+type Maintenance struct {
+	mu         sync.RWMutex
+	active     bool
+	reason     string
+	retryAfter time.Duration
+}
+
+// Start puts the handlers in maintenance, reason is responded to the clients, retryAfter is the Retry-After if it's not 0.
+func (m *Maintenance) Start(reason string, retryAfter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = true
+	m.reason = reason
+	m.retryAfter = retryAfter
+}
+
+// Stop brings the handlers back
+func (m *Maintenance) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = false
+}
+
+// Active reports if the handlers are in maintenance
+func (m *Maintenance) Active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.active
+}
+
+func (m *Maintenance) err() *MaintenanceError {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.active {
+		return nil
+	}
+	return &MaintenanceError{Code: MaintenanceCode, Reason: m.reason, RetryAfter: m.retryAfter}
+}
+
+// WithMaintenance puts the handler in maintenance while m is started, besides Config.Maintenance.
+func WithMaintenance(m *Maintenance) Option {
+	return func(opts *handlerOptions) {
+		opts.maintenance = m
+	}
+}
+
+// checkMaintenance returns the MaintenanceError of the config's or the handler's Maintenance, and sets Retry-After to w if it's not nil.
+func (h *Handler) checkMaintenance(w http.ResponseWriter) error {
+	me := h.cfg.Maintenance.err()
+	if me == nil {
+		me = h.opts.maintenance.err()
+	}
+	if me == nil {
+		return nil
+	}
+	if w != nil && me.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(me.RetryAfter.Seconds()))))
+	}
+	return me
+}
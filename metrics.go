@@ -0,0 +1,47 @@
+package jsonhandlerfunc
+
+import (
+	"net/http"
+	"time"
+)
+
+/*
+MetricsRecorder records the calls of the handlers by the reflected func name, for the dashboards,
+see the metrics package for a Prometheus collector. It's called by http and Invoke calls, keep it fast.
+*/
+type MetricsRecorder interface {
+	// Begin is called when a call starts
+	Begin(funcName string)
+	// End is called with the status code of the response after the call is done, an Invoke call has the status code of its error.
+	End(funcName string, statusCode int, duration time.Duration)
+}
+
+// recordMetrics records the call with Config.Metrics, the returned func is called with the status code when the call is done.
+func (h *Handler) recordMetrics() (end func(statusCode int)) {
+	m := h.cfg.Metrics
+	if m == nil {
+		return func(int) {}
+	}
+	name := funcName(h.v)
+	start := time.Now()
+	m.Begin(name)
+	return func(statusCode int) {
+		m.End(name, statusCode, time.Since(start))
+	}
+}
+
+// statusCode is the status code of the written response, 200 if nothing is written yet.
+func (rw *responseWriter) statusCode() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// invokeStatusCode is the status code of the error of an Invoke call
+func invokeStatusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return statusCodeOf(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,241 @@
+/*
+Package metrics collects the calls of jsonhandlerfunc handlers for Prometheus, set the Collector to Config.Metrics
+and serve it as the scrape endpoint:
+
+	c := metrics.NewCollector()
+	cfg := &jsonhandlerfunc.Config{Metrics: c}
+	http.Handle("/metrics", c)
+
+The metrics are labeled by the reflected func name and the status code:
+
+	jsonhf_requests_total{func,code}                 counter of the calls
+	jsonhf_errors_total{func,code}                   counter of the calls with status code 400 and above
+	jsonhf_in_flight{func}                           gauge of the calls being handled now
+	jsonhf_request_duration_seconds{func,code}       histogram of the latencies
+	jsonhf_retries_total{func}                       counter of the retries of WithAutoRetry
+
+It's written in the Prometheus text format without the client library, so it can be scraped by Prometheus
+or any agent that reads the format.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram buckets, the same as the Prometheus client's.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a jsonhandlerfunc.MetricsRecorder that serves its metrics in the Prometheus text format.
+type Collector struct {
+	// Namespace prefixes the metric names, default is "jsonhf"
+	Namespace string
+	// Buckets are the upper bounds in seconds of the latency histogram, default is DefaultBuckets
+	Buckets []float64
+
+	mu       sync.Mutex
+	inFlight map[string]int64
+	series   map[seriesKey]*series
+	retries  map[string]int64
+}
+
+type seriesKey struct {
+	funcName   string
+	statusCode int
+}
+
+type series struct {
+	count   int64
+	sum     float64
+	buckets []int64
+}
+
+// NewCollector creates a Collector with the default namespace and buckets
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Begin counts the call in flight
+func (c *Collector) Begin(funcName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight == nil {
+		c.inFlight = map[string]int64{}
+	}
+	c.inFlight[funcName]++
+}
+
+// End counts the call done with its status code and latency
+func (c *Collector) End(funcName string, statusCode int, duration time.Duration) {
+	buckets := c.buckets()
+	seconds := duration.Seconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight[funcName]--
+	if c.series == nil {
+		c.series = map[seriesKey]*series{}
+	}
+	key := seriesKey{funcName, statusCode}
+	s := c.series[key]
+	if s == nil {
+		s = &series{buckets: make([]int64, len(buckets))}
+		c.series[key] = s
+	}
+	s.count++
+	s.sum += seconds
+	for i, le := range buckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Retry counts the retry of the call, it makes the Collector a jsonhandlerfunc.RetryRecorder.
+func (c *Collector) Retry(funcName string, attempt int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.retries == nil {
+		c.retries = map[string]int64{}
+	}
+	c.retries[funcName]++
+}
+
+func (c *Collector) buckets() []float64 {
+	if len(c.Buckets) > 0 {
+		return c.Buckets
+	}
+	return DefaultBuckets
+}
+
+func (c *Collector) name(metric string) string {
+	ns := c.Namespace
+	if ns == "" {
+		ns = "jsonhf"
+	}
+	return ns + "_" + metric
+}
+
+// ServeHTTP serves the metrics for the Prometheus scrapes
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format, sorted by the func name and status code.
+func (c *Collector) WriteTo(w io.Writer) (n int64, err error) {
+	buckets := c.buckets()
+	c.mu.Lock()
+	var keys []seriesKey
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	snapshot := map[seriesKey]series{}
+	for _, key := range keys {
+		s := *c.series[key]
+		s.buckets = append([]int64(nil), s.buckets...)
+		snapshot[key] = s
+	}
+	var funcs []string
+	inFlight := map[string]int64{}
+	for name, count := range c.inFlight {
+		funcs = append(funcs, name)
+		inFlight[name] = count
+	}
+	var retried []string
+	retries := map[string]int64{}
+	for name, count := range c.retries {
+		retried = append(retried, name)
+		retries[name] = count
+	}
+	c.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].funcName != keys[j].funcName {
+			return keys[i].funcName < keys[j].funcName
+		}
+		return keys[i].statusCode < keys[j].statusCode
+	})
+	sort.Strings(funcs)
+	sort.Strings(retried)
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	labels := func(key seriesKey) string {
+		return fmt.Sprintf(`func="%s",code="%d"`, escape(key.funcName), key.statusCode)
+	}
+
+	requests := c.name("requests_total")
+	fmt.Fprintf(cw, "# HELP %s Calls of the handlers by func and status code.\n# TYPE %s counter\n", requests, requests)
+	for _, key := range keys {
+		fmt.Fprintf(cw, "%s{%s} %d\n", requests, labels(key), snapshot[key].count)
+	}
+
+	errs := c.name("errors_total")
+	fmt.Fprintf(cw, "# HELP %s Calls of the handlers with status code 400 and above.\n# TYPE %s counter\n", errs, errs)
+	for _, key := range keys {
+		if key.statusCode >= 400 {
+			fmt.Fprintf(cw, "%s{%s} %d\n", errs, labels(key), snapshot[key].count)
+		}
+	}
+
+	gauge := c.name("in_flight")
+	fmt.Fprintf(cw, "# HELP %s Calls of the handlers being handled now.\n# TYPE %s gauge\n", gauge, gauge)
+	for _, name := range funcs {
+		fmt.Fprintf(cw, "%s{func=\"%s\"} %d\n", gauge, escape(name), inFlight[name])
+	}
+
+	hist := c.name("request_duration_seconds")
+	fmt.Fprintf(cw, "# HELP %s Latencies of the calls of the handlers.\n# TYPE %s histogram\n", hist, hist)
+	for _, key := range keys {
+		s := snapshot[key]
+		for i, le := range buckets {
+			fmt.Fprintf(cw, "%s_bucket{%s,le=\"%s\"} %d\n", hist, labels(key), formatFloat(le), s.buckets[i])
+		}
+		fmt.Fprintf(cw, "%s_bucket{%s,le=\"+Inf\"} %d\n", hist, labels(key), s.count)
+		fmt.Fprintf(cw, "%s_sum{%s} %s\n", hist, labels(key), formatFloat(s.sum))
+		fmt.Fprintf(cw, "%s_count{%s} %d\n", hist, labels(key), s.count)
+	}
+
+	retriesTotal := c.name("retries_total")
+	fmt.Fprintf(cw, "# HELP %s Retries of the calls of the handlers with WithAutoRetry.\n# TYPE %s counter\n", retriesTotal, retriesTotal)
+	for _, name := range retried {
+		fmt.Fprintf(cw, "%s{func=\"%s\"} %d\n", retriesTotal, escape(name), retries[name])
+	}
+	if err = cw.w.Flush(); err == nil {
+		err = cw.err
+	}
+	return cw.n, err
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	if err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return n, err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
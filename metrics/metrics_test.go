@@ -0,0 +1,65 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/theplant/jsonhandlerfunc"
+	"github.com/theplant/jsonhandlerfunc/metrics"
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string   { return "not found" }
+func (notFoundError) StatusCode() int { return 404 }
+
+func getUser(id int) (name string, err error) {
+	if id != 1 {
+		err = notFoundError{}
+		return
+	}
+	name = "felix"
+	return
+}
+
+func ExampleCollector() {
+	c := metrics.NewCollector()
+	c.Buckets = []float64{1}
+	cfg := &jsonhandlerfunc.Config{Metrics: c}
+	hf := cfg.ToHandlerFunc(getUser)
+	for _, id := range []string{"1", "1", "2"} {
+		hf(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"params": [`+id+`]}`)))
+	}
+	cfg.NewHandler(getUser).Invoke(context.Background(), 3)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		if !strings.Contains(line, "_sum{") {
+			fmt.Println(line)
+		}
+	}
+	//Output:
+	// # HELP jsonhf_requests_total Calls of the handlers by func and status code.
+	// # TYPE jsonhf_requests_total counter
+	// jsonhf_requests_total{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="200"} 2
+	// jsonhf_requests_total{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="404"} 2
+	// # HELP jsonhf_errors_total Calls of the handlers with status code 400 and above.
+	// # TYPE jsonhf_errors_total counter
+	// jsonhf_errors_total{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="404"} 2
+	// # HELP jsonhf_in_flight Calls of the handlers being handled now.
+	// # TYPE jsonhf_in_flight gauge
+	// jsonhf_in_flight{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser"} 0
+	// # HELP jsonhf_request_duration_seconds Latencies of the calls of the handlers.
+	// # TYPE jsonhf_request_duration_seconds histogram
+	// jsonhf_request_duration_seconds_bucket{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="200",le="1"} 2
+	// jsonhf_request_duration_seconds_bucket{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="200",le="+Inf"} 2
+	// jsonhf_request_duration_seconds_count{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="200"} 2
+	// jsonhf_request_duration_seconds_bucket{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="404",le="1"} 2
+	// jsonhf_request_duration_seconds_bucket{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="404",le="+Inf"} 2
+	// jsonhf_request_duration_seconds_count{func="github.com/theplant/jsonhandlerfunc/metrics_test.getUser",code="404"} 2
+	// # HELP jsonhf_retries_total Retries of the calls of the handlers with WithAutoRetry.
+	// # TYPE jsonhf_retries_total counter
+}
@@ -0,0 +1,27 @@
+package jsonhandlerfunc
+
+import (
+	"net/http"
+)
+
+/*
+Use adds middleware to Config.Middlewares, for cross cutting concerns like auth, CORS and logging
+attached when the funcs are converted, instead of at every mux registration:
+
+	cfg := jsonhandlerfunc.ProdConfig().Use(cors, accessLog)
+	mux.Handle("/api/users", cfg.ToHandlerFunc(listUsers))
+
+They wrap the handlers created after, inside the middleware of Registry.Use, and read the method with MethodName.
+The calls of a batch go through them one by one, and Invoke goes through them with a request of no body.
+*/
+func (cfg *Config) Use(middleware ...func(http.Handler) http.Handler) *Config {
+	cfg.Middlewares = append(cfg.Middlewares, middleware...)
+	return cfg
+}
+
+func (cfg *Config) wrapMiddlewares(h http.Handler) http.Handler {
+	for i := len(cfg.Middlewares) - 1; i >= 0; i-- {
+		h = cfg.Middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,120 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+MultipartEnvelopeField is the form field of a multipart/form-data request that carries the JSON envelope,
+the params of type *multipart.FileHeader or []*multipart.FileHeader are the names of the file fields:
+
+	envelope: {"params": ["felix", "avatar"]}
+	avatar:   (the uploaded file)
+
+for func(name string, avatar *multipart.FileHeader) (err error), a null file param is a nil file.
+*/
+const MultipartEnvelopeField = "envelope"
+
+// DefaultMaxMultipartMemory is the Config.MaxMultipartMemory when it's not set
+const DefaultMaxMultipartMemory = 32 << 20
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// MissingFileCode is the code of MissingFileError
+const MissingFileCode = "missing_file"
+
+// MissingFileError is responded with 422 when a file param names a file field that is not uploaded.
+type MissingFileError struct {
+	Code  string `json:"code"`
+	Field string `json:"field"`
+}
+
+func (e *MissingFileError) Error() string {
+	return fmt.Sprintf("file %s is not uploaded", e.Field)
+}
+
+func (e *MissingFileError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// fileParam is decoded from the name of the file field in place of a file param, until resolveFiles.
+type fileParam struct {
+	field    string
+	multiple bool
+}
+
+func (fp *fileParam) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &fp.field)
+}
+
+func isFileParam(t reflect.Type) bool {
+	return t == fileHeaderType || t == fileHeadersType
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return r.Method == http.MethodPost && mediaType == "multipart/form-data"
+}
+
+// multipartEnvelope parses the multipart form of r, and returns the envelope field to decode.
+func (cfg *Config) multipartEnvelope(r *http.Request) (io.Reader, error) {
+	maxMemory := cfg.MaxMultipartMemory
+	if maxMemory <= 0 {
+		maxMemory = DefaultMaxMultipartMemory
+	}
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		return nil, err
+	}
+	return strings.NewReader(r.FormValue(MultipartEnvelopeField)), nil
+}
+
+/*
+removeMultipartFiles removes the temp files of the uploaded files after the call, since r is the copy of the request with the context of the call,
+and net/http only removes the ones of the form of the original request.
+*/
+func removeMultipartFiles(r *http.Request) {
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+}
+
+// resolveFiles replaces the decoded file params with the uploaded files they name.
+func (args *handlerArgs) resolveFiles(r *http.Request) error {
+	for j, notNil := range args.notNilParams {
+		fp, ok := notNil.(*fileParam)
+		if !ok || j >= len(args.params) {
+			continue
+		}
+		p := args.params[j]
+		var files []*multipart.FileHeader
+		if p != nil && fp.field != "" {
+			if r.MultipartForm != nil {
+				files = r.MultipartForm.File[fp.field]
+			}
+			if len(files) == 0 {
+				return &MissingFileError{Code: MissingFileCode, Field: fp.field}
+			}
+		}
+		if fp.multiple {
+			args.params[j] = &files
+		} else {
+			var fh *multipart.FileHeader
+			if len(files) > 0 {
+				fh = files[0]
+			}
+			args.params[j] = fh
+		}
+		args.notNilParams[j] = args.params[j]
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ParamStyle is how the params of the request envelope are keyed, see Config.ParamStyle
+type ParamStyle int
+
+const (
+	// PositionalParams are a json array in the order of the func's params
+	PositionalParams ParamStyle = iota
+	// NamedParams are also accepted as a json object keyed by the names of WithParamNames,
+	// like {"params": {"name": "Gates", "gender": 1}}, a func with one struct param is keyed by the struct's fields.
+	// Missing names are zero values and unknown names are ignored, so funcs can gain params without breaking clients.
+	NamedParams
+)
+
+// namedParams decodes the params array as it is, or the params object by names
+type namedParams struct {
+	args *handlerArgs
+}
+
+func (np *namedParams) UnmarshalJSON(b []byte) (err error) {
+	args := np.args
+	if trimmed := bytes.TrimSpace(b); len(trimmed) == 0 || trimmed[0] != '{' {
+		return args.unmarshalPositional(b)
+	}
+
+	names := args.paramNames()
+	if names == nil {
+		if args.singleStructParam() {
+			return json.Unmarshal(b, args.params[0])
+		}
+		return fmt.Errorf("named params of %s require WithParamNames or a single struct param", args.ft)
+	}
+
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return
+	}
+	for i, name := range names {
+		val, ok := raw[name]
+		if !ok {
+			continue
+		}
+		err = json.Unmarshal(val, args.params[i])
+		if err != nil {
+			return fmt.Errorf("param %q: %s", name, err)
+		}
+	}
+	return
+}
+
+// paramNames of the params in the array, without the envelope sections
+func (args *handlerArgs) paramNames() (names []string) {
+	all := args.h.opts.paramNames
+	if all == nil {
+		return nil
+	}
+	for _, index := range args.argIndexes {
+		names = append(names, all[index-args.injectedCount])
+	}
+	return
+}
+
+func (args *handlerArgs) singleStructParam() bool {
+	if len(args.params) != 1 {
+		return false
+	}
+	t := args.ft.In(args.argIndexes[0])
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
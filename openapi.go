@@ -0,0 +1,247 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// OpenAPIInfo is the info object of the OpenAPI document
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+/*
+OpenAPI returns the OpenAPI 3.1 document of the registered methods, derived from Schema,
+every method is a POST operation at /<method> with the params envelope as the request body.
+Params and results are tuples described with prefixItems, named struct types are in components
+by their Go type name, a type of the same name as one already in components is qualified by its package name, like http.Cookie,
+and numbered if that's taken too.
+*/
+func (reg *Registry) OpenAPI(info OpenAPIInfo) map[string]interface{} {
+	g := &openAPIGen{components: map[string]interface{}{}, names: map[interface{}]string{}}
+	paths := map[string]interface{}{}
+	for _, ms := range reg.Schema().Methods {
+		paths["/"+ms.Name] = map[string]interface{}{"post": g.operation(ms)}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(g.components) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": g.components}
+	}
+	return doc
+}
+
+/*
+ServeOpenAPI serves the OpenAPI document at the url path with GET, like /api/openapi.json,
+it's generated once when first requested, register all the methods before serving.
+*/
+func (reg *Registry) ServeOpenAPI(path string, info OpenAPIInfo) {
+	reg.openAPIPath = path
+	reg.openAPIInfo = info
+}
+
+func (reg *Registry) serveOpenAPI(w http.ResponseWriter, r *http.Request) bool {
+	if reg.openAPIPath == "" || r.URL.Path != reg.openAPIPath || r.Method != http.MethodGet {
+		return false
+	}
+	reg.openAPIOnce.Do(func() {
+		reg.openAPIDoc, _ = json.Marshal(reg.OpenAPI(reg.openAPIInfo))
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reg.openAPIDoc)
+	return true
+}
+
+type openAPIGen struct {
+	components map[string]interface{}
+	// names of the components by the reflect.Type of the named types, or by Name for the schemas without it
+	names map[interface{}]string
+}
+
+func (g *openAPIGen) operation(ms *MethodSchema) map[string]interface{} {
+	envelope := map[string]interface{}{"params": g.tuple(ms.Params)}
+	for _, s := range ms.Sections {
+		envelope[s.Name] = g.schema(s.Type)
+	}
+
+	errSchema := map[string]interface{}{
+		"type": []string{"object", "null"},
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{"type": "string"},
+			"value": map[string]interface{}{},
+		},
+	}
+	var results map[string]interface{}
+	if ms.NamedResults {
+		results = g.object(append(ms.Results, &FieldSchema{Name: "error"}), errSchema)
+	} else {
+		results = g.tuple(ms.Results)
+		results["prefixItems"] = append(results["prefixItems"].([]interface{}), errSchema)
+		results["minItems"] = len(ms.Results) + 1
+		results["maxItems"] = len(ms.Results) + 1
+	}
+
+	op := map[string]interface{}{
+		"operationId": ms.Name,
+		"requestBody": map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{
+					"type":       "object",
+					"properties": envelope,
+				}},
+			},
+		},
+		"responses": map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "the results with the error as the last one",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"results": results},
+					}},
+				},
+			},
+		},
+	}
+
+	var headers []interface{}
+	for _, h := range ms.RequiredHeaders {
+		headers = append(headers, map[string]interface{}{
+			"name":     h,
+			"in":       "header",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(headers) > 0 {
+		op["parameters"] = headers
+	}
+	if len(ms.Preconditions) > 0 {
+		op["x-preconditions"] = ms.Preconditions
+	}
+	if ms.MinClientVersion != "" {
+		op["x-min-client-version"] = ms.MinClientVersion
+	}
+	return op
+}
+
+// tuple is the array schema of positional values
+func (g *openAPIGen) tuple(fs []*FieldSchema) map[string]interface{} {
+	items := []interface{}{}
+	for _, f := range fs {
+		s := g.schema(f.Type)
+		if f.Name != "" {
+			s = map[string]interface{}{"title": f.Name, "allOf": []interface{}{s}}
+		}
+		items = append(items, s)
+	}
+	return map[string]interface{}{
+		"type":        "array",
+		"prefixItems": items,
+		"minItems":    len(fs),
+		"maxItems":    len(fs),
+	}
+}
+
+// object is the object schema of named values, of WithResultNames, errSchema is of the "error" value
+func (g *openAPIGen) object(fs []*FieldSchema, errSchema map[string]interface{}) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+	for _, f := range fs {
+		if f.Type == nil {
+			props[f.Name] = errSchema
+		} else {
+			props[f.Name] = g.schema(f.Type)
+		}
+		if !f.Optional {
+			required = append(required, f.Name)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": props, "required": required}
+}
+
+// schema is the JSON Schema of ts, named structs are referred to in components.
+func (g *openAPIGen) schema(ts *TypeSchema) map[string]interface{} {
+	if ts.Name != "" && ts.Kind == "object" && ts.Elem == nil {
+		key := interface{}(ts.Name)
+		if ts.typ != nil {
+			key = ts.typ
+		}
+		name, ok := g.names[key]
+		if !ok && ts.Fields != nil {
+			name = g.componentName(ts)
+			g.names[key] = name
+			// placeholder for types that refer to themselves
+			g.components[name] = nil
+			component := *ts
+			component.Nullable = false
+			g.components[name] = g.inline(&component)
+			ok = true
+		}
+		if ok {
+			ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+			if ts.Nullable {
+				return map[string]interface{}{"anyOf": []interface{}{ref, map[string]interface{}{"type": "null"}}}
+			}
+			return ref
+		}
+	}
+	return g.inline(ts)
+}
+
+// componentName is the Name of ts if it's not taken by another type, or qualified by the package name
+func (g *openAPIGen) componentName(ts *TypeSchema) string {
+	if _, taken := g.components[ts.Name]; !taken || ts.typ == nil {
+		return ts.Name
+	}
+	qualified := path.Base(ts.typ.PkgPath()) + "." + ts.Name
+	name := qualified
+	for i := 2; ; i++ {
+		if _, taken := g.components[name]; !taken {
+			return name
+		}
+		name = qualified + strconv.Itoa(i)
+	}
+}
+
+func (g *openAPIGen) inline(ts *TypeSchema) map[string]interface{} {
+	s := map[string]interface{}{}
+	if ts.Kind != "any" {
+		if ts.Nullable {
+			s["type"] = []string{ts.Kind, "null"}
+		} else {
+			s["type"] = ts.Kind
+		}
+	}
+	if ts.Format != "" {
+		s["format"] = ts.Format
+	}
+	switch {
+	case ts.Kind == "array":
+		s["items"] = g.schema(ts.Elem)
+	case ts.Elem != nil:
+		s["additionalProperties"] = g.schema(ts.Elem)
+	case ts.Kind == "object":
+		props := map[string]interface{}{}
+		var required []string
+		for _, f := range ts.Fields {
+			props[f.Name] = g.schema(f.Type)
+			if !f.Optional {
+				required = append(required, f.Name)
+			}
+		}
+		s["properties"] = props
+		if len(required) > 0 {
+			s["required"] = required
+		}
+	}
+	return s
+}
@@ -0,0 +1,615 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+GenerateFromOpenAPI writes Go source of package pkgName from an OpenAPI 3 document in JSON, for spec-first teams to start
+with the funcs of the operations instead of translating the schemas by hand. Convert a YAML document to JSON first.
+
+Every operation is a func stub to implement, with a leading context.Context, the params struct of its parameters
+and request body, and the result of its success response, which is wired by a Handle func:
+
+	func Handle(mux *http.ServeMux, cfg *jsonhandlerfunc.Config) {
+		mux.Handle("GET /users/{id}", cfg.ToHandlerFunc(GetUser, jsonhandlerfunc.WithQueryParams("expand"), jsonhandlerfunc.WithPathParams("id")))
+	}
+
+	func GetUser(ctx context.Context, params GetUserParams) (result *User, err error)
+
+The component schemas are Go types, string and integer enums are named types with constants, and the codes of the
+error responses, of their code property enums or else of their status texts, are constants with an Error type that
+responds them with their status codes. The query, path and header params are fields of the params struct bound by
+WithQueryParams, WithPathParams and WithHeaderParams, the others are decoded from the body.
+
+The documents of Registry.OpenAPI generate the funcs of their params and results tuples back.
+*/
+func GenerateFromOpenAPI(w io.Writer, pkgName string, doc []byte) (err error) {
+	g := &openAPIImporter{
+		types:    &bytes.Buffer{},
+		declared: map[string]bool{},
+		imports:  map[string]bool{"net/http": true, packageImportPath: true},
+		codes:    map[string]int{},
+	}
+	if err = json.Unmarshal(doc, &g.doc); err != nil {
+		return fmt.Errorf("decode OpenAPI document: %w", err)
+	}
+
+	var componentNames []string
+	for name := range g.doc.Components.Schemas {
+		componentNames = append(componentNames, name)
+	}
+	sort.Strings(componentNames)
+	for _, name := range componentNames {
+		g.declared[goName(name)] = true
+	}
+	g.errorType = "Error"
+	for g.declared[g.errorType] {
+		g.errorType = "API" + g.errorType
+	}
+	for _, name := range componentNames {
+		g.declare(goName(name), g.doc.Components.Schemas[name])
+	}
+
+	var paths []string
+	for p := range g.doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	handle := &bytes.Buffer{}
+	funcs := &bytes.Buffer{}
+	for _, p := range paths {
+		item := g.doc.Paths[p]
+		for _, method := range []string{"get", "put", "post", "delete", "patch", "head", "options"} {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			op := &oaOperation{}
+			if err = json.Unmarshal(raw, op); err != nil {
+				return fmt.Errorf("decode operation %s %s: %w", method, p, err)
+			}
+			var pathParams []*oaParameter
+			if raw, ok := item["parameters"]; ok {
+				json.Unmarshal(raw, &pathParams)
+			}
+			op.Parameters = append(pathParams, op.Parameters...)
+			g.operation(handle, funcs, strings.ToUpper(method), p, op)
+		}
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by jsonhandlerfunc.GenerateFromOpenAPI from %s %s, implement the funcs and keep the rest in sync with the document.\n\n", g.doc.Info.Title, g.doc.Info.Version)
+	fmt.Fprintf(src, "package %s\n\nimport (\n", pkgName)
+	var imports []string
+	for p := range g.imports {
+		imports = append(imports, p)
+	}
+	sort.Strings(imports)
+	for _, p := range imports {
+		if p == packageImportPath {
+			continue
+		}
+		fmt.Fprintf(src, "\t%q\n", p)
+	}
+	fmt.Fprintf(src, "\n\t%q\n)\n\n", packageImportPath)
+	fmt.Fprintf(src, "// Handle registers the handlers of the operations of the document to mux\n")
+	fmt.Fprintf(src, "func Handle(mux *http.ServeMux, cfg *jsonhandlerfunc.Config) {\n%s}\n", handle)
+	src.Write(funcs.Bytes())
+	src.Write(g.types.Bytes())
+	g.writeErrors(src)
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return
+	}
+	_, err = w.Write(formatted)
+	return
+}
+
+type oaDocument struct {
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	// Paths are the path items by the methods, and the parameters of all the methods
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas       map[string]*oaSchema    `json:"schemas"`
+		Parameters    map[string]*oaParameter `json:"parameters"`
+		RequestBodies map[string]*oaBody      `json:"requestBodies"`
+		Responses     map[string]*oaBody      `json:"responses"`
+	} `json:"components"`
+}
+
+type oaOperation struct {
+	OperationID string             `json:"operationId"`
+	Summary     string             `json:"summary"`
+	Parameters  []*oaParameter     `json:"parameters"`
+	RequestBody *oaBody            `json:"requestBody"`
+	Responses   map[string]*oaBody `json:"responses"`
+}
+
+type oaParameter struct {
+	Ref      string    `json:"$ref"`
+	Name     string    `json:"name"`
+	In       string    `json:"in"`
+	Required bool      `json:"required"`
+	Schema   *oaSchema `json:"schema"`
+}
+
+// oaBody is a request body or a response
+type oaBody struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *oaSchema `json:"schema"`
+	} `json:"content"`
+}
+
+type oaSchema struct {
+	Ref                  string               `json:"$ref"`
+	Type                 json.RawMessage      `json:"type"`
+	Format               string               `json:"format"`
+	Nullable             bool                 `json:"nullable"`
+	Title                string               `json:"title"`
+	Enum                 []interface{}        `json:"enum"`
+	Items                *oaSchema            `json:"items"`
+	PrefixItems          []*oaSchema          `json:"prefixItems"`
+	Properties           map[string]*oaSchema `json:"properties"`
+	Required             []string             `json:"required"`
+	AdditionalProperties json.RawMessage      `json:"additionalProperties"`
+	AllOf                []*oaSchema          `json:"allOf"`
+	AnyOf                []*oaSchema          `json:"anyOf"`
+	OneOf                []*oaSchema          `json:"oneOf"`
+}
+
+// kind is the type of s other than null, and if null is allowed by the type list of 3.1 or nullable of 3.0.
+func (s *oaSchema) kind() (kind string, nullable bool) {
+	var kinds []string
+	if err := json.Unmarshal(s.Type, &kinds); err != nil {
+		json.Unmarshal(s.Type, &kind)
+		return kind, s.Nullable
+	}
+	for _, k := range kinds {
+		if k == "null" {
+			nullable = true
+			continue
+		}
+		kind = k
+	}
+	return
+}
+
+func (s *oaSchema) isStruct() bool {
+	return len(s.Properties) > 0 || len(s.AllOf) > 1
+}
+
+type openAPIImporter struct {
+	doc       oaDocument
+	types     *bytes.Buffer
+	declared  map[string]bool
+	imports   map[string]bool
+	errorType string
+	// codes are the status codes of the error codes, codeOrder is in the order they are found
+	codes     map[string]int
+	codeOrder []string
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// schema resolves the $ref of s to the component schema
+func (g *openAPIImporter) schema(s *oaSchema) *oaSchema {
+	for s != nil && s.Ref != "" {
+		s = g.doc.Components.Schemas[refName(s.Ref)]
+	}
+	return s
+}
+
+func (g *openAPIImporter) body(b *oaBody, components map[string]*oaBody) *oaSchema {
+	for b != nil && b.Ref != "" {
+		b = components[refName(b.Ref)]
+	}
+	if b == nil {
+		return nil
+	}
+	if c, ok := b.Content["application/json"]; ok {
+		return c.Schema
+	}
+	var types []string
+	for t := range b.Content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if strings.Contains(t, "json") {
+			return b.Content[t].Schema
+		}
+	}
+	return nil
+}
+
+/*
+goType is the Go type of s, the inline structs and enums are declared by the name, refs to struct components are pointers,
+and so are the nullable values that are not nil-able.
+*/
+func (g *openAPIImporter) goType(s *oaSchema, name string) (t string) {
+	if s == nil {
+		return "interface{}"
+	}
+	if s.Ref != "" {
+		t = goName(refName(s.Ref))
+		if c := g.schema(s); c != nil && c.isStruct() {
+			t = "*" + t
+		}
+		return
+	}
+	if len(s.AllOf) == 1 {
+		return g.goType(s.AllOf[0], name)
+	}
+	if alts := append(append([]*oaSchema{}, s.AnyOf...), s.OneOf...); len(alts) > 0 {
+		var nonNull []*oaSchema
+		for _, alt := range alts {
+			if kind, _ := alt.kind(); kind != "null" || alt.Ref != "" {
+				nonNull = append(nonNull, alt)
+			}
+		}
+		if len(nonNull) != 1 {
+			return "interface{}"
+		}
+		return nilable(g.goType(nonNull[0], name))
+	}
+	kind, nullable := s.kind()
+	defer func() {
+		if nullable {
+			t = nilable(t)
+		}
+	}()
+	if (kind == "string" || kind == "integer") && len(s.Enum) > 0 || s.isStruct() {
+		g.declareOnce(name, s)
+		if s.isStruct() {
+			return "*" + name
+		}
+		return name
+	}
+	switch kind {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int32" || s.Format == "int64" {
+			return s.Format
+		}
+		return "int"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items, name+"Item")
+	case "object":
+		if len(s.AdditionalProperties) > 0 && s.AdditionalProperties[0] == '{' {
+			elem := &oaSchema{}
+			json.Unmarshal(s.AdditionalProperties, elem)
+			return "map[string]" + g.goType(elem, name+"Value")
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+func nilable(t string) string {
+	if strings.HasPrefix(t, "*") || strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") || t == "interface{}" {
+		return t
+	}
+	return "*" + t
+}
+
+func (g *openAPIImporter) declareOnce(name string, s *oaSchema) {
+	if g.declared[name] {
+		return
+	}
+	g.declared[name] = true
+	g.declare(name, s)
+}
+
+// declare writes the type of name, a struct, an enum with its constants, or the Go type of s.
+func (g *openAPIImporter) declare(name string, s *oaSchema) {
+	decl := &bytes.Buffer{}
+	kind, _ := s.kind()
+	switch {
+	case s.isStruct():
+		fmt.Fprintf(decl, "\ntype %s struct {\n", name)
+		g.fields(decl, name, s)
+		fmt.Fprintf(decl, "}\n")
+	case (kind == "string" || kind == "integer") && len(s.Enum) > 0:
+		base := "string"
+		if kind == "integer" {
+			base = "int"
+		}
+		fmt.Fprintf(decl, "\ntype %s %s\n\nconst (\n", name, base)
+		for _, v := range s.Enum {
+			if kind == "string" {
+				fmt.Fprintf(decl, "\t%s%s %s = %q\n", name, goName(fmt.Sprint(v)), name, fmt.Sprint(v))
+				continue
+			}
+			fmt.Fprintf(decl, "\t%s%v %s = %v\n", name, v, name, v)
+		}
+		fmt.Fprintf(decl, ")\n")
+	default:
+		fmt.Fprintf(decl, "\ntype %s %s\n", name, strings.TrimPrefix(g.goType(s, name+"Item"), "*"))
+	}
+	g.types.Write(decl.Bytes())
+}
+
+// fields writes the fields of the properties of s sorted by names, the refs of allOf are embedded.
+func (g *openAPIImporter) fields(w io.Writer, name string, s *oaSchema) {
+	props := map[string]*oaSchema{}
+	required := map[string]bool{}
+	for _, part := range append([]*oaSchema{s}, s.AllOf...) {
+		if part.Ref != "" {
+			fmt.Fprintf(w, "\t%s\n", goName(refName(part.Ref)))
+			continue
+		}
+		for p, ps := range part.Properties {
+			props[p] = ps
+		}
+		for _, r := range part.Required {
+			required[r] = true
+		}
+	}
+	var names []string
+	for p := range props {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	for _, p := range names {
+		g.field(w, name, p, props[p], required[p])
+	}
+}
+
+func (g *openAPIImporter) field(w io.Writer, structName, jsonName string, s *oaSchema, required bool) {
+	tag := jsonName
+	if !required {
+		tag += ",omitempty"
+	}
+	fmt.Fprintf(w, "\t%s %s `json:%q`\n", goName(jsonName), g.goType(s, structName+goName(jsonName)), tag)
+}
+
+// operation writes the handler of the operation to handle, and the func stub to funcs.
+func (g *openAPIImporter) operation(handle, funcs io.Writer, method, path string, op *oaOperation) {
+	name := goName(op.OperationID)
+	if op.OperationID == "" {
+		name = goName(strings.ToLower(method) + " " + strings.NewReplacer("{", "", "}", "").Replace(path))
+	}
+
+	params := []string{"ctx context.Context"}
+	var options []string
+	body := g.body(op.RequestBody, g.doc.Components.RequestBodies)
+	if env := g.schema(body); env != nil && env.Properties["params"] != nil && env.Properties["params"].PrefixItems != nil {
+		var names []string
+		for i, item := range env.Properties["params"].PrefixItems {
+			pname := fmt.Sprintf("p%d", i)
+			if item.Title != "" {
+				pname = goParamName(item.Title)
+				names = append(names, strconv.Quote(item.Title))
+			}
+			params = append(params, fmt.Sprintf("%s %s", pname, g.goType(item, name+goName(pname))))
+		}
+		if len(names) > 0 && len(names) == len(params)-1 {
+			options = append(options, fmt.Sprintf("jsonhandlerfunc.WithParamNames(%s)", strings.Join(names, ", ")))
+		}
+	} else if p, opts := g.params(name, method, op, body); p != "" {
+		params = append(params, p)
+		options = opts
+	}
+
+	results := []string{}
+	var successCodes, errorCodes []string
+	for status := range op.Responses {
+		if code, err := strconv.Atoi(status); err == nil && code >= http.StatusBadRequest {
+			errorCodes = append(errorCodes, g.errorCodes(code, g.body(op.Responses[status], g.doc.Components.Responses))...)
+			continue
+		}
+		if strings.HasPrefix(status, "2") || status == "default" {
+			successCodes = append(successCodes, status)
+		}
+	}
+	sort.Strings(successCodes)
+	if len(successCodes) > 0 {
+		resp := g.body(op.Responses[successCodes[0]], g.doc.Components.Responses)
+		if env := g.schema(resp); env != nil && env.Properties["results"] != nil && len(env.Properties["results"].PrefixItems) > 0 {
+			items := env.Properties["results"].PrefixItems
+			for i, item := range items[:len(items)-1] {
+				rname := fmt.Sprintf("r%d", i)
+				if item.Title != "" {
+					rname = goParamName(item.Title)
+				}
+				results = append(results, fmt.Sprintf("%s %s", rname, g.goType(item, name+goName(rname))))
+			}
+		} else if resp != nil {
+			results = append(results, "result "+g.goType(resp, name+"Result"))
+		}
+	}
+	results = append(results, "err error")
+
+	handler := name
+	if len(options) > 0 {
+		handler += ", " + strings.Join(options, ", ")
+	}
+	fmt.Fprintf(handle, "\tmux.Handle(%q, cfg.ToHandlerFunc(%s))\n", method+" "+path, handler)
+
+	g.imports["context"] = true
+	g.imports["errors"] = true
+	summary := op.Summary
+	if summary == "" {
+		summary = "handles " + method + " " + path
+	}
+	fmt.Fprintf(funcs, "\n// %s %s\n", name, strings.TrimSuffix(summary, "."))
+	if len(errorCodes) > 0 {
+		sort.Strings(errorCodes)
+		fmt.Fprintf(funcs, "// It returns the %s of %s.\n", g.errorType, strings.Join(errorCodes, ", "))
+	}
+	fmt.Fprintf(funcs, "func %s(%s) (%s) {\n", name, strings.Join(params, ", "), strings.Join(results, ", "))
+	fmt.Fprintf(funcs, "\terr = jsonhandlerfunc.NewStatusCodeError(http.StatusNotImplemented, errors.New(%q))\n\treturn\n}\n", name+" is not implemented")
+}
+
+/*
+params declares the params struct of the parameters and the request body of op, and returns the param of it,
+with the WithQueryParams, WithPathParams and WithHeaderParams of the parameters.
+The body is the single param if there are no parameters.
+*/
+func (g *openAPIImporter) params(name, method string, op *oaOperation, body *oaSchema) (param string, options []string) {
+	var ps []*oaParameter
+	for _, p := range op.Parameters {
+		for p != nil && p.Ref != "" {
+			p = g.doc.Components.Parameters[refName(p.Ref)]
+		}
+		if p != nil && p.In != "cookie" {
+			ps = append(ps, p)
+		}
+	}
+	if len(ps) == 0 {
+		if body == nil {
+			return
+		}
+		return "params " + strings.TrimPrefix(g.goType(body, name+"Params"), "*"), nil
+	}
+
+	structName := name + "Params"
+	decl := &bytes.Buffer{}
+	fmt.Fprintf(decl, "\n// %s are the params of %s\ntype %s struct {\n", structName, name, structName)
+	names := map[string][]string{}
+	for _, p := range ps {
+		g.field(decl, structName, p.Name, p.Schema, p.Required || p.In == "path")
+		names[p.In] = append(names[p.In], strconv.Quote(p.Name))
+	}
+	if body != nil {
+		if rb := g.schema(body); rb != nil && rb.isStruct() {
+			if body.Ref != "" {
+				fmt.Fprintf(decl, "\t%s\n", goName(refName(body.Ref)))
+			} else {
+				g.fields(decl, structName, body)
+			}
+		} else {
+			g.field(decl, structName, "body", body, true)
+		}
+	}
+	fmt.Fprintf(decl, "}\n")
+	g.declared[structName] = true
+	g.types.Write(decl.Bytes())
+	for _, in := range []struct{ in, option string }{
+		{"query", "WithQueryParams"},
+		{"path", "WithPathParams"},
+		{"header", "WithHeaderParams"},
+	} {
+		if len(names[in.in]) > 0 {
+			options = append(options, fmt.Sprintf("jsonhandlerfunc.%s(%s)", in.option, strings.Join(names[in.in], ", ")))
+		}
+	}
+	return "params " + structName, options
+}
+
+// errorCodes are the code constants of the error response of status, of the enum of its code property, or else of the status text.
+func (g *openAPIImporter) errorCodes(status int, s *oaSchema) (consts []string) {
+	var codes []string
+	if s = g.schema(s); s != nil {
+		for _, part := range append([]*oaSchema{s}, s.AllOf...) {
+			if part = g.schema(part); part == nil {
+				continue
+			}
+			if code := part.Properties["code"]; code != nil {
+				for _, v := range g.schema(code).Enum {
+					codes = append(codes, fmt.Sprint(v))
+				}
+			}
+		}
+	}
+	if len(codes) == 0 && http.StatusText(status) != "" {
+		codes = []string{strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")}
+	}
+	for _, code := range codes {
+		if _, ok := g.codes[code]; !ok {
+			g.codes[code] = status
+			g.codeOrder = append(g.codeOrder, code)
+		}
+		consts = append(consts, "Code"+goName(code))
+	}
+	return
+}
+
+func (g *openAPIImporter) writeErrors(w io.Writer) {
+	if len(g.codeOrder) == 0 {
+		return
+	}
+	sort.Strings(g.codeOrder)
+	fmt.Fprintf(w, "\n// The codes of the error responses of the document\nconst (\n")
+	for _, code := range g.codeOrder {
+		fmt.Fprintf(w, "\tCode%s = %q\n", goName(code), code)
+	}
+	fmt.Fprintf(w, ")\n\nvar errorStatusCodes = map[string]int{\n")
+	for _, code := range g.codeOrder {
+		fmt.Fprintf(w, "\tCode%s: %d,\n", goName(code), g.codes[code])
+	}
+	fmt.Fprintf(w, "}\n\n// %s is an error response of the document, responded with the status code of its Code, default is 500.\n", g.errorType)
+	fmt.Fprintf(w, "type %s struct {\n\tCode string `json:\"code\"`\n\tMessage string `json:\"message,omitempty\"`\n}\n\n", g.errorType)
+	fmt.Fprintf(w, "func (e *%s) Error() string {\n\tif e.Message != \"\" {\n\t\treturn e.Code + \": \" + e.Message\n\t}\n\treturn e.Code\n}\n\n", g.errorType)
+	fmt.Fprintf(w, "func (e *%s) StatusCode() int {\n\tif code, ok := errorStatusCodes[e.Code]; ok {\n\t\treturn code\n\t}\n\treturn http.StatusInternalServerError\n}\n", g.errorType)
+}
+
+// goInitialisms are upper cased in the Go names
+var goInitialisms = map[string]bool{"api": true, "http": true, "id": true, "ip": true, "json": true, "uri": true, "url": true, "uuid": true}
+
+// goName is the exported Go name of a name of the document, like user_id is UserID, and in-stock is InStock.
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if goInitialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	if b.Len() == 0 || unicode.IsDigit([]rune(b.String())[0]) {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// goParamName is the unexported Go name of a param, like user_id is userID.
+func goParamName(name string) string {
+	n := goName(name)
+	if goInitialisms[strings.ToLower(n)] {
+		n = strings.ToLower(n)
+	} else {
+		runes := []rune(n)
+		runes[0] = unicode.ToLower(runes[0])
+		n = string(runes)
+	}
+	if token.IsKeyword(n) || n == "ctx" || n == "err" {
+		n += "_"
+	}
+	return n
+}
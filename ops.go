@@ -0,0 +1,179 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpsMetaKey is the response meta key of the OpTimings of the request with Config.DebugOps
+const OpsMetaKey = "ops"
+
+// OpDeadlineExceededCode is the code of OpTimeoutError
+const OpDeadlineExceededCode = "op_deadline_exceeded"
+
+// OpTimeoutError is returned by Op.End when the op took longer than its WithOpTimeout, it's responded with 504.
+type OpTimeoutError struct {
+	Code      string `json:"code"`
+	Op        string `json:"op"`
+	TimeoutMs int64  `json:"timeout_ms"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+	// Err is the error the op ended with, like the context.DeadlineExceeded of a db driver
+	Err error `json:"-"`
+}
+
+func (e *OpTimeoutError) Error() string {
+	return fmt.Sprintf("%s exceeded its deadline of %dms after %dms", e.Op, e.TimeoutMs, e.ElapsedMs)
+}
+
+func (e *OpTimeoutError) StatusCode() int {
+	return http.StatusGatewayTimeout
+}
+
+func (e *OpTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// OpTiming is the timing of an ended Op
+type OpTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+	Exceeded bool          `json:"exceeded,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+/*
+WithOpTimeout declares the deadline of the op of name started by the func with StartOp,
+like a db query or a call to another service, so a slow dependency fails fast with an OpTimeoutError
+instead of using up the time of the whole request.
+*/
+func WithOpTimeout(name string, d time.Duration) Option {
+	return func(opts *handlerOptions) {
+		if opts.opTimeouts == nil {
+			opts.opTimeouts = map[string]time.Duration{}
+		}
+		if existing, ok := opts.opTimeouts[name]; ok && existing != d {
+			opts.conflict("WithOpTimeout %q is set with both %s and %s, keep one of them", name, existing, d)
+		}
+		opts.opTimeouts[name] = d
+	}
+}
+
+// opRecorder collects the timings of the ops of a request, ops can end in other goroutines.
+type opRecorder struct {
+	timeouts map[string]time.Duration
+	mu       sync.Mutex
+	timings  []OpTiming
+}
+
+func (rec *opRecorder) add(t OpTiming) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.timings = append(rec.timings, t)
+}
+
+// Op is a named sub operation of a func, see StartOp
+type Op struct {
+	name    string
+	start   time.Time
+	timeout time.Duration
+	ctx     context.Context
+	cancel  context.CancelFunc
+	rec     *opRecorder
+}
+
+/*
+StartOp starts a named sub operation of the func, like a db query, pass Op.Context to it and end it with Op.End:
+
+	op := jsonhandlerfunc.StartOp(ctx, "db.query")
+	rows, err := db.QueryContext(op.Context(), query)
+	if err = op.End(err); err != nil {
+		return
+	}
+
+The timings are passed to Config.OnOps, and responded with Config.DebugOps.
+ctx is the func's context, an op of another context is not recorded and has no timeout.
+*/
+func StartOp(ctx context.Context, name string) *Op {
+	op := &Op{name: name, start: time.Now(), ctx: ctx, cancel: func() {}}
+	if state := RequestStateOf(ctx); state != nil && state.ops != nil {
+		op.rec = state.ops
+		op.timeout = op.rec.timeouts[name]
+	}
+	if op.timeout > 0 {
+		op.ctx, op.cancel = context.WithTimeout(ctx, op.timeout)
+	}
+	return op
+}
+
+// Context is the context of the op, with the deadline of WithOpTimeout
+func (op *Op) Context() context.Context {
+	return op.ctx
+}
+
+// End records the timing of the op, and returns an OpTimeoutError if the op exceeded its deadline, or else err.
+func (op *Op) End(err error) error {
+	op.cancel()
+	t := OpTiming{Name: op.name, Duration: time.Since(op.start), Timeout: op.timeout}
+	if op.timeout > 0 && t.Duration >= op.timeout {
+		t.Exceeded = true
+		err = &OpTimeoutError{
+			Code:      OpDeadlineExceededCode,
+			Op:        op.name,
+			TimeoutMs: int64(op.timeout / time.Millisecond),
+			ElapsedMs: int64(t.Duration / time.Millisecond),
+			Err:       err,
+		}
+	}
+	if err != nil {
+		t.Error = err.Error()
+	}
+	if op.rec != nil {
+		op.rec.add(t)
+	}
+	return err
+}
+
+// OpTimings returns the timings of the ended ops of the request
+func (s *RequestState) OpTimings() []OpTiming {
+	if s.ops == nil {
+		return nil
+	}
+	s.ops.mu.Lock()
+	defer s.ops.mu.Unlock()
+	return append([]OpTiming(nil), s.ops.timings...)
+}
+
+// reportOps is deferred by the handler to call Config.OnOps after the response.
+func (cfg *Config) reportOps(r *http.Request) func() {
+	return func() {
+		if cfg.OnOps == nil {
+			return
+		}
+		state := RequestStateOf(r.Context())
+		if ops := state.OpTimings(); len(ops) > 0 {
+			cfg.OnOps(state, ops)
+		}
+	}
+}
+
+// debugOps sets the timings of the ops to the response meta and the Server-Timing header with Config.DebugOps.
+func (rw *responseWriter) debugOps() {
+	if rw.opState == nil {
+		return
+	}
+	ops := rw.opState.OpTimings()
+	if len(ops) == 0 {
+		return
+	}
+	rw.setMeta(OpsMetaKey, ops)
+	var metrics []string
+	for _, t := range ops {
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%.1f", strings.ReplaceAll(t.Name, " ", "_"), float64(t.Duration)/float64(time.Millisecond)))
+	}
+	rw.Header().Set("Server-Timing", strings.Join(metrics, ", "))
+}
@@ -0,0 +1,199 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+Option customizes one handler, pass it to ToHandlerFunc in any position after the func:
+
+	jsonhandlerfunc.ToHandlerFunc(f, injector, jsonhandlerfunc.WithRequiredHeaders("X-Api-Key"))
+*/
+type Option func(opts *handlerOptions)
+
+type handlerOptions struct {
+	requiredHeaders     []string
+	minClientVersion    string
+	partialTimeout      *partialTimeout
+	faultInjection      *FaultInjection
+	envelopeSections    map[int]string
+	cacheableGET        bool
+	getMaxAge           time.Duration
+	publicCache         bool
+	auditChain          *AuditChain
+	paramNames          []string
+	panicIsolation      *PanicIsolation
+	listPolicy          *ListPolicy
+	preconditions       []Precondition
+	protoStructResults  bool
+	tee                 *Tee
+	streamContentType   string
+	rejectDuplicateKeys bool
+	maintenance         *Maintenance
+	responseJSONSchema  map[string]interface{}
+	pageSize            int
+	opTimeouts          map[string]time.Duration
+	redactedParams      map[int]bool
+	responseCache       *ResponseCache
+	fieldCipher         FieldCipher
+	conditionalPOST     bool
+	requiredParams      map[int]bool
+	queryParams         map[string]bool
+	pathParams          []string
+	headerParams        []string
+	autoRetry           *autoRetry
+	timingMeta          bool
+	resultNames         []resultName
+	successStatusCode   int
+	poolClass           string
+
+	conflicts []string
+}
+
+func (opts *handlerOptions) conflict(format string, args ...interface{}) {
+	opts.conflicts = append(opts.conflicts, fmt.Sprintf(format, args...))
+}
+
+/*
+validate reports all conflicting options when the handler is created, with what to change,
+instead of misbehaving at request time.
+*/
+func (opts *handlerOptions) validate(cfg *Config, ft reflect.Type, injectorOnly bool) {
+	conflicts := opts.conflicts
+	add := func(format string, args ...interface{}) {
+		conflicts = append(conflicts, fmt.Sprintf(format, args...))
+	}
+
+	if opts.partialTimeout != nil && cfg.Timeout > 0 && opts.partialTimeout.d >= cfg.Timeout {
+		add("WithPartialTimeout(%s) is not shorter than Config.Timeout %s, the partial func would never be used, make it shorter", opts.partialTimeout.d, cfg.Timeout)
+	}
+	if opts.autoRetry != nil && opts.partialTimeout != nil {
+		add("WithAutoRetry doesn't retry the func of WithPartialTimeout, which responds the partial results instead, remove one of them")
+	}
+	if opts.cacheableGET && opts.partialTimeout != nil {
+		add("WithCacheableGET would cache the degraded results of WithPartialTimeout, remove one of them")
+	}
+	if opts.cacheableGET && len(opts.requiredHeaders) > 0 {
+		add("WithCacheableGET publicly caches responses of requests that require headers %v, remove one of them", opts.requiredHeaders)
+	}
+	if opts.cacheableGET && opts.auditChain != nil {
+		add("WithCacheableGET responses served from caches are not in the chain of WithAuditChain, remove one of them")
+	}
+	if opts.publicCache && !opts.cacheableGET {
+		add("WithPublicCache only applies to the GET responses of WithCacheableGET, add it")
+	}
+	if opts.publicCache && opts.responseCache != nil && len(opts.responseCache.Dimensions) > 0 {
+		add("WithPublicCache would publicly cache the responses that vary by the Dimensions of WithResponseCache, remove one of them")
+	}
+	if opts.responseCache != nil && !opts.cacheableGET {
+		add("WithResponseCache only caches the GET responses of WithCacheableGET, add it")
+	}
+	if opts.cacheableGET && hasPrecondition(opts.preconditions, PreconditionBody) {
+		add("WithCacheableGET requests have no body, they would never pass RequireBody, remove one of them")
+	}
+	if opts.queryParams != nil && hasPrecondition(opts.preconditions, PreconditionBody) {
+		add("WithQueryParams GET requests have no body, they would never pass RequireBody, remove one of them")
+	}
+	if opts.cacheableGET && hasPrecondition(opts.preconditions, PreconditionAuthenticated) {
+		add("WithCacheableGET publicly caches responses of requests that RequireAuthenticated, remove one of them")
+	}
+	if opts.streamContentType != "" && !injectorOnly && streamResultIndex(ft) < 0 {
+		add("WithStreamContentType has no effect, %s has no io.Reader result", ft)
+	}
+	if opts.pageSize > 0 && !injectorOnly && sliceResultIndex(ft) < 0 {
+		add("WithAutoPaginate has no effect, %s has no slice result", ft)
+	}
+	if opts.listPolicy != nil && !injectorOnly && !hasListOptionsParam(ft) {
+		add("WithListOptions has no effect, %s has no ListOptions param", ft)
+	}
+	if injectorOnly {
+		if opts.partialTimeout != nil {
+			add("WithPartialTimeout has no effect without a func, pass the func before the injectors")
+		}
+		if len(opts.envelopeSections) > 0 {
+			add("WithEnvelopeSection has no effect without a func, pass the func before the injectors")
+		}
+		if opts.paramNames != nil {
+			add("WithParamNames has no effect without a func, pass the func before the injectors")
+		}
+		if opts.auditChain != nil {
+			add("WithAuditChain has no effect without a func, pass the func before the injectors")
+		}
+		if opts.pageSize > 0 {
+			add("WithAutoPaginate has no effect without a func, pass the func before the injectors")
+		}
+		if opts.queryParams != nil {
+			add("WithQueryParams has no effect without a func, pass the func before the injectors")
+		}
+		if opts.pathParams != nil {
+			add("WithPathParams has no effect without a func, pass the func before the injectors")
+		}
+		if opts.headerParams != nil {
+			add("WithHeaderParams has no effect without a func, pass the func before the injectors")
+		}
+	}
+
+	if len(conflicts) > 0 {
+		panic(fmt.Sprintf("conflicting options for %s:\n  - %s", ft, strings.Join(conflicts, "\n  - ")))
+	}
+}
+
+func splitOptions(funcs []interface{}) (fs []interface{}, opts *handlerOptions) {
+	opts = &handlerOptions{}
+	for _, f := range funcs {
+		if opt, ok := f.(Option); ok {
+			opt(opts)
+			continue
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// WithRequiredHeaders responds a MissingHeadersError with 400 if any of the headers is not in the request.
+func WithRequiredHeaders(names ...string) Option {
+	return func(opts *handlerOptions) {
+		for _, name := range names {
+			opts.requiredHeaders = append(opts.requiredHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// MissingHeadersCode is the code of MissingHeadersError
+const MissingHeadersCode = "missing_headers"
+
+// MissingHeadersError lists the required headers that the request didn't set.
+type MissingHeadersError struct {
+	Code    string   `json:"code"`
+	Headers []string `json:"headers"`
+}
+
+func (e *MissingHeadersError) Error() string {
+	return fmt.Sprintf("missing required headers: %s", strings.Join(e.Headers, ", "))
+}
+
+func (e *MissingHeadersError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (opts *handlerOptions) checkRequiredHeaders(r *http.Request) error {
+	return checkRequiredHeaders(r.Header, opts.requiredHeaders)
+}
+
+// checkRequiredHeaders of the request on the server, or of the request the Client is sending
+func checkRequiredHeaders(header http.Header, names []string) error {
+	var missing []string
+	for _, name := range names {
+		if header.Get(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &MissingHeadersError{Code: MissingHeadersCode, Headers: missing}
+}
@@ -0,0 +1,84 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+Page is the standard result of list funcs with a ListOptions param, NextCursor is the ListOptions.Cursor of the next page,
+empty on the last page:
+
+	func listUsers(ctx context.Context, lo *jsonhandlerfunc.ListOptions) (page *jsonhandlerfunc.Page[*User], err error)
+
+Iterate, and the Iterate<Method> methods that GenerateClient writes for the methods returning it, follow the cursors.
+*/
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+/*
+Iterate calls method with params, which has a ListOptions or *ListOptions param, and calls onItem with every item of the Page[T]
+result, calling the method again with the NextCursor in the ListOptions until the last page, or onItem returns an error:
+
+	err := jsonhandlerfunc.Iterate(ctx, client, "ListUsers", []interface{}{&jsonhandlerfunc.ListOptions{Limit: 100}}, func(u *User) error {
+		return export(u)
+	})
+
+The params are not modified, the ListOptions is copied for the next pages.
+*/
+func Iterate[T any](ctx context.Context, c *Client, method string, params []interface{}, onItem func(item T) error) (err error) {
+	params = append([]interface{}{}, params...)
+	index := -1
+	var lo ListOptions
+	for i, p := range params {
+		switch v := p.(type) {
+		case ListOptions:
+			index, lo = i, v
+		case *ListOptions:
+			index = i
+			if v != nil {
+				lo = *v
+			}
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("jsonhandlerfunc: iterate %s needs a ListOptions param", method)
+	}
+
+	seen := map[string]bool{}
+	for {
+		params[index] = lo
+		var page Page[T]
+		if err = c.Call(ctx, method, params, &page); err != nil {
+			return
+		}
+		for _, item := range page.Items {
+			if err = onItem(item); err != nil {
+				return
+			}
+		}
+		if page.NextCursor == "" {
+			return
+		}
+		if seen[page.NextCursor] {
+			return fmt.Errorf("jsonhandlerfunc: iterate %s got the cursor %q again", method, page.NextCursor)
+		}
+		seen[page.NextCursor] = true
+		lo.Offset, lo.Cursor = 0, page.NextCursor
+	}
+}
+
+// pageItemType is the T of Page[T] or *Page[T], nil if t is not.
+func pageItemType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.PkgPath() != packageImportPath || !strings.HasPrefix(t.Name(), "Page[") {
+		return nil
+	}
+	return t.Field(0).Type.Elem()
+}
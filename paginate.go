@@ -0,0 +1,112 @@
+package jsonhandlerfunc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+)
+
+// CursorEnvelopeKey is the top level key of the request envelope for the cursor of WithAutoPaginate
+const CursorEnvelopeKey = "cursor"
+
+// NextCursorMetaKey is the response meta key of the cursor of the next page of WithAutoPaginate, not set on the last page.
+const NextCursorMetaKey = "next_cursor"
+
+// InvalidCursorCode is the code of InvalidCursorError
+const InvalidCursorCode = "invalid_cursor"
+
+// InvalidCursorError is responded with 422 when the cursor is malformed, or it's of a request with other params.
+type InvalidCursorError struct {
+	Code string `json:"code"`
+}
+
+func (e *InvalidCursorError) Error() string {
+	return "invalid cursor"
+}
+
+func (e *InvalidCursorError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+/*
+WithAutoPaginate responds the first pageSize items of the first slice result, and the cursor of the next page
+in the response meta NextCursorMetaKey, to make legacy unbounded list handlers safe without rewriting them.
+Clients request the next page with the same params and the cursor:
+
+	{"params": ["active"], "cursor": "eyJvIjoxMDAsImgiOiIuLi4ifQ"}
+
+The func is called again for every page, so the results should be in a stable order between calls.
+*/
+func WithAutoPaginate(pageSize int) Option {
+	return func(opts *handlerOptions) {
+		if pageSize <= 0 {
+			opts.conflict("WithAutoPaginate(%d) needs a positive page size", pageSize)
+		}
+		opts.pageSize = pageSize
+	}
+}
+
+// pageCursor is the offset of the next page, bound to the params by their hash
+type pageCursor struct {
+	Offset int    `json:"o"`
+	Hash   string `json:"h"`
+}
+
+func sliceResultIndex(ft reflect.Type) int {
+	for i := 0; i < ft.NumOut()-1; i++ {
+		if ft.Out(i).Kind() == reflect.Slice && ft.Out(i).Elem().Kind() != reflect.Uint8 {
+			return i
+		}
+	}
+	return -1
+}
+
+// paramsHash identifies the params that a cursor is for
+func paramsHash(params []reflect.Value) string {
+	vals := make([]interface{}, len(params))
+	for i, p := range params {
+		vals[i] = p.Interface()
+	}
+	b, _ := json.Marshal(vals)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// pageOffset returns the offset of the cursor of the request, 0 without a cursor.
+func pageOffset(cursor string, params []reflect.Value) (offset int, err error) {
+	if cursor == "" {
+		return
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	var pc pageCursor
+	if err == nil {
+		err = json.Unmarshal(raw, &pc)
+	}
+	if err != nil || pc.Offset < 0 || pc.Hash != paramsHash(params) {
+		return 0, &InvalidCursorError{Code: InvalidCursorCode}
+	}
+	return pc.Offset, nil
+}
+
+// paginate replaces the slice result of outs with the page at offset, and sets the next cursor to the meta.
+func (h *Handler) paginate(rw *responseWriter, outs []interface{}, offset int, params []reflect.Value) {
+	index := sliceResultIndex(h.ft)
+	v := reflect.ValueOf(outs[index])
+	if !v.IsValid() || v.IsNil() {
+		return
+	}
+	if offset > v.Len() {
+		offset = v.Len()
+	}
+	end := offset + h.opts.pageSize
+	if end >= v.Len() {
+		end = v.Len()
+	} else {
+		b, _ := json.Marshal(pageCursor{Offset: end, Hash: paramsHash(params)})
+		rw.setMeta(NextCursorMetaKey, base64.RawURLEncoding.EncodeToString(b))
+	}
+	outs[index] = v.Slice(offset, end).Interface()
+}
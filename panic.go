@@ -0,0 +1,38 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanic is deferred by the handler to respond the panic of the func or an injector with Config.PanicHandler,
+// http.ErrAbortHandler is panicked again to abort the response as net/http does.
+func (h *Handler) recoverPanic(onPanic func(err error)) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	stack := debug.Stack()
+	handle := h.cfg.PanicHandler
+	if handle == nil {
+		handle = func(recovered interface{}, stack []byte) error {
+			log.Printf("jsonhandlerfunc: %s panicked: %v\n%s", h.v.Type(), recovered, stack)
+			return &PanicError{Code: PanicCode}
+		}
+	}
+	onPanic(handle(p, stack))
+}
+
+/*
+DebugPanicHandler is a Config.PanicHandler that responds the panic and the stack in the PanicError for local development,
+DevConfig uses it, never expose the stacks in production.
+*/
+func DebugPanicHandler(recovered interface{}, stack []byte) error {
+	log.Printf("jsonhandlerfunc: panicked: %v\n%s", recovered, stack)
+	return &PanicError{Code: PanicCode, Panic: fmt.Sprint(recovered), Stack: string(stack)}
+}
@@ -0,0 +1,97 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ParamsCountCode is the code of ParamsCountError
+const ParamsCountCode = "params_count_mismatch"
+
+// ParamDesc describes a param that the client passes, Name is set with WithParamNames.
+type ParamDesc struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	Type  string `json:"type"`
+}
+
+/*
+ParamsCountError is responded with 422 when the count of the passed params is not the required,
+Params are the required params in order, so client developers see what's missing without counting commas.
+Injected params and envelope sections are not counted, since clients don't pass them in the params.
+Variadic is true when the last param is variadic, Required is then the least count.
+*/
+type ParamsCountError struct {
+	Code     string      `json:"code"`
+	Required int         `json:"required"`
+	Passed   int         `json:"passed"`
+	Params   []ParamDesc `json:"params"`
+	Variadic bool        `json:"variadic,omitempty"`
+}
+
+func (e *ParamsCountError) Error() string {
+	var descs []string
+	for _, p := range e.Params {
+		if p.Name != "" {
+			descs = append(descs, p.Name+" "+p.Type)
+			continue
+		}
+		descs = append(descs, p.Type)
+	}
+	if e.Variadic {
+		return fmt.Sprintf("require at least %d params (%s), but passed in %d params", e.Required, strings.Join(descs, ", "), e.Passed)
+	}
+	return fmt.Sprintf("require %d params (%s), but passed in %d params", e.Required, strings.Join(descs, ", "), e.Passed)
+}
+
+func (e *ParamsCountError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+/*
+WithParamNames names the func's params after the injected ones in order, Go doesn't keep the names of func params,
+they are used in ParamsCountError, and the schemas and clients generated from the handler.
+*/
+func WithParamNames(names ...string) Option {
+	return func(opts *handlerOptions) {
+		if opts.paramNames != nil {
+			opts.conflict("WithParamNames is passed more than once, keep one of them")
+		}
+		opts.paramNames = names
+	}
+}
+
+func (opts *handlerOptions) checkParamNames(ft reflect.Type, injectedCount int) {
+	if opts.paramNames == nil {
+		return
+	}
+	if count := ft.NumIn() - injectedCount; len(opts.paramNames) != count {
+		panic(fmt.Sprintf("WithParamNames has %d names, but %s has %d params after the injected ones", len(opts.paramNames), ft, count))
+	}
+}
+
+// paramsCountError describes the params after the injected ones, except envelope sections unless withSections.
+func (h *Handler) paramsCountError(injectedCount int, passed int, withSections bool) error {
+	e := &ParamsCountError{Code: ParamsCountCode, Passed: passed, Params: []ParamDesc{}}
+	for i := injectedCount; i < h.ft.NumIn(); i++ {
+		if _, ok := h.opts.envelopeSections[i]; ok && !withSections {
+			continue
+		}
+		p := ParamDesc{Index: len(e.Params), Type: h.ft.In(i).String()}
+		if h.ft.IsVariadic() && i == h.ft.NumIn()-1 {
+			p.Type = "..." + h.ft.In(i).Elem().String()
+			e.Variadic = true
+		}
+		if h.opts.paramNames != nil {
+			p.Name = h.opts.paramNames[i-injectedCount]
+		}
+		e.Params = append(e.Params, p)
+	}
+	e.Required = len(e.Params)
+	if e.Variadic {
+		e.Required--
+	}
+	return e
+}
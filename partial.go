@@ -0,0 +1,82 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// DegradedMetaKey is set to true in the response meta when the result is from the partial func of WithPartialTimeout.
+const DegradedMetaKey = "degraded"
+
+type partialTimeout struct {
+	d  time.Duration
+	fn interface{}
+}
+
+/*
+WithPartialTimeout responds the result of the cheaper partialFunc when the func didn't return in d,
+the context of the func is canceled, and "degraded": true is set in the response meta.
+
+partialFunc must have the same type as the func, it's called with the same arguments,
+except the canceled context that is passed in with the request context.
+*/
+func WithPartialTimeout(d time.Duration, partialFunc interface{}) Option {
+	if reflect.TypeOf(partialFunc) == nil || reflect.TypeOf(partialFunc).Kind() != reflect.Func {
+		panic("partialFunc must be a func.")
+	}
+	return func(opts *handlerOptions) {
+		if opts.partialTimeout != nil {
+			opts.conflict("WithPartialTimeout is passed more than once, keep one of them")
+		}
+		opts.partialTimeout = &partialTimeout{d: d, fn: partialFunc}
+	}
+}
+
+func (p *partialTimeout) check(ft reflect.Type) {
+	if pt := reflect.TypeOf(p.fn); pt != ft {
+		panic(fmt.Sprintf("partial func type %s is not the same as %s", pt, ft))
+	}
+}
+
+/*
+call calls the func with mainCtx, and if it doesn't return in time,
+cancels mainCtx and calls the partial func with ctx instead.
+*/
+func (p *partialTimeout) call(ctx context.Context, mainCtx context.Context, cancelMain context.CancelFunc, start time.Time, v reflect.Value, inVals []reflect.Value) (outVals []reflect.Value, degraded bool, err error) {
+	done := goCall(ctx, v, inVals)
+	timer := time.NewTimer(p.d)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		outVals = res.values()
+		return
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			err = newTimeoutError(start)
+			return
+		}
+		outVals = (<-done).values()
+		return
+	case <-timer.C:
+	}
+
+	cancelMain()
+	degraded = true
+	outVals, err = callWithDeadline(ctx, start, reflect.ValueOf(p.fn), replaceContext(inVals, mainCtx, ctx))
+	return
+}
+
+func replaceContext(inVals []reflect.Value, from, to context.Context) (replaced []reflect.Value) {
+	for _, val := range inVals {
+		if val.Kind() == reflect.Interface && !val.IsNil() {
+			if c, ok := val.Interface().(context.Context); ok && c == from {
+				val = reflect.ValueOf(&to).Elem()
+			}
+		}
+		replaced = append(replaced, val)
+	}
+	return
+}
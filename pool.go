@@ -0,0 +1,226 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolBusyCode is the code of PoolBusyError
+const PoolBusyCode = "pool_busy"
+
+// PoolBusyError is responded with 503 when the pool of the handler's class has no worker free and its queue is full,
+// or no worker got free in Pool.QueueTimeout.
+type PoolBusyError struct {
+	Code  string `json:"code"`
+	Class string `json:"class"`
+}
+
+func (e *PoolBusyError) Error() string {
+	return fmt.Sprintf("pool %s is busy", e.Class)
+}
+
+func (e *PoolBusyError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+/*
+Pool is the workers of a class of handlers in Config.Pools, like "cpu", "io" or "bulk",
+so the bulk exports can't take all the CPU and connections from the latency sensitive handlers of the same process:
+
+	cfg := &jsonhandlerfunc.Config{
+		Pools: map[string]*jsonhandlerfunc.Pool{
+			"bulk": {Workers: 2, MaxQueue: 10},
+			"io":   {Workers: 200},
+		},
+	}
+	mux.Handle("/export", cfg.NewHandler(exportOrders, jsonhandlerfunc.WithPoolClass("bulk")))
+
+The funcs of a class are called by at most Workers at the same time, after the request is decoded and validated,
+the other calls wait for a worker in the queue, the waiting counts in Config.Timeout. The handlers without a class are not limited,
+unless Config.DefaultPoolClass is set. A func that timed out keeps its worker until it returns, though the TimeoutError is responded at the deadline,
+so the funcs that ignore their context can't run more than Workers at the same time.
+*/
+type Pool struct {
+	// Workers is how many funcs of the class are called at the same time, default is runtime.GOMAXPROCS.
+	Workers int
+	// MaxQueue is how many calls can wait for a worker, the calls after it are rejected with PoolBusyError, default 0 doesn't limit.
+	MaxQueue int
+	// QueueTimeout is how long a call waits for a worker before it's rejected with PoolBusyError, default waits until the request is done.
+	QueueTimeout time.Duration
+
+	class string
+	once  sync.Once
+	sem   chan struct{}
+
+	busy, waiting, completed, rejected int64
+}
+
+// PoolStats are the metrics of a Pool, for the dashboards, they are in HandlerDiagnostics and returned by Config.PoolStats.
+type PoolStats struct {
+	Class   string `json:"class"`
+	Workers int    `json:"workers"`
+	// Busy is how many workers are calling funcs now
+	Busy int64 `json:"busy"`
+	// Waiting is how many calls are waiting for a worker now
+	Waiting   int64 `json:"waiting"`
+	Completed int64 `json:"completed"`
+	// Rejected counts the calls rejected with PoolBusyError
+	Rejected int64 `json:"rejected"`
+}
+
+// WithPoolClass runs the calls of the handler in the Pool of class in Config.Pools.
+func WithPoolClass(class string) Option {
+	return func(opts *handlerOptions) {
+		if opts.poolClass != "" {
+			opts.conflict("WithPoolClass is passed more than once, keep one of them")
+		}
+		opts.poolClass = class
+	}
+}
+
+// pool returns the Pool of the handler's class, it panics with an unknown class when the handler is created.
+func (cfg *Config) pool(opts *handlerOptions) *Pool {
+	class := opts.poolClass
+	if class == "" {
+		class = cfg.DefaultPoolClass
+	}
+	if class == "" {
+		return nil
+	}
+	p, ok := cfg.Pools[class]
+	if !ok {
+		panic(fmt.Sprintf("pool class %q is not in Config.Pools", class))
+	}
+	p.init(class)
+	return p
+}
+
+func (p *Pool) init(class string) {
+	p.once.Do(func() {
+		p.class = class
+		workers := p.Workers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		p.sem = make(chan struct{}, workers)
+	})
+}
+
+// acquire waits for a worker of the pool, the returned func is deferred to release it, nil pools don't wait.
+func (p *Pool) acquire(ctx context.Context, start time.Time) (release func(), err error) {
+	if p == nil {
+		return func() {}, nil
+	}
+	release = func() {
+		<-p.sem
+		atomic.AddInt64(&p.busy, -1)
+		atomic.AddInt64(&p.completed, 1)
+	}
+	select {
+	case p.sem <- struct{}{}:
+		atomic.AddInt64(&p.busy, 1)
+		return
+	default:
+	}
+
+	if waiting := atomic.AddInt64(&p.waiting, 1); p.MaxQueue > 0 && waiting > int64(p.MaxQueue) {
+		atomic.AddInt64(&p.waiting, -1)
+		return nil, p.reject()
+	}
+	defer atomic.AddInt64(&p.waiting, -1)
+	var timeout <-chan time.Time
+	if p.QueueTimeout > 0 {
+		timer := time.NewTimer(p.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.sem <- struct{}{}:
+		atomic.AddInt64(&p.busy, 1)
+		return
+	case <-timeout:
+		return nil, p.reject()
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, newTimeoutError(start)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// runningFuncs counts the funcs of a call that run in other goroutines and have not returned, see Pool.hold.
+type runningFuncs struct {
+	n  int64
+	wg sync.WaitGroup
+}
+
+type runningFuncsKey struct{}
+
+/*
+hold returns ctx that the funcs called in other goroutines are counted in with startFunc,
+and the release that frees the worker once they all returned, even after the call timed out.
+*/
+func (p *Pool) hold(ctx context.Context, release func()) (context.Context, func()) {
+	if p == nil {
+		return ctx, release
+	}
+	rf := &runningFuncs{}
+	return context.WithValue(ctx, runningFuncsKey{}, rf), func() {
+		if atomic.LoadInt64(&rf.n) == 0 {
+			release()
+			return
+		}
+		go func() {
+			rf.wg.Wait()
+			release()
+		}()
+	}
+}
+
+// startFunc counts a func started in another goroutine in the runningFuncs of ctx, the returned func is called when it returns.
+func startFunc(ctx context.Context) (returned func()) {
+	rf, _ := ctx.Value(runningFuncsKey{}).(*runningFuncs)
+	if rf == nil {
+		return func() {}
+	}
+	atomic.AddInt64(&rf.n, 1)
+	rf.wg.Add(1)
+	return func() {
+		atomic.AddInt64(&rf.n, -1)
+		rf.wg.Done()
+	}
+}
+
+func (p *Pool) reject() error {
+	atomic.AddInt64(&p.rejected, 1)
+	return &PoolBusyError{Code: PoolBusyCode, Class: p.class}
+}
+
+// Stats returns the metrics of the pool, read with atomics so it never waits for the calls.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Class:     p.class,
+		Workers:   cap(p.sem),
+		Busy:      atomic.LoadInt64(&p.busy),
+		Waiting:   atomic.LoadInt64(&p.waiting),
+		Completed: atomic.LoadInt64(&p.completed),
+		Rejected:  atomic.LoadInt64(&p.rejected),
+	}
+}
+
+// PoolStats returns the metrics of Config.Pools sorted by class, the pools not used by any handler yet have no workers.
+func (cfg *Config) PoolStats() (stats []PoolStats) {
+	for class, p := range cfg.Pools {
+		s := p.Stats()
+		s.Class = class
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Class < stats[j].Class })
+	return
+}
@@ -0,0 +1,137 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Precondition is a declarative check of a request before any work, declared by RequireTLS, RequireBody and RequireAuthenticated.
+type Precondition string
+
+const (
+	PreconditionTLS           Precondition = "tls"
+	PreconditionBody          Precondition = "body"
+	PreconditionAuthenticated Precondition = "authenticated"
+)
+
+// codes of PreconditionError
+const (
+	TLSRequiredCode     = "tls_required"
+	BodyRequiredCode    = "body_required"
+	UnauthenticatedCode = "unauthenticated"
+)
+
+var preconditionCodes = map[Precondition]string{
+	PreconditionTLS:           TLSRequiredCode,
+	PreconditionBody:          BodyRequiredCode,
+	PreconditionAuthenticated: UnauthenticatedCode,
+}
+
+var preconditionStatusCodes = map[Precondition]int{
+	PreconditionTLS:           http.StatusForbidden,
+	PreconditionBody:          http.StatusBadRequest,
+	PreconditionAuthenticated: http.StatusUnauthorized,
+}
+
+/*
+PreconditionError is responded when the request doesn't meet a precondition of the handler,
+with 403 for PreconditionTLS, 400 for PreconditionBody and 401 for PreconditionAuthenticated.
+*/
+type PreconditionError struct {
+	Code         string       `json:"code"`
+	Precondition Precondition `json:"precondition"`
+}
+
+func newPreconditionError(p Precondition) *PreconditionError {
+	return &PreconditionError{Code: preconditionCodes[p], Precondition: p}
+}
+
+func (e *PreconditionError) Error() string {
+	switch e.Precondition {
+	case PreconditionTLS:
+		return "request must be over TLS"
+	case PreconditionBody:
+		return "request body is required"
+	case PreconditionAuthenticated:
+		return "request is not authenticated"
+	}
+	return fmt.Sprintf("precondition %s failed", e.Precondition)
+}
+
+func (e *PreconditionError) StatusCode() int {
+	return preconditionStatusCodes[e.Precondition]
+}
+
+func withPrecondition(p Precondition) Option {
+	return func(opts *handlerOptions) {
+		if hasPrecondition(opts.preconditions, p) {
+			return
+		}
+		opts.preconditions = append(opts.preconditions, p)
+	}
+}
+
+// RequireTLS responds a PreconditionError with 403 if the request is not over TLS, see Config.TrustForwardedProto.
+func RequireTLS() Option {
+	return withPrecondition(PreconditionTLS)
+}
+
+// RequireBody responds a PreconditionError with 400 if the request body is empty.
+func RequireBody() Option {
+	return withPrecondition(PreconditionBody)
+}
+
+// RequireAuthenticated responds a PreconditionError with 401 if the request is not authenticated, see Config.IsAuthenticated.
+func RequireAuthenticated() Option {
+	return withPrecondition(PreconditionAuthenticated)
+}
+
+func hasPrecondition(preconditions []Precondition, p Precondition) bool {
+	for _, declared := range preconditions {
+		if declared == p {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions checks the preconditions in the order they are declared.
+func (cfg *Config) checkPreconditions(r *http.Request, preconditions []Precondition) error {
+	for _, p := range preconditions {
+		var ok bool
+		switch p {
+		case PreconditionTLS:
+			ok = r.TLS != nil || cfg.TrustForwardedProto && r.Header.Get("X-Forwarded-Proto") == "https"
+		case PreconditionBody:
+			raw, _ := ioutil.ReadAll(bufferBody(r))
+			ok = len(bytes.TrimSpace(raw)) > 0
+		case PreconditionAuthenticated:
+			if cfg.IsAuthenticated != nil {
+				ok = cfg.IsAuthenticated(r)
+			} else {
+				ok = r.Header.Get("Authorization") != ""
+			}
+		}
+		if !ok {
+			return newPreconditionError(p)
+		}
+	}
+	return nil
+}
+
+/*
+checkPreconditionsLocally is how a Client enforces the preconditions of a method before sending the request,
+the body is always sent by the client, and authenticated means an Authorization header.
+*/
+func checkPreconditionsLocally(req *http.Request, preconditions []Precondition) error {
+	for _, p := range preconditions {
+		switch {
+		case p == PreconditionTLS && req.URL.Scheme != "https",
+			p == PreconditionAuthenticated && req.Header.Get("Authorization") == "":
+			return newPreconditionError(p)
+		}
+	}
+	return nil
+}
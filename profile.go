@@ -0,0 +1,39 @@
+package jsonhandlerfunc
+
+import (
+	"time"
+)
+
+/*
+DevConfig is the Config preset for local development, responses are pretty printed for reading in a browser or curl,
+and there is no Timeout so that stepping through a func in a debugger doesn't fail the request,
+panics are responded with the stack by DebugPanicHandler, and the timings of the ops with DebugOps.
+Unknown fields of the params are rejected, so misspelled fields of the clients are found early.
+Override any field of the returned Config as needed.
+*/
+func DevConfig() *Config {
+	return &Config{
+		Indent:                "  ",
+		PanicHandler:          DebugPanicHandler,
+		DebugOps:              true,
+		DisallowUnknownFields: true,
+	}
+}
+
+/*
+ProdConfig is the Config preset for production, funcs are limited by a Timeout of 30 seconds,
+request bodies by MaxRequestBodyBytes of 10MB and DecodeTimeout of 10 seconds for services without a proxy in front,
+responses are one line json, and clients can opt in the compact envelope to save bandwidth.
+Override any field of the returned Config as needed:
+
+	cfg := jsonhandlerfunc.ProdConfig()
+	cfg.Timeout = 5 * time.Second
+*/
+func ProdConfig() *Config {
+	return &Config{
+		Timeout:              30 * time.Second,
+		MaxRequestBodyBytes:  10 << 20,
+		DecodeTimeout:        10 * time.Second,
+		AllowCompactEnvelope: true,
+	}
+}
@@ -0,0 +1,45 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+)
+
+// Progress is reported by long running funcs with ReportProgress
+type Progress struct {
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+}
+
+type progressListenerKey struct{}
+
+/*
+ReportProgress reports the progress of the func to the listeners of ctx, it does nothing if there is no listener.
+The listeners are Config.OnProgress, the "progress" events of the SSE EventStream to the produce of it,
+and the progress messages of ToWebsocketHandler to the func of the message.
+*/
+func ReportProgress(ctx context.Context, percent float64, message string) {
+	if listen, ok := ctx.Value(progressListenerKey{}).(func(Progress)); ok {
+		listen(Progress{Percent: percent, Message: message})
+	}
+}
+
+// WithProgressListener returns a context that ReportProgress calls listen with, listeners of the parent are still called.
+func WithProgressListener(ctx context.Context, listen func(p Progress)) context.Context {
+	parent, _ := ctx.Value(progressListenerKey{}).(func(Progress))
+	return context.WithValue(ctx, progressListenerKey{}, func(p Progress) {
+		if parent != nil {
+			parent(p)
+		}
+		listen(p)
+	})
+}
+
+func (cfg *Config) withProgressListener(r *http.Request) *http.Request {
+	if cfg.OnProgress == nil {
+		return r
+	}
+	return r.WithContext(WithProgressListener(r.Context(), func(p Progress) {
+		cfg.OnProgress(r, p)
+	}))
+}
@@ -0,0 +1,206 @@
+package jsonhandlerfunc
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+WithProtoStructResults encodes the results except the error in the JSON form of google.protobuf.Struct values,
+for consumers that feed the responses into protobuf pipelines:
+64 bit integers are strings, NaN and infinities are "NaN", "Infinity" and "-Infinity",
+and struct field names are lowerCamelCase, like created_at is createdAt.
+Values that implement json.Marshaler, like time.Time, are in their own JSON form.
+*/
+func WithProtoStructResults() Option {
+	return func(opts *handlerOptions) {
+		opts.protoStructResults = true
+	}
+}
+
+// toProtoStruct converts the results except the error when WithProtoStructResults is set.
+func (opts *handlerOptions) toProtoStruct(outs []interface{}) []interface{} {
+	if !opts.protoStructResults {
+		return outs
+	}
+	converted := make([]interface{}, len(outs))
+	last := len(outs) - 1
+	for i, out := range outs[:last] {
+		converted[i] = protoStructValue(reflect.ValueOf(out))
+	}
+	converted[last] = outs[last]
+	return converted
+}
+
+func protoStructValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.CanInterface() {
+		switch m := v.Interface().(type) {
+		case json.Marshaler:
+			raw, err := m.MarshalJSON()
+			if err != nil {
+				return nil
+			}
+			var decoded interface{}
+			json.Unmarshal(raw, &decoded)
+			return decoded
+		case encoding.TextMarshaler:
+			text, _ := m.MarshalText()
+			return string(text)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return protoStructValue(v.Elem())
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return v.Int()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return v.Uint()
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return "NaN"
+		case math.IsInf(f, 1):
+			return "Infinity"
+		case math.IsInf(f, -1):
+			return "-Infinity"
+		}
+		return f
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			return base64.StdEncoding.EncodeToString(v.Bytes())
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = protoStructValue(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		m := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			m[protoStructKey(iter.Key())] = protoStructValue(iter.Value())
+		}
+		return m
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		protoStructFields(v, m)
+		return m
+	}
+	return nil
+}
+
+func protoStructKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if k.CanInterface() {
+		if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+			text, _ := tm.MarshalText()
+			return string(text)
+		}
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return ""
+}
+
+// protoStructFields follows the fields of encoding/json, embedded structs are flattened.
+func protoStructFields(v reflect.Value, m map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			ev := fv
+			for ev.Kind() == reflect.Ptr && !ev.IsNil() {
+				ev = ev.Elem()
+			}
+			if ev.Kind() == reflect.Struct {
+				protoStructFields(ev, m)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		m[lowerCamelCase(name)] = protoStructValue(fv)
+	}
+}
+
+// lowerCamelCase is the JSON name of protobuf fields, like created_at is createdAt and UserID is userID.
+func lowerCamelCase(name string) string {
+	var b strings.Builder
+	upper := false
+	for i, r := range name {
+		switch {
+		case r == '_':
+			upper = i > 0
+			continue
+		case b.Len() == 0:
+			r = unicode.ToLower(r)
+		case upper:
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return name
+	}
+	return b.String()
+}
+
+// isEmptyValue is the empty value of omitempty of encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+QueryEnvelopeKey is the query arg of the whole request envelope of the GET requests, encoded as URL-safe base64 json,
+like /users?q=eyJwYXJhbXMiOlsiZmVsaXgiXX0 for {"params":["felix"]}, so deep links and emails can embed complete calls
+without query escaping the nested json, see EncodeQueryEnvelope. The other query args are ignored when it's set.
+It's a param when a name of WithParamNames or a field of the single struct param is "q".
+*/
+const QueryEnvelopeKey = "q"
+
+// DefaultMaxQueryEnvelope is the max decoded bytes of the QueryEnvelopeKey envelope when Config.MaxQueryEnvelopeBytes is not set
+const DefaultMaxQueryEnvelope = 8 << 10
+
+// EncodeQueryEnvelope is the QueryEnvelopeKey value of the request envelope of params.
+func EncodeQueryEnvelope(params ...interface{}) (string, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	b, err := json.Marshal(Req{Params: params})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+WithQueryParams serves the func also with GET, binding only the params of names from the query args,
+like /api/products?limit=10&cursor=abc, so browsers and caches can hit list endpoints without the json envelope.
+The names are of WithParamNames, or the fields of the single struct param, the params or fields not bound are zero values,
+and the params json value of the query is ignored. The query args of the other methods are bound over the params of the body.
+Combine it with WithCacheableGET for the cache headers.
+It panics when the handler is created if a name is neither.
+*/
+func WithQueryParams(names ...string) Option {
+	if len(names) == 0 {
+		panic("query param names can not be empty.")
+	}
+	return func(opts *handlerOptions) {
+		if opts.queryParams != nil {
+			opts.conflict("WithQueryParams is passed more than once, keep one of them")
+		}
+		opts.queryParams = map[string]bool{}
+		for _, name := range names {
+			opts.queryParams[name] = true
+		}
+	}
+}
+
+/*
+WithPathParams binds the params of names from the path values of the http.ServeMux pattern the handler is served at,
+like id of "GET /users/{id}", and WithHeaderParams from the request headers of the names, like "X-Tenant".
+The names are of WithParamNames, or the fields of the single struct param, like for WithQueryParams,
+they are bound over the decoded params, so the body, or the query of GET requests, can be empty.
+It panics when the handler is created if a name is neither.
+*/
+func WithPathParams(names ...string) Option {
+	if len(names) == 0 {
+		panic("path param names can not be empty.")
+	}
+	return func(opts *handlerOptions) {
+		if opts.pathParams != nil {
+			opts.conflict("WithPathParams is passed more than once, keep one of them")
+		}
+		opts.pathParams = names
+	}
+}
+
+// WithHeaderParams binds the params of names from the request headers of the names, see WithPathParams.
+func WithHeaderParams(names ...string) Option {
+	if len(names) == 0 {
+		panic("header param names can not be empty.")
+	}
+	return func(opts *handlerOptions) {
+		if opts.headerParams != nil {
+			opts.conflict("WithHeaderParams is passed more than once, keep one of them")
+		}
+		opts.headerParams = names
+	}
+}
+
+// checkQueryParams checks the names of WithQueryParams, WithPathParams and WithHeaderParams are params or fields of the func.
+func (opts *handlerOptions) checkQueryParams(ft reflect.Type, firstParam int) {
+	if opts.queryParams == nil && opts.pathParams == nil && opts.headerParams == nil || firstParam >= ft.NumIn() {
+		return
+	}
+	known := map[string]bool{}
+	if opts.paramNames != nil {
+		for _, name := range opts.paramNames {
+			known[name] = true
+		}
+	} else if firstParam == ft.NumIn()-1 {
+		if ts := cachedTypeSchema(ft.In(firstParam)); ts.Kind == "object" {
+			for _, f := range ts.Fields {
+				known[f.Name] = true
+			}
+		}
+	}
+	var queryNames []string
+	for name := range opts.queryParams {
+		queryNames = append(queryNames, name)
+	}
+	for _, option := range []struct {
+		name  string
+		names []string
+	}{
+		{"WithQueryParams", queryNames},
+		{"WithPathParams", opts.pathParams},
+		{"WithHeaderParams", opts.headerParams},
+	} {
+		var unknown []string
+		for _, name := range option.names {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			panic(fmt.Sprintf("%s names %v are not names of WithParamNames or fields of the single struct param of %s", option.name, unknown, ft))
+		}
+	}
+}
+
+// bindsRequest is true if params are bound from the path values or headers, or from the query of the requests not of isQueryGET.
+func (opts *handlerOptions) bindsRequest() bool {
+	return opts.pathParams != nil || opts.headerParams != nil || opts.queryParams != nil
+}
+
+/*
+bindRequest binds the params of WithPathParams and WithHeaderParams over the decoded params,
+and the ones of WithQueryParams too if the query was not decoded as the envelope, like of the POST requests.
+*/
+func (args *handlerArgs) bindRequest(r *http.Request, queryDecoded bool) (err error) {
+	opts := args.h.opts
+	values := map[string][]string{}
+	if !queryDecoded {
+		query := r.URL.Query()
+		for name := range opts.queryParams {
+			if vs, ok := query[name]; ok {
+				values[name] = vs
+			}
+		}
+	}
+	for _, name := range opts.pathParams {
+		if v := r.PathValue(name); v != "" {
+			values[name] = []string{v}
+		}
+	}
+	for _, name := range opts.headerParams {
+		if vs := r.Header.Values(name); len(vs) > 0 {
+			values[name] = vs
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	e := &ValidationError{Code: InvalidParamsCode}
+	invalid := func(field string, ts *TypeSchema) {
+		e.Fields = append(e.Fields, &FieldError{Field: field, Rule: "type", Message: "is not of type " + ts.Kind})
+	}
+	if names := args.paramNames(); names != nil {
+		for i, name := range names {
+			vs, ok := values[name]
+			if !ok || i >= len(args.params) {
+				continue
+			}
+			if args.params[i] == nil {
+				args.params[i] = args.notNilParams[i]
+			}
+			if json.Unmarshal(queryValue(vs, args.schema(i)), args.params[i]) != nil {
+				invalid(fmt.Sprintf("params[%d]", i), args.schema(i))
+			}
+		}
+	} else if args.singleStructParam() {
+		if args.params[0] == nil {
+			args.params[0] = args.notNilParams[0]
+		}
+		for _, f := range args.schema(0).Fields {
+			vs, ok := values[f.Name]
+			if !ok {
+				continue
+			}
+			obj, _ := json.Marshal(map[string]json.RawMessage{f.Name: queryValue(vs, f.Type)})
+			if json.Unmarshal(obj, args.params[0]) != nil {
+				invalid("params[0]."+f.Name, f.Type)
+			}
+		}
+	}
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return
+}
+
+// isQueryGET is true for GET requests of WithCacheableGET and WithQueryParams, or GET requests with an empty body with Config.QueryParams.
+func (h *Handler) isQueryGET(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	return h.opts.cacheableGET || h.opts.queryParams != nil || h.cfg.QueryParams && r.ContentLength == 0
+}
+
+// boundByQuery is true if the param or field of name is bound from the query, all are unless WithQueryParams.
+func (args *handlerArgs) boundByQuery(name string) bool {
+	return args.h.opts.queryParams == nil || args.h.opts.queryParams[name]
+}
+
+/*
+queryEnvelope builds the request envelope from the query, values that are json are taken as they are, like params=["shoes",10].
+Without the params value, the query args are the params by the names of WithParamNames,
+or the fields of the single struct param, like /users?name=felix&tag=a&tag=b.
+*/
+func (args *handlerArgs) queryEnvelope(r *http.Request) (io.Reader, error) {
+	query := r.URL.Query()
+	if q, ok := query[QueryEnvelopeKey]; ok && !args.isQueryParam(QueryEnvelopeKey) {
+		return args.h.cfg.decodeQueryEnvelope(q[0])
+	}
+	envelope := map[string]json.RawMessage{}
+	for name, values := range query {
+		if name == CursorEnvelopeKey {
+			envelope[name] = queryValue(values, &TypeSchema{Kind: "string"})
+			continue
+		}
+		if len(values) == 0 || !json.Valid([]byte(values[0])) {
+			continue
+		}
+		envelope[name] = json.RawMessage(values[0])
+	}
+	if _, ok := envelope["params"]; !ok || args.h.opts.queryParams != nil {
+		if params := args.queryParams(query); params != nil {
+			envelope["params"] = params
+		}
+	}
+	b, _ := json.Marshal(envelope)
+	return bytes.NewReader(b), nil
+}
+
+// decodeQueryEnvelope decodes the base64 json envelope of QueryEnvelopeKey, up to Config.MaxQueryEnvelopeBytes.
+func (cfg *Config) decodeQueryEnvelope(q string) (io.Reader, error) {
+	max := cfg.MaxQueryEnvelopeBytes
+	if max <= 0 {
+		max = DefaultMaxQueryEnvelope
+	}
+	q = strings.TrimRight(q, "=")
+	if int64(base64.RawURLEncoding.DecodedLen(len(q))) > max {
+		return nil, &RequestTooLargeError{Code: RequestTooLargeCode, MaxBytes: max}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q)
+	if err != nil || !json.Valid(b) {
+		return nil, fmt.Errorf("query %s is not URL-safe base64 json", QueryEnvelopeKey)
+	}
+	return bytes.NewReader(b), nil
+}
+
+// isQueryParam is true if name is a name of WithParamNames or a field of the single struct param bound from the query.
+func (args *handlerArgs) isQueryParam(name string) bool {
+	if !args.boundByQuery(name) {
+		return false
+	}
+	if names := args.paramNames(); names != nil {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	if args.singleStructParam() {
+		for _, f := range args.schema(0).Fields {
+			if f.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryParams are the params array of the query args by names, nil if the params are not named.
+func (args *handlerArgs) queryParams(query map[string][]string) json.RawMessage {
+	var params []json.RawMessage
+	if names := args.paramNames(); names != nil {
+		for i, name := range names {
+			if !args.boundByQuery(name) {
+				params = append(params, json.RawMessage("null"))
+				continue
+			}
+			params = append(params, queryValue(query[name], args.schema(i)))
+		}
+	} else if args.singleStructParam() {
+		ts := args.schema(0)
+		fields := map[string]json.RawMessage{}
+		for _, f := range ts.Fields {
+			if values, ok := query[f.Name]; ok && args.boundByQuery(f.Name) {
+				fields[f.Name] = queryValue(values, f.Type)
+			}
+		}
+		obj, _ := json.Marshal(fields)
+		params = append(params, obj)
+	} else {
+		return nil
+	}
+	b, _ := json.Marshal(params)
+	return b
+}
+
+// schema is the type schema of the i-th decoded param
+func (args *handlerArgs) schema(i int) *TypeSchema {
+	return args.h.argPlans[args.argIndexes[i]-args.injectedCount].schema
+}
+
+// queryValue is the json of the query values as ts, strings don't need to be quoted, and arrays are the repeated values.
+func queryValue(values []string, ts *TypeSchema) json.RawMessage {
+	if len(values) == 0 {
+		return json.RawMessage("null")
+	}
+	if ts.Kind == "array" && !(len(values) == 1 && isJSONArray(values[0])) {
+		var elems []json.RawMessage
+		for _, v := range values {
+			elems = append(elems, queryValue([]string{v}, ts.Elem))
+		}
+		b, _ := json.Marshal(elems)
+		return b
+	}
+	v := values[0]
+	var s string
+	if ts.Kind == "string" && json.Unmarshal([]byte(v), &s) != nil || !json.Valid([]byte(v)) {
+		b, _ := json.Marshal(v)
+		return b
+	}
+	return json.RawMessage(v)
+}
+
+func isJSONArray(v string) bool {
+	trimmed := bytes.TrimSpace([]byte(v))
+	return len(trimmed) > 0 && trimmed[0] == '[' && json.Valid(trimmed)
+}
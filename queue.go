@@ -0,0 +1,249 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Message is a request envelope received from a queue, like {"method": "users.Create", "params": [...]},
+Ack removes it from the queue, Nack makes it delivered again.
+SQSQueue and KafkaQueue adapt the SQS and Kafka clients, ChanQueue is in memory.
+*/
+type Message interface {
+	Body() []byte
+	Ack() error
+	Nack() error
+	// DeliveryCount is how many times the message is delivered, 1 for the first time, for QueueConsumer.MaxAttempts
+	DeliveryCount() int
+}
+
+// Queue receives messages, it blocks until there is one or ctx is done.
+type Queue interface {
+	Receive(ctx context.Context) (Message, error)
+}
+
+// QueueEnvelope is the body of a Message
+type QueueEnvelope struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+/*
+QueueConsumer dispatches messages from Queue to the Registry's funcs with Invoke,
+so the same funcs are called synchronously by http and asynchronously by queues.
+*/
+type QueueConsumer struct {
+	Registry *Registry
+	Queue    Queue
+	// Concurrency is how many messages are handled at the same time, default is 1.
+	Concurrency int
+	// Retryable decides if a failed message is Nack'ed to be delivered again, or dead-lettered,
+	// default retries errors with status code 500 and above, so bad messages are not retried at all.
+	Retryable func(err error) bool
+	// MaxAttempts is how many times a message is handled while its error is Retryable, default is 3,
+	// then it's dead-lettered, so a message that always fails is not delivered again forever.
+	// The attempts are the DeliveryCount of the messages, counted by the queue, so the messages of the same body
+	// are counted apart. A message that fails because ctx is done is Nack'ed without being taken as a failed attempt.
+	MaxAttempts int
+	// DeadLetter is called with a failed message that is not retried before it's Ack'ed, like to send it to a dead-letter queue,
+	// an error Nacks it instead. Default logs it.
+	DeadLetter func(msg Message, method string, err error) error
+	// OnResult is called after every message is handled
+	OnResult func(msg Message, method string, results []interface{}, err error)
+
+	busy, handled, failed, deadLettered int64
+}
+
+// QueueStats are the metrics of a QueueConsumer, for Registry.AddDiagnostics
+type QueueStats struct {
+	Concurrency int `json:"concurrency"`
+	// Busy is how many messages are being handled now
+	Busy    int64 `json:"busy"`
+	Handled int64 `json:"handled"`
+	// Failed counts the handled messages with an error
+	Failed int64 `json:"failed"`
+	// DeadLettered counts the failed messages not retried
+	DeadLettered int64 `json:"dead_lettered"`
+}
+
+// Stats returns the metrics of the consumer
+func (qc *QueueConsumer) Stats() QueueStats {
+	concurrency := qc.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return QueueStats{
+		Concurrency:  concurrency,
+		Busy:         atomic.LoadInt64(&qc.busy),
+		Handled:      atomic.LoadInt64(&qc.handled),
+		Failed:       atomic.LoadInt64(&qc.failed),
+		DeadLettered: atomic.LoadInt64(&qc.deadLettered),
+	}
+}
+
+/*
+Run receives and handles messages until ctx is done or Queue.Receive returns an error,
+it waits for the messages in handling before returning.
+*/
+func (qc *QueueConsumer) Run(ctx context.Context) (err error) {
+	concurrency := qc.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		var msg Message
+		msg, err = qc.Queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			qc.handle(ctx, msg)
+		}()
+	}
+}
+
+func (qc *QueueConsumer) handle(ctx context.Context, msg Message) {
+	atomic.AddInt64(&qc.busy, 1)
+	defer atomic.AddInt64(&qc.busy, -1)
+	var env QueueEnvelope
+	var results []interface{}
+	err := json.Unmarshal(msg.Body(), &env)
+	if err != nil {
+		err = NewStatusCodeError(http.StatusUnprocessableEntity, fmt.Errorf("decode queue message error: %s", err))
+	} else {
+		params := make([]interface{}, len(env.Params))
+		for i, p := range env.Params {
+			params[i] = p
+		}
+		results, err = qc.Registry.Invoke(ctx, env.Method, params...)
+	}
+
+	atomic.AddInt64(&qc.handled, 1)
+	if err != nil {
+		atomic.AddInt64(&qc.failed, 1)
+	}
+	if qc.OnResult != nil {
+		qc.OnResult(msg, env.Method, results, err)
+	}
+
+	retryable := qc.Retryable
+	if retryable == nil {
+		retryable = defaultRetryable
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the consumer is stopping, the message is delivered again without counting it as failed
+		err = msg.Nack()
+	case err != nil && retryable(err) && msg.DeliveryCount() < qc.maxAttempts():
+		err = msg.Nack()
+	case err != nil:
+		atomic.AddInt64(&qc.deadLettered, 1)
+		if err = qc.deadLetter(msg, env.Method, err); err != nil {
+			log.Printf("jsonhandlerfunc: dead letter queue message of %s error: %s\n", env.Method, err)
+			err = msg.Nack()
+		} else {
+			err = msg.Ack()
+		}
+	default:
+		err = msg.Ack()
+	}
+	if err != nil {
+		log.Printf("jsonhandlerfunc: ack queue message of %s error: %s\n", env.Method, err)
+	}
+}
+
+func (qc *QueueConsumer) maxAttempts() int {
+	if qc.MaxAttempts <= 0 {
+		return 3
+	}
+	return qc.MaxAttempts
+}
+
+func (qc *QueueConsumer) deadLetter(msg Message, method string, err error) error {
+	if qc.DeadLetter != nil {
+		return qc.DeadLetter(msg, method, err)
+	}
+	log.Printf("jsonhandlerfunc: dead letter queue message of %s: %s: %s\n", method, err, msg.Body())
+	return nil
+}
+
+func defaultRetryable(err error) bool {
+	return statusCodeOf(err, http.StatusInternalServerError) >= http.StatusInternalServerError
+}
+
+/*
+ChanQueue is an in memory Queue, as a reference implementation and for tests, send the bodies of the messages to C.
+Nack'ed messages are received again with their delivery counts, so cancel the consumer's ctx instead of closing C.
+Create it with NewChanQueue.
+*/
+type ChanQueue struct {
+	C chan []byte
+
+	redelivered chan *chanMessage
+}
+
+func NewChanQueue(size int) *ChanQueue {
+	return &ChanQueue{C: make(chan []byte, size), redelivered: make(chan *chanMessage, size)}
+}
+
+func (q *ChanQueue) Receive(ctx context.Context) (msg Message, err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case m := <-q.redelivered:
+		m.deliveries++
+		return m, nil
+	case body, ok := <-q.C:
+		if !ok {
+			return nil, fmt.Errorf("jsonhandlerfunc: queue closed")
+		}
+		return &chanMessage{q: q, body: body, deliveries: 1}, nil
+	}
+}
+
+type chanMessage struct {
+	q          *ChanQueue
+	body       []byte
+	deliveries int
+}
+
+func (m *chanMessage) Body() []byte {
+	return m.body
+}
+
+func (m *chanMessage) Ack() error {
+	return nil
+}
+
+func (m *chanMessage) DeliveryCount() int {
+	return m.deliveries
+}
+
+func (m *chanMessage) Nack() error {
+	select {
+	case m.q.redelivered <- m:
+		return nil
+	default:
+		return fmt.Errorf("jsonhandlerfunc: queue is full")
+	}
+}
@@ -0,0 +1,190 @@
+package jsonhandlerfunc_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/theplant/jsonhandlerfunc"
+)
+
+// ### Queue: consume request envelopes from a queue with the registered funcs
+func ExampleQueueConsumer() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+	var attempts int
+	reg.Register("flaky", func(name string) (r string, err error) {
+		attempts++
+		if attempts == 1 {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusServiceUnavailable, fmt.Errorf("downstream is down"))
+			return
+		}
+		r = "recovered " + name
+		return
+	})
+
+	queue := jsonhandlerfunc.NewChanQueue(10)
+	queue.C <- []byte(`{"method": "GreetingService.Hello", "params": ["Gates"]}`)
+	queue.C <- []byte(`{"method": "flaky", "params": ["Gates"]}`)
+	queue.C <- []byte(`not json`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := 0
+	consumer := &jsonhandlerfunc.QueueConsumer{
+		Registry: reg,
+		Queue:    queue,
+		OnResult: func(msg jsonhandlerfunc.Message, method string, results []interface{}, err error) {
+			fmt.Println(method, results, err)
+			handled++
+			if handled == 4 {
+				cancel()
+			}
+		},
+	}
+	fmt.Println(consumer.Run(ctx))
+	//Output:
+	// GreetingService.Hello [Hello Gates] <nil>
+	// flaky [] 503: downstream is down
+	//  [] 422: decode queue message error: invalid character 'o' in literal null (expecting 'u')
+	// flaky [recovered Gates] <nil>
+	// <nil>
+}
+
+// ### Queue: a message that fails MaxAttempts times is dead-lettered instead of delivered again forever
+func ExampleQueueConsumer_deadLetter() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("broken", func(name string) (r string, err error) {
+		err = fmt.Errorf("broken for %s", name)
+		return
+	})
+
+	queue := jsonhandlerfunc.NewChanQueue(10)
+	queue.C <- []byte(`{"method": "broken", "params": ["Gates"]}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	consumer := &jsonhandlerfunc.QueueConsumer{
+		Registry:    reg,
+		Queue:       queue,
+		MaxAttempts: 2,
+		OnResult: func(msg jsonhandlerfunc.Message, method string, results []interface{}, err error) {
+			fmt.Println(method, err)
+		},
+		DeadLetter: func(msg jsonhandlerfunc.Message, method string, err error) error {
+			fmt.Println("dead letter:", string(msg.Body()))
+			cancel()
+			return nil
+		},
+	}
+	fmt.Println(consumer.Run(ctx))
+	fmt.Printf("%+v\n", consumer.Stats())
+	//Output:
+	// broken broken for Gates
+	// broken broken for Gates
+	// dead letter: {"method": "broken", "params": ["Gates"]}
+	// <nil>
+	// {Concurrency:1 Busy:0 Handled:2 Failed:2 DeadLettered:1}
+}
+
+// ### Queue: the attempts are counted by the deliveries of the messages, not by their bodies, and stopping the consumer is not an attempt
+func ExampleQueueConsumer_deliveryCount() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("broken", func(name string) (r string, err error) {
+		err = fmt.Errorf("broken for %s", name)
+		return
+	})
+	started := make(chan bool)
+	reg.Register("slow", func(ctx context.Context) (err error) {
+		started <- true
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	queue := jsonhandlerfunc.NewChanQueue(10)
+	queue.C <- []byte(`{"method": "broken", "params": ["Gates"]}`)
+	queue.C <- []byte(`{"method": "broken", "params": ["Gates"]}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deadLetters := 0
+	consumer := &jsonhandlerfunc.QueueConsumer{
+		Registry:    reg,
+		Queue:       queue,
+		MaxAttempts: 2,
+		DeadLetter: func(msg jsonhandlerfunc.Message, method string, err error) error {
+			fmt.Println("dead letter after", msg.DeliveryCount(), "attempts")
+			if deadLetters++; deadLetters == 2 {
+				queue.C <- []byte(`{"method": "slow"}`)
+			}
+			return nil
+		},
+	}
+	go func() {
+		<-started
+		cancel()
+	}()
+	fmt.Println(consumer.Run(ctx))
+	fmt.Printf("%+v\n", consumer.Stats())
+
+	msg, _ := queue.Receive(context.Background())
+	fmt.Println(string(msg.Body()), msg.DeliveryCount())
+	//Output:
+	// dead letter after 2 attempts
+	// dead letter after 2 attempts
+	// <nil>
+	// {Concurrency:1 Busy:0 Handled:5 Failed:5 DeadLettered:2}
+	// {"method": "slow"} 2
+}
+
+type fakeSQS struct {
+	bodies []string
+}
+
+func (c *fakeSQS) ReceiveMessage(ctx context.Context) (msg *jsonhandlerfunc.SQSMessage, err error) {
+	if len(c.bodies) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	msg = &jsonhandlerfunc.SQSMessage{Body: []byte(c.bodies[0]), ReceiveCount: 1}
+	c.bodies = c.bodies[1:]
+	msg.ReceiptHandle = fmt.Sprintf("handle-%d", len(c.bodies))
+	return
+}
+
+func (c *fakeSQS) DeleteMessage(ctx context.Context, receiptHandle string) error {
+	fmt.Println("delete", receiptHandle)
+	return nil
+}
+
+func (c *fakeSQS) ChangeMessageVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	fmt.Println("change visibility", receiptHandle, timeout)
+	return nil
+}
+
+// ### Queue: SQSQueue deletes the handled messages and makes the retried ones visible again
+func ExampleSQSQueue() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+	reg.Register("down", func() (err error) {
+		return jsonhandlerfunc.NewStatusCodeError(http.StatusServiceUnavailable, fmt.Errorf("downstream is down"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := 0
+	consumer := &jsonhandlerfunc.QueueConsumer{
+		Registry: reg,
+		Queue: &jsonhandlerfunc.SQSQueue{Client: &fakeSQS{bodies: []string{
+			`{"method": "GreetingService.Hello", "params": ["Gates"]}`,
+			`{"method": "down"}`,
+		}}},
+		OnResult: func(msg jsonhandlerfunc.Message, method string, results []interface{}, err error) {
+			if handled++; handled == 2 {
+				defer cancel()
+			}
+		},
+	}
+	fmt.Println(consumer.Run(ctx))
+	//Output:
+	// delete handle-1
+	// change visibility handle-0 0s
+	// <nil>
+}
@@ -0,0 +1,143 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+SQSClient is the calls of the SQS API that SQSQueue makes, implemented with the SQS client of the AWS SDK, like:
+
+	func (c *sqsClient) ReceiveMessage(ctx context.Context) (msg *jsonhandlerfunc.SQSMessage, err error) {
+		out, err := c.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: &c.url, MaxNumberOfMessages: 1, WaitTimeSeconds: 20,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount}})
+		if err != nil || len(out.Messages) == 0 {
+			return
+		}
+		m := out.Messages[0]
+		count, _ := strconv.Atoi(m.Attributes["ApproximateReceiveCount"])
+		return &jsonhandlerfunc.SQSMessage{Body: []byte(*m.Body), ReceiptHandle: *m.ReceiptHandle, ReceiveCount: count}, nil
+	}
+*/
+type SQSClient interface {
+	// ReceiveMessage long polls a message of the queue, msg is nil if there was none before the poll timed out.
+	ReceiveMessage(ctx context.Context) (msg *SQSMessage, err error)
+	DeleteMessage(ctx context.Context, receiptHandle string) error
+	ChangeMessageVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error
+}
+
+/*
+SQSQueue is the Queue of an SQS queue, Ack deletes the message by its receipt handle,
+and Nack changes its visibility timeout to 0 so it's received again. The redrive policy of the queue
+still applies to the messages the consumer failed to Ack.
+*/
+type SQSQueue struct {
+	Client SQSClient
+}
+
+// SQSMessage is a message received by SQSClient, ReceiveCount is the ApproximateReceiveCount attribute of the message.
+type SQSMessage struct {
+	Body          []byte
+	ReceiptHandle string
+	ReceiveCount  int
+}
+
+func (q *SQSQueue) Receive(ctx context.Context) (msg Message, err error) {
+	for {
+		var m *SQSMessage
+		m, err = q.Client.ReceiveMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			return &sqsMessage{client: q.Client, msg: m}, nil
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type sqsMessage struct {
+	client SQSClient
+	msg    *SQSMessage
+}
+
+func (m *sqsMessage) Body() []byte {
+	return m.msg.Body
+}
+
+func (m *sqsMessage) Ack() error {
+	return m.client.DeleteMessage(context.Background(), m.msg.ReceiptHandle)
+}
+
+func (m *sqsMessage) Nack() error {
+	return m.client.ChangeMessageVisibility(context.Background(), m.msg.ReceiptHandle, 0)
+}
+
+func (m *sqsMessage) DeliveryCount() int {
+	return m.msg.ReceiveCount
+}
+
+// KafkaReader is the calls of a Kafka consumer that KafkaQueue makes, like FetchMessage and CommitMessages of the Reader of segmentio/kafka-go.
+type KafkaReader interface {
+	// Fetch reads the value of the next message without committing its offset, commit commits it.
+	Fetch(ctx context.Context) (value []byte, commit func(ctx context.Context) error, err error)
+}
+
+/*
+KafkaQueue is the Queue of a Kafka consumer, Ack commits the offset of the message. Kafka doesn't deliver a message again,
+so the Nack'ed messages are received again from the KafkaQueue before the next ones are fetched.
+Committing an offset commits the ones before it, so use a Concurrency of 1 to not commit the messages still in handling.
+*/
+type KafkaQueue struct {
+	Reader KafkaReader
+
+	mu     sync.Mutex
+	nacked []*kafkaMessage
+}
+
+func (q *KafkaQueue) Receive(ctx context.Context) (msg Message, err error) {
+	q.mu.Lock()
+	if len(q.nacked) > 0 {
+		var m *kafkaMessage
+		m, q.nacked = q.nacked[0], q.nacked[1:]
+		q.mu.Unlock()
+		m.deliveries++
+		return m, nil
+	}
+	q.mu.Unlock()
+
+	value, commit, err := q.Reader.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaMessage{q: q, value: value, commit: commit, deliveries: 1}, nil
+}
+
+type kafkaMessage struct {
+	q          *KafkaQueue
+	value      []byte
+	commit     func(ctx context.Context) error
+	deliveries int
+}
+
+func (m *kafkaMessage) Body() []byte {
+	return m.value
+}
+
+func (m *kafkaMessage) Ack() error {
+	return m.commit(context.Background())
+}
+
+func (m *kafkaMessage) DeliveryCount() int {
+	return m.deliveries
+}
+
+func (m *kafkaMessage) Nack() error {
+	m.q.mu.Lock()
+	defer m.q.mu.Unlock()
+	m.q.nacked = append(m.q.nacked, m)
+	return nil
+}
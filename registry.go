@@ -0,0 +1,228 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+/*
+Registry holds many funcs by name, and serves them behind one http.Handler,
+the method name is the last element of the request url path, like /api/UserService.Create,
+or the "method" of the request body, like {"method": "UserService.Create", "params": [...]}.
+It's the place for the shared Config, injectors, options and middleware of the funcs.
+*/
+type Registry struct {
+	Config *Config
+
+	handlers   map[string]*Handler
+	fallback   *Handler
+	shared     []interface{}
+	middleware []func(http.Handler) http.Handler
+
+	openAPIPath string
+	openAPIInfo OpenAPIInfo
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+
+	diagnosticsPath  string
+	extraDiagnostics map[string]func() interface{}
+
+	schemaPath string
+}
+
+// DefaultRegistry is used by the package level Register and RegisterInterface
+var DefaultRegistry = NewRegistry(defaultConfig)
+
+func NewRegistry(cfg *Config) *Registry {
+	if cfg == nil {
+		cfg = defaultConfig
+	}
+	return &Registry{
+		Config:   cfg,
+		handlers: map[string]*Handler{},
+	}
+}
+
+// Register func to DefaultRegistry with name, the funcs is the same as ToHandlerFunc
+func Register(name string, funcs ...interface{}) {
+	DefaultRegistry.Register(name, funcs...)
+}
+
+func (reg *Registry) Register(name string, funcs ...interface{}) {
+	if _, exists := reg.handlers[name]; exists {
+		panic(fmt.Sprintf("method %s is already registered", name))
+	}
+	if len(funcs) > 0 && len(reg.shared) > 0 {
+		funcs = append(append([]interface{}{funcs[0]}, reg.shared...), funcs[1:]...)
+	}
+	reg.handlers[name] = reg.Config.NewHandler(funcs...)
+}
+
+/*
+Inject adds injectors and options shared by the funcs registered after it,
+the shared injectors inject the first params, before the injectors passed to Register:
+
+	reg.Inject(ctxInjector, currentUserInjector, jsonhandlerfunc.WithRequiredHeaders("X-Api-Key"))
+	reg.Register("users.Update", func(ctx context.Context, user *User, name string) (err error) { ... })
+*/
+func (reg *Registry) Inject(funcs ...interface{}) {
+	reg.shared = append(reg.shared, funcs...)
+}
+
+// Use adds http middleware around the dispatched handlers, the first one is the outermost, read the method with MethodName.
+func (reg *Registry) Use(middleware ...func(http.Handler) http.Handler) {
+	reg.middleware = append(reg.middleware, middleware...)
+}
+
+type methodNameKey struct{}
+
+// MethodName returns the registry method name of the request context, for middleware and funcs.
+func MethodName(ctx context.Context) string {
+	name, _ := ctx.Value(methodNameKey{}).(string)
+	return name
+}
+
+// Handler returns the registered handler of the method, nil if not found.
+func (reg *Registry) Handler(name string) *Handler {
+	return reg.handlers[name]
+}
+
+// Invoke calls the registered method in process, see Handler.Invoke
+func (reg *Registry) Invoke(ctx context.Context, method string, params ...interface{}) (results []interface{}, err error) {
+	h, ok := reg.handlers[method]
+	if !ok && reg.fallback != nil {
+		h, ok = reg.fallback, true
+	}
+	if !ok {
+		err = &MethodNotFoundError{Code: MethodNotFoundCode, Method: method}
+		return
+	}
+	return h.Invoke(context.WithValue(ctx, methodNameKey{}, method), params...)
+}
+
+// Methods returns sorted registered method names
+func (reg *Registry) Methods() (names []string) {
+	for name := range reg.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if reg.serveOpenAPI(w, r) {
+		return
+	}
+	if reg.serveDiagnostics(w, r) {
+		return
+	}
+	if reg.serveSchema(w, r) {
+		return
+	}
+	if reg.Config.serveBatch(w, r, reg) {
+		return
+	}
+	name := path.Base(r.URL.Path)
+	h, ok := reg.handlers[name]
+	if !ok && r.Method == http.MethodPost {
+		if bodyName := bodyMethodName(r); bodyName != "" {
+			name = bodyName
+			h, ok = reg.handlers[name]
+		}
+	}
+	if !ok && reg.fallback != nil {
+		h, ok = reg.fallback, true
+	}
+	if !ok {
+		err := &MethodNotFoundError{Code: MethodNotFoundCode, Method: name}
+		writeJSONResponse(reg.Config.newResponseWriter(w, r), http.StatusNotFound, []interface{}{reg.Config.responseError(err)})
+		return
+	}
+
+	var next http.Handler = h
+	for i := len(reg.middleware) - 1; i >= 0; i-- {
+		next = reg.middleware[i](next)
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), methodNameKey{}, name)))
+}
+
+// bodyMethodName reads the "method" of the request body, the body is kept for the handler.
+func bodyMethodName(r *http.Request) string {
+	var req struct {
+		Method string `json:"method"`
+	}
+	json.NewDecoder(bufferBody(r)).Decode(&req)
+	return req.Method
+}
+
+// MethodNotFoundCode is the code of MethodNotFoundError
+const MethodNotFoundCode = "method_not_found"
+
+// MethodNotFoundError is responded with 404 when the registry has no func for the requested method.
+type MethodNotFoundError struct {
+	Code   string `json:"code"`
+	Method string `json:"method"`
+}
+
+func (e *MethodNotFoundError) Error() string {
+	return fmt.Sprintf("method %s not found", e.Method)
+}
+
+func (e *MethodNotFoundError) StatusCode() int {
+	return http.StatusNotFound
+}
+
+/*
+RegisterInterface registers impl's methods of interface I to DefaultRegistry, named like "UserService.Create",
+so that the server and generated clients share the Go interface as the single source of truth.
+The extra funcs like injectors and options are passed to every method.
+I can't be inferred from impl, pass it explicitly:
+
+	jsonhandlerfunc.RegisterInterface[UserService](impl)
+
+It panics if I is not an interface type, or impl doesn't implement it.
+*/
+func RegisterInterface[I any, T any](impl T, funcs ...interface{}) {
+	if it := reflect.TypeOf((*I)(nil)).Elem(); it.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("RegisterInterface type argument %s is not an interface, pass the interface like RegisterInterface[UserService](impl)", it))
+	}
+	DefaultRegistry.RegisterInterface((*I)(nil), impl, funcs...)
+}
+
+/*
+RegisterInterface registers impl's methods of the interface that iface points to, like:
+
+	reg.RegisterInterface((*UserService)(nil), impl)
+*/
+func (reg *Registry) RegisterInterface(iface interface{}, impl interface{}, funcs ...interface{}) {
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Ptr || it.Elem().Kind() != reflect.Interface {
+		panic("iface must be a pointer to interface, like (*UserService)(nil)")
+	}
+	it = it.Elem()
+	iv := reflect.ValueOf(impl)
+	if !iv.IsValid() || !iv.Type().Implements(it) {
+		panic(fmt.Sprintf("%T does not implement %s", impl, it))
+	}
+	for _, name := range interfaceMethodNames(it) {
+		method := iv.MethodByName(name).Interface()
+		reg.Register(interfaceMethodName(it, name), append([]interface{}{method}, funcs...)...)
+	}
+}
+
+func interfaceMethodName(it reflect.Type, method string) string {
+	return it.Name() + "." + method
+}
+
+func interfaceMethodNames(it reflect.Type) (names []string) {
+	for i := 0; i < it.NumMethod(); i++ {
+		names = append(names, it.Method(i).Name)
+	}
+	return
+}
@@ -0,0 +1,911 @@
+package jsonhandlerfunc_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theplant/jsonhandlerfunc"
+)
+
+type GreetingService interface {
+	Hello(ctx context.Context, name string) (r string, err error)
+	Bye(name string) (r string, err error)
+}
+
+type greetingService struct{}
+
+func (greetingService) Hello(ctx context.Context, name string) (r string, err error) {
+	r = "Hello " + name
+	return
+}
+
+func (greetingService) Bye(name string) (r string, err error) {
+	r = "Bye " + name
+	return
+}
+
+func (greetingService) NotInInterface() (err error) {
+	return
+}
+
+// ### Registry: register an implementation with the methods of a Go interface
+func ExampleRegisterInterface() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+	fmt.Println(reg.Methods())
+
+	for _, method := range []string{"GreetingService.Hello", "GreetingService.Bye", "GreetingService.NotInInterface"} {
+		req := httptest.NewRequest("POST", "/api/"+method, strings.NewReader(`{"params": ["Gates"]}`))
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, req)
+		fmt.Println(w.Code, w.Body.String())
+	}
+
+	jsonhandlerfunc.RegisterInterface[GreetingService](greetingService{})
+	fmt.Println(jsonhandlerfunc.DefaultRegistry.Methods())
+	//Output:
+	// [GreetingService.Bye GreetingService.Hello]
+	// 200 {"results":["Hello Gates",null]}
+	//
+	// 200 {"results":["Bye Gates",null]}
+	//
+	// 404 {"results":[{"error":"method GreetingService.NotInInterface not found","value":{"code":"method_not_found","method":"GreetingService.NotInInterface"}}]}
+	//
+	// [GreetingService.Bye GreetingService.Hello]
+}
+
+// ### Registry: Warm calls methods in process to prime caches
+func ExampleRegistry_Warm() {
+	var cache = map[string]string{}
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("products.Get", func(id string) (r string, err error) {
+		if id == "" {
+			err = fmt.Errorf("id is required")
+			return
+		}
+		r = "product " + id
+		cache[id] = r
+		return
+	})
+
+	results := reg.Warm(context.Background(), []jsonhandlerfunc.WarmSpec{
+		{Method: "products.Get", Params: []interface{}{"1"}},
+		{Method: "products.Get", Params: []interface{}{""}},
+		{Method: "products.Unknown"},
+	})
+	for _, res := range results {
+		fmt.Println(res.Method, res.StatusCode, res.Err)
+	}
+	fmt.Println(cache)
+	//Output:
+	// products.Get 200 <nil>
+	// products.Get 200 id is required
+	// products.Unknown 404 method products.Unknown not found
+	// map[1:product 1]
+}
+
+// ### Registry: Invoke calls a registered method in process
+func ExampleRegistry_Invoke() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+
+	results, err := reg.Invoke(context.Background(), "GreetingService.Hello", "Gates")
+	fmt.Println(results, err)
+	_, err = reg.Invoke(context.Background(), "GreetingService.Unknown")
+	fmt.Println(err)
+	//Output:
+	// [Hello Gates] <nil>
+	// method GreetingService.Unknown not found
+}
+
+// ### Registry: Invoke decodes the params of the types registered with RegisterType the same as the requests
+func ExampleRegistry_Invoke_registerType() {
+	cfg := &jsonhandlerfunc.Config{}
+	jsonhandlerfunc.RegisterType(cfg, func(raw json.RawMessage) (t time.Time, err error) {
+		var s string
+		if err = json.Unmarshal(raw, &s); err != nil {
+			return
+		}
+		return time.Parse("2006-01-02", s)
+	}, nil)
+	reg := jsonhandlerfunc.NewRegistry(cfg)
+	reg.Register("nextDay", func(day time.Time, until *time.Time) (next string, err error) {
+		return day.AddDate(0, 0, 1).Format("Jan 2") + " until " + until.Format("Jan 2"), nil
+	})
+
+	results, err := reg.Invoke(context.Background(), "nextDay", json.RawMessage(`"2024-01-02"`), "2024-02-01")
+	fmt.Println(results, err)
+	_, err = reg.Invoke(context.Background(), "nextDay", "tomorrow", "2024-02-01")
+	fmt.Println(err)
+	//Output:
+	// [Jan 3 until Feb 1] <nil>
+	// param 0: decode time.Time: parsing time "tomorrow" as "2006-01-02": cannot parse "tomorrow" as "2006"
+}
+
+// ### Registry: dispatch by the method in the body, with shared injectors and middleware
+func ExampleRegistry_Inject() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Inject(func(w http.ResponseWriter, r *http.Request) (userId string, err error) {
+		userId = r.Header.Get("X-User-Id")
+		if userId == "" {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusUnauthorized, fmt.Errorf("login required"))
+		}
+		return
+	})
+	reg.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Println("calling", jsonhandlerfunc.MethodName(r.Context()))
+			next.ServeHTTP(w, r)
+		})
+	})
+	reg.Register("users.Rename", func(userId string, name string) (r string, err error) {
+		r = fmt.Sprintf("user %s renamed to %s", userId, name)
+		return
+	})
+
+	for _, userId := range []string{"1", ""} {
+		req := httptest.NewRequest("POST", "/api", strings.NewReader(`{"method": "users.Rename", "params": ["Gates"]}`))
+		req.Header.Set("X-User-Id", userId)
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, req)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// calling users.Rename
+	// 200 {"results":["user 1 renamed to Gates",null]}
+	// calling users.Rename
+	// 401 {"results":["",{"error":"login required","value":{}}]}
+}
+
+// ### Registry: Config JSONRPC speaks JSON-RPC 2.0
+func ExampleConfig_jsonrpc() {
+	reg := jsonhandlerfunc.NewRegistry(&jsonhandlerfunc.Config{JSONRPC: true})
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+	reg.Register("math.Divide", func(a, b int) (q int, r int, err error) {
+		if b == 0 {
+			err = fmt.Errorf("divide by zero")
+			return
+		}
+		q, r = a/b, a%b
+		return
+	})
+
+	for _, body := range []string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "GreetingService.Hello", "params": ["Gates"]}`,
+		`{"jsonrpc": "2.0", "id": "a", "method": "math.Divide", "params": [7, 2]}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "math.Divide", "params": [7, 0]}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "math.Divide", "params": [7]}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "math.Unknown", "params": []}`,
+		`{"jsonrpc": "1.0", "id": 5, "method": "math.Divide", "params": [7, 2]}`,
+		`{"jsonrpc": "2.0", "method": "GreetingService.Bye", "params": ["Gates"]}`,
+	} {
+		req := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, req)
+		fmt.Print(w.Code, " ", w.Body.String())
+		if w.Body.Len() == 0 {
+			fmt.Println()
+		}
+	}
+	//Output:
+	// 200 {"jsonrpc":"2.0","result":"Hello Gates","id":1}
+	// 200 {"jsonrpc":"2.0","result":[3,1],"id":"a"}
+	// 200 {"jsonrpc":"2.0","error":{"code":-32000,"message":"divide by zero","data":{}},"id":2}
+	// 200 {"jsonrpc":"2.0","error":{"code":-32602,"message":"require 2 params (int, int), but passed in 1 params","data":{"code":"params_count_mismatch","required":2,"passed":1,"params":[{"index":0,"type":"int"},{"index":1,"type":"int"}]}},"id":3}
+	// 200 {"jsonrpc":"2.0","error":{"code":-32601,"message":"method math.Unknown not found","data":{"code":"method_not_found","method":"math.Unknown"}},"id":4}
+	// 200 {"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request, jsonrpc must be \"2.0\"","data":{}},"id":5}
+	// 204
+}
+
+// ### Registry: Config AllowBatch serves many calls in one request
+func ExampleConfig_batch() {
+	reg := jsonhandlerfunc.NewRegistry(&jsonhandlerfunc.Config{AllowBatch: true, BatchConcurrency: 4, MaxBatchSize: 3})
+	reg.RegisterInterface((*GreetingService)(nil), greetingService{})
+
+	for _, body := range []string{
+		`[
+			{"method": "GreetingService.Hello", "params": ["Gates"]},
+			{"method": "GreetingService.Bye", "params": ["Jobs"]},
+			{"method": "GreetingService.Unknown", "params": []}
+		]`,
+		`[{}, {}, {}, {}]`,
+	} {
+		req := httptest.NewRequest("POST", "/api", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, req)
+		fmt.Print(w.Code, " ", w.Body.String())
+	}
+	//Output:
+	// 200 [{"results":["Hello Gates",null]},{"results":["Bye Jobs",null]},{"results":[{"error":"method GreetingService.Unknown not found","value":{"code":"method_not_found","method":"GreetingService.Unknown"}}]}]
+	// 413 {"results":[{"error":"batch of 4 calls is larger than 3","value":{"code":"batch_too_large","size":4,"max_size":3}}]}
+}
+
+// ### Registry: a call of a batch consumes the results of an earlier call with {"$ref": "0.results.0.id"}
+func ExampleConfig_batchRefs() {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	reg := jsonhandlerfunc.NewRegistry(&jsonhandlerfunc.Config{AllowBatch: true, BatchConcurrency: 4})
+	reg.Register("me", func() (u *user, err error) {
+		u = &user{ID: 42, Name: "felix"}
+		return
+	})
+	reg.Register("orders", func(userID int) (orders []string, err error) {
+		orders = []string{fmt.Sprintf("order 1 of user %d", userID)}
+		return
+	})
+
+	body := `[
+		{"method": "me", "params": []},
+		{"method": "orders", "params": [{"$ref": "0.results.0.id"}]},
+		{"method": "orders", "params": [{"$ref": "0.results.0.email"}]},
+		{"method": "orders", "params": [{"$ref": "3.results.0"}]}
+	]`
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("POST", "/api", strings.NewReader(body)))
+	fmt.Print(w.Code, " ", w.Body.String())
+	//Output:
+	// 200 [{"results":[{"id":42,"name":"felix"},null]},{"results":[["order 1 of user 42"],null]},{"results":[{"error":"invalid batch ref \"0.results.0.email\": email is not in the response of call 0","value":{"code":"invalid_batch_ref","ref":"0.results.0.email","reason":"email is not in the response of call 0"}}]},{"results":[{"error":"invalid batch ref \"3.results.0\": it must start with the index of an earlier call","value":{"code":"invalid_batch_ref","ref":"3.results.0","reason":"it must start with the index of an earlier call"}}]}]
+}
+
+// ### ReadTypeCacheStats: the metadata of a type reused by many handlers is computed once in the process
+func ExampleReadTypeCacheStats() {
+	type money struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	before := jsonhandlerfunc.ReadTypeCacheStats()
+	reg := jsonhandlerfunc.NewRegistry(&jsonhandlerfunc.Config{QueryParams: true})
+	reg.Register("charge", func(m money) (r money, err error) { return m, nil })
+	reg.Register("refund", func(m money) (r money, err error) { return m, nil })
+	reg.Register("balance", func() (r money, err error) { return })
+	reg.Schema()
+
+	after := jsonhandlerfunc.ReadTypeCacheStats()
+	fmt.Println("lookups:", after.Hits+after.Misses-before.Hits-before.Misses)
+	fmt.Println("computed at most once:", after.Misses-before.Misses <= 1)
+	//Output:
+	// lookups: 7
+	// computed at most once: true
+}
+
+// ### Registry: ToWebsocketHandler calls the registered funcs with the messages of a websocket connection
+func ExampleRegistry_ToWebsocketHandler() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("Orders.Summary", func(ctx context.Context, day string) (count int, err error) {
+		if day == "" {
+			err = jsonhandlerfunc.NewStatusCodeError(http.StatusUnprocessableEntity, errors.New("day is required"))
+			return
+		}
+		count = len(day)
+		return
+	})
+	reg.Register("Orders.Export", func() (s http.Handler, err error) {
+		s = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/csv")
+			fmt.Fprint(w, "id,total\n")
+		})
+		return
+	})
+	ts := httptest.NewServer(reg.ToWebsocketHandler(nil))
+	defer ts.Close()
+
+	conn, r := wsDial(ts.URL + "/ws")
+	defer conn.Close()
+	for _, msg := range []string{
+		`{"id": 1, "method": "Orders.Summary", "params": ["today"]}`,
+		`{"id": "b", "method": "Orders.Summary", "params": [""]}`,
+		`{"id": 3, "method": "Orders.Missing", "params": []}`,
+		`{"id": 4, "method": "Orders.Export", "params": []}`,
+	} {
+		wsWrite(conn, 0x1, []byte(msg))
+		fmt.Println(wsRead(r))
+	}
+	wsWrite(conn, 0x9, []byte("ping"))
+	fmt.Println(wsRead(r))
+
+	res, _ := http.Get(ts.URL + "/ws")
+	fmt.Println(res.StatusCode)
+	//Output:
+	// 101 s3pPLMBiTxaQ9kYGzzhZRbK+xOo=
+	// 1 {"id":1,"status":200,"results":[5,null]}
+	// 1 {"id":"b","status":422,"results":[0,{"error":"day is required","value":{}}]}
+	// 1 {"id":3,"status":404,"results":[{"error":"method Orders.Missing not found","value":{"code":"method_not_found","method":"Orders.Missing"}}]}
+	// 1 {"id":4,"status":406,"results":[{"error":"the response of text/csv can not be sent over websocket","value":{}}]}
+	// a ping
+	// 400
+}
+
+// ### Registry: ToWebsocketHandler sends the progress of ReportProgress before the response with the id of the message
+func ExampleRegistry_ToWebsocketHandler_progress() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("Orders.Import", func(ctx context.Context, rows int) (count int, err error) {
+		for i := 1; i <= rows; i++ {
+			jsonhandlerfunc.ReportProgress(ctx, float64(i*100/rows), fmt.Sprintf("row %d", i))
+		}
+		return rows, nil
+	})
+	ts := httptest.NewServer(reg.ToWebsocketHandler(nil))
+	defer ts.Close()
+
+	conn, r := wsDial(ts.URL + "/ws")
+	defer conn.Close()
+	wsWrite(conn, 0x1, []byte(`{"id": 1, "method": "Orders.Import", "params": [2]}`))
+	for i := 0; i < 3; i++ {
+		fmt.Println(wsRead(r))
+	}
+	//Output:
+	// 101 s3pPLMBiTxaQ9kYGzzhZRbK+xOo=
+	// 1 {"id":1,"progress":{"percent":50,"message":"row 1"}}
+	// 1 {"id":1,"progress":{"percent":100,"message":"row 2"}}
+	// 1 {"id":1,"status":200,"results":[2,null]}
+}
+
+// ### Registry: ToWebsocketHandler closes the connections with oversized frames, like a continuation that declares a length near 2^63
+func ExampleRegistry_ToWebsocketHandler_oversizedFrames() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("echo", func(s string) (r string, err error) {
+		return s, nil
+	})
+	ts := httptest.NewServer(reg.ToWebsocketHandler(nil))
+	defer ts.Close()
+
+	readClose := func(r *bufio.Reader) {
+		head := make([]byte, 4)
+		io.ReadFull(r, head)
+		fmt.Println(head[0]&0x0F, int(head[2])<<8|int(head[3]))
+	}
+
+	conn, r := wsDial(ts.URL + "/ws")
+	// a text frame that is not final, then a continuation of 2^63-1 bytes
+	conn.Write([]byte{0x01, 0x80 | 1, 1, 2, 3, 4, 'a' ^ 1})
+	conn.Write([]byte{0x80, 0x80 | 127, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 1, 2, 3, 4})
+	readClose(r)
+	conn.Close()
+
+	conn, r = wsDial(ts.URL + "/ws")
+	// a ping of 126 bytes, over the 125 of the control frames
+	conn.Write(append([]byte{0x89, 0x80 | 126, 0, 126, 1, 2, 3, 4}, make([]byte, 126)...))
+	readClose(r)
+	conn.Close()
+
+	conn, r = wsDial(ts.URL + "/ws")
+	defer conn.Close()
+	wsWrite(conn, 0x1, []byte(`{"id": 1, "method": "echo", "params": ["still serving"]}`))
+	fmt.Println(wsRead(r))
+	//Output:
+	// 101 s3pPLMBiTxaQ9kYGzzhZRbK+xOo=
+	// 8 1009
+	// 101 s3pPLMBiTxaQ9kYGzzhZRbK+xOo=
+	// 8 1002
+	// 101 s3pPLMBiTxaQ9kYGzzhZRbK+xOo=
+	// 1 {"id":1,"status":200,"results":["still serving",null]}
+}
+
+// wsDial opens a websocket connection to url
+func wsDial(rawURL string) (net.Conn, *bufio.Reader) {
+	u, _ := url.Parse(rawURL)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", u.Path, u.Host)
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res.StatusCode, res.Header.Get("Sec-WebSocket-Accept"))
+	return conn, r
+}
+
+// wsWrite writes a masked final frame of opcode
+func wsWrite(conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+// wsRead reads a frame of the server with a payload shorter than 64KB
+func wsRead(r *bufio.Reader) string {
+	head := make([]byte, 2)
+	io.ReadFull(r, head)
+	n := int(head[1])
+	if n == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		n = int(ext[0])<<8 | int(ext[1])
+	}
+	payload := make([]byte, n)
+	io.ReadFull(r, payload)
+	return fmt.Sprintf("%x %s", head[0]&0x0F, payload)
+}
+
+// ### Contracts: the JSON cases of a dir are run against a registry, the same cases run against a live server with the contract command
+func ExampleRunContracts() {
+	type User struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("users.get", func(id int) (u *User, err error) {
+		if id != 1 {
+			return nil, jsonhandlerfunc.NewStatusCodeError(http.StatusNotFound, fmt.Errorf("user %d not found", id))
+		}
+		return &User{ID: "u_1", Name: "felix"}, nil
+	})
+
+	dir, _ := os.MkdirTemp("", "contracts")
+	defer os.RemoveAll(dir)
+	os.WriteFile(filepath.Join(dir, "get.json"), []byte(`[
+		{
+			"name": "get a user",
+			"method": "users.get",
+			"request": {"params": [1]},
+			"response_headers": {"Content-Type": "$regex:^application/json"},
+			"response": {"results": [{"id": "$regex:^u_[0-9]+$", "name": "felix"}, null]}
+		},
+		{
+			"name": "get a missing user",
+			"method": "users.get",
+			"request": {"params": [2]},
+			"status": 404,
+			"response": {"results": [null, {"error": "$string"}]}
+		}
+	]`), 0644)
+	os.WriteFile(filepath.Join(dir, "outdated.json"), []byte(`{
+		"name": "an outdated case",
+		"method": "users.get",
+		"request": {"params": [1]},
+		"response": {"results": [{"id": "$integer", "name": "felix", "email": "$string"}, "$notnull"]}
+	}`), 0644)
+
+	cases, err := jsonhandlerfunc.LoadContracts(dir)
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range jsonhandlerfunc.RunContracts(reg, cases) {
+		fmt.Println(r)
+	}
+	//Output:
+	// PASS get.json: get a user
+	// PASS get.json: get a missing user
+	// FAIL outdated.json: an outdated case:
+	// 	results[0].email: is missing
+	// 	results[0].id: want integer, got string
+	// 	results[1]: want not null, got null
+}
+
+func ExampleRegistry_ServeSchema() {
+	type User struct {
+		ID    int64  `json:"id"`
+		Email string `json:"email"`
+	}
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("users.get", func(ctx context.Context, id int64) (u *User, err error) {
+		return &User{ID: id}, nil
+	}, jsonhandlerfunc.WithParamNames("id"))
+	reg.Register("users.rename", func(ctx context.Context, id int64, name string) (err error) {
+		return
+	})
+	reg.ServeSchema("/schema.json")
+
+	for _, url := range []string{"/schema.json?method=users.get", "/schema.json?method=users.delete"} {
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		fmt.Println(w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/schema.json", nil))
+	var s jsonhandlerfunc.Schema
+	json.NewDecoder(w.Body).Decode(&s)
+	for _, ms := range s.Methods {
+		fmt.Println(ms.Name, len(ms.Params), len(ms.Results))
+	}
+	//Output:
+	// 200 {"name":"users.get","params":[{"name":"id","type":{"kind":"integer"}}],"results":[{"type":{"name":"User","kind":"object","nullable":true,"fields":[{"name":"id","type":{"kind":"integer"}},{"name":"email","type":{"kind":"string"}}]}}]}
+	// 404 {"error":"method users.delete is not registered"}
+	// users.get 1 1
+	// users.rename 2 0
+}
+
+// ### Registry: Warm fills WithResponseCache with GET requests, so the first clients already hit the cache
+func ExampleRegistry_Warm_responseCache() {
+	type listParams struct {
+		Limit int `json:"limit"`
+	}
+	var calls int
+	cache := jsonhandlerfunc.NewResponseCache()
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("products.List", func(params listParams) (r []string, err error) {
+		calls++
+		for i := 1; i <= params.Limit; i++ {
+			r = append(r, fmt.Sprintf("product %d", i))
+		}
+		return
+	}, jsonhandlerfunc.WithCacheableGET(time.Minute), jsonhandlerfunc.WithResponseCache(cache), jsonhandlerfunc.WithQueryParams("limit"))
+	reg.Register("products.Get", func(id string) (r string, err error) {
+		calls++
+		return "product " + id, nil
+	}, jsonhandlerfunc.WithCacheableGET(time.Minute), jsonhandlerfunc.WithResponseCache(cache))
+
+	for _, res := range reg.Warm(context.Background(), []jsonhandlerfunc.WarmSpec{
+		{Method: "products.List", Query: url.Values{"limit": {"2"}}},
+		{Method: "products.Get", Params: []interface{}{"1"}},
+	}) {
+		fmt.Println(res.Method, res.StatusCode, res.Err)
+	}
+	q, _ := jsonhandlerfunc.EncodeQueryEnvelope("1")
+	for _, target := range []string{"/products.List?limit=2", "/products.Get?q=" + q} {
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		fmt.Println(w.Header().Get(jsonhandlerfunc.CacheStatusHeader), strings.TrimSpace(w.Body.String()))
+	}
+	fmt.Println("calls:", calls)
+	//Output:
+	// products.List 200 <nil>
+	// products.Get 200 <nil>
+	// HIT {"results":[["product 1","product 2"],null]}
+	// HIT {"results":["product 1",null]}
+	// calls: 2
+}
+
+// ### Registry: RegisterInterface panics with what to pass when the type argument is not an interface
+func ExampleRegisterInterface_notInterface() {
+	defer func() {
+		fmt.Println(recover())
+	}()
+	jsonhandlerfunc.RegisterInterface[greetingService](greetingService{})
+	//Output:
+	// RegisterInterface type argument jsonhandlerfunc_test.greetingService is not an interface, pass the interface like RegisterInterface[UserService](impl)
+}
+
+type apiNode struct {
+	Name     string     `json:"name"`
+	Children []*apiNode `json:"children,omitempty"`
+}
+
+// ### Registry.ServeOpenAPI: serve the OpenAPI document of the registered funcs
+func ExampleRegistry_ServeOpenAPI() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("tree", func(depth int) (r *apiNode, err error) {
+		return
+	}, jsonhandlerfunc.WithParamNames("depth"), jsonhandlerfunc.RequireAuthenticated())
+	reg.ServeOpenAPI("/api/openapi.json", jsonhandlerfunc.OpenAPIInfo{Title: "Tree", Version: "1.0"})
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/api/openapi.json")
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+	var doc struct {
+		OpenAPI    string
+		Components json.RawMessage
+		Paths      map[string]struct {
+			Post struct {
+				RequestBody   json.RawMessage
+				Responses     json.RawMessage
+				Preconditions []string `json:"x-preconditions"`
+			}
+		}
+	}
+	json.NewDecoder(res.Body).Decode(&doc)
+	op := doc.Paths["/tree"].Post
+	fmt.Println(doc.OpenAPI, op.Preconditions)
+	fmt.Println(string(op.RequestBody))
+	fmt.Println(string(op.Responses))
+	fmt.Println(string(doc.Components))
+	//Output:
+	// 3.1.0 [authenticated]
+	// {"content":{"application/json":{"schema":{"properties":{"params":{"maxItems":1,"minItems":1,"prefixItems":[{"allOf":[{"type":"integer"}],"title":"depth"}],"type":"array"}},"type":"object"}}},"required":true}
+	// {"default":{"content":{"application/json":{"schema":{"properties":{"results":{"maxItems":2,"minItems":2,"prefixItems":[{"anyOf":[{"$ref":"#/components/schemas/apiNode"},{"type":"null"}]},{"properties":{"error":{"type":"string"},"value":{}},"type":["object","null"]}],"type":"array"}},"type":"object"}}},"description":"the results with the error as the last one"}}
+	// {"schemas":{"apiNode":{"properties":{"children":{"items":{"anyOf":[{"$ref":"#/components/schemas/apiNode"},{"type":"null"}]},"type":"array"},"name":{"type":"string"}},"required":["name"],"type":"object"}}}
+}
+
+type Cookie struct {
+	Value string `json:"value"`
+}
+
+// ### Registry.OpenAPI: the components of the types of the same name in different packages
+func ExampleRegistry_OpenAPI_sameNames() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("setCookie", func(c Cookie, hc *http.Cookie) (err error) {
+		return
+	})
+
+	doc := reg.OpenAPI(jsonhandlerfunc.OpenAPIInfo{Title: "Cookies", Version: "1.0"})
+	params, _ := json.Marshal(doc["paths"].(map[string]interface{})["/setCookie"])
+	var op struct {
+		Post struct {
+			RequestBody struct {
+				Content struct {
+					JSON struct {
+						Schema struct {
+							Properties struct {
+								Params struct {
+									PrefixItems json.RawMessage
+								}
+							}
+						}
+					} `json:"application/json"`
+				}
+			}
+		}
+	}
+	json.Unmarshal(params, &op)
+	fmt.Println(string(op.Post.RequestBody.Content.JSON.Schema.Properties.Params.PrefixItems))
+	var names []string
+	for name := range doc["components"].(map[string]interface{})["schemas"].(map[string]interface{}) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println(names)
+	//Output:
+	// [{"$ref":"#/components/schemas/Cookie"},{"anyOf":[{"$ref":"#/components/schemas/http.Cookie"},{"type":"null"}]}]
+	// [Cookie http.Cookie]
+}
+
+type counterService struct {
+	n int
+}
+
+func (s *counterService) Add(ctx context.Context, delta int) (r int, err error) {
+	s.n += delta
+	r = s.n
+	return
+}
+
+func (s *counterService) Reset() (err error) {
+	s.n = 0
+	return
+}
+
+func (s *counterService) String() string {
+	return fmt.Sprint(s.n)
+}
+
+// ### Registry.RegisterService: register every method of a struct
+func ExampleRegistry_RegisterService() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.RegisterService(&counterService{})
+	fmt.Println(reg.Methods())
+
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+	client := jsonhandlerfunc.NewClient(ts.URL)
+	var n int
+	client.Call(context.Background(), "counterService.Add", []interface{}{2}, &n)
+	client.Call(context.Background(), "counterService.Add", []interface{}{3}, &n)
+	fmt.Println(n)
+
+	hfs := jsonhandlerfunc.ToHandlerFuncs(&counterService{n: 10})
+	fmt.Println(len(hfs), httpPostJSON(hfs["Add"], `{"params": [1]}`))
+	//Output:
+	// [counterService.Add counterService.Reset]
+	// 5
+	// 2 {"results":[11,null]}
+}
+
+// ### Registry.Fallback: proxy the unknown methods to the old backend
+func ExampleRegistry_Fallback() {
+	oldReg := jsonhandlerfunc.NewRegistry(nil)
+	oldReg.Register("hello", func(name string) (r string, err error) {
+		r = "old hello " + name
+		return
+	})
+	oldTs := httptest.NewServer(oldReg)
+	defer oldTs.Close()
+	oldClient := jsonhandlerfunc.NewClient(oldTs.URL)
+
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("bye", func(name string) (r string, err error) {
+		r = "new bye " + name
+		return
+	})
+	reg.Fallback(func(ctx context.Context, method string, rawParams []json.RawMessage) (results []interface{}, err error) {
+		params := make([]interface{}, len(rawParams))
+		for i, p := range rawParams {
+			params[i] = p
+		}
+		var r json.RawMessage
+		err = oldClient.Call(ctx, method, params, &r)
+		results = []interface{}{r}
+		return
+	})
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	client := jsonhandlerfunc.NewClient(ts.URL)
+	for _, method := range []string{"hello", "bye", "unknown"} {
+		var r string
+		err := client.Call(context.Background(), method, []interface{}{"Gates"}, &r)
+		fmt.Println(r, err)
+	}
+	//Output:
+	// old hello Gates <nil>
+	// new bye Gates <nil>
+	//  method unknown not found
+}
+
+type printSink struct{}
+
+func (printSink) Send(ctx context.Context, rec *jsonhandlerfunc.TeeRecord) error {
+	fmt.Println(rec.Method, rec.StatusCode, string(rec.Request), string(rec.Response))
+	return nil
+}
+
+// ### Tee: copies of the envelopes are sent to an analytics sink asynchronously
+func ExampleWithTee() {
+	tee := jsonhandlerfunc.NewTee(printSink{}, 10)
+	tee.Redact = func(rec *jsonhandlerfunc.TeeRecord) {
+		rec.Request = jsonhandlerfunc.RedactJSON(rec.Request, "password")
+	}
+
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Inject(jsonhandlerfunc.WithTee(tee))
+	reg.Register("login", func(form struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}) (ok bool, err error) {
+		ok = form.Password == "secret"
+		return
+	})
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	http.Post(ts.URL+"/login", "application/json", strings.NewReader(`{"params": [{"name": "felix", "password": "secret"}]}`))
+	tee.Close()
+	fmt.Printf("%+v\n", tee.Stats())
+	//Output:
+	// login 200 {"params":[{"name":"felix","password":"[REDACTED]"}]} {"results":[true,null]}
+	// {Sent:1 Dropped:0 Failed:0}
+}
+
+type formUser struct {
+	Name    string    `json:"name" label:"Full name" doc:"as shown on the profile"`
+	Status  string    `json:"status" enum:"active,inactive"`
+	Tags    []string  `json:"tags,omitempty"`
+	Birth   time.Time `json:"birth_date"`
+	Manager *formUser `json:"manager"`
+}
+
+// ### Handler.FormDescriptor: forms of the params for admin UIs, responded to OPTIONS
+func ExampleHandler_FormDescriptor() {
+	reg := jsonhandlerfunc.NewRegistry(&jsonhandlerfunc.Config{ServeFormDescriptors: true})
+	reg.Register("createUser", func(user *formUser, notify bool) (err error) {
+		return
+	}, jsonhandlerfunc.WithParamNames("user", "notifyByEmail"))
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/createUser", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+	var fd jsonhandlerfunc.FormDescriptor
+	json.NewDecoder(res.Body).Decode(&fd)
+	out, _ := json.MarshalIndent(fd, "", "  ")
+	fmt.Println(res.Header.Get("Allow"))
+	fmt.Println(string(out))
+	//Output:
+	// POST, OPTIONS
+	// {
+	//   "params": [
+	//     {
+	//       "name": "user",
+	//       "label": "User",
+	//       "type": "object",
+	//       "required": false,
+	//       "fields": [
+	//         {
+	//           "name": "name",
+	//           "label": "Full name",
+	//           "doc": "as shown on the profile",
+	//           "type": "string",
+	//           "required": true
+	//         },
+	//         {
+	//           "name": "status",
+	//           "label": "Status",
+	//           "type": "string",
+	//           "required": true,
+	//           "enum": [
+	//             "active",
+	//             "inactive"
+	//           ]
+	//         },
+	//         {
+	//           "name": "tags",
+	//           "label": "Tags",
+	//           "type": "array",
+	//           "required": false,
+	//           "elem": {
+	//             "type": "string",
+	//             "required": true
+	//           }
+	//         },
+	//         {
+	//           "name": "birth_date",
+	//           "label": "Birth date",
+	//           "type": "date-time",
+	//           "required": true
+	//         },
+	//         {
+	//           "name": "manager",
+	//           "label": "Manager",
+	//           "type": "object",
+	//           "required": false
+	//         }
+	//       ]
+	//     },
+	//     {
+	//       "name": "notifyByEmail",
+	//       "label": "Notify by email",
+	//       "type": "boolean",
+	//       "required": true
+	//     }
+	//   ]
+	// }
+}
+
+// ### Registry.ServeDiagnostics: runtime stats of the handlers as json for scraping
+func ExampleRegistry_ServeDiagnostics() {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	reg.Register("export", func() (err error) {
+		close(started)
+		<-release
+		return
+	})
+	reg.Register("ping", func() (r string, err error) {
+		r = "pong"
+		return
+	}, jsonhandlerfunc.WithPanicIsolation(jsonhandlerfunc.PanicIsolation{}))
+	consumer := &jsonhandlerfunc.QueueConsumer{Registry: reg, Queue: jsonhandlerfunc.NewChanQueue(1), Concurrency: 4}
+	reg.AddDiagnostics("queue", func() interface{} { return consumer.Stats() })
+	reg.ServeDiagnostics("/debug/jsonhandlerfunc")
+	ts := httptest.NewServer(reg)
+	defer ts.Close()
+
+	http.Post(ts.URL+"/ping", "application/json", nil)
+	go http.Post(ts.URL+"/export", "application/json", nil)
+	<-started
+
+	res, err := http.Get(ts.URL + "/debug/jsonhandlerfunc")
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+	var d jsonhandlerfunc.Diagnostics
+	json.NewDecoder(res.Body).Decode(&d)
+	close(release)
+	handlers, _ := json.Marshal(d.Handlers)
+	extra, _ := json.Marshal(d.Extra)
+	fmt.Println(string(handlers))
+	fmt.Println(string(extra))
+	//Output:
+	// {"export":{"in_flight":1,"calls":1},"ping":{"in_flight":0,"calls":1,"panics":{"calls":1,"panics":0,"rate":0,"disabled":false,"restarts":0}}}
+	// {"queue":{"busy":0,"concurrency":4,"dead_lettered":0,"failed":0,"handled":0}}
+}
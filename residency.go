@@ -0,0 +1,98 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WrongRegionCode is the code of WrongRegionError
+const WrongRegionCode = "wrong_region"
+
+// WrongRegionError is responded with 421 when the data of the request is in another region, Endpoint is where to send it again.
+type WrongRegionError struct {
+	Code   string `json:"code"`
+	Region string `json:"region"`
+	// Endpoint is the URL of the request at the deployment of Region
+	Endpoint string `json:"endpoint"`
+}
+
+func (e *WrongRegionError) Error() string {
+	return fmt.Sprintf("the data is in region %s, send the request to %s", e.Region, e.Endpoint)
+}
+
+func (e *WrongRegionError) StatusCode() int {
+	return http.StatusMisdirectedRequest
+}
+
+// ResidencyBlockedCode is the code of ResidencyBlockedError
+const ResidencyBlockedCode = "residency_blocked"
+
+// ResidencyBlockedError is responded with 451 when the data of the request is in a region that no deployment serves.
+type ResidencyBlockedError struct {
+	Code   string `json:"code"`
+	Region string `json:"region"`
+}
+
+func (e *ResidencyBlockedError) Error() string {
+	return fmt.Sprintf("the data in region %s can not be served", e.Region)
+}
+
+func (e *ResidencyBlockedError) StatusCode() int {
+	return http.StatusUnavailableForLegalReasons
+}
+
+/*
+Residency routes the requests by the data residency of their tenants for the split deployments by region,
+it's checked after the injectors and before the func, so the region can be of the injected tenant:
+
+	cfg := &jsonhandlerfunc.Config{
+		Residency: &jsonhandlerfunc.Residency{
+			Region: os.Getenv("REGION"),
+			RegionOf: func(state *jsonhandlerfunc.RequestState) (region string, err error) {
+				var t *Tenant
+				if state.Lookup(&t) {
+					region = t.Region
+				}
+				return
+			},
+			Endpoints: map[string]string{
+				"eu": "https://eu.api.example.com",
+				"us": "https://us.api.example.com",
+			},
+		},
+	}
+
+The requests of another region are rejected with WrongRegionError of 421 with the endpoint to send them to,
+and the ones of a region without an endpoint with ResidencyBlockedError of 451, without calling the func.
+*/
+type Residency struct {
+	// Region is the region of this deployment, like "eu".
+	Region string
+	// RegionOf returns the region the data of the request must stay in, empty serves the request in this deployment.
+	// An error is responded instead of calling the func.
+	RegionOf func(state *RequestState) (region string, err error)
+	// Endpoints are the base URLs of the deployments by region, the path of the request is appended to it for WrongRegionError.
+	Endpoints map[string]string
+}
+
+// checkResidency checks Config.Residency after the injectors, like checkQuota.
+func (cfg *Config) checkResidency(r *http.Request) (err error) {
+	res := cfg.Residency
+	if res == nil || res.RegionOf == nil {
+		return
+	}
+	region, err := res.RegionOf(RequestStateOf(r.Context()))
+	if err != nil || region == "" || region == res.Region {
+		return
+	}
+	endpoint, ok := res.Endpoints[region]
+	if !ok {
+		return &ResidencyBlockedError{Code: ResidencyBlockedCode, Region: region}
+	}
+	return &WrongRegionError{
+		Code:     WrongRegionCode,
+		Region:   region,
+		Endpoint: strings.TrimSuffix(endpoint, "/") + r.URL.RequestURI(),
+	}
+}
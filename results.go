@@ -0,0 +1,113 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+PositionalResultsHeader asks for the results array of the handlers of WithResultNames, for the clients that read the results by index,
+Client and the TypeScript client of GenerateTS send "X-Jsonhf-Positional-Results: 1".
+*/
+const PositionalResultsHeader = "X-Jsonhf-Positional-Results"
+
+// resultName is a name of WithResultNames, omitEmpty is of the ",omitempty" suffix
+type resultName struct {
+	name      string
+	omitEmpty bool
+}
+
+/*
+WithResultNames names the func's results before the error in order, and responds them as an object keyed by the names,
+with the error at "error", instead of the array that clients read by index:
+
+	jsonhandlerfunc.ToHandlerFunc(getOrder, jsonhandlerfunc.WithResultNames("order", "shipment,omitempty", "invoices"))
+
+	{"results": {"order": {...}, "invoices": [...], "error": null}}
+
+A name with ",omitempty" omits the result when it's empty like encoding/json does, so a nil pointer is not responded as null.
+The names are also of the schemas and clients generated from the handler. The requests with PositionalResultsHeader,
+the compact envelope and Config.ResponseShape keep the results array.
+*/
+func WithResultNames(names ...string) Option {
+	var rns []resultName
+	seen := map[string]bool{}
+	for _, name := range names {
+		n, opt, _ := strings.Cut(name, ",")
+		if n == "" || n == "error" || seen[n] {
+			panic(fmt.Sprintf("result name %q is empty, error or duplicated.", n))
+		}
+		seen[n] = true
+		rns = append(rns, resultName{name: n, omitEmpty: opt == "omitempty"})
+	}
+	return func(opts *handlerOptions) {
+		if opts.resultNames != nil {
+			opts.conflict("WithResultNames is passed more than once, keep one of them")
+		}
+		opts.resultNames = rns
+	}
+}
+
+func (opts *handlerOptions) checkResultNames(ft reflect.Type) {
+	if opts.resultNames == nil {
+		return
+	}
+	if count := ft.NumOut() - 1; len(opts.resultNames) != count {
+		panic(fmt.Sprintf("WithResultNames has %d names, but %s has %d results before the error", len(opts.resultNames), ft, count))
+	}
+}
+
+// resultsObject is the results of WithResultNames, encoded as an object in the order of the names, noEscapeHTML is of Config.DisableHTMLEscape.
+type resultsObject struct {
+	names        []resultName
+	outs         []interface{}
+	noEscapeHTML bool
+}
+
+func (opts *handlerOptions) namedResults(r *http.Request) []resultName {
+	if opts.resultNames == nil || r.Header.Get(PositionalResultsHeader) == "1" {
+		return nil
+	}
+	return opts.resultNames
+}
+
+// toResultsObject is out as a resultsObject if it's the results and the error of the names.
+func toResultsObject(names []resultName, out interface{}, noEscapeHTML bool) interface{} {
+	outs, ok := out.([]interface{})
+	if names == nil || !ok || len(outs) != len(names)+1 {
+		return out
+	}
+	return &resultsObject{names: names, outs: outs, noEscapeHTML: noEscapeHTML}
+}
+
+func (o *resultsObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(!o.noEscapeHTML)
+	buf.WriteByte('{')
+	for i, out := range o.outs {
+		name := "error"
+		if i < len(o.names) {
+			name = o.names[i].name
+			if o.names[i].omitEmpty && (out == nil || isEmptyValue(reflect.ValueOf(out))) {
+				continue
+			}
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		enc.Encode(name)
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		if err := enc.Encode(out); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,151 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// AttemptsMetaKey is the response meta key of how many times the func was called when WithAutoRetry retried it.
+const AttemptsMetaKey = "attempts"
+
+// RetryRecorder is implemented by a Config.Metrics that records the retries of WithAutoRetry, like the Collector of the metrics package.
+type RetryRecorder interface {
+	// Retry is called before the func is called again, attempt is the number of the failed call, from 1.
+	Retry(funcName string, attempt int, err error)
+}
+
+const (
+	// retryBudgetRatio of the calls can be retried
+	retryBudgetRatio = 0.2
+	// retryBudgetReserve retries can be done at once before the calls fill the budget
+	retryBudgetReserve = 10
+)
+
+type autoRetry struct {
+	n           int
+	backoff     func(attempt int) time.Duration
+	isRetryable func(err error) bool
+	budget      *retryBudget
+}
+
+/*
+WithAutoRetry calls the func again up to n times when it returns a retryable error, waiting backoff(attempt) before
+the next call, for flaky downstreams of idempotent funcs, so clients don't see the transient 5xx. Only pass it for
+idempotent funcs, which are called again with the same params:
+
+	jsonhandlerfunc.ToHandlerFunc(getRates, jsonhandlerfunc.WithAutoRetry(2, jsonhandlerfunc.ExponentialBackoff(50*time.Millisecond, time.Second), nil))
+
+isRetryable defaults to IsTransientError, and backoff defaults to no wait. The retries of a handler are limited by
+its budget of 20% of its calls, with a reserve of 10, so retries don't multiply the load of a dependency that is down,
+and they stop at the deadline of the request. The calls are counted by AttemptsMetaKey in the response meta when retried,
+and by a Config.Metrics that is a RetryRecorder.
+*/
+func WithAutoRetry(n int, backoff func(attempt int) time.Duration, isRetryable func(err error) bool) Option {
+	if n < 1 {
+		panic("auto retry times must be at least 1.")
+	}
+	if isRetryable == nil {
+		isRetryable = IsTransientError
+	}
+	return func(opts *handlerOptions) {
+		if opts.autoRetry != nil {
+			opts.conflict("WithAutoRetry is passed more than once, keep one of them")
+		}
+		opts.autoRetry = &autoRetry{n: n, backoff: backoff, isRetryable: isRetryable, budget: &retryBudget{tokens: retryBudgetReserve}}
+	}
+}
+
+// ExponentialBackoff waits base before the first retry, and doubles it for every retry after, up to max.
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// IsTransientError reports if err is of a status code 502, 503 or 504, or a net.Error that is a timeout.
+func IsTransientError(err error) bool {
+	switch statusCodeOf(err, 0) {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	te, ok := err.(interface{ Timeout() bool })
+	return ok && te.Timeout()
+}
+
+/*
+call calls the func with callWithDeadline of ctx, and again while its error is retryable, c.attempts is how many times it's called.
+A panic or the deadline of the request is never retried.
+*/
+func (ar *autoRetry) call(ctx context.Context, c *handlerCall, h *Handler, inVals []reflect.Value) (outVals []reflect.Value, err error) {
+	ar.budget.deposit()
+	for c.attempts = 1; ; c.attempts++ {
+		outVals, err = callWithDeadline(ctx, c.start, h.v, inVals)
+		if err != nil {
+			return
+		}
+		funcErr, _ := outVals[len(outVals)-1].Interface().(error)
+		if funcErr == nil || c.attempts > ar.n || !ar.isRetryable(funcErr) || !ar.budget.withdraw() {
+			return
+		}
+		if !ar.wait(ctx, c.attempts) {
+			return
+		}
+		if rr, ok := h.cfg.Metrics.(RetryRecorder); ok {
+			rr.Retry(funcName(h.v), c.attempts, funcErr)
+		}
+	}
+}
+
+// wait waits the backoff of attempt, false if ctx is done before that.
+func (ar *autoRetry) wait(ctx context.Context, attempt int) bool {
+	var d time.Duration
+	if ar.backoff != nil {
+		d = ar.backoff(attempt)
+	}
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryBudget is a token bucket, every call deposits retryBudgetRatio, and every retry withdraws one.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += retryBudgetRatio
+	if b.tokens > retryBudgetReserve {
+		b.tokens = retryBudgetReserve
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
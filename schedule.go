@@ -0,0 +1,284 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule returns the next time after t to run
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a cron expression of 5 fields "minute hour day-of-month month day-of-week",
+// each field is *, a number, a range a-b, a list a,b and a step */n or a-b/n,
+// or a descriptor: @yearly, @monthly, @weekly, @daily, @hourly, or @every <duration> like @every 5m.
+func ParseSchedule(spec string) (s Schedule, err error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		var d time.Duration
+		d, err = time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q: duration must be positive", spec)
+		}
+		return everySchedule(d), nil
+	}
+
+	if descriptor, ok := scheduleDescriptors[spec]; ok {
+		spec = descriptor
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: must have 5 fields", spec)
+	}
+
+	cs := &cronSchedule{}
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&cs.minute, 0, 59},
+		{&cs.hour, 0, 23},
+		{&cs.dom, 1, 31},
+		{&cs.month, 1, 12},
+		{&cs.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		*b.set, err = parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %s", spec, err)
+		}
+	}
+	// 7 is also Sunday
+	if cs.dow&(1<<7) != 0 {
+		cs.dow |= 1
+	}
+	cs.domStar = fields[2] == "*"
+	cs.dowStar = fields[4] == "*"
+	return cs, nil
+}
+
+var scheduleDescriptors = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+func parseCronField(field string, min, max int) (set uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid number in %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid number in %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func (cs *cronSchedule) has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := cs.has(cs.dom, t.Day())
+	dowMatch := cs.has(cs.dow, int(t.Weekday()))
+	if cs.domStar || cs.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+/*
+Next steps the wall clock fields in the location of t with time.Date, since Truncate is of the absolute time,
+which is not of the wall clock in the zones of a non-whole-hour offset, like UTC+5:30.
+*/
+func (cs *cronSchedule) Next(t time.Time) time.Time {
+	t = wallClock(t, t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !cs.has(cs.month, int(t.Month())) {
+			t = wallClock(t, t.Year(), t.Month()+1, 1, 0, 0)
+			continue
+		}
+		if !cs.dayMatches(t) {
+			t = wallClock(t, t.Year(), t.Month(), t.Day()+1, 0, 0)
+			continue
+		}
+		if !cs.has(cs.hour, t.Hour()) {
+			t = wallClock(t, t.Year(), t.Month(), t.Day(), t.Hour()+1, 0)
+			continue
+		}
+		if !cs.has(cs.minute, t.Minute()) {
+			t = wallClock(t, t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// wallClock is the time of the wall clock fields in the location of t, a minute after t if the fields are not after t, like at the end of DST.
+func wallClock(t time.Time, year int, month time.Month, day, hour, min int) time.Time {
+	next := time.Date(year, month, day, hour, min, 0, 0, t.Location())
+	if !next.After(t) {
+		next = t.Add(time.Minute)
+	}
+	return next
+}
+
+// ScheduledJob invokes the registered Method with Params on the cron expression Spec
+type ScheduledJob struct {
+	Spec   string
+	Method string
+	Params []interface{}
+}
+
+/*
+Scheduler invokes registered funcs of Registry on schedules with Invoke,
+so maintenance endpoints don't need a separate job framework.
+*/
+type Scheduler struct {
+	Registry *Registry
+	Jobs     []ScheduledJob
+	// Location of the cron expressions, default is time.Local
+	Location *time.Location
+	// OnFailure is called when a job returns an error, for alerting, default logs the error.
+	OnFailure func(job ScheduledJob, err error)
+	// OnResult is called after every run of a job
+	OnResult func(job ScheduledJob, results []interface{}, err error)
+}
+
+/*
+Run runs the jobs until ctx is done, a job is skipped if its last run is not finished yet.
+It returns an error without running any job if any of the Specs is invalid.
+*/
+func (s *Scheduler) Run(ctx context.Context) (err error) {
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	schedules := make([]Schedule, len(s.Jobs))
+	for i, job := range s.Jobs {
+		schedules[i], err = ParseSchedule(job.Spec)
+		if err != nil {
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	running := make([]bool, len(s.Jobs))
+	var mu sync.Mutex
+
+	now := time.Now().In(loc)
+	nexts := make([]time.Time, len(s.Jobs))
+	for i, schedule := range schedules {
+		nexts[i] = schedule.Next(now)
+	}
+
+	for {
+		earliest := -1
+		for i, next := range nexts {
+			if !next.IsZero() && (earliest < 0 || next.Before(nexts[earliest])) {
+				earliest = i
+			}
+		}
+		if earliest < 0 {
+			<-ctx.Done()
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(nexts[earliest]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		i := earliest
+		nexts[i] = schedules[i].Next(time.Now().In(loc))
+		mu.Lock()
+		if running[i] {
+			mu.Unlock()
+			continue
+		}
+		running[i] = true
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(job ScheduledJob) {
+			defer func() {
+				mu.Lock()
+				running[i] = false
+				mu.Unlock()
+				wg.Done()
+			}()
+			s.run(ctx, job)
+		}(s.Jobs[i])
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job ScheduledJob) {
+	results, err := s.Registry.Invoke(ctx, job.Method, job.Params...)
+	if s.OnResult != nil {
+		s.OnResult(job, results, err)
+	}
+	if err == nil {
+		return
+	}
+	if s.OnFailure != nil {
+		s.OnFailure(job, err)
+		return
+	}
+	log.Printf("jsonhandlerfunc: scheduled job %s %s error: %s\n", job.Spec, job.Method, err)
+}
@@ -0,0 +1,80 @@
+package jsonhandlerfunc_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/theplant/jsonhandlerfunc"
+)
+
+// ### Schedule: invoke the registered funcs on cron expressions
+func ExampleParseSchedule() {
+	from := time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)
+	for _, spec := range []string{"*/15 * * * *", "0 3 * * 1-5", "0 0 1 */3 *", "@daily", "@every 90s", "0 25 * * *"} {
+		s, err := jsonhandlerfunc.ParseSchedule(spec)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(spec, "=>", s.Next(from).Format(time.RFC3339))
+	}
+	//Output:
+	// */15 * * * * => 2024-01-31T10:45:00Z
+	// 0 3 * * 1-5 => 2024-02-01T03:00:00Z
+	// 0 0 1 */3 * => 2024-04-01T00:00:00Z
+	// @daily => 2024-02-01T00:00:00Z
+	// @every 90s => 2024-01-31T10:31:30Z
+	// invalid schedule "0 25 * * *": "25" is out of range 0-23
+}
+
+func ExampleParseSchedule_location() {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	s, _ := jsonhandlerfunc.ParseSchedule("0 12 * * *")
+	fmt.Println(s.Next(time.Date(2024, 1, 31, 10, 30, 0, 0, kolkata)).Format(time.RFC3339))
+	s, _ = jsonhandlerfunc.ParseSchedule("30 * * * *")
+	fmt.Println(s.Next(time.Date(2024, 1, 31, 10, 30, 0, 0, kolkata)).Format(time.RFC3339))
+	//Output:
+	// 2024-01-31T12:00:00+05:30
+	// 2024-01-31T11:30:00+05:30
+}
+
+func ExampleScheduler() {
+	reg := jsonhandlerfunc.NewRegistry(nil)
+	var runs int
+	reg.Register("cleanup", func(ctx context.Context, days int) (deleted int, err error) {
+		runs++
+		if runs == 2 {
+			err = fmt.Errorf("database is locked")
+			return
+		}
+		deleted = days * 10
+		return
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := 0
+	s := &jsonhandlerfunc.Scheduler{
+		Registry: reg,
+		Jobs: []jsonhandlerfunc.ScheduledJob{
+			{Spec: "@every 10ms", Method: "cleanup", Params: []interface{}{30}},
+		},
+		OnResult: func(job jsonhandlerfunc.ScheduledJob, results []interface{}, err error) {
+			fmt.Println(job.Method, results, err)
+			done++
+			if done == 3 {
+				cancel()
+			}
+		},
+		OnFailure: func(job jsonhandlerfunc.ScheduledJob, err error) {
+			fmt.Println("alert:", job.Method, err)
+		},
+	}
+	fmt.Println(s.Run(ctx))
+	//Output:
+	// cleanup [300] <nil>
+	// cleanup [0] database is locked
+	// alert: cleanup database is locked
+	// cleanup [300] <nil>
+	// <nil>
+}
@@ -0,0 +1,270 @@
+package jsonhandlerfunc
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+Schema describes the registered methods, derived from the funcs by reflection,
+snapshots of it are diffed with DiffSchemas to see what's changed between releases.
+*/
+type Schema struct {
+	Methods []*MethodSchema `json:"methods"`
+}
+
+// MethodSchema describes the envelope of a method, the injected params are not in Params.
+type MethodSchema struct {
+	Name     string         `json:"name"`
+	Params   []*FieldSchema `json:"params"`
+	Sections []*FieldSchema `json:"sections,omitempty"`
+	Results  []*FieldSchema `json:"results"`
+	// NamedResults is true when the results are responded as an object keyed by their names, see WithResultNames.
+	NamedResults     bool           `json:"named_results,omitempty"`
+	RequiredHeaders  []string       `json:"required_headers,omitempty"`
+	MinClientVersion string         `json:"min_client_version,omitempty"`
+	Preconditions    []Precondition `json:"preconditions,omitempty"`
+}
+
+// FieldSchema is a named value, a param, a result or a struct field, Name of params is set with WithParamNames.
+type FieldSchema struct {
+	Name     string      `json:"name,omitempty"`
+	Type     *TypeSchema `json:"type"`
+	Optional bool        `json:"optional,omitempty"`
+}
+
+/*
+TypeSchema is the json type of a Go type, Kind is one of
+"string", "integer", "number", "boolean", "array", "object" and "any".
+Elem is set for arrays and maps, which are objects without Fields, and Fields for structs.
+A struct that refers to itself is described only by its Name inside itself.
+*/
+type TypeSchema struct {
+	Name     string         `json:"name,omitempty"`
+	Kind     string         `json:"kind"`
+	Format   string         `json:"format,omitempty"`
+	Nullable bool           `json:"nullable,omitempty"`
+	Elem     *TypeSchema    `json:"elem,omitempty"`
+	Fields   []*FieldSchema `json:"fields,omitempty"`
+
+	// typ of the named type, to tell apart the types of the same Name in different packages
+	typ reflect.Type
+}
+
+// Schema of the registered methods sorted by name
+func (reg *Registry) Schema() *Schema {
+	s := &Schema{Methods: []*MethodSchema{}}
+	for _, name := range reg.Methods() {
+		s.Methods = append(s.Methods, reg.handlers[name].schema(name))
+	}
+	return s
+}
+
+/*
+ServeSchema serves the Schema of the registered methods as json at the url path with GET, like /api/schema.json,
+for the API gateways and the contract tests to read what each method expects, like gRPC reflection.
+path?method=users.get serves the MethodSchema of one method, or 404 if it's not registered.
+It's described when requested, so the methods registered later are in it. Protect it with Use middleware like the other methods if needed.
+*/
+func (reg *Registry) ServeSchema(path string) {
+	reg.schemaPath = path
+}
+
+func (reg *Registry) serveSchema(w http.ResponseWriter, r *http.Request) bool {
+	if reg.schemaPath == "" || r.URL.Path != reg.schemaPath || r.Method != http.MethodGet {
+		return false
+	}
+	var next http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var v interface{} = reg.Schema()
+		if name := r.URL.Query().Get("method"); name != "" {
+			h, ok := reg.handlers[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("method %s is not registered", name)})
+				return
+			}
+			v = h.schema(name)
+		}
+		json.NewEncoder(w).Encode(v)
+	})
+	for i := len(reg.middleware) - 1; i >= 0; i-- {
+		next = reg.middleware[i](next)
+	}
+	next.ServeHTTP(w, r)
+	return true
+}
+
+// method returns the schema of the method, nil if it's not in s or s is nil.
+func (s *Schema) method(name string) *MethodSchema {
+	if s == nil {
+		return nil
+	}
+	for _, ms := range s.Methods {
+		if ms.Name == name {
+			return ms
+		}
+	}
+	return nil
+}
+
+func (h *Handler) schema(name string) *MethodSchema {
+	ms := &MethodSchema{
+		Name:             name,
+		Params:           []*FieldSchema{},
+		Results:          []*FieldSchema{},
+		RequiredHeaders:  h.opts.requiredHeaders,
+		MinClientVersion: h.opts.minClientVersion,
+		Preconditions:    h.opts.preconditions,
+	}
+
+	if h.callable != nil {
+		// the params and results of a Callable are not known
+		return ms
+	}
+	if h.firstIsAlsoInjector {
+		for _, inj := range h.argsInjectors {
+			ms.Results = append(ms.Results, resultSchemas(reflect.TypeOf(inj))...)
+		}
+		return ms
+	}
+
+	injected := injectedCount(h.argsInjectors)
+	for i := injected; i < h.ft.NumIn(); i++ {
+		f := &FieldSchema{Type: cachedTypeSchema(h.ft.In(i))}
+		if h.opts.paramNames != nil {
+			f.Name = h.opts.paramNames[i-injected]
+		}
+		if section, ok := h.opts.envelopeSections[i]; ok {
+			f.Name = section
+			ms.Sections = append(ms.Sections, f)
+			continue
+		}
+		ms.Params = append(ms.Params, f)
+	}
+	ms.Results = resultSchemas(h.ft)
+	for i, rn := range h.opts.resultNames {
+		ms.Results[i].Name = rn.name
+		ms.Results[i].Optional = rn.omitEmpty
+		ms.NamedResults = true
+	}
+	return ms
+}
+
+// resultSchemas of the func's results, except the last error which is in every envelope.
+func resultSchemas(ft reflect.Type) (fs []*FieldSchema) {
+	fs = []*FieldSchema{}
+	for i := 0; i < ft.NumOut()-1; i++ {
+		fs = append(fs, &FieldSchema{Type: cachedTypeSchema(ft.Out(i))})
+	}
+	return
+}
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	jsonMarshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonRawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// typeSchema describes t as it's encoded by encoding/json, visiting are the structs being described, for recursive types.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) (ts *TypeSchema) {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	defer func() {
+		ts.Nullable = nullable
+	}()
+
+	ts = &TypeSchema{}
+	if t.PkgPath() != "" {
+		ts.Name, ts.typ = t.Name(), t
+	}
+	switch {
+	case t == timeType:
+		ts.Kind, ts.Format = "string", "date-time"
+		return
+	case t == fileHeaderType.Elem():
+		// the name of the multipart file field
+		ts.Name, ts.Kind, ts.Format = "", "string", "file"
+		return
+	case t == jsonRawMessageType || t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		ts.Kind = "any"
+		return
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		ts.Kind = "string"
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		ts.Kind = "boolean"
+	case reflect.String:
+		ts.Kind = "string"
+	case reflect.Float32, reflect.Float64:
+		ts.Kind = "number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		ts.Kind = "integer"
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			ts.Kind, ts.Format = "string", "byte"
+			return
+		}
+		ts.Kind = "array"
+		ts.Elem = typeSchema(t.Elem(), visiting)
+	case reflect.Map:
+		ts.Kind = "object"
+		ts.Elem = typeSchema(t.Elem(), visiting)
+	case reflect.Struct:
+		ts.Kind = "object"
+		if visiting[t] {
+			return
+		}
+		visiting[t] = true
+		ts.Fields = structFieldSchemas(t, visiting)
+		delete(visiting, t)
+	default:
+		ts.Kind = "any"
+	}
+	return
+}
+
+// structFieldSchemas follows the field names of encoding/json, embedded structs are flattened.
+func structFieldSchemas(t reflect.Type, visiting map[reflect.Type]bool) (fs []*FieldSchema) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fs = append(fs, structFieldSchemas(ft, visiting)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fs = append(fs, &FieldSchema{
+			Name:     name,
+			Type:     typeSchema(sf.Type, visiting),
+			Optional: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+	return
+}
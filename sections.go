@@ -0,0 +1,78 @@
+package jsonhandlerfunc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+/*
+WithEnvelopeSection decodes the top level section name of the request envelope into the func's param at paramIndex,
+like {"auth": {"token": "..."}, "params": ["Gates"]}, for clients that can't set headers, like webview bridges and beacon APIs.
+The param is not in the "params" array anymore.
+*/
+func WithEnvelopeSection(name string, paramIndex int) Option {
+	if name == "params" || name == "p" {
+		panic(fmt.Sprintf("envelope section can not be named %q", name))
+	}
+	return func(opts *handlerOptions) {
+		if opts.envelopeSections == nil {
+			opts.envelopeSections = map[int]string{}
+		}
+		if existing, ok := opts.envelopeSections[paramIndex]; ok {
+			opts.conflict("WithEnvelopeSection maps both %q and %q to param %d, keep one of them", existing, name, paramIndex)
+		}
+		for index, existing := range opts.envelopeSections {
+			if existing == name && index != paramIndex {
+				opts.conflict("WithEnvelopeSection maps %q to both param %d and %d, use different section names", name, index, paramIndex)
+			}
+		}
+		opts.envelopeSections[paramIndex] = name
+	}
+}
+
+func (opts *handlerOptions) checkEnvelopeSections(ft reflect.Type, injectedCount int) {
+	for index, name := range opts.envelopeSections {
+		if index < injectedCount || index >= ft.NumIn() {
+			panic(fmt.Sprintf("envelope section %q param index %d must be one of the not injected params of %s", name, index, ft))
+		}
+	}
+}
+
+// envelopeReq decodes the params and the sections declared by WithEnvelopeSection
+type envelopeReq struct {
+	compactReq
+	sections map[string]interface{}
+	// cursor is decoded from CursorEnvelopeKey for WithAutoPaginate if it's not nil
+	cursor *string
+}
+
+func (req *envelopeReq) UnmarshalJSON(b []byte) (err error) {
+	err = json.Unmarshal(b, &req.compactReq)
+	if err != nil || len(req.sections) == 0 && req.cursor == nil {
+		return
+	}
+
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return
+	}
+	if cursor, ok := raw[CursorEnvelopeKey]; ok && req.cursor != nil {
+		err = json.Unmarshal(cursor, req.cursor)
+		if err != nil {
+			return
+		}
+	}
+	for name, pv := range req.sections {
+		section, ok := raw[name]
+		if !ok {
+			continue
+		}
+		err = json.Unmarshal(section, pv)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+/*
+ToHandlerFuncs converts every exported method of service, usually a pointer to a struct, to a http.HandlerFunc
+by the method name, the same as ToHandlerFunc, a leading context.Context param is injected the same way.
+Methods that don't return an error last, like String, are not handlers and skipped.
+The extra funcs like injectors and options are passed to every method.
+*/
+func ToHandlerFuncs(service interface{}, funcs ...interface{}) map[string]http.HandlerFunc {
+	return defaultConfig.ToHandlerFuncs(service, funcs...)
+}
+
+func (cfg *Config) ToHandlerFuncs(service interface{}, funcs ...interface{}) map[string]http.HandlerFunc {
+	hfs := map[string]http.HandlerFunc{}
+	for name, method := range serviceMethods(service) {
+		hfs[name] = cfg.ToHandlerFunc(append([]interface{}{method}, funcs...)...)
+	}
+	return hfs
+}
+
+// RegisterService registers service's methods to DefaultRegistry, see Registry.RegisterService
+func RegisterService(service interface{}, funcs ...interface{}) {
+	DefaultRegistry.RegisterService(service, funcs...)
+}
+
+/*
+RegisterService registers every exported method of service that returns an error last,
+named like "UserService.Create" by the type name of service, the same as RegisterInterface.
+*/
+func (reg *Registry) RegisterService(service interface{}, funcs ...interface{}) {
+	t := reflect.TypeOf(service)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for name, method := range serviceMethods(service) {
+		reg.Register(t.Name()+"."+name, append([]interface{}{method}, funcs...)...)
+	}
+}
+
+func serviceMethods(service interface{}) map[string]interface{} {
+	sv := reflect.ValueOf(service)
+	if !sv.IsValid() {
+		panic("service must not be nil")
+	}
+	methods := map[string]interface{}{}
+	for i := 0; i < sv.NumMethod(); i++ {
+		mt := sv.Type().Method(i)
+		ft := mt.Type
+		if ft.NumOut() == 0 || !isError(ft.Out(ft.NumOut()-1)) {
+			continue
+		}
+		methods[mt.Name] = sv.Method(i).Interface()
+	}
+	if len(methods) == 0 {
+		panic(fmt.Sprintf("%T has no exported methods that return an error", service))
+	}
+	return methods
+}
@@ -0,0 +1,83 @@
+package jsonhandlerfunc
+
+import (
+	"net/http"
+)
+
+/*
+ResponseShape changes the envelope of the responses to match an existing API contract, like:
+
+	&jsonhandlerfunc.ResponseShape{UnwrapSingleResult: true}
+
+responds {"result": {...}, "error": null} instead of {"results": [{...}, null]}.
+The compact envelope and JSON-RPC requests are not shaped, and Client, the generated clients and the schema
+only know the default envelope.
+*/
+type ResponseShape struct {
+	// ResultsKey is the key of the results, default is "results".
+	ResultsKey string
+	// ErrorKey moves the error out of the results to the key, like "error", the results are without it then.
+	ErrorKey string
+	// UnwrapSingleResult responds the result at ResultKey instead of the results when the func has one result besides the error,
+	// the error is at ErrorKey, default "error".
+	UnwrapSingleResult bool
+	// ResultKey is the key of the unwrapped result, default is "result".
+	ResultKey string
+	// Write responds the results instead, it's responsible for the whole response including the headers.
+	Write ResponseWriterFunc
+}
+
+// ResponseWriterFunc writes the response of the results except the error, err is nil if the func succeeded.
+type ResponseWriterFunc func(w http.ResponseWriter, statusCode int, results []interface{}, err *ResponseError)
+
+// splitResults splits out to the results and the error, which is the last.
+func splitResults(out interface{}) (results []interface{}, respErr *ResponseError) {
+	outs, _ := out.([]interface{})
+	if len(outs) == 0 {
+		return
+	}
+	results = outs[:len(outs)-1]
+	respErr, _ = outs[len(outs)-1].(*ResponseError)
+	return
+}
+
+// envelope is the response of out in the shape, besides Write
+func (shape *ResponseShape) envelope(out interface{}, meta map[string]interface{}, warnings []Warning) interface{} {
+	resp := map[string]interface{}{}
+	if meta != nil {
+		resp["meta"] = meta
+	}
+	if warnings != nil {
+		resp["warnings"] = warnings
+	}
+	errorKey := shape.ErrorKey
+	if shape.UnwrapSingleResult && errorKey == "" {
+		errorKey = "error"
+	}
+	if errorKey == "" {
+		resp[defaultString(shape.ResultsKey, "results")] = out
+		return resp
+	}
+
+	results, respErr := splitResults(out)
+	resp[errorKey] = respErr
+	switch {
+	case shape.UnwrapSingleResult && len(results) == 1:
+		resp[defaultString(shape.ResultKey, "result")] = results[0]
+	case shape.UnwrapSingleResult && len(results) == 0:
+		// errors responded before the func is called have no results
+	default:
+		if results == nil {
+			results = []interface{}{}
+		}
+		resp[defaultString(shape.ResultsKey, "results")] = results
+	}
+	return resp
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+/*
+RequestState is the structured state of a request, for the response shaping hooks like Config.ShapeResults
+and Config.LocalizeResults, so they can filter fields by the role of the injected user, or add links,
+without ad hoc context keys. Read it from the request context with RequestStateOf.
+*/
+type RequestState struct {
+	Request *http.Request
+	// Method is the Registry method name, empty if the handler is not served by a Registry.
+	Method   string
+	Language string
+	// Injected are the values returned by the injectors, in the order of the func's params.
+	Injected []interface{}
+	// Bag is the key value bag of the request, see BagOf.
+	Bag *Bag
+
+	ops *opRecorder
+}
+
+type requestStateKey struct{}
+
+// RequestStateOf returns the state of the request of ctx, nil if ctx is not of a request served by a handler.
+func RequestStateOf(ctx context.Context) *RequestState {
+	state, _ := ctx.Value(requestStateKey{}).(*RequestState)
+	return state
+}
+
+/*
+Lookup sets ptr to the first injected value assignable to it, and reports if there is one:
+
+	var user *User
+	if state.Lookup(&user) { ... }
+*/
+func (s *RequestState) Lookup(ptr interface{}) bool {
+	pv := reflect.ValueOf(ptr)
+	if pv.Kind() != reflect.Ptr || pv.IsNil() {
+		panic("Lookup needs a not nil pointer")
+	}
+	t := pv.Elem().Type()
+	for _, v := range s.Injected {
+		if v != nil && reflect.TypeOf(v).AssignableTo(t) {
+			pv.Elem().Set(reflect.ValueOf(v))
+			return true
+		}
+	}
+	return false
+}
+
+func withRequestState(r *http.Request) *http.Request {
+	ctx := r.Context()
+	state := &RequestState{Method: MethodName(ctx), Language: Language(ctx), Bag: BagOf(ctx)}
+	r = r.WithContext(context.WithValue(ctx, requestStateKey{}, state))
+	state.Request = r
+	return r
+}
+
+func (s *RequestState) setInjected(injectVals []reflect.Value) {
+	for _, val := range injectVals {
+		s.Injected = append(s.Injected, val.Interface())
+	}
+}
+
+// shapeResults calls Config.ShapeResults with the results except the error.
+func (cfg *Config) shapeResults(r *http.Request, outs []interface{}) []interface{} {
+	if cfg.ShapeResults == nil {
+		return outs
+	}
+	last := len(outs) - 1
+	shaped := cfg.ShapeResults(RequestStateOf(r.Context()), outs[:last])
+	return append(shaped, outs[last])
+}
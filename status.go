@@ -0,0 +1,61 @@
+package jsonhandlerfunc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+/*
+WithSuccessStatusCode is the status code of the responses without error of the handler, like 201 for create endpoints,
+or 204 for the funcs that only return an error, it overrides Config.SuccessStatusCode. 204 responds no body.
+*/
+func WithSuccessStatusCode(code int) Option {
+	if code < 200 || code > 299 {
+		panic(fmt.Sprintf("success status code %d is not 2xx.", code))
+	}
+	return func(opts *handlerOptions) {
+		if opts.successStatusCode != 0 {
+			opts.conflict("WithSuccessStatusCode is passed more than once, keep one of them")
+		}
+		opts.successStatusCode = code
+	}
+}
+
+// successStatusCode is of WithSuccessStatusCode, or Config.SuccessStatusCode, default is 200.
+func (cfg *Config) successStatusCode(opts *handlerOptions) int {
+	if opts != nil && opts.successStatusCode != 0 {
+		return opts.successStatusCode
+	}
+	if cfg.SuccessStatusCode != 0 {
+		return cfg.SuccessStatusCode
+	}
+	return http.StatusOK
+}
+
+// decodeErrorStatusCode is Config.DecodeErrorStatusCode, default is 422.
+func (cfg *Config) decodeErrorStatusCode() int {
+	if cfg.DecodeErrorStatusCode != 0 {
+		return cfg.DecodeErrorStatusCode
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// errStatusCode is the code of the StatusCodeError in the error chain, or else of Config.ErrToStatusCode, defaultCode if both have none.
+func (cfg *Config) errStatusCode(err error, defaultCode int) int {
+	var httpE StatusCodeError
+	if errors.As(err, &httpE) {
+		return httpE.StatusCode()
+	}
+	if cfg.ErrToStatusCode != nil {
+		if code := cfg.ErrToStatusCode(err); code != 0 {
+			return code
+		}
+	}
+	return defaultCode
+}
+
+// bodyAllowed reports if a response of the status code can have a body.
+func bodyAllowed(httpCode int) bool {
+	return httpCode >= 200 && httpCode != http.StatusNoContent && httpCode != http.StatusNotModified
+}
@@ -0,0 +1,88 @@
+package jsonhandlerfunc
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+/*
+Stream is a result that is copied to the response as it is instead of encoded in the envelope,
+for file downloads and large exports. Funcs can also return an io.Reader or io.ReadCloser,
+which are streamed with the content type of WithStreamContentType.
+The reader is closed after copied if it's an io.Closer.
+
+When the error is not nil, or the stream is nil, the results are responded in the envelope as usual.
+*/
+type Stream struct {
+	Reader io.Reader
+	// ContentType default is application/octet-stream
+	ContentType string
+	// Filename sets Content-Disposition to download it as an attachment
+	Filename string
+	// Size sets Content-Length if it's more than 0
+	Size int64
+}
+
+var (
+	ioReaderType     = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	ioReadCloserType = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+	streamPtrType    = reflect.TypeOf((*Stream)(nil))
+)
+
+// WithStreamContentType is the Content-Type of the io.Reader results, default is application/octet-stream.
+func WithStreamContentType(contentType string) Option {
+	return func(opts *handlerOptions) {
+		opts.streamContentType = contentType
+	}
+}
+
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if closer, ok := s.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	contentType := s.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if s.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": s.Filename}))
+	}
+	if s.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(s.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	// the copy stops once the client went away, a slow reader doesn't keep the goroutine alive
+	if _, err := io.Copy(w, &contextReader{Reader: s.Reader, ctx: r.Context(), untilCanceled: true}); err != nil {
+		log.Println("jsonhandlerfunc: copy stream error:", err)
+	}
+}
+
+// streamResultIndex finds the io.Reader, io.ReadCloser or *Stream return value of the func, -1 if there is none.
+func streamResultIndex(ft reflect.Type) int {
+	for i := 0; i < ft.NumOut()-1; i++ {
+		switch ft.Out(i) {
+		case ioReaderType, ioReadCloserType, streamPtrType:
+			return i
+		}
+	}
+	return -1
+}
+
+// streamed returns the stream result when the error is nil, nil otherwise.
+func (h *Handler) streamed(outVals []reflect.Value) *Stream {
+	if h.streamIndex < 0 || !outVals[len(outVals)-1].IsNil() || outVals[h.streamIndex].IsNil() {
+		return nil
+	}
+	switch v := outVals[h.streamIndex].Interface().(type) {
+	case *Stream:
+		return v
+	case io.Reader:
+		return &Stream{Reader: v, ContentType: h.opts.streamContentType}
+	}
+	return nil
+}
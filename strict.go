@@ -0,0 +1,207 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+WithRequiredParams rejects the requests that omit the params at the indexes of the func's params, or pass null,
+with a ValidationError of the "required" rule, instead of calling the func with zero values.
+Config.RequireParams requires all the params of all the handlers.
+*/
+func WithRequiredParams(paramIndexes ...int) Option {
+	return func(opts *handlerOptions) {
+		if opts.requiredParams == nil {
+			opts.requiredParams = map[int]bool{}
+		}
+		for _, i := range paramIndexes {
+			opts.requiredParams[i] = true
+		}
+	}
+}
+
+func (opts *handlerOptions) checkRequiredParams(ft reflect.Type, injectedCount int) {
+	for index := range opts.requiredParams {
+		if index < injectedCount || index >= ft.NumIn() {
+			panic(fmt.Sprintf("required param index %d must be one of the not injected params of %s", index, ft))
+		}
+	}
+}
+
+func (h *Handler) isStrict() bool {
+	return h.cfg.DisallowUnknownFields || h.cfg.RequireParams || len(h.opts.requiredParams) > 0
+}
+
+/*
+checkStrict reads body, and returns it to be read again if its params pass Config.DisallowUnknownFields,
+Config.RequireParams and WithRequiredParams, bodies of other Codecs are not checked, and invalid json is left to the decoder.
+*/
+func (h *Handler) checkStrict(body io.Reader, codec Codec, compact bool) (io.Reader, error) {
+	if !h.isStrict() || codec != JSONCodec {
+		return body, nil
+	}
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var envelope map[string]json.RawMessage
+	if json.Unmarshal(raw, &envelope) != nil {
+		return bytes.NewReader(raw), nil
+	}
+	params, ok := envelope["params"]
+	if !ok && compact {
+		params = envelope["p"]
+	}
+
+	var plans []argPlan
+	for _, plan := range h.argPlans {
+		if plan.section == "" {
+			plans = append(plans, plan)
+		}
+	}
+	e := &ValidationError{Code: InvalidParamsCode}
+	if trimmed := bytes.TrimSpace(params); h.cfg.ParamStyle == NamedParams && len(trimmed) > 0 && trimmed[0] == '{' {
+		h.checkNamedParams(e, plans, params)
+	} else {
+		var vals []json.RawMessage
+		if len(params) > 0 && json.Unmarshal(params, &vals) != nil {
+			return bytes.NewReader(raw), nil
+		}
+		for i, plan := range plans {
+			var val json.RawMessage
+			if i < len(vals) {
+				val = vals[i]
+			}
+			if h.ft.IsVariadic() && plan.index == h.ft.NumIn()-1 {
+				// the variadic params can be none, and are checked as the slice
+				if val != nil {
+					h.checkParam(e, fmt.Sprintf("params[%d:]", i), plan, joinRawArray(vals[i:]))
+				}
+				continue
+			}
+			h.checkParam(e, fmt.Sprintf("params[%d]", i), plan, val)
+		}
+	}
+	if len(e.Fields) > 0 {
+		return nil, e
+	}
+	return bytes.NewReader(raw), nil
+}
+
+func (h *Handler) checkNamedParams(e *ValidationError, plans []argPlan, params json.RawMessage) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(params, &obj) != nil {
+		return
+	}
+	if h.opts.paramNames == nil {
+		if len(plans) == 1 {
+			h.checkParam(e, "params", plans[0], params)
+		}
+		return
+	}
+	names := map[string]bool{}
+	for _, plan := range plans {
+		name := h.opts.paramNames[plan.index-injectedCount(h.argsInjectors)]
+		names[name] = true
+		h.checkParam(e, "params."+name, plan, obj[name])
+	}
+	if h.cfg.DisallowUnknownFields {
+		var keys []string
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !names[key] {
+				e.Fields = append(e.Fields, &FieldError{Field: "params." + key, Rule: "unknown", Message: "is not a param"})
+			}
+		}
+	}
+}
+
+// checkParam checks the json val of the param of plan at path, val is nil if it's omitted.
+func (h *Handler) checkParam(e *ValidationError, path string, plan argPlan, val json.RawMessage) {
+	if bytes.Equal(bytes.TrimSpace(val), []byte("null")) {
+		val = nil
+	}
+	if val == nil {
+		if h.cfg.RequireParams || h.opts.requiredParams[plan.index] {
+			e.Fields = append(e.Fields, &FieldError{Field: path, Rule: "required", Message: "is required"})
+		}
+		return
+	}
+	if !h.cfg.DisallowUnknownFields || plan.file {
+		return
+	}
+	var v interface{}
+	if json.Unmarshal(val, &v) != nil {
+		return
+	}
+	unknownFields(e, path, v, plan.newType)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// unknownFields adds the keys of the objects of v that are not fields of the structs of t, the names match without case like encoding/json.
+func unknownFields(e *ValidationError, path string, v interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := structFields(t)
+		for _, key := range sortedKeys(obj) {
+			f := fieldOf(fields, key)
+			if f == nil {
+				e.Fields = append(e.Fields, &FieldError{Field: path + "." + key, Rule: "unknown", Message: "is not a field of " + t.String()})
+				continue
+			}
+			unknownFields(e, path+"."+key, obj[key], f.typ)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := v.([]interface{}); ok {
+			for i, ev := range arr {
+				unknownFields(e, fmt.Sprintf("%s[%d]", path, i), ev, t.Elem())
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for _, key := range sortedKeys(obj) {
+				unknownFields(e, fmt.Sprintf("%s[%s]", path, key), obj[key], t.Elem())
+			}
+		}
+	}
+}
+
+// fieldOf is the field of the key, the exact name first, or else the name without case like encoding/json.
+func fieldOf(fields []jsonField, key string) *jsonField {
+	for i := range fields {
+		if fields[i].name == key {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, key) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TeeRecord is a copy of a request and its response envelopes sent to a TeeSink.
+type TeeRecord struct {
+	Method     string          `json:"method,omitempty"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	StatusCode int             `json:"status_code"`
+	Time       time.Time       `json:"time"`
+	Duration   time.Duration   `json:"duration"`
+}
+
+// TeeSink receives the records of a Tee, like an analytics pipeline, it's called by the Tee's workers one record at a time.
+type TeeSink interface {
+	Send(ctx context.Context, rec *TeeRecord) error
+}
+
+// TeeStats are the metrics of a Tee
+type TeeStats struct {
+	Sent int64 `json:"sent"`
+	// Dropped counts the records dropped because the queue was full or the tee was closed
+	Dropped int64 `json:"dropped"`
+	// Failed counts the records that the sink returned an error for
+	Failed int64 `json:"failed"`
+}
+
+/*
+Tee sends copies of the envelopes of the handlers created WithTee to Sink asynchronously,
+through a bounded queue, so the callers never wait for the sink, records are dropped when the queue is full.
+*/
+type Tee struct {
+	// SampleRate from 0 to 1 is the portion of the requests that are teed, 0 tees all.
+	SampleRate float64
+	// Redact modifies the record before it's sent, like RedactJSON the passwords, it's called by the workers.
+	Redact func(rec *TeeRecord)
+
+	sink  TeeSink
+	queue chan *TeeRecord
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	sent, dropped, failed int64
+}
+
+// NewTee starts a worker to send records to sink, queueSize is the max records waiting to be sent, default is 1000.
+func NewTee(sink TeeSink, queueSize int) *Tee {
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	t := &Tee{sink: sink, queue: make(chan *TeeRecord, queueSize)}
+	t.wg.Add(1)
+	go t.work()
+	return t
+}
+
+// WithTee tees the envelopes of the handler to tee, see Tee.
+func WithTee(tee *Tee) Option {
+	return func(opts *handlerOptions) {
+		opts.tee = tee
+	}
+}
+
+func (t *Tee) work() {
+	defer t.wg.Done()
+	for rec := range t.queue {
+		if t.Redact != nil {
+			t.Redact(rec)
+		}
+		if err := t.sink.Send(context.Background(), rec); err != nil {
+			atomic.AddInt64(&t.failed, 1)
+			log.Println("jsonhandlerfunc: tee send error:", err)
+			continue
+		}
+		atomic.AddInt64(&t.sent, 1)
+	}
+}
+
+// Close stops teeing, and waits for the records in the queue to be sent.
+func (t *Tee) Close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+}
+
+// Stats returns the metrics of the tee
+func (t *Tee) Stats() TeeStats {
+	return TeeStats{
+		Sent:    atomic.LoadInt64(&t.sent),
+		Dropped: atomic.LoadInt64(&t.dropped),
+		Failed:  atomic.LoadInt64(&t.failed),
+	}
+}
+
+func (t *Tee) enqueue(rec *TeeRecord) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		atomic.AddInt64(&t.dropped, 1)
+		return
+	}
+	select {
+	case t.queue <- rec:
+	default:
+		atomic.AddInt64(&t.dropped, 1)
+	}
+}
+
+// record captures the request body and the response of a sampled request, the returned func enqueues them encrypted by enc.
+func (t *Tee) record(rw *responseWriter, r *http.Request, start time.Time, enc *fieldEncryption) (enqueue func()) {
+	if t == nil || t.SampleRate > 0 && rand.Float64() >= t.SampleRate {
+		return func() {}
+	}
+	var reqBody []byte
+	if r.Body != nil {
+		reqBody, _ = ioutil.ReadAll(bufferBody(r))
+	}
+	rw.capture = &bytes.Buffer{}
+	return func() {
+		rec := &TeeRecord{
+			Method:     MethodName(r.Context()),
+			Request:    rawJSON(reqBody),
+			Response:   rawJSON(rw.capture.Bytes()),
+			StatusCode: rw.status,
+			Time:       start,
+			Duration:   time.Since(start),
+		}
+		if err := enc.record(rec); err != nil {
+			atomic.AddInt64(&t.failed, 1)
+			log.Println("jsonhandlerfunc: tee encrypt error:", err)
+			return
+		}
+		t.enqueue(rec)
+	}
+}
+
+// rawJSON is b if it's valid JSON, or b as a JSON string, like a response of a Codec.
+func rawJSON(b []byte) json.RawMessage {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+/*
+RedactJSON replaces the values of the object fields named in fields with "[REDACTED]" at any depth of raw,
+for Tee.Redact:
+
+	Redact: func(rec *jsonhandlerfunc.TeeRecord) {
+		rec.Request = jsonhandlerfunc.RedactJSON(rec.Request, "password", "token")
+	}
+*/
+func RedactJSON(raw json.RawMessage, fields ...string) json.RawMessage {
+	var v interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil {
+		return raw
+	}
+	names := map[string]bool{}
+	for _, f := range fields {
+		names[f] = true
+	}
+	redacted, err := json.Marshal(redactValue(v, names))
+	if err != nil {
+		return raw
+	}
+	return redacted
+}
+
+func redactValue(v interface{}, names map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range v {
+			if names[k] {
+				v[k] = "[REDACTED]"
+				continue
+			}
+			v[k] = redactValue(fv, names)
+		}
+	case []interface{}:
+		for i, ev := range v {
+			v[i] = redactValue(ev, names)
+		}
+	}
+	return v
+}
@@ -0,0 +1,164 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// DeadlineExceededCode is the code of TimeoutError, clients can use it to tell a timeout from business errors.
+const DeadlineExceededCode = "deadline_exceeded"
+
+/*
+TimeoutError is responded with http code 504 when the func didn't return before
+Config.Timeout or the deadline of the request context.
+*/
+type TimeoutError struct {
+	Code      string `json:"code"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("deadline exceeded after %dms", e.ElapsedMs)
+}
+
+func (e *TimeoutError) StatusCode() int {
+	return http.StatusGatewayTimeout
+}
+
+func newTimeoutError(start time.Time) *TimeoutError {
+	return &TimeoutError{
+		Code:      DeadlineExceededCode,
+		ElapsedMs: int64(time.Since(start) / time.Millisecond),
+	}
+}
+
+type callResult struct {
+	outVals  []reflect.Value
+	panicked bool
+	panicVal interface{}
+}
+
+// goCall calls the func in another goroutine, the panic is recovered and raised again by values, it's counted by startFunc of ctx.
+func goCall(ctx context.Context, v reflect.Value, inVals []reflect.Value) <-chan callResult {
+	done := make(chan callResult, 1)
+	returned := startFunc(ctx)
+	go func() {
+		defer returned()
+		var res callResult
+		defer func() {
+			if p := recover(); p != nil {
+				res.panicked = true
+				res.panicVal = p
+			}
+			done <- res
+		}()
+		res.outVals = callFunc(v, inVals)
+	}()
+	return done
+}
+
+func (res callResult) values() []reflect.Value {
+	if res.panicked {
+		panic(res.panicVal)
+	}
+	return res.outVals
+}
+
+// callWithDeadline calls the func in another goroutine when ctx has a deadline,
+// if the deadline fires first, the func's late return values are discarded.
+func callWithDeadline(ctx context.Context, start time.Time, v reflect.Value, inVals []reflect.Value) (outVals []reflect.Value, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		outVals = callFunc(v, inVals)
+		return
+	}
+
+	done := goCall(ctx, v, inVals)
+	select {
+	case res := <-done:
+		outVals = res.values()
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			err = newTimeoutError(start)
+			return
+		}
+		outVals = (<-done).values()
+	}
+	return
+}
+
+// contextReader fails the reads with the error of ctx once it's done, or only once it's canceled with untilCanceled.
+type contextReader struct {
+	io.Reader
+	ctx           context.Context
+	untilCanceled bool
+	eof           int32
+}
+
+func (cr *contextReader) Read(p []byte) (n int, err error) {
+	if err = cr.err(); err != nil {
+		return
+	}
+	n, err = cr.Reader.Read(p)
+	if err == io.EOF {
+		atomic.StoreInt32(&cr.eof, 1)
+	} else if err != nil && cr.err() != nil {
+		err = cr.err()
+	}
+	return
+}
+
+func (cr *contextReader) err() error {
+	err := cr.ctx.Err()
+	if cr.untilCanceled && err != context.Canceled {
+		return nil
+	}
+	return err
+}
+
+/*
+watchBody fails the reads of the request body with the error of the request context once it's done,
+like when Config.Timeout fired or the client went away, so an abandoned request doesn't keep decoding,
+a read blocked on the connection is woken by the read deadline of http.ResponseController.
+The returned func stops watching, call it once the body is decoded.
+*/
+func watchBody(w http.ResponseWriter, r *http.Request) (stop func()) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return func() {}
+	}
+	ctx := r.Context()
+	body := &contextReader{Reader: r.Body, ctx: ctx}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, r.Body}
+
+	rc := http.NewResponseController(w)
+	var woken int32
+	stopWaking := context.AfterFunc(ctx, func() {
+		// the server reads the connection in the background after the body, it must not be woken
+		if atomic.LoadInt32(&body.eof) == 0 && rc.SetReadDeadline(time.Now()) == nil {
+			atomic.StoreInt32(&woken, 1)
+		}
+	})
+	return func() {
+		if !stopWaking() && atomic.LoadInt32(&woken) == 1 {
+			rc.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// contextError is the error of the call when the request context is done, nil if it isn't.
+func (c *handlerCall) contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return newTimeoutError(c.start)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,88 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimingMetaKey is the response meta key of the TimingMeta of WithTimingMeta.
+const TimingMetaKey = "timing"
+
+/*
+TimingMeta is the server side timing of a call in the response meta of WithTimingMeta,
+for client SDKs to adapt their timeouts and hedging to the real server side measurements.
+*/
+type TimingMeta struct {
+	// ServerMs is the milliseconds the server processed the request until the response was written.
+	ServerMs float64 `json:"server_ms"`
+	// DeadlineRemainingMs is the milliseconds left to the deadline of the request, like of Config.Timeout, when the response was written,
+	// omitted if the request has no deadline.
+	DeadlineRemainingMs *float64 `json:"deadline_remaining_ms,omitempty"`
+	// Retry is the advice of retrying the request, omitted for the successful responses.
+	Retry *RetryAdvice `json:"retry,omitempty"`
+}
+
+// RetryAdvice tells the client if a failed request can be retried, and how long to wait before that.
+type RetryAdvice struct {
+	// Retryable is true for the status codes 408, 429, 502, 503 and 504.
+	Retryable bool `json:"retryable"`
+	// AfterMs is the milliseconds of the Retry-After of the response, like of a QuotaExceededError or a MaintenanceError.
+	AfterMs int64 `json:"after_ms,omitempty"`
+}
+
+type timingMeta struct {
+	start time.Time
+	ctx   context.Context
+}
+
+/*
+WithTimingMeta sets the TimingMeta of the call to the response meta by TimingMetaKey, including the error responses:
+
+	{"results": [...], "meta": {"timing": {"server_ms": 12.3, "deadline_remaining_ms": 987.7}}}
+
+The responses from WithResponseCache are written as they were stored, with the timing of the call that stored them.
+*/
+func WithTimingMeta() Option {
+	return func(opts *handlerOptions) {
+		opts.timingMeta = true
+	}
+}
+
+// setTimingMeta sets the TimingMeta to the response meta when it's written with httpCode.
+func (rw *responseWriter) setTimingMeta(httpCode int) {
+	if rw.timing == nil {
+		return
+	}
+	now := time.Now()
+	tm := &TimingMeta{ServerMs: millis(now.Sub(rw.timing.start))}
+	if deadline, ok := rw.timing.ctx.Deadline(); ok {
+		remaining := millis(deadline.Sub(now))
+		if remaining < 0 {
+			remaining = 0
+		}
+		tm.DeadlineRemainingMs = &remaining
+	}
+	if httpCode >= http.StatusBadRequest {
+		tm.Retry = &RetryAdvice{Retryable: isRetryableStatus(httpCode)}
+		if secs, err := strconv.Atoi(rw.Header().Get("Retry-After")); err == nil && secs > 0 {
+			tm.Retry.AfterMs = int64(secs) * 1000
+		}
+	}
+	rw.setMeta(TimingMetaKey, tm)
+}
+
+func isRetryableStatus(httpCode int) bool {
+	switch httpCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// millis is d in milliseconds, rounded to 0.1.
+func millis(d time.Duration) float64 {
+	return float64(d.Round(100*time.Microsecond)) / float64(time.Millisecond)
+}
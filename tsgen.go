@@ -0,0 +1,191 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+GenerateTS writes TypeScript of the schema, usually Registry.Schema, for web clients:
+interfaces of the named struct types, and a createClient(baseURL) with a typed function per method,
+that posts the params envelope and resolves the results, or rejects with a JSONHandlerError.
+The functions of the methods with RequiredHeaders reject without sending the request if init doesn't have the headers.
+A method with one result resolves it, with more results resolves them as a tuple.
+
+	jsonhandlerfunc.GenerateTS(f, reg.Schema())
+*/
+func GenerateTS(w io.Writer, schema *Schema) (err error) {
+	g := &tsGen{interfaces: map[string]string{}}
+	methods := &bytes.Buffer{}
+	for _, ms := range schema.Methods {
+		g.method(methods, ms)
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by jsonhandlerfunc.GenerateTS. DO NOT EDIT.\n\n")
+	var names []string
+	for name := range g.interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "export interface %s %s\n\n", name, g.interfaces[name])
+	}
+	out.WriteString(tsRuntime)
+	fmt.Fprintf(out, "\nexport function createClient(baseURL: string, init?: RequestInit) {\n\treturn {\n")
+	out.Write(methods.Bytes())
+	fmt.Fprintf(out, "\t};\n}\n")
+	_, err = w.Write(out.Bytes())
+	return
+}
+
+const tsRuntime = `export class JSONHandlerError extends Error {
+	constructor(message: string, public status: number, public value: unknown) {
+		super(message);
+	}
+}
+
+async function call(baseURL: string, init: RequestInit | undefined, method: string, params: unknown[], sections?: object, requiredHeaders?: string[]): Promise<unknown[]> {
+	const headers = new Headers(init?.headers);
+	const missing = (requiredHeaders ?? []).filter((name) => !headers.get(name));
+	if (missing.length > 0) {
+		throw new JSONHandlerError("missing required headers: " + missing.join(", "), 400, { code: "missing_headers", headers: missing });
+	}
+	headers.set("Content-Type", "application/json");
+	headers.set("X-Jsonhf-Positional-Results", "1");
+	const res = await fetch(baseURL.replace(/\/$/, "") + "/" + method, {
+		...init,
+		method: "POST",
+		headers,
+		body: JSON.stringify({ ...sections, params }),
+	});
+	const body = await res.json();
+	const results: unknown[] = body.results;
+	const err = results[results.length - 1] as { error: string; value: unknown } | null;
+	if (err) {
+		throw new JSONHandlerError(err.error, res.status, err.value);
+	}
+	return results.slice(0, -1);
+}
+`
+
+type tsGen struct {
+	interfaces map[string]string
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func (g *tsGen) method(w io.Writer, ms *MethodSchema) {
+	var args, params []string
+	for i, p := range ms.Params {
+		name := p.Name
+		if name == "" || !tsIdentifier.MatchString(name) {
+			name = fmt.Sprintf("p%d", i)
+		}
+		args = append(args, name+": "+g.typ(p.Type))
+		params = append(params, name)
+	}
+	// the optional args of call after the params
+	optional := ""
+	if len(ms.Sections) > 0 {
+		args = append(args, "sections: "+g.fields(ms.Sections))
+		optional = ", sections"
+	}
+
+	if len(ms.RequiredHeaders) > 0 {
+		if optional == "" {
+			optional = ", undefined"
+		}
+		headers, _ := json.Marshal(ms.RequiredHeaders)
+		optional += ", " + string(headers)
+	}
+
+	var results []string
+	for _, r := range ms.Results {
+		results = append(results, g.typ(r.Type))
+	}
+	resolve := ""
+	switch len(results) {
+	case 0:
+		results = []string{"void"}
+		resolve = ".then(() => undefined)"
+	case 1:
+		resolve = fmt.Sprintf(".then((r) => r[0] as %s)", results[0])
+	default:
+		results = []string{"[" + strings.Join(results, ", ") + "]"}
+		resolve = fmt.Sprintf(".then((r) => r as %s)", results[0])
+	}
+
+	fmt.Fprintf(w, "\t\t%s: (%s): Promise<%s> =>\n", tsKey(ms.Name), strings.Join(args, ", "), results[0])
+	fmt.Fprintf(w, "\t\t\tcall(baseURL, init, %q, [%s]%s)%s,\n", ms.Name, strings.Join(params, ", "), optional, resolve)
+}
+
+// typ is the TypeScript type of ts, named structs are declared as interfaces.
+func (g *tsGen) typ(ts *TypeSchema) (t string) {
+	defer func() {
+		if ts.Nullable {
+			t += " | null"
+		}
+	}()
+
+	switch ts.Kind {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		elem := g.typ(ts.Elem)
+		if ts.Elem.Nullable {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case "object":
+		if ts.Elem != nil {
+			return "Record<string, " + g.typ(ts.Elem) + ">"
+		}
+		if ts.Name == "" {
+			return g.fields(ts.Fields)
+		}
+		if _, ok := g.interfaces[ts.Name]; !ok && ts.Fields != nil {
+			// placeholder for types that refer to themselves
+			g.interfaces[ts.Name] = ""
+			g.interfaces[ts.Name] = g.fields(ts.Fields)
+		}
+		if _, ok := g.interfaces[ts.Name]; ok {
+			return ts.Name
+		}
+		return "{}"
+	}
+	return "unknown"
+}
+
+func (g *tsGen) fields(fs []*FieldSchema) string {
+	if len(fs) == 0 {
+		return "{}"
+	}
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, f := range fs {
+		optional := ""
+		if f.Optional {
+			optional = "?"
+		}
+		fmt.Fprintf(&b, "\t%s%s: %s;\n", tsKey(f.Name), optional, g.typ(f.Type))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func tsKey(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf("%q", name)
+}
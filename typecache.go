@@ -0,0 +1,106 @@
+package jsonhandlerfunc
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+typeCache is the process-wide cache of the metadata of the types of the handlers, shared by all the handlers
+and the generators, so the struct analyses of a type reused in many signatures are computed once.
+The cached values are shared, they must not be modified.
+*/
+type typeCache struct {
+	// schemas are the *TypeSchema of the types
+	schemas sync.Map
+	// fields are the []jsonField of the struct types
+	fields sync.Map
+
+	hits, misses int64
+}
+
+var types = &typeCache{}
+
+// jsonField is a field of a struct as it's encoded by encoding/json, the fields of embedded structs are flattened.
+type jsonField struct {
+	name    string
+	typ     reflect.Type
+	encrypt bool
+}
+
+// TypeCacheStats are the hits and misses of the process-wide type metadata cache, Schemas and Structs are the cached types.
+type TypeCacheStats struct {
+	CacheHitStats
+	Schemas int `json:"schemas"`
+	Structs int `json:"structs"`
+}
+
+// ReadTypeCacheStats returns the stats of the type metadata cache shared by all the handlers and the generators.
+func ReadTypeCacheStats() TypeCacheStats {
+	stats := TypeCacheStats{
+		CacheHitStats: *newCacheHitStats(atomic.LoadInt64(&types.hits), atomic.LoadInt64(&types.misses)),
+	}
+	types.schemas.Range(func(_, _ interface{}) bool {
+		stats.Schemas++
+		return true
+	})
+	types.fields.Range(func(_, _ interface{}) bool {
+		stats.Structs++
+		return true
+	})
+	return stats
+}
+
+func (c *typeCache) load(m *sync.Map, t reflect.Type, compute func() interface{}) interface{} {
+	if v, ok := m.Load(t); ok {
+		atomic.AddInt64(&c.hits, 1)
+		return v
+	}
+	atomic.AddInt64(&c.misses, 1)
+	v, _ := m.LoadOrStore(t, compute())
+	return v
+}
+
+// cachedTypeSchema is the typeSchema of t from the cache
+func cachedTypeSchema(t reflect.Type) *TypeSchema {
+	return types.load(&types.schemas, t, func() interface{} {
+		return typeSchema(t, map[reflect.Type]bool{})
+	}).(*TypeSchema)
+}
+
+// structFields are the fields of the struct t from the cache
+func structFields(t reflect.Type) []jsonField {
+	return types.load(&types.fields, t, func() interface{} {
+		return collectFields(t, nil)
+	}).([]jsonField)
+}
+
+// collectFields follows the field names of encoding/json, embedded structs are flattened.
+func collectFields(t reflect.Type, fields []jsonField) []jsonField {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = collectFields(ft, fields)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: sf.Type, encrypt: hasEncryptTag(sf)})
+	}
+	return fields
+}
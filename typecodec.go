@@ -0,0 +1,104 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+/*
+RegisterType registers how the params of type T are decoded and the results of type T are encoded by the handlers of cfg,
+instead of wrapping every param of a type like time.Time in a struct just to control its json:
+
+	jsonhandlerfunc.RegisterType(cfg, func(raw json.RawMessage) (t time.Time, err error) {
+		var millis int64
+		if err = json.Unmarshal(raw, &millis); err == nil {
+			return time.UnixMilli(millis), nil
+		}
+		var s string
+		if err = json.Unmarshal(raw, &s); err != nil {
+			return
+		}
+		return time.Parse("2006-01-02", s)
+	}, func(t time.Time) interface{} {
+		return t.Format("2006-01-02")
+	})
+
+It applies to the params and the results of T and *T, a null param is the zero value of T without calling decode.
+A nil decode or encode keeps encoding/json for that way. The fields of structs are still decoded by encoding/json,
+use a named type with json.Unmarshaler for them. Register the types before the handlers are created.
+*/
+func RegisterType[T any](cfg *Config, decode func(raw json.RawMessage) (T, error), encode func(v T) interface{}) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	tc := &typeCodec{}
+	if decode != nil {
+		tc.decode = func(raw json.RawMessage) (v reflect.Value, err error) {
+			val, err := decode(raw)
+			if err != nil {
+				return v, fmt.Errorf("decode %s: %s", t, err)
+			}
+			return reflect.ValueOf(&val).Elem(), nil
+		}
+	}
+	if encode != nil {
+		tc.encode = func(v reflect.Value) interface{} {
+			return encode(v.Interface().(T))
+		}
+	}
+	if cfg.typeCodecs == nil {
+		cfg.typeCodecs = map[reflect.Type]*typeCodec{}
+	}
+	cfg.typeCodecs[t] = tc
+}
+
+type typeCodec struct {
+	decode func(raw json.RawMessage) (reflect.Value, error)
+	encode func(v reflect.Value) interface{}
+}
+
+// typeDecoder returns the decode of the registered type t, nil if t is not registered or decoded by encoding/json.
+func (cfg *Config) typeDecoder(t reflect.Type) func(raw json.RawMessage) (reflect.Value, error) {
+	if tc := cfg.typeCodecs[t]; tc != nil {
+		return tc.decode
+	}
+	return nil
+}
+
+// typeParam is the value of a param of a registered type to decode to, it's unwrapped by handlerArgs.inVals.
+type typeParam struct {
+	decode func(raw json.RawMessage) (reflect.Value, error)
+	val    reflect.Value
+}
+
+func (tp *typeParam) UnmarshalJSON(b []byte) (err error) {
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		return
+	}
+	v, err := tp.decode(b)
+	if err != nil {
+		return
+	}
+	tp.val.Elem().Set(v)
+	return
+}
+
+// encodeType is the result v encoded by its registered type, v itself if its type is not registered.
+func (cfg *Config) encodeType(v reflect.Value) interface{} {
+	if len(cfg.typeCodecs) == 0 {
+		return v.Interface()
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		if tc := cfg.typeCodecs[t.Elem()]; tc != nil && tc.encode != nil {
+			if v.IsNil() {
+				return nil
+			}
+			return tc.encode(v.Elem())
+		}
+	}
+	if tc := cfg.typeCodecs[t]; tc != nil && tc.encode != nil {
+		return tc.encode(v)
+	}
+	return v.Interface()
+}
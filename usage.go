@@ -0,0 +1,84 @@
+package jsonhandlerfunc
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Usage is the accounting of one request, reported to Config.OnUsage after the response is written.
+type Usage struct {
+	// Method is the Registry method name, empty if the handler is not served by a Registry.
+	Method string
+	// RequestBytes is how many bytes of the request body are read to decode it.
+	RequestBytes int64
+	// ResponseBytes is the size of the encoded response body.
+	ResponseBytes int64
+	StatusCode    int
+	Duration      time.Duration
+}
+
+// QuotaExceededCode is the code of QuotaExceededError
+const QuotaExceededCode = "quota_exceeded"
+
+// QuotaExceededError is returned by Config.CheckQuota to respond 429, RetryAfter sets the Retry-After header if it's not 0.
+type QuotaExceededError struct {
+	Code       string        `json:"code"`
+	Quota      string        `json:"quota,omitempty"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Quota != "" {
+		return "quota exceeded: " + e.Quota
+	}
+	return "quota exceeded"
+}
+
+func (e *QuotaExceededError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return
+}
+
+// countUsage counts the request body read from now on, the returned func reports the usage to Config.OnUsage.
+func (cfg *Config) countUsage(rw *responseWriter, r *http.Request, start time.Time) (report func()) {
+	if cfg.OnUsage == nil || r.Body == nil {
+		return func() {}
+	}
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+	return func() {
+		state := RequestStateOf(r.Context())
+		cfg.OnUsage(state, &Usage{
+			Method:        state.Method,
+			RequestBytes:  body.n,
+			ResponseBytes: rw.written,
+			StatusCode:    rw.status,
+			Duration:      time.Since(start),
+		})
+	}
+}
+
+// checkQuota calls Config.CheckQuota after the injectors, so the quota can be of the injected API key or tenant.
+func (cfg *Config) checkQuota(w http.ResponseWriter, r *http.Request) error {
+	if cfg.CheckQuota == nil {
+		return nil
+	}
+	err := cfg.CheckQuota(RequestStateOf(r.Context()))
+	if qe, ok := err.(*QuotaExceededError); ok && qe.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(qe.RetryAfter.Seconds()))))
+	}
+	return err
+}
@@ -0,0 +1,297 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InvalidParamsCode is the code of ValidationError
+const InvalidParamsCode = "invalid_params"
+
+// ValidationError is responded with 422 when Config.Validator rejects the params, with an error per field.
+type ValidationError struct {
+	Code   string        `json:"code"`
+	Fields []*FieldError `json:"fields"`
+}
+
+// FieldError is an invalid field, Field is the path of it in the envelope like params[0].email.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+" "+f.Message)
+	}
+	return "invalid params: " + strings.Join(msgs, ", ")
+}
+
+func (e *ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// validate runs Config.Validator with the params after the injected ones, other errors than ValidationError are 422 unless they have a status code.
+func (h *Handler) validate(inVals []reflect.Value) error {
+	if h.cfg.Validator == nil {
+		return nil
+	}
+	var params []interface{}
+	for _, v := range inVals[injectedCount(h.argsInjectors):] {
+		params = append(params, v.Interface())
+	}
+	return h.cfg.Validator(params)
+}
+
+/*
+ValidateTags is a Config.Validator of validate struct tags, the rules are separated by commas:
+
+	type SignUp struct {
+		Email    string   `json:"email" validate:"required,email"`
+		Password string   `json:"password" validate:"min=8,max=64"`
+		Plan     string   `json:"plan" validate:"oneof=free pro"`
+		Tags     []string `json:"tags" validate:"max=5"`
+	}
+
+required is not the zero value, min and max limit numbers, or the length of strings, slices and maps,
+oneof is a space separated list of the allowed values, and email has an @ with text around it.
+Nested structs, and the elements of slices and maps are validated too. To plug in another validator library,
+set Config.Validator to a func that converts its errors to a ValidationError.
+
+The tags of the param types are parsed when the handlers are created, which panics with an unknown rule,
+or a min or max that is not a number. The ones only found at request time, like of the values of interface fields, are 500.
+*/
+func ValidateTags(params []interface{}) error {
+	tv := &tagValidator{e: &ValidationError{Code: InvalidParamsCode}, visiting: map[reflect.Type]bool{}}
+	for i, p := range params {
+		tv.value(fmt.Sprintf("params[%d]", i), reflect.ValueOf(p))
+	}
+	if tv.err != nil {
+		return NewStatusCodeError(http.StatusInternalServerError, tv.err)
+	}
+	if len(tv.e.Fields) > 0 {
+		return tv.e
+	}
+	return nil
+}
+
+// tagValidator validates a value by ValidateTags, err is of a validate tag that can't be parsed.
+type tagValidator struct {
+	e        *ValidationError
+	visiting map[reflect.Type]bool
+	err      error
+}
+
+func (tv *tagValidator) value(path string, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		if tv.visiting[t] {
+			return
+		}
+		tv.visiting[t] = true
+		defer delete(tv.visiting, t)
+		tv.fields(path, v)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			tv.value(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			tv.value(fmt.Sprintf("%s[%v]", path, iter.Key()), iter.Value())
+		}
+	}
+}
+
+// fields follows the field names of encoding/json, embedded structs are flattened.
+func (tv *tagValidator) fields(path string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			ev := fv
+			for ev.Kind() == reflect.Ptr && !ev.IsNil() {
+				ev = ev.Elem()
+			}
+			if ev.Kind() == reflect.Struct {
+				tv.fields(path, ev)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fieldPath := path + "." + name
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			rules, err := parseValidateTag(tag)
+			if err != nil {
+				tv.err = fmt.Errorf("%s of %s: %s", sf.Name, t, err)
+				return
+			}
+			for _, rule := range rules {
+				if msg := rule.check(fv); msg != "" {
+					tv.e.Fields = append(tv.e.Fields, &FieldError{Field: fieldPath, Rule: rule.rule, Message: msg})
+				}
+			}
+		}
+		tv.value(fieldPath, fv)
+	}
+}
+
+// validateRule is a parsed rule of a validate tag, rule is as it's written, like min=8.
+type validateRule struct {
+	rule    string
+	name    string
+	arg     string
+	limit   float64
+	allowed []string
+}
+
+// validateRules are the parsed rules of the validate tags
+var validateRules sync.Map
+
+// parseValidateTag parses the rules of tag once, an unknown rule or a min or max that is not a number is an error.
+func parseValidateTag(tag string) (rules []validateRule, err error) {
+	if v, ok := validateRules.Load(tag); ok {
+		return v.([]validateRule), nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		vr := validateRule{rule: rule, name: name, arg: arg}
+		switch name {
+		case "required", "email":
+		case "min", "max":
+			if vr.limit, err = strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("validate rule %q needs a number", rule)
+			}
+		case "oneof":
+			vr.allowed = strings.Fields(arg)
+		default:
+			return nil, fmt.Errorf("unknown validate rule %q", rule)
+		}
+		rules = append(rules, vr)
+	}
+	validateRules.Store(tag, rules)
+	return
+}
+
+// checkValidateTags parses the validate tags of t, and of the types of its fields and elements.
+func checkValidateTags(t reflect.Type, visiting map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			return nil
+		}
+		visiting[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.Tag.Get("json") == "-" || !sf.IsExported() && !sf.Anonymous {
+				continue
+			}
+			if tag := sf.Tag.Get("validate"); tag != "" {
+				if _, err := parseValidateTag(tag); err != nil {
+					return fmt.Errorf("%s of %s: %s", sf.Name, t, err)
+				}
+			}
+			if err := checkValidateTags(sf.Type, visiting); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return checkValidateTags(t.Elem(), visiting)
+	}
+	return nil
+}
+
+// checkValidateTags panics when the handler is created if the validate tags of the params are not of ValidateTags.
+func (cfg *Config) checkValidateTags(ft reflect.Type, firstParam int) {
+	if cfg.Validator == nil || reflect.ValueOf(cfg.Validator).Pointer() != reflect.ValueOf(ValidateTags).Pointer() {
+		return
+	}
+	visiting := map[reflect.Type]bool{}
+	for i := firstParam; i < ft.NumIn(); i++ {
+		if err := checkValidateTags(ft.In(i), visiting); err != nil {
+			panic(fmt.Sprintf("ValidateTags of %s: %s", ft, err))
+		}
+	}
+}
+
+// check returns the message if v breaks the rule, nil pointers only break required.
+func (vr validateRule) check(v reflect.Value) string {
+	if vr.name == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch vr.name {
+	case "min", "max":
+		n, unit := validateSize(v)
+		if vr.name == "min" && n < vr.limit {
+			return strings.TrimSpace("must be at least " + vr.arg + " " + unit)
+		}
+		if vr.name == "max" && n > vr.limit {
+			return strings.TrimSpace("must be at most " + vr.arg + " " + unit)
+		}
+	case "oneof":
+		if !containsString(vr.allowed, fmt.Sprint(v.Interface())) {
+			return "must be one of " + strings.Join(vr.allowed, ", ")
+		}
+	case "email":
+		s := v.String()
+		at := strings.LastIndex(s, "@")
+		if s != "" && (at <= 0 || at == len(s)-1 || strings.ContainsAny(s, " \t\r\n")) {
+			return "must be an email address"
+		}
+	}
+	return ""
+}
+
+// validateSize is the number, or the length of strings, slices and maps in the unit.
+func validateSize(v reflect.Value) (n float64, unit string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(len([]rune(v.String()))), "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "items"
+	}
+	return 0, ""
+}
@@ -0,0 +1,92 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+/*
+Variadic funcs, like func(ctx context.Context, ids ...int64), take the params after the others as the variadic slice,
+{"params": [1, 2, 3]} calls it with ids []int64{1, 2, 3}, and {"params": []} with no ids,
+the same as the flattened params of Client.Bind and Handler.Invoke. With NamedParams, the variadic param is a json array.
+*/
+
+// variadicParams decodes the params array, with the elements after the other params into the variadic slice.
+type variadicParams struct {
+	args *handlerArgs
+}
+
+func (vp *variadicParams) UnmarshalJSON(b []byte) error {
+	return vp.args.unmarshalPositional(b)
+}
+
+// variadic reports if the last param of the params array is variadic, not an envelope section.
+func (args *handlerArgs) variadic() bool {
+	return args.ft.IsVariadic() && len(args.argIndexes) > 0 && args.argIndexes[len(args.argIndexes)-1] == args.ft.NumIn()-1
+}
+
+// unmarshalPositional decodes the params array, the params are cut to the passed ones for the ParamsCountError if less are passed.
+func (args *handlerArgs) unmarshalPositional(b []byte) (err error) {
+	if !args.variadic() {
+		return json.Unmarshal(b, &args.params)
+	}
+	var raws []json.RawMessage
+	if err = json.Unmarshal(b, &raws); err != nil {
+		return
+	}
+	fixed := len(args.params) - 1
+	if len(raws) < fixed {
+		args.params = args.params[:len(raws)]
+	}
+	for i, raw := range raws {
+		if i == fixed {
+			return json.Unmarshal(joinRawArray(raws[fixed:]), args.params[fixed])
+		}
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			// like the array decoding, the zero value of notNilParams is used
+			args.params[i] = nil
+			continue
+		}
+		if err = json.Unmarshal(raw, args.params[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// joinRawArray is the json array of raws
+func joinRawArray(raws []json.RawMessage) json.RawMessage {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+	for i, raw := range raws {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(raw)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// callFunc calls v with inVals, the last of which is the variadic slice if v is variadic.
+func callFunc(v reflect.Value, inVals []reflect.Value) []reflect.Value {
+	if v.Type().IsVariadic() {
+		return v.CallSlice(inVals)
+	}
+	return v.Call(inVals)
+}
+
+// variadicParamOf converts the params of Invoke after the fixed ones to the variadic slice of type t.
+func variadicParamOf(params []interface{}, t reflect.Type) (val reflect.Value, err error) {
+	val = reflect.MakeSlice(t, len(params), len(params))
+	for i, p := range params {
+		var ev reflect.Value
+		if ev, err = convertParam(p, t.Elem(), nil); err != nil {
+			return val, fmt.Errorf("variadic param %d: %s", i, err)
+		}
+		val.Index(i).Set(ev)
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package jsonhandlerfunc
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultClientVersionHeader is the header that WithMinClientVersion reads when Config.ClientVersionHeader is empty.
+const DefaultClientVersionHeader = "X-Client-Version"
+
+// UpgradeRequiredCode is the code of UpgradeRequiredError
+const UpgradeRequiredCode = "upgrade_required"
+
+/*
+UpgradeRequiredError is responded with 426 when the client version header is missing,
+can't be parsed, or is older than the version declared by WithMinClientVersion.
+*/
+type UpgradeRequiredError struct {
+	Code          string `json:"code"`
+	ClientVersion string `json:"client_version"`
+	MinVersion    string `json:"min_version"`
+}
+
+func (e *UpgradeRequiredError) Error() string {
+	return fmt.Sprintf("client version %q is not supported, upgrade to %s or later", e.ClientVersion, e.MinVersion)
+}
+
+func (e *UpgradeRequiredError) StatusCode() int {
+	return http.StatusUpgradeRequired
+}
+
+// WithMinClientVersion rejects requests from clients older than minVersion, like "2.3.0".
+func WithMinClientVersion(minVersion string) Option {
+	if _, err := parseVersion(minVersion); err != nil {
+		panic(fmt.Sprintf("invalid min client version %q: %s", minVersion, err))
+	}
+	return func(opts *handlerOptions) {
+		if opts.minClientVersion != "" && opts.minClientVersion != minVersion {
+			opts.conflict("WithMinClientVersion is set to both %s and %s, keep one of them", opts.minClientVersion, minVersion)
+		}
+		opts.minClientVersion = minVersion
+	}
+}
+
+func (cfg *Config) checkClientVersion(r *http.Request, minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+	header := cfg.ClientVersionHeader
+	if header == "" {
+		header = DefaultClientVersionHeader
+	}
+	compare := cfg.CompareClientVersion
+	if compare == nil {
+		compare = compareVersions
+	}
+
+	clientVersion := r.Header.Get(header)
+	if clientVersion != "" {
+		if c, err := compare(clientVersion, minVersion); err == nil && c >= 0 {
+			return nil
+		}
+	}
+	return &UpgradeRequiredError{
+		Code:          UpgradeRequiredCode,
+		ClientVersion: clientVersion,
+		MinVersion:    minVersion,
+	}
+}
+
+// compareVersions compares dotted numeric versions like "v1.2.10", missing parts are 0 and pre-release suffixes are ignored.
+func compareVersions(a, b string) (c int, err error) {
+	av, err := parseVersion(a)
+	if err != nil {
+		return
+	}
+	bv, err := parseVersion(b)
+	if err != nil {
+		return
+	}
+	for len(av) < len(bv) {
+		av = append(av, 0)
+	}
+	for len(bv) < len(av) {
+		bv = append(bv, 0)
+	}
+	for i := range av {
+		if av[i] < bv[i] {
+			return -1, nil
+		}
+		if av[i] > bv[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(s string) (parts []int, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	for _, p := range strings.Split(s, ".") {
+		var n int
+		n, err = strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		parts = append(parts, n)
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WarmSpec is a registered method to call with Params by Registry.Warm
+type WarmSpec struct {
+	Method string
+	Params []interface{}
+	// Header is set to the request, like X-Api-Key for WithRequiredHeaders
+	Header http.Header
+	// Query is of the GET request of the methods of WithResponseCache, the same as the clients send to hit the cached response,
+	// like limit=10 of WithQueryParams, default is the QueryEnvelopeKey of Params.
+	Query url.Values
+}
+
+// WarmResult is the status of a WarmSpec call, Err is set if the method responded an error.
+type WarmResult struct {
+	Method     string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+/*
+Warm calls the registered methods in process without network, at startup or on schedule with WarmEvery,
+to prime caches used by the funcs and the reflection paths of the handlers. The responses are discarded,
+except that the methods of WithResponseCache are called with GET requests of WarmSpec.Query, which store their responses in the cache.
+*/
+func (reg *Registry) Warm(ctx context.Context, specs []WarmSpec) (results []WarmResult) {
+	for _, spec := range specs {
+		start := time.Now()
+		status, err := reg.warm(ctx, spec)
+		results = append(results, WarmResult{
+			Method:     spec.Method,
+			StatusCode: status,
+			Duration:   time.Since(start),
+			Err:        err,
+		})
+	}
+	return
+}
+
+// WarmEvery calls Warm with specs every interval until ctx is done, failures are logged.
+func (reg *Registry) WarmEvery(ctx context.Context, interval time.Duration, specs []WarmSpec) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, res := range reg.Warm(ctx, specs) {
+			if res.Err != nil {
+				log.Printf("jsonhandlerfunc: warm %s error: %s\n", res.Method, res.Err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (reg *Registry) warm(ctx context.Context, spec WarmSpec) (status int, err error) {
+	r, err := reg.warmRequest(spec)
+	if err != nil {
+		return
+	}
+	r = r.WithContext(ctx)
+	for k, vs := range spec.Header {
+		r.Header[k] = vs
+	}
+
+	w := &bufferResponseWriter{header: http.Header{}, status: http.StatusOK}
+	reg.ServeHTTP(w, r)
+
+	var resp struct {
+		Results []json.RawMessage `json:"results"`
+	}
+	if err = json.Unmarshal(w.body.Bytes(), &resp); err != nil {
+		return w.status, fmt.Errorf("decode response with status %d error: %s", w.status, err)
+	}
+	return w.status, decodeResults(w.status, resp.Results, nil)
+}
+
+// warmRequest is the GET request of spec if its method is of WithResponseCache, or else the POST request of its params.
+func (reg *Registry) warmRequest(spec WarmSpec) (r *http.Request, err error) {
+	if h := reg.handlers[spec.Method]; h != nil && h.opts.responseCache != nil {
+		query := spec.Query
+		if query == nil {
+			var q string
+			if q, err = EncodeQueryEnvelope(spec.Params...); err != nil {
+				return
+			}
+			query = url.Values{QueryEnvelopeKey: {q}}
+		}
+		return http.NewRequest("GET", "/"+spec.Method+"?"+query.Encode(), http.NoBody)
+	}
+
+	params := spec.Params
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(Req{Params: params})
+	if err != nil {
+		return
+	}
+	if r, err = http.NewRequest("POST", "/"+spec.Method, bytes.NewReader(body)); err != nil {
+		return
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return
+}
+
+// bufferResponseWriter keeps the response in memory, for in process calls.
+type bufferResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferResponseWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -0,0 +1,75 @@
+package jsonhandlerfunc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Warning is a non-fatal problem of a call responded in the "warnings" of the envelope, like fallback data used or partial results.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+/*
+AddWarning adds a warning to the response of the request of ctx, for the funcs to report degraded behavior
+while still returning their results, instead of abusing the error:
+
+	func listProducts(ctx context.Context) (ps []*Product, err error) {
+		ps, err = search.Products(ctx)
+		if err != nil {
+			jsonhandlerfunc.AddWarning(ctx, "search_unavailable", "the products are not ranked")
+			return db.Products(ctx)
+		}
+		return
+	}
+
+It responds {"results": [...], "warnings": [{"code": "search_unavailable", "message": "the products are not ranked"}]}.
+It does nothing if ctx is not of a request served by a handler, and the warnings after the response is written are dropped.
+*/
+func AddWarning(ctx context.Context, code, message string) {
+	ws := warningsOf(ctx)
+	if ws == nil {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.written {
+		return
+	}
+	ws.list = append(ws.list, Warning{Code: code, Message: message})
+}
+
+// WarningsOf returns the warnings added to the request of ctx so far, like for the logs of Config.OnResponse.
+func WarningsOf(ctx context.Context) []Warning {
+	return warningsOf(ctx).take(false)
+}
+
+type warningsKey struct{}
+
+type warnings struct {
+	mu      sync.Mutex
+	list    []Warning
+	written bool
+}
+
+func withWarnings(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), warningsKey{}, &warnings{}))
+}
+
+func warningsOf(ctx context.Context) *warnings {
+	ws, _ := ctx.Value(warningsKey{}).(*warnings)
+	return ws
+}
+
+// take returns a copy of the warnings, written stops adding more when the response is written.
+func (ws *warnings) take(written bool) []Warning {
+	if ws == nil {
+		return nil
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.written = ws.written || written
+	return append([]Warning(nil), ws.list...)
+}
@@ -0,0 +1,376 @@
+package jsonhandlerfunc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxWebsocketMessage is the max bytes of a websocket message when Config.MaxRequestBodyBytes is not set
+const DefaultMaxWebsocketMessage = 4 << 20
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocket opcodes and close codes of RFC 6455
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseTooBig      = 1009
+	wsCloseInternal    = 1011
+
+	// wsMaxControlPayload is the max payload of the control frames
+	wsMaxControlPayload = 125
+)
+
+/*
+ToWebsocketHandler serves the registered funcs over websocket connections, for realtime clients like dashboards
+that call many funcs on one connection. Every text message is the request envelope with the method and an id,
+and the response of the call is sent back with the same id, and the http status code:
+
+	-> {"id": 7, "method": "Orders.Summary", "params": ["today"]}
+	<- {"id": 7, "status": 200, "results": [{"count": 42}, null], "meta": {...}}
+
+The progress of ReportProgress is sent before the response with the same id, like {"id": 7, "progress": {"percent": 50}}.
+
+The messages are called in order one by one, like the requests of the handshake request's headers and path,
+through the middleware, injectors and options of the registry, an array of envelopes is a batch of Config.AllowBatch.
+The call is canceled when the connection is closed, and the responses that are not json, like streams, are responded with 406.
+
+checkOrigin reports if the handshake request is allowed, default allows the requests without Origin or of the same host,
+so other sites can't call the funcs with the cookies of the browser.
+*/
+func (reg *Registry) ToWebsocketHandler(checkOrigin func(r *http.Request) bool) http.Handler {
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebsocketHandshake(r) {
+			reg.Config.returnError(nil, w, NewStatusCodeError(http.StatusBadRequest, errors.New("not a websocket handshake")), http.StatusBadRequest)
+			return
+		}
+		if !checkOrigin(r) {
+			reg.Config.returnError(nil, w, NewStatusCodeError(http.StatusForbidden, fmt.Errorf("origin %s is not allowed", r.Header.Get("Origin"))), http.StatusForbidden)
+			return
+		}
+		netConn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			reg.Config.returnError(nil, w, err, http.StatusInternalServerError)
+			return
+		}
+		defer netConn.Close()
+
+		h := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+		fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(h[:]))
+		if err = brw.Flush(); err != nil {
+			return
+		}
+
+		maxMessage := int64(DefaultMaxWebsocketMessage)
+		if reg.Config.MaxRequestBodyBytes > 0 {
+			maxMessage = reg.Config.MaxRequestBodyBytes
+		}
+		conn := &wsConn{conn: netConn, r: brw.Reader, w: brw.Writer, maxMessage: maxMessage}
+		reg.serveWebsocket(conn, r)
+	})
+}
+
+// serveWebsocket calls the messages one by one, while reading the next ones to answer the pings and the close.
+func (reg *Registry) serveWebsocket(conn *wsConn, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	messages := make(chan []byte)
+	go func() {
+		defer cancel()
+		defer close(messages)
+		// a panic of the reader closes the connection instead of crashing the server
+		defer func() {
+			if p := recover(); p != nil {
+				conn.close(wsCloseInternal)
+			}
+		}()
+		for {
+			msg, err := conn.readMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for msg := range messages {
+		if err := conn.writeMessage(reg.callWebsocketMessage(ctx, conn, r, msg)); err != nil {
+			return
+		}
+	}
+}
+
+/*
+callWebsocketMessage serves msg like a request of the handshake request, and returns its response with the id of msg.
+The progress the func reports with ReportProgress is sent before the response with the same id, like {"id": 7, "progress": {"percent": 50}}.
+*/
+func (reg *Registry) callWebsocketMessage(ctx context.Context, conn *wsConn, handshake *http.Request, msg []byte) []byte {
+	var env struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	json.Unmarshal(msg, &env)
+	id := env.ID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	var mu sync.Mutex
+	var responded bool
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		responded = true
+	}()
+	ctx = WithProgressListener(ctx, func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if responded {
+			return
+		}
+		data, _ := json.Marshal(p)
+		conn.writeMessage([]byte(fmt.Sprintf(`{"id":%s,"progress":%s}`, id, data)))
+	})
+
+	r := handshake.Clone(ctx)
+	r.Method = http.MethodPost
+	r.URL = &url.URL{Path: strings.TrimSuffix(handshake.URL.Path, "/") + "/" + env.Method, RawQuery: handshake.URL.RawQuery}
+	for _, name := range []string{"Upgrade", "Connection", "Accept-Encoding", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol"} {
+		r.Header.Del(name)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Body = io.NopCloser(bytes.NewReader(msg))
+	r.ContentLength = int64(len(msg))
+
+	rec := &responseRecorder{header: http.Header{}, code: http.StatusOK}
+	reg.ServeHTTP(rec, r)
+
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if !strings.HasPrefix(rec.header.Get("Content-Type"), "application/json") || len(body) == 0 {
+		return []byte(fmt.Sprintf(`{"id":%s,"status":%d,"results":[{"error":"the response of %s can not be sent over websocket","value":{}}]}`,
+			id, http.StatusNotAcceptable, strings.ReplaceAll(rec.header.Get("Content-Type"), `"`, "")))
+	}
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, `{"id":%s,"status":%d,`, id, rec.code)
+	if body[0] == '{' {
+		out.Write(body[1:])
+	} else {
+		fmt.Fprintf(out, `"batch":%s}`, body)
+	}
+	return out.Bytes()
+}
+
+func isWebsocketHandshake(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerHasToken(r.Header, "Connection", "upgrade") &&
+		headerHasToken(r.Header, "Upgrade", "websocket") &&
+		r.Header.Get("Sec-WebSocket-Version") == "13" &&
+		r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// responseRecorder records a response served in process, like of a websocket message or a ContractCase
+type responseRecorder struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.code = code
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// wsConn reads and writes the frames of a websocket connection of the server side.
+type wsConn struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	maxMessage int64
+
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+var errWebsocketClosed = errors.New("websocket closed")
+
+/*
+readMessage reads the next text message, joining the fragments, it answers the pings and the close,
+and closes with an error code for binary messages, unmasked frames and the messages larger than maxMessage.
+*/
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame(int64(len(msg)))
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.close(wsCloseNormal)
+			return nil, errWebsocketClosed
+		case wsBinary:
+			c.close(wsCloseUnsupported)
+			return nil, errWebsocketClosed
+		case wsText, wsContinuation:
+			if (opcode == wsText) != (msg == nil) {
+				c.close(wsCloseProtocol)
+				return nil, errWebsocketClosed
+			}
+			msg = append(msg, payload...)
+			if msg == nil {
+				msg = []byte{}
+			}
+			if fin {
+				return msg, nil
+			}
+		default:
+			c.close(wsCloseProtocol)
+			return nil, errWebsocketClosed
+		}
+	}
+}
+
+// readFrame reads a frame, read is the bytes of the message before it for the max message size.
+func (c *wsConn) readFrame(read int64) (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0F
+	masked := head[1]&0x80 != 0
+	n := int64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+	if !masked {
+		c.close(wsCloseProtocol)
+		return false, 0, nil, errWebsocketClosed
+	}
+	if opcode&0x8 != 0 && (n > wsMaxControlPayload || !fin) {
+		c.close(wsCloseProtocol)
+		return false, 0, nil, errWebsocketClosed
+	}
+	// compared without adding to read, a length near 2^63 would overflow
+	if n < 0 || n > c.maxMessage-read {
+		c.close(wsCloseTooBig)
+		return false, 0, nil, errWebsocketClosed
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+func (c *wsConn) writeMessage(msg []byte) error {
+	return c.writeFrame(wsText, msg)
+}
+
+// writeFrame writes an unmasked final frame, it's safe to be called by the reader and the caller.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	head := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xFFFF:
+		head = append(head, 126, 0, 0)
+		binary.BigEndian.PutUint16(head[2:], uint16(n))
+	default:
+		head = append(head, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(n))
+	}
+	c.w.Write(head)
+	c.w.Write(payload)
+	return c.w.Flush()
+}
+
+func (c *wsConn) close(code int) {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	c.writeFrame(wsClose, payload)
+}
@@ -0,0 +1,141 @@
+package jsonhandlerfunc
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"sync"
+)
+
+/*
+responseWriter tracks whether the header and body were already written,
+so that injectors, the error path and the normal encode path can not write the response twice.
+*/
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	written     int64
+	compact     bool
+	indent      string
+	// noEscapeHTML and floatFormat are of Config.DisableHTMLEscape and Config.FloatFormat
+	noEscapeHTML bool
+	floatFormat  FloatFormat
+	// compression is Config.Compression, and encoder is the coding negotiated for the request, nil if none is accepted
+	compression *Compression
+	encoder     *ContentEncoder
+	jsonrpc     *jsonrpcRequest
+	reqCodec    Codec
+	codec       Codec
+	shape       *ResponseShape
+	// opState is the state of the request for Config.DebugOps
+	opState *RequestState
+	// resultNames are of WithResultNames, nil for the requests of PositionalResultsHeader
+	resultNames []resultName
+	// timing is of WithTimingMeta
+	timing *timingMeta
+	// bag is the Bag of the request for Config.SurfaceBagKeys
+	bag *Bag
+	// funcHeader is the ResponseHeader that the func set, applied before the header is written
+	funcHeader *ResponseHeader
+	// warnings are of AddWarning, responded in the envelope
+	warnings *warnings
+	// capture is a copy of the written body for WithTee
+	capture *bytes.Buffer
+	meta    map[string]interface{}
+}
+
+// encodeBuffers pools the buffers the responses are encoded to before they are written
+var encodeBuffers = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+// maxPooledBuffer is the max capacity of a buffer put back to encodeBuffers, so a large response doesn't stay in the pool.
+const maxPooledBuffer = 64 << 10
+
+func getEncodeBuffer() *bytes.Buffer {
+	return encodeBuffers.Get().(*bytes.Buffer)
+}
+
+func putEncodeBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	encodeBuffers.Put(buf)
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+// newResponseWriter wraps w with the response settings of cfg for the request
+func (cfg *Config) newResponseWriter(w http.ResponseWriter, r *http.Request) *responseWriter {
+	rw := newResponseWriter(w)
+	rw.jsonrpc = cfg.readJSONRPC(r)
+	rw.compact = cfg.wantsCompact(r) && rw.jsonrpc == nil
+	rw.indent = cfg.Indent
+	rw.noEscapeHTML = cfg.DisableHTMLEscape
+	rw.floatFormat = cfg.FloatFormat
+	rw.compression = cfg.Compression
+	rw.encoder = cfg.Compression.negotiate(r.Header.Get("Accept-Encoding"))
+	if rw.jsonrpc == nil {
+		rw.reqCodec, rw.codec = cfg.negotiateCodecs(r)
+	}
+	rw.shape = cfg.ResponseShape
+	return rw
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		log.Printf("jsonhandlerfunc: suppressed WriteHeader(%d), header already written with %d\n", code, rw.status)
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = code
+	rw.funcHeader.apply(rw.ResponseWriter)
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (n int, err error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err = rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	if rw.capture != nil {
+		rw.capture.Write(b[:n])
+	}
+	return
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) setMeta(key string, val interface{}) {
+	if rw.meta == nil {
+		rw.meta = map[string]interface{}{}
+	}
+	rw.meta[key] = val
+}
+
+// Unwrap is for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// alreadyWritten reports if the response was written by someone else, and logs a diagnostic when it was.
+func alreadyWritten(w http.ResponseWriter, httpCode int) bool {
+	rw, ok := w.(*responseWriter)
+	if !ok || !rw.wroteHeader {
+		return false
+	}
+	log.Printf("jsonhandlerfunc: response already written with %d (%d bytes), suppressed writing %d response\n", rw.status, rw.written, httpCode)
+	return true
+}